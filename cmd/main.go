@@ -30,6 +30,8 @@ func main() {
 	log.Printf("Received signal: %v", sig)
 
 	err = app.Stop()
-	log.Printf("HTTP server shutdown error: %v", err)
+	if err != nil {
+		log.Printf("Shutdown error: %v", err)
+	}
 
 }
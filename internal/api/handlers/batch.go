@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/SemenShakhray/list-of-song/internal/models"
+	"github.com/SemenShakhray/list-of-song/internal/service"
+
+	"go.uber.org/zap"
+)
+
+// maxBatchSize limits the number of operations in one batch request.
+const maxBatchSize = 1000
+
+type batchResponse struct {
+	Error   string               `json:"error,omitempty"`
+	Results []models.BatchResult `json:"results"`
+}
+
+// Batch applies several create, update and delete operations at once
+//
+//	@Summary		Batch operations
+//	@Description	Apply a list of create, update and delete operations. By default the batch runs in one transaction and is rolled back on the first failure. With best_effort every operation is applied independently. Songs created in a batch are not enriched from the external API
+//	@Tags			Songs
+//	@Accept			json
+//	@Produce		json
+//	@Param			batch	body		models.BatchRequest	true	"Operations"
+//	@Success		200		{object}	batchResponse		"Per-operation results"
+//	@Failure		400		{object}	map[string]string	"Invalid request"
+//	@Failure		422		{object}	batchResponse		"Atomic batch rolled back"
+//	@Failure		500		{object}	map[string]string	"Internal server error"
+//	@Router			/songs/batch [post]
+func (h *Handler) Batch(w http.ResponseWriter, r *http.Request) {
+	log := h.logger(r.Context())
+	log.Debug("Incoming request to Batch endpoint")
+
+	var req models.BatchRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		log.Error("Failed to decode request body", zap.Error(err))
+		http.Error(w, `{"error":"failed to decode request"}`, http.StatusBadRequest)
+		return
+	}
+	if len(req.Operations) == 0 {
+		http.Error(w, `{"error":"no operations in batch"}`, http.StatusBadRequest)
+		return
+	}
+	if len(req.Operations) > maxBatchSize {
+		http.Error(w, fmt.Sprintf(`{"error":"too many operations: maximum is %d"}`, maxBatchSize), http.StatusBadRequest)
+		return
+	}
+	log.Debug("Batch decoded", zap.Int("operations", len(req.Operations)), zap.Bool("best_effort", req.BestEffort))
+
+	status := http.StatusOK
+	var res batchResponse
+	res.Results, err = h.Service.Batch(r.Context(), req.Operations, !req.BestEffort)
+	if err != nil {
+		log.Error("service Batch", zap.Error(err))
+		if !errors.Is(err, service.ErrBatchAborted) {
+			http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusInternalServerError)
+			return
+		}
+		status = http.StatusUnprocessableEntity
+		res.Error = err.Error()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err = json.NewEncoder(w).Encode(res)
+	if err != nil {
+		log.Error("Failed to encode response", zap.Error(err))
+		return
+	}
+
+	log.Debug("Response sent successfully")
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/SemenShakhray/list-of-song/pkg/textdiff"
+
+	"go.uber.org/zap"
+)
+
+// diffContext is the number of unchanged lines around changes in a unified diff.
+const diffContext = 3
+
+// DiffLyrics returns the difference between two versions of the song text
+//
+//	@Summary		Diff song text
+//	@Description	Compare the song text after revision from with the text after revision to, line by line and word by word. Without to the latest revision is used, without from the revision before to, so by default the last change is shown
+//	@Tags			History
+//	@Produce		json
+//	@Produce		text/x-diff
+//	@Param			id		path		int					true	"Song ID"
+//	@Param			from	query		integer				false	"Old revision"
+//	@Param			to		query		integer				false	"New revision"
+//	@Param			format	query		string				false	"Diff format: json or unified (default json)"
+//	@Success		200		{object}	models.LyricsDiff	"Difference between the texts"
+//	@Failure		400		{object}	map[string]string	"Invalid input"
+//	@Failure		422		{object}	map[string]string	"Texts are too large to compare"
+//	@Failure		500		{object}	map[string]string	"Internal server error"
+//	@Router			/songs/{id}/diff [get]
+func (h *Handler) DiffLyrics(w http.ResponseWriter, r *http.Request) {
+	log := h.logger(r.Context())
+	log.Debug("Incoming request to DiffLyrics endpoint")
+
+	id, err := ValidID(r)
+	if err != nil {
+		log.Error("Converion id", zap.Error(fmt.Errorf("failed conversion id into int: %w", err)))
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	from, err := revisionParam(r, "from")
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+	to, err := revisionParam(r, "to")
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	format := r.FormValue("format")
+	if format != "" && format != "json" && format != "unified" {
+		http.Error(w, `{"error":"unknown diff format"}`, http.StatusBadRequest)
+		return
+	}
+
+	diff, err := h.Service.DiffLyrics(r.Context(), id, from, to)
+	if err != nil {
+		log.Error("service DiffLyrics", zap.Error(err))
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), diffStatus(err))
+		return
+	}
+
+	if format == "unified" {
+		unified, err := textdiff.Unified(diff.OldText, diff.NewText,
+			fmt.Sprintf("song/%d/revision/%d", id, diff.From),
+			fmt.Sprintf("song/%d/revision/%d", id, diff.To),
+			diffContext)
+		if err != nil {
+			log.Error("Unified diff", zap.Error(err))
+			http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), diffStatus(err))
+			return
+		}
+		w.Header().Set("Content-Type", "text/x-diff; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		if _, err := io.WriteString(w, unified); err != nil {
+			log.Error("Failed to write response", zap.Error(err))
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(diff)
+	if err != nil {
+		log.Error("Failed to encode response", zap.Error(err))
+		return
+	}
+
+	log.Debug("Response sent successfully")
+}
+
+// diffStatus maps an error of a diff to the HTTP status code.
+func diffStatus(err error) int {
+	if errors.Is(err, textdiff.ErrTooLarge) {
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusInternalServerError
+}
+
+func revisionParam(r *http.Request, name string) (int, error) {
+	val := r.FormValue(name)
+	if val == "" {
+		return 0, nil
+	}
+	rev, err := strconv.Atoi(val)
+	if err != nil {
+		return 0, fmt.Errorf("failed conversion %s into int: %w", name, err)
+	}
+	if rev < 0 {
+		return 0, fmt.Errorf("invalid %s: negative", name)
+	}
+	return rev, nil
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SemenShakhray/list-of-song/internal/models"
+
+	"go.uber.org/zap"
+)
+
+// StreamEvents streams song changes as server-sent events
+//
+//	@Summary		Stream song events
+//	@Description	Stream song.created, song.updated and song.deleted events as server-sent events, optionally only of the given groups. Every event carries its ID, a client reconnecting with the Last-Event-ID header gets the events it missed while they are still in the event log
+//	@Tags			Songs
+//	@Produce		text/event-stream
+//	@Param			group			query		[]string			false	"Only events of songs of these groups, may be repeated"	collectionFormat(multi)
+//	@Param			Last-Event-ID	header		integer				false	"ID of the last event received, the stream resumes after it"
+//	@Param			last_event_id	query		integer				false	"Same as the Last-Event-ID header, for clients that cannot set headers"
+//	@Success		200				{string}	string				"Stream of id, event and data lines, the data is the event as JSON"
+//	@Failure		400				{object}	map[string]string	"Invalid event ID"
+//	@Router			/songs/events [get]
+func (h *Handler) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	log := h.logger(r.Context())
+	log.Debug("Incoming request to StreamEvents endpoint")
+
+	var groups []string
+	for _, group := range r.URL.Query()["group"] {
+		if group = strings.TrimSpace(group); group != "" {
+			groups = append(groups, group)
+		}
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+	var lastID int64
+	if lastEventID != "" {
+		id, err := strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil || id < 0 {
+			log.Error("Invalid last event ID", zap.String("last_event_id", lastEventID))
+			http.Error(w, `{"error":"invalid last event ID"}`, http.StatusBadRequest)
+			return
+		}
+		lastID = id
+	}
+
+	rc := http.NewResponseController(w)
+	// The stream stays open far longer than the server write timeout.
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		log.Debug("Write deadline can not be reset", zap.Error(err))
+	}
+
+	sub, missed := h.Hub.Subscribe(groups, lastID, lastEventID != "")
+	defer h.Hub.Unsubscribe(sub)
+	log.Debug("Event stream subscribed", zap.Strings("groups", groups), zap.String("last_event_id", lastEventID),
+		zap.Int("missed", len(missed)))
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// Keeps nginx from buffering the stream.
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	for _, event := range missed {
+		if err := writeEvent(w, event); err != nil {
+			log.Debug("Event stream closed", zap.Error(err))
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		log.Debug("Event stream closed", zap.Error(err))
+		return
+	}
+
+	heartbeat := time.NewTicker(h.Heartbeat)
+	defer heartbeat.Stop()
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			log.Debug("Event stream closed by client")
+			return
+		case event, ok := <-sub.Events:
+			if !ok {
+				// Fell behind or shutting down, the client reconnects and
+				// resumes from the log.
+				log.Debug("Event stream ended by server")
+				return
+			}
+			err = writeEvent(w, event)
+		case <-heartbeat.C:
+			_, err = io.WriteString(w, ": heartbeat\n\n")
+		}
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			log.Debug("Event stream closed", zap.Error(err))
+			return
+		}
+	}
+}
+
+// writeEvent writes an event in the text/event-stream format, the event type
+// is the SSE event name and the whole event the data.
+func writeEvent(w io.Writer, event models.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Id, event.Type, data)
+	return err
+}
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/SemenShakhray/list-of-song/internal/models"
+
+	"go.uber.org/zap"
+)
+
+// exportFlushEvery is the number of rows written between flushes of the response.
+const exportFlushEvery = 100
+
+// songEncoder writes songs of one export format to the response.
+type songEncoder interface {
+	Begin() error
+	Encode(song models.Song) error
+	End() error
+}
+
+// Export streams the song library
+//
+//	@Summary		Export songs
+//	@Description	Stream all songs matching the filters as CSV, NDJSON or a JSON array. Without limit every matching song is exported
+//	@Tags			Songs
+//	@Produce		json
+//	@Produce		text/csv
+//	@Param			format	query		string		false	"Export format: csv, ndjson or json (default json)"
+//	@Param			song	query		string		false	"Filter by song name (partial match)"
+//	@Param			group	query		string		false	"Filter by group name (partial match)"
+//	@Param			text	query		string		false	"Filter by lyrics (partial match)"
+//	@Param			link	query		string		false	"Filter by link (partial match)"
+//	@Param			date	query		string		false	"Filter by release date"
+//	@Param			limit	query		integer		false	"Limit the number of results"
+//	@Param			offset	query		integer		false	"Offset for pagination"
+//	@Success		200		{array}		models.Song	"Exported songs"
+//	@Failure		400		{object}	map[string]string	"Invalid filters or format"
+//	@Failure		500		{object}	map[string]string	"Internal server error"
+//	@Router			/songs/export [get]
+func (h *Handler) Export(w http.ResponseWriter, r *http.Request) {
+	log := h.logger(r.Context())
+	log.Debug("Incoming request to Export endpoint")
+
+	filters, err := ValidFiltres(r)
+	if err != nil {
+		log.Error("Failed to validate filters", zap.Error(err))
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+	if r.FormValue("limit") == "" {
+		filters.Limit = 0
+	}
+
+	format := r.FormValue("format")
+	if format == "" {
+		format = "json"
+	}
+	enc, contentType, err := newSongEncoder(format, w)
+	if err != nil {
+		log.Error("Invalid export format", zap.Error(err))
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+	log.Debug("Export parameters validated", zap.String("format", format), zap.Any("filters", filters))
+
+	rc := http.NewResponseController(w)
+	// The server write timeout is sized for regular requests, a full export may take longer.
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		log.Debug("Write deadline can not be reset", zap.Error(err))
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="songs.%s"`, format))
+	w.WriteHeader(http.StatusOK)
+
+	if err := enc.Begin(); err != nil {
+		log.Error("Failed to write export", zap.Error(err))
+		return
+	}
+
+	total := 0
+	err = h.Service.Export(r.Context(), filters, func(song models.Song) error {
+		if err := enc.Encode(song); err != nil {
+			return fmt.Errorf("failed to encode song: %w", err)
+		}
+		total++
+		if total%exportFlushEvery == 0 {
+			return rc.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		// The status line is already sent, so the client only sees a truncated body.
+		log.Error("service Export", zap.Error(err), zap.Int("written", total))
+		return
+	}
+
+	if err := enc.End(); err != nil {
+		log.Error("Failed to write export", zap.Error(err))
+		return
+	}
+	if err := rc.Flush(); err != nil {
+		log.Error("Failed to flush export", zap.Error(err))
+		return
+	}
+
+	log.Debug("Export sent successfully", zap.Int("total", total))
+}
+
+func newSongEncoder(format string, w io.Writer) (songEncoder, string, error) {
+	switch format {
+	case "csv":
+		return &csvEncoder{w: csv.NewWriter(w)}, "text/csv; charset=utf-8", nil
+	case "ndjson":
+		return &ndjsonEncoder{enc: json.NewEncoder(w)}, "application/x-ndjson", nil
+	case "json":
+		return &jsonEncoder{w: w}, "application/json", nil
+	}
+	return nil, "", fmt.Errorf("unknown export format")
+}
+
+type csvEncoder struct {
+	w *csv.Writer
+}
+
+func (e *csvEncoder) Begin() error {
+	return e.w.Write([]string{"id", "song", "group", "text", "link", "date"})
+}
+
+func (e *csvEncoder) Encode(song models.Song) error {
+	err := e.w.Write([]string{strconv.Itoa(song.Id), song.Song, song.Group, song.Text, song.Link, song.Date})
+	if err != nil {
+		return err
+	}
+	// csv.Writer buffers internally, push the row to the response so flushes reach the client.
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func (e *csvEncoder) End() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type ndjsonEncoder struct {
+	enc *json.Encoder
+}
+
+func (e *ndjsonEncoder) Begin() error { return nil }
+
+func (e *ndjsonEncoder) Encode(song models.Song) error { return e.enc.Encode(song) }
+
+func (e *ndjsonEncoder) End() error { return nil }
+
+// jsonEncoder writes a single JSON array without holding it in memory.
+type jsonEncoder struct {
+	w     io.Writer
+	count int
+}
+
+func (e *jsonEncoder) Begin() error {
+	_, err := io.WriteString(e.w, "[")
+	return err
+}
+
+func (e *jsonEncoder) Encode(song models.Song) error {
+	b, err := json.Marshal(song)
+	if err != nil {
+		return err
+	}
+	if e.count > 0 {
+		if _, err := io.WriteString(e.w, ","); err != nil {
+			return err
+		}
+	}
+	e.count++
+	_, err = e.w.Write(b)
+	return err
+}
+
+func (e *jsonEncoder) End() error {
+	_, err := io.WriteString(e.w, "]\n")
+	return err
+}
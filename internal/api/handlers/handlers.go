@@ -1,17 +1,22 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"net"
 	"net/http"
-	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
-	"github.com/SemenShakhray/list-of-song/internal/config"
+	"github.com/SemenShakhray/list-of-song/internal/auth"
+	"github.com/SemenShakhray/list-of-song/internal/enrichment"
+	"github.com/SemenShakhray/list-of-song/internal/health"
 	"github.com/SemenShakhray/list-of-song/internal/models"
 	"github.com/SemenShakhray/list-of-song/internal/service"
+	"github.com/SemenShakhray/list-of-song/internal/storage"
+	"github.com/SemenShakhray/list-of-song/pkg/logger"
 
 	"go.uber.org/zap"
 )
@@ -19,16 +24,40 @@ import (
 type Handler struct {
 	Log     *zap.Logger
 	Service service.Servicer
-	Cfg     config.Config
+	Keys    service.KeyServicer
+	// Webhooks manages the webhook subscriptions, /webhooks is not served
+	// when it is nil.
+	Webhooks service.WebhookServicer
+	// Hub streams the song events, /songs/events is not served when it is
+	// nil.
+	Hub *service.Hub
+	// Heartbeat is how often an idle event stream gets a comment.
+	Heartbeat time.Duration
+	// Enricher fetches song details from the external API while it is enabled.
+	Enricher *enrichment.Client
+	// Policy is the role policy routes are checked against, nil when
+	// authentication is disabled.
+	Policy auth.Policy
+	// Levels changes the log levels at runtime.
+	Levels *logger.Levels
+	// Health runs the readiness checks, /readyz is not served when it is nil.
+	Health *health.Checker
 }
 
-func NewHandler(log *zap.Logger, serv service.Servicer) Handler {
+func NewHandler(log *zap.Logger, serv service.Servicer, keys service.KeyServicer) Handler {
 	return Handler{
 		Log:     log,
 		Service: serv,
+		Keys:    keys,
 	}
 }
 
+// logger returns the handler logger with the fields of the request, every
+// line it writes carries the request ID.
+func (h *Handler) logger(ctx context.Context) *zap.Logger {
+	return logger.FromContext(ctx, h.Log)
+}
+
 // AddSong adds a new song to the database
 //
 //	@Summary		Add a new song
@@ -42,45 +71,36 @@ func NewHandler(log *zap.Logger, serv service.Servicer) Handler {
 //	@Failure		500		{object}	map[string]string	"Failed add song"
 //	@Router			/songs [post]
 func (h *Handler) AddSong(w http.ResponseWriter, r *http.Request) {
-	h.Log.Debug("Incoming request to AddSong endpoint")
+	log := h.logger(r.Context())
+	log.Debug("Incoming request to AddSong endpoint")
 
 	var song models.Song
 	err := json.NewDecoder(r.Body).Decode(&song)
 	if err != nil {
-		h.Log.Error("Failed to decode request body", zap.Error(err))
+		log.Error("Failed to decode request body", zap.Error(err))
 		http.Error(w, `{"error":"failed to decode request"}`, http.StatusBadRequest)
 		return
 	}
-	h.Log.Debug("Song data", zap.String("song", song.Song), zap.String("group", song.Group))
-
-	h.Log.Debug("calling an external API")
-	if h.Cfg.API.Call {
-		hostPort := net.JoinHostPort(h.Cfg.API.Host, h.Cfg.API.Port)
-		apiURL := fmt.Sprintf("http://%s/info?group=%s&song=%s", hostPort, url.QueryEscape(song.Group), url.QueryEscape(song.Song))
+	log.Debug("Song data", zap.String("song", song.Song), zap.String("group", song.Group))
 
-		resp, err := http.Get(apiURL)
-		if err != nil || resp.StatusCode != http.StatusOK {
-			h.Log.Error("Failed to fetch song details from external API", zap.Error(err))
+	log.Debug("calling an external API")
+	if h.Enricher != nil && h.Enricher.Enabled() {
+		err := h.Enricher.Enrich(r.Context(), &song)
+		if err != nil {
+			log.Error("Failed to fetch song details from external API", zap.Error(err))
 			http.Error(w, `{"error":"failed to fetch song details from external API"}`, http.StatusInternalServerError)
 			return
 		}
-		defer resp.Body.Close()
-
-		if err := json.NewDecoder(resp.Body).Decode(&song); err != nil {
-			h.Log.Error("Failed to decode API response", zap.Error(err))
-			http.Error(w, `{"error":"failed to decode API response"}`, http.StatusInternalServerError)
-			return
-		}
 	}
 
 	err = h.Service.AddSong(r.Context(), song)
 	if err != nil {
-		h.Log.Error("service AddSong", zap.Error(err))
+		log.Error("service AddSong", zap.Error(err))
 		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusInternalServerError)
 		return
 	}
 
-	h.Log.Debug("Song added successfully", zap.Any("song", song))
+	log.Debug("Song added successfully", zap.Any("song", song))
 
 	res := map[string]string{"message": "song added successfully"}
 	w.WriteHeader(http.StatusOK)
@@ -88,7 +108,7 @@ func (h *Handler) AddSong(w http.ResponseWriter, r *http.Request) {
 
 	err = json.NewEncoder(w).Encode(res)
 	if err != nil {
-		h.Log.Error("Failed to encode response", zap.Error(err))
+		log.Error("Failed to encode response", zap.Error(err))
 		http.Error(w, `{"error":"failed to encode response"}`, http.StatusInternalServerError)
 	}
 }
@@ -112,19 +132,20 @@ func (h *Handler) AddSong(w http.ResponseWriter, r *http.Request) {
 //	@Failure		500				{object}	map[string]string	"Internal server error"
 //	@Router			/songs [get]
 func (h *Handler) GetAll(w http.ResponseWriter, r *http.Request) {
-	h.Log.Debug("Incoming request to GetAll endpoint")
+	log := h.logger(r.Context())
+	log.Debug("Incoming request to GetAll endpoint")
 
 	filtres, err := ValidFiltres(r)
 	if err != nil {
-		h.Log.Error("Failed to validate filters", zap.Error(err))
+		log.Error("Failed to validate filters", zap.Error(err))
 		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusBadRequest)
 		return
 	}
-	h.Log.Debug("Filters validated successfully", zap.Any("filters", filtres))
+	log.Debug("Filters validated successfully", zap.Any("filters", filtres))
 
 	songs, err := h.Service.GetAll(r.Context(), filtres)
 	if err != nil {
-		h.Log.Error("service GetAll", zap.Error(err))
+		log.Error("service GetAll", zap.Error(err))
 		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusInternalServerError)
 		return
 	}
@@ -133,12 +154,12 @@ func (h *Handler) GetAll(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	err = json.NewEncoder(w).Encode(songs)
 	if err != nil {
-		h.Log.Error("Failed to encode response", zap.Error(err))
+		log.Error("Failed to encode response", zap.Error(err))
 		http.Error(w, `{"error":"failed to encode response"}`, http.StatusInternalServerError)
 		return
 	}
 
-	h.Log.Debug("Response sent successfully")
+	log.Debug("Response sent successfully")
 }
 
 func ValidFiltres(r *http.Request) (models.Filters, error) {
@@ -185,9 +206,10 @@ func ValidFiltres(r *http.Request) (models.Filters, error) {
 func ValidID(r *http.Request) (int, error) {
 	path := r.URL.Path
 	paramPath := strings.Split(path, "/")
-	val := paramPath[2]
-	valByte := []byte(val)
-	id, err := strconv.Atoi(string(valByte[0]))
+	if len(paramPath) < 3 {
+		return 0, fmt.Errorf("missing id in path")
+	}
+	id, err := strconv.Atoi(paramPath[2])
 	if err != nil {
 		return 0, fmt.Errorf("failed conversion id into int: %w", err)
 
@@ -195,6 +217,14 @@ func ValidID(r *http.Request) (int, error) {
 	return id, nil
 }
 
+// songStatus returns the status of an error from a song change.
+func songStatus(err error) int {
+	if errors.Is(err, storage.ErrSongExists) {
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
 // Update updates an existing song
 //
 //	@Summary		Update a song
@@ -206,33 +236,35 @@ func ValidID(r *http.Request) (int, error) {
 //	@Param			song	body		models.Song			true	"Updated song details"
 //	@Success		200		{object}	map[string]string	"Song updated successfully"
 //	@Failure		400		{object}	map[string]string	"Invalid request body or ID"
+//	@Failure		409		{object}	map[string]string	"Another song has this title and group"
 //	@Failure		500		{object}	map[string]string	"Internal server error"
 //	@Router			/songs/{id} [put]
 func (h *Handler) Update(w http.ResponseWriter, r *http.Request) {
-	h.Log.Debug("Incoming request to Update endpoint")
+	log := h.logger(r.Context())
+	log.Debug("Incoming request to Update endpoint")
 
 	var song models.Song
 
 	err := json.NewDecoder(r.Body).Decode(&song)
 	if err != nil {
-		h.Log.Error("Failed to decode request body", zap.Error(err))
+		log.Error("Failed to decode request body", zap.Error(err))
 		http.Error(w, `{"error":"failed to decode request"}`, http.StatusBadRequest)
 		return
 	}
 	// val := chi.URLParam(r, "id")
 	id, err := ValidID(r)
 	if err != nil {
-		h.Log.Error("Converion id", zap.Error(fmt.Errorf("failed conversion id into int: %w", err)))
+		log.Error("Converion id", zap.Error(fmt.Errorf("failed conversion id into int: %w", err)))
 		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusBadRequest)
 		return
 	}
-	h.Log.Debug("Request body decoded successfully", zap.Any("song", song))
+	log.Debug("Request body decoded successfully", zap.Any("song", song))
 
 	song.Id = id
 	err = h.Service.Update(r.Context(), song)
 	if err != nil {
-		h.Log.Error("service Update", zap.Error(err))
-		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusInternalServerError)
+		log.Error("service Update", zap.Error(err))
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), songStatus(err))
 		return
 	}
 
@@ -242,12 +274,12 @@ func (h *Handler) Update(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	err = json.NewEncoder(w).Encode(res)
 	if err != nil {
-		h.Log.Error("Failed to encode response", zap.Error(err))
+		log.Error("Failed to encode response", zap.Error(err))
 		http.Error(w, `{"error":"failed to encode response"}`, http.StatusInternalServerError)
 		return
 	}
 
-	h.Log.Debug("Response sent successfully")
+	log.Debug("Response sent successfully")
 }
 
 // Delete deletes a song from the database by its ID
@@ -261,21 +293,22 @@ func (h *Handler) Update(w http.ResponseWriter, r *http.Request) {
 //	@Failure		500	{object}	map[string]string	"Internal server error"
 //	@Router			/songs/{id} [delete]
 func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
-	h.Log.Debug("Incoming request to Delete endpoint")
+	log := h.logger(r.Context())
+	log.Debug("Incoming request to Delete endpoint")
 
 	// val := chi.URLParam(r, "id")
 	id, err := ValidID(r)
 	if err != nil {
-		h.Log.Error("Converion id", zap.Error(fmt.Errorf("failed conversion id into int: %w", err)))
+		log.Error("Converion id", zap.Error(fmt.Errorf("failed conversion id into int: %w", err)))
 		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusBadRequest)
 		return
 	}
 
-	h.Log.Debug("Request body decoded successfully", zap.Int("song", id))
+	log.Debug("Request body decoded successfully", zap.Int("song", id))
 
 	err = h.Service.Delete(r.Context(), id)
 	if err != nil {
-		h.Log.Error("service Delete", zap.Error(err))
+		log.Error("service Delete", zap.Error(err))
 		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusInternalServerError)
 		return
 	}
@@ -286,12 +319,12 @@ func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	err = json.NewEncoder(w).Encode(res)
 	if err != nil {
-		h.Log.Error("Failed to encode response", zap.Error(err))
+		log.Error("Failed to encode response", zap.Error(err))
 		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusInternalServerError)
 		return
 	}
 
-	h.Log.Debug("Response sent successfully")
+	log.Debug("Response sent successfully")
 }
 
 // GetText возвращает текст песни по её ID и фильтрам.
@@ -307,25 +340,26 @@ func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
 //	@Failure		500		{object}	map[string]string	"Internal server error"
 //	@Router			/songs/{id} [get]
 func (h *Handler) GetText(w http.ResponseWriter, r *http.Request) {
-	h.Log.Debug("Incoming request to GetText endpoint")
+	log := h.logger(r.Context())
+	log.Debug("Incoming request to GetText endpoint")
 
 	filters, err := ValidFiltres(r)
 	if err != nil {
-		h.Log.Error("Failed to validate filters", zap.Error(err))
+		log.Error("Failed to validate filters", zap.Error(err))
 		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusBadRequest)
 		return
 	}
 
 	id, err := ValidID(r)
 	if err != nil {
-		h.Log.Error("Converion id", zap.Error(fmt.Errorf("failed conversion id into int: %w", err)))
+		log.Error("Converion id", zap.Error(fmt.Errorf("failed conversion id into int: %w", err)))
 		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusBadRequest)
 		return
 	}
 
 	text, err := h.Service.GetText(r.Context(), filters, id)
 	if err != nil {
-		h.Log.Error("service GetText", zap.Error(err))
+		log.Error("service GetText", zap.Error(err))
 		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusInternalServerError)
 	}
 
@@ -334,10 +368,10 @@ func (h *Handler) GetText(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	err = json.NewEncoder(w).Encode(response)
 	if err != nil {
-		h.Log.Error("Failed to encode response", zap.Error(err))
+		log.Error("Failed to encode response", zap.Error(err))
 		http.Error(w, `{"error":"failed to encode response"}`, http.StatusInternalServerError)
 		return
 	}
 
-	h.Log.Debug("Response sent successfully")
+	log.Debug("Response sent successfully")
 }
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/SemenShakhray/list-of-song/internal/health"
+
+	"go.uber.org/zap"
+)
+
+// Healthz reports that the process is alive
+//
+//	@Summary		Liveness probe
+//	@Description	Always succeeds while the process serves requests, dependencies are not checked
+//	@Tags			Health
+//	@Produce		json
+//	@Success		200	{object}	health.Report	"Alive"
+//	@Router			/healthz [get]
+func (h *Handler) Healthz(w http.ResponseWriter, r *http.Request) {
+	h.writeHealth(w, r, http.StatusOK, health.Report{Status: health.StatusOK})
+}
+
+// Readyz reports whether the service can serve requests
+//
+//	@Summary		Readiness probe
+//	@Description	Check the database connection, the migration status and, when enabled, the external API. Every dependency is reported with its status and latency. During shutdown the service is reported as not ready
+//	@Tags			Health
+//	@Produce		json
+//	@Success		200	{object}	health.Report	"Ready"
+//	@Failure		503	{object}	health.Report	"Not ready"
+//	@Router			/readyz [get]
+func (h *Handler) Readyz(w http.ResponseWriter, r *http.Request) {
+	report := h.Health.Ready(r.Context())
+
+	status := http.StatusOK
+	if report.Status != health.StatusOK {
+		h.logger(r.Context()).Warn("Service is not ready", zap.Any("report", report))
+		status = http.StatusServiceUnavailable
+	}
+	h.writeHealth(w, r, status, report)
+}
+
+func (h *Handler) writeHealth(w http.ResponseWriter, r *http.Request, status int, report health.Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(report)
+	if err != nil {
+		h.logger(r.Context()).Error("Failed to encode response", zap.Error(err))
+		return
+	}
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/SemenShakhray/list-of-song/internal/api/middleware"
+	"github.com/SemenShakhray/list-of-song/internal/auth"
+
+	"go.uber.org/zap"
+)
+
+// ValidRevision returns the revision number from a /songs/{id}/history/{rev} path.
+func ValidRevision(r *http.Request) (int, error) {
+	paramPath := strings.Split(r.URL.Path, "/")
+	if len(paramPath) < 5 {
+		return 0, fmt.Errorf("missing revision in path")
+	}
+	rev, err := strconv.Atoi(paramPath[4])
+	if err != nil {
+		return 0, fmt.Errorf("failed conversion revision into int: %w", err)
+	}
+	if rev <= 0 {
+		return 0, fmt.Errorf("invalid revision: %d", rev)
+	}
+	return rev, nil
+}
+
+// GetHistory returns the revision history of a song
+//
+//	@Summary		Get song history
+//	@Description	Retrieve the revisions of a song, the newest first. Every revision has the song state before and after the change, the actor and the request ID
+//	@Tags			History
+//	@Produce		json
+//	@Param			id		path		int					true	"Song ID"
+//	@Param			limit	query		integer				false	"Limit the number of results"
+//	@Param			offset	query		integer				false	"Offset for pagination"
+//	@Success		200		{array}		models.Revision		"List of revisions"
+//	@Failure		400		{object}	map[string]string	"Invalid input"
+//	@Failure		500		{object}	map[string]string	"Internal server error"
+//	@Router			/songs/{id}/history [get]
+func (h *Handler) GetHistory(w http.ResponseWriter, r *http.Request) {
+	log := h.logger(r.Context())
+	log.Debug("Incoming request to GetHistory endpoint")
+
+	filters, err := ValidFiltres(r)
+	if err != nil {
+		log.Error("Failed to validate filters", zap.Error(err))
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	id, err := ValidID(r)
+	if err != nil {
+		log.Error("Converion id", zap.Error(fmt.Errorf("failed conversion id into int: %w", err)))
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	revisions, err := h.Service.GetHistory(r.Context(), id, filters.Limit, filters.Offset)
+	if err != nil {
+		log.Error("service GetHistory", zap.Error(err))
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(revisions)
+	if err != nil {
+		log.Error("Failed to encode response", zap.Error(err))
+		return
+	}
+
+	log.Debug("Response sent successfully")
+}
+
+// GetRevision returns one revision of a song
+//
+//	@Summary		Get song revision
+//	@Description	Retrieve a single revision of a song by its number
+//	@Tags			History
+//	@Produce		json
+//	@Param			id	path		int					true	"Song ID"
+//	@Param			rev	path		int					true	"Revision number"
+//	@Success		200	{object}	models.Revision		"Revision"
+//	@Failure		400	{object}	map[string]string	"Invalid input"
+//	@Failure		500	{object}	map[string]string	"Internal server error"
+//	@Router			/songs/{id}/history/{rev} [get]
+func (h *Handler) GetRevision(w http.ResponseWriter, r *http.Request) {
+	log := h.logger(r.Context())
+	log.Debug("Incoming request to GetRevision endpoint")
+
+	id, err := ValidID(r)
+	if err != nil {
+		log.Error("Converion id", zap.Error(fmt.Errorf("failed conversion id into int: %w", err)))
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+	rev, err := ValidRevision(r)
+	if err != nil {
+		log.Error("Conversion revision", zap.Error(err))
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	revision, err := h.Service.GetRevision(r.Context(), id, rev)
+	if err != nil {
+		log.Error("service GetRevision", zap.Error(err))
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(revision)
+	if err != nil {
+		log.Error("Failed to encode response", zap.Error(err))
+		return
+	}
+
+	log.Debug("Response sent successfully")
+}
+
+// Revert sets a song back to a previous revision
+//
+//	@Summary		Revert a song
+//	@Description	Set a song back to its state after the given revision. The revert is recorded as a new revision. Reverting to a revision that left the song in the trash deletes it and needs the permission to delete songs
+//	@Tags			History
+//	@Produce		json
+//	@Param			id	path		int					true	"Song ID"
+//	@Param			rev	path		int					true	"Revision number"
+//	@Success		200	{object}	map[string]string	"Song reverted successfully"
+//	@Failure		400	{object}	map[string]string	"Invalid input"
+//	@Failure		403	{object}	map[string]string	"Reverting to a deleted state without the permission to delete"
+//	@Failure		409	{object}	map[string]string	"Another song has this title and group"
+//	@Failure		500	{object}	map[string]string	"Internal server error"
+//	@Router			/songs/{id}/history/{rev}/revert [post]
+func (h *Handler) Revert(w http.ResponseWriter, r *http.Request) {
+	log := h.logger(r.Context())
+	log.Debug("Incoming request to Revert endpoint")
+
+	id, err := ValidID(r)
+	if err != nil {
+		log.Error("Converion id", zap.Error(fmt.Errorf("failed conversion id into int: %w", err)))
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+	rev, err := ValidRevision(r)
+	if err != nil {
+		log.Error("Conversion revision", zap.Error(err))
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	// A revert to a state in the trash deletes the song, so it needs the
+	// permission of DELETE /songs/{id} on top of the one of the route.
+	// Revisions never change, the check cannot go stale.
+	if h.Policy != nil {
+		target, err := h.Service.GetRevision(r.Context(), id, rev)
+		if err != nil {
+			log.Error("service GetRevision", zap.Error(err))
+			http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusInternalServerError)
+			return
+		}
+		principal, _ := auth.PrincipalFrom(r.Context())
+		if target.After != nil && target.After.DeletedAt != nil && !h.Policy.Allows(principal.Roles, auth.PermDelete) {
+			middleware.Forbid(w, r, auth.PermDelete, h.Log)
+			return
+		}
+	}
+
+	err = h.Service.Revert(r.Context(), id, rev)
+	if err != nil {
+		log.Error("service Revert", zap.Error(err))
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), songStatus(err))
+		return
+	}
+
+	res := map[string]string{"message": "song reverted successfully"}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(res)
+	if err != nil {
+		log.Error("Failed to encode response", zap.Error(err))
+		return
+	}
+
+	log.Debug("Response sent successfully")
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SemenShakhray/list-of-song/internal/auth"
+	"github.com/SemenShakhray/list-of-song/internal/models"
+	"github.com/SemenShakhray/list-of-song/internal/service"
+
+	"go.uber.org/zap"
+)
+
+// revertService serves one revision and records the reverts.
+type revertService struct {
+	service.Servicer
+	revision models.Revision
+	err      error
+	reverted []int
+}
+
+func (s *revertService) GetRevision(_ context.Context, id int, revision int) (models.Revision, error) {
+	if s.err != nil {
+		return models.Revision{}, s.err
+	}
+	return s.revision, nil
+}
+
+func (s *revertService) Revert(_ context.Context, id int, revision int) error {
+	s.reverted = append(s.reverted, revision)
+	return nil
+}
+
+func TestRevertOfDelete(t *testing.T) {
+	deletedAt := time.Now()
+	live := models.Revision{SongId: 3, Revision: 2, After: &models.Song{Id: 3, Song: "Song"}}
+	trashed := models.Revision{SongId: 3, Revision: 2, After: &models.Song{Id: 3, Song: "Song", DeletedAt: &deletedAt}}
+	// A revision that removed the song for good has no state after it.
+	purged := models.Revision{SongId: 3, Revision: 2}
+
+	for _, tc := range []struct {
+		name     string
+		policy   auth.Policy
+		role     auth.Role
+		revision models.Revision
+		err      error
+		want     int
+	}{
+		{name: "editor to a live state", policy: auth.DefaultPolicy, role: auth.RoleEditor, revision: live, want: http.StatusOK},
+		{name: "editor to the trash", policy: auth.DefaultPolicy, role: auth.RoleEditor, revision: trashed, want: http.StatusForbidden},
+		{name: "admin to the trash", policy: auth.DefaultPolicy, role: auth.RoleAdmin, revision: trashed, want: http.StatusOK},
+		{name: "editor to no state", policy: auth.DefaultPolicy, role: auth.RoleEditor, revision: purged, want: http.StatusOK},
+		{name: "authentication disabled", revision: trashed, want: http.StatusOK},
+		{name: "revision not read", policy: auth.DefaultPolicy, role: auth.RoleAdmin, err: errors.New("connection refused"), want: http.StatusInternalServerError},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			serv := &revertService{revision: tc.revision, err: tc.err}
+			h := NewHandler(zap.NewNop(), serv, nil)
+			h.Policy = tc.policy
+
+			r := httptest.NewRequest("POST", "/songs/3/history/2/revert", nil)
+			p := auth.Principal{Subject: "alice", Method: auth.MethodAPIKey, Roles: []auth.Role{tc.role}}
+			r = r.WithContext(auth.WithPrincipal(r.Context(), p))
+			w := httptest.NewRecorder()
+			h.Revert(w, r)
+
+			if w.Code != tc.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tc.want, w.Body)
+			}
+			if reverted := len(serv.reverted) == 1; reverted != (tc.want == http.StatusOK) {
+				t.Errorf("reverted %v, want a revert only with status 200", serv.reverted)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/SemenShakhray/list-of-song/internal/auth"
+	"github.com/SemenShakhray/list-of-song/internal/storage"
+
+	"go.uber.org/zap"
+)
+
+type createKeyRequest struct {
+	Name string `json:"name"`
+	// Role defaults to viewer.
+	Role string `json:"role"`
+}
+
+// CreateKey creates a new API key
+//
+//	@Summary		Create an API key
+//	@Description	Create a new API key with a role. The key is shown only in this response, only its hash is stored
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			key	body		createKeyRequest	true	"Key name and role"
+//	@Success		201	{object}	models.APIKey		"Created key"
+//	@Failure		400	{object}	map[string]string	"Invalid input"
+//	@Failure		500	{object}	map[string]string	"Internal server error"
+//	@Router			/admin/api-keys [post]
+func (h *Handler) CreateKey(w http.ResponseWriter, r *http.Request) {
+	log := h.logger(r.Context())
+	log.Debug("Incoming request to CreateKey endpoint")
+
+	var req createKeyRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		log.Error("Failed to decode request body", zap.Error(err))
+		http.Error(w, `{"error":"failed to decode request"}`, http.StatusBadRequest)
+		return
+	}
+	if req.Name == "" {
+		http.Error(w, `{"error":"key name is required"}`, http.StatusBadRequest)
+		return
+	}
+	if req.Role == "" {
+		req.Role = string(auth.RoleViewer)
+	}
+	if h.Policy != nil && !h.Policy.ValidRole(auth.Role(req.Role)) {
+		http.Error(w, `{"error":"unknown role"}`, http.StatusBadRequest)
+		return
+	}
+
+	key, err := h.Keys.CreateKey(r.Context(), req.Name, req.Role)
+	if err != nil {
+		log.Error("service CreateKey", zap.Error(err))
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+	log.Info("API key created", zap.Int("key", key.Id), zap.String("name", key.Name), zap.String("prefix", key.Prefix), zap.String("role", key.Role))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(key)
+	if err != nil {
+		log.Error("Failed to encode response", zap.Error(err))
+		return
+	}
+}
+
+// ListKeys returns all API keys
+//
+//	@Summary		List API keys
+//	@Description	Retrieve all API keys including revoked ones, without the keys themselves
+//	@Tags			Admin
+//	@Produce		json
+//	@Success		200	{array}		models.APIKey		"List of keys"
+//	@Failure		500	{object}	map[string]string	"Internal server error"
+//	@Router			/admin/api-keys [get]
+func (h *Handler) ListKeys(w http.ResponseWriter, r *http.Request) {
+	log := h.logger(r.Context())
+	log.Debug("Incoming request to ListKeys endpoint")
+
+	keys, err := h.Keys.ListKeys(r.Context())
+	if err != nil {
+		log.Error("service ListKeys", zap.Error(err))
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(keys)
+	if err != nil {
+		log.Error("Failed to encode response", zap.Error(err))
+		return
+	}
+}
+
+// RevokeKey revokes an API key
+//
+//	@Summary		Revoke an API key
+//	@Description	Revoke an API key by its ID, requests with it are rejected afterwards
+//	@Tags			Admin
+//	@Produce		json
+//	@Param			id	path		int					true	"Key ID"
+//	@Success		200	{object}	map[string]string	"Key revoked successfully"
+//	@Failure		400	{object}	map[string]string	"Invalid key ID"
+//	@Failure		404	{object}	map[string]string	"Key not found"
+//	@Failure		500	{object}	map[string]string	"Internal server error"
+//	@Router			/admin/api-keys/{id} [delete]
+func (h *Handler) RevokeKey(w http.ResponseWriter, r *http.Request) {
+	log := h.logger(r.Context())
+	log.Debug("Incoming request to RevokeKey endpoint")
+
+	paramPath := strings.Split(r.URL.Path, "/")
+	id, err := strconv.Atoi(paramPath[len(paramPath)-1])
+	if err != nil {
+		log.Error("Converion id", zap.Error(fmt.Errorf("failed conversion id into int: %w", err)))
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	err = h.Keys.RevokeKey(r.Context(), id)
+	if err != nil {
+		log.Error("service RevokeKey", zap.Error(err))
+		status := http.StatusInternalServerError
+		if errors.Is(err, storage.ErrKeyNotFound) {
+			status = http.StatusNotFound
+		}
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), status)
+		return
+	}
+	log.Info("API key revoked", zap.Int("key", id))
+
+	res := map[string]string{"message": "key revoked successfully"}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(res)
+	if err != nil {
+		log.Error("Failed to encode response", zap.Error(err))
+		return
+	}
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+type logLevels struct {
+	Level string `json:"level"`
+	// Packages are the levels overriding Level for named loggers.
+	Packages map[string]string `json:"packages"`
+}
+
+type setLogLevelRequest struct {
+	// Package is the logger name, empty for the base level.
+	Package string `json:"package"`
+	// Level is debug, info, warn or error. An empty level removes the
+	// override of a package.
+	Level string `json:"level"`
+}
+
+// GetLogLevel returns the current log levels
+//
+//	@Summary		Get log levels
+//	@Description	Retrieve the base log level and the per package overrides
+//	@Tags			Admin
+//	@Produce		json
+//	@Success		200	{object}	logLevels	"Log levels"
+//	@Router			/admin/log-level [get]
+func (h *Handler) GetLogLevel(w http.ResponseWriter, r *http.Request) {
+	log := h.logger(r.Context())
+	log.Debug("Incoming request to GetLogLevel endpoint")
+
+	h.writeLogLevels(w, r)
+}
+
+// SetLogLevel changes a log level at runtime
+//
+//	@Summary		Set a log level
+//	@Description	Change the base log level or the level of one package without a restart. An empty level removes the package override
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			level	body		setLogLevelRequest	true	"Package and level"
+//	@Success		200		{object}	logLevels			"Log levels"
+//	@Failure		400		{object}	map[string]string	"Invalid input"
+//	@Router			/admin/log-level [put]
+func (h *Handler) SetLogLevel(w http.ResponseWriter, r *http.Request) {
+	log := h.logger(r.Context())
+	log.Debug("Incoming request to SetLogLevel endpoint")
+
+	var req setLogLevelRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		log.Error("Failed to decode request body", zap.Error(err))
+		http.Error(w, `{"error":"failed to decode request"}`, http.StatusBadRequest)
+		return
+	}
+	if req.Package == "" && req.Level == "" {
+		http.Error(w, `{"error":"level is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	err = h.Levels.Set(req.Package, req.Level)
+	if err != nil {
+		http.Error(w, `{"error":"unknown log level"}`, http.StatusBadRequest)
+		return
+	}
+	log.Info("Log level changed", zap.String("package", req.Package), zap.String("level", req.Level))
+
+	h.writeLogLevels(w, r)
+}
+
+func (h *Handler) writeLogLevels(w http.ResponseWriter, r *http.Request) {
+	res := logLevels{
+		Level:    h.Levels.Base().String(),
+		Packages: make(map[string]string),
+	}
+	for name, level := range h.Levels.Packages() {
+		res.Packages[name] = level.String()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(res)
+	if err != nil {
+		h.logger(r.Context()).Error("Failed to encode response", zap.Error(err))
+		return
+	}
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// GetTrash returns a list of deleted songs
+//
+//	@Summary		Get deleted songs
+//	@Description	Retrieve songs in the trash with optional filters, the most recently deleted first. Songs are purged from the trash after the retention period
+//	@Tags			Trash
+//	@Produce		json
+//	@Param			song	query		string		false	"Filter by song name (partial match)"
+//	@Param			group	query		string		false	"Filter by group name (partial match)"
+//	@Param			text	query		string		false	"Filter by lyrics (partial match)"
+//	@Param			link	query		string		false	"Filter by link (partial match)"
+//	@Param			date	query		string		false	"Filter by release date"
+//	@Param			limit	query		integer		false	"Limit the number of results"
+//	@Param			offset	query		integer		false	"Offset for pagination"
+//	@Success		200		{array}		models.Song	"List of deleted songs"
+//	@Failure		400		{object}	map[string]string	"Invalid filters provided"
+//	@Failure		500		{object}	map[string]string	"Internal server error"
+//	@Router			/songs/trash [get]
+func (h *Handler) GetTrash(w http.ResponseWriter, r *http.Request) {
+	log := h.logger(r.Context())
+	log.Debug("Incoming request to GetTrash endpoint")
+
+	filtres, err := ValidFiltres(r)
+	if err != nil {
+		log.Error("Failed to validate filters", zap.Error(err))
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	songs, err := h.Service.GetTrash(r.Context(), filtres)
+	if err != nil {
+		log.Error("service GetTrash", zap.Error(err))
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(songs)
+	if err != nil {
+		log.Error("Failed to encode response", zap.Error(err))
+		return
+	}
+
+	log.Debug("Response sent successfully")
+}
+
+// Restore moves a song out of the trash
+//
+//	@Summary		Restore a song
+//	@Description	Restore a deleted song by its ID
+//	@Tags			Trash
+//	@Produce		json
+//	@Param			id	path		int					true	"Song ID"
+//	@Success		200	{object}	map[string]string	"Song restored successfully"
+//	@Failure		400	{object}	map[string]string	"Invalid song ID"
+//	@Failure		409	{object}	map[string]string	"Another song has this title and group"
+//	@Failure		500	{object}	map[string]string	"Internal server error"
+//	@Router			/songs/{id}/restore [post]
+func (h *Handler) Restore(w http.ResponseWriter, r *http.Request) {
+	log := h.logger(r.Context())
+	log.Debug("Incoming request to Restore endpoint")
+
+	id, err := ValidID(r)
+	if err != nil {
+		log.Error("Converion id", zap.Error(fmt.Errorf("failed conversion id into int: %w", err)))
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	err = h.Service.Restore(r.Context(), id)
+	if err != nil {
+		log.Error("service Restore", zap.Error(err))
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), songStatus(err))
+		return
+	}
+
+	res := map[string]string{"message": "song restored successfully"}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(res)
+	if err != nil {
+		log.Error("Failed to encode response", zap.Error(err))
+		return
+	}
+
+	log.Debug("Response sent successfully")
+}
+
+// PurgeTrash permanently removes songs from the trash
+//
+//	@Summary		Purge the trash
+//	@Description	Permanently remove songs deleted before the given time, by default everything in the trash
+//	@Tags			Trash
+//	@Produce		json
+//	@Param			before	query		string				false	"RFC 3339 time, songs deleted before it are removed"
+//	@Success		200		{object}	map[string]int64	"Number of purged songs"
+//	@Failure		400		{object}	map[string]string	"Invalid input"
+//	@Failure		500		{object}	map[string]string	"Internal server error"
+//	@Router			/songs/trash/purge [post]
+func (h *Handler) PurgeTrash(w http.ResponseWriter, r *http.Request) {
+	log := h.logger(r.Context())
+	log.Debug("Incoming request to PurgeTrash endpoint")
+
+	before := time.Now()
+	if val := r.FormValue("before"); val != "" {
+		t, err := time.Parse(time.RFC3339, val)
+		if err != nil {
+			log.Error("Failed to parse before", zap.Error(err))
+			http.Error(w, `{"error":"invalid before: expected RFC 3339 time"}`, http.StatusBadRequest)
+			return
+		}
+		before = t
+	}
+
+	n, err := h.Service.Purge(r.Context(), before)
+	if err != nil {
+		log.Error("service Purge", zap.Error(err))
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+	log.Info("Trash purged", zap.Int64("songs", n), zap.Time("before", before))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(map[string]int64{"purged": n})
+	if err != nil {
+		log.Error("Failed to encode response", zap.Error(err))
+		return
+	}
+}
@@ -0,0 +1,294 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/SemenShakhray/list-of-song/internal/models"
+	"github.com/SemenShakhray/list-of-song/internal/service"
+	"github.com/SemenShakhray/list-of-song/internal/storage"
+
+	"go.uber.org/zap"
+)
+
+type webhookRequest struct {
+	URL string `json:"url"`
+	// Events defaults to all song events.
+	Events []string `json:"events"`
+	// Active defaults to true.
+	Active *bool `json:"active"`
+}
+
+func (req webhookRequest) webhook() models.Webhook {
+	return models.Webhook{
+		URL:    req.URL,
+		Events: req.Events,
+		Active: req.Active == nil || *req.Active,
+	}
+}
+
+// webhookStatus returns the status of an error from the webhook service.
+func webhookStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrInvalidWebhook):
+		return http.StatusBadRequest
+	case errors.Is(err, storage.ErrWebhookNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// CreateWebhook subscribes a URL to song events
+//
+//	@Summary		Create a webhook
+//	@Description	Subscribe a URL to song.created, song.updated and song.deleted events, all of them when no events are given. Every delivery is signed with the secret, which is shown only in this response
+//	@Tags			Webhooks
+//	@Accept			json
+//	@Produce		json
+//	@Param			webhook	body		webhookRequest		true	"Webhook URL and events"
+//	@Success		201		{object}	models.Webhook		"Created webhook"
+//	@Failure		400		{object}	map[string]string	"Invalid input"
+//	@Failure		500		{object}	map[string]string	"Internal server error"
+//	@Router			/webhooks [post]
+func (h *Handler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	log := h.logger(r.Context())
+	log.Debug("Incoming request to CreateWebhook endpoint")
+
+	var req webhookRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		log.Error("Failed to decode request body", zap.Error(err))
+		http.Error(w, `{"error":"failed to decode request"}`, http.StatusBadRequest)
+		return
+	}
+
+	hook, err := h.Webhooks.CreateWebhook(r.Context(), req.webhook())
+	if err != nil {
+		log.Error("service CreateWebhook", zap.Error(err))
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), webhookStatus(err))
+		return
+	}
+	log.Info("Webhook created", zap.Int("webhook", hook.Id), zap.String("url", hook.URL), zap.Strings("events", hook.Events))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(hook)
+	if err != nil {
+		log.Error("Failed to encode response", zap.Error(err))
+		return
+	}
+}
+
+// ListWebhooks returns all webhooks
+//
+//	@Summary		List webhooks
+//	@Description	Retrieve all webhooks without their secrets
+//	@Tags			Webhooks
+//	@Produce		json
+//	@Success		200	{array}		models.Webhook		"List of webhooks"
+//	@Failure		500	{object}	map[string]string	"Internal server error"
+//	@Router			/webhooks [get]
+func (h *Handler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	log := h.logger(r.Context())
+	log.Debug("Incoming request to ListWebhooks endpoint")
+
+	hooks, err := h.Webhooks.ListWebhooks(r.Context())
+	if err != nil {
+		log.Error("service ListWebhooks", zap.Error(err))
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(hooks)
+	if err != nil {
+		log.Error("Failed to encode response", zap.Error(err))
+		return
+	}
+}
+
+// GetWebhook returns one webhook
+//
+//	@Summary		Get a webhook
+//	@Description	Retrieve a webhook by its ID without its secret
+//	@Tags			Webhooks
+//	@Produce		json
+//	@Param			id	path		int					true	"Webhook ID"
+//	@Success		200	{object}	models.Webhook		"Webhook"
+//	@Failure		400	{object}	map[string]string	"Invalid webhook ID"
+//	@Failure		404	{object}	map[string]string	"Webhook not found"
+//	@Failure		500	{object}	map[string]string	"Internal server error"
+//	@Router			/webhooks/{id} [get]
+func (h *Handler) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	log := h.logger(r.Context())
+	log.Debug("Incoming request to GetWebhook endpoint")
+
+	id, err := ValidID(r)
+	if err != nil {
+		log.Error("Converion id", zap.Error(err))
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	hook, err := h.Webhooks.GetWebhook(r.Context(), id)
+	if err != nil {
+		log.Error("service GetWebhook", zap.Error(err))
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), webhookStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(hook)
+	if err != nil {
+		log.Error("Failed to encode response", zap.Error(err))
+		return
+	}
+}
+
+// UpdateWebhook changes a webhook
+//
+//	@Summary		Update a webhook
+//	@Description	Replace the URL, events and active flag of a webhook, the secret is kept. An inactive webhook gets no new deliveries and its pending ones wait until it is active again
+//	@Tags			Webhooks
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int					true	"Webhook ID"
+//	@Param			webhook	body		webhookRequest		true	"Webhook URL, events and active flag"
+//	@Success		200		{object}	models.Webhook		"Updated webhook"
+//	@Failure		400		{object}	map[string]string	"Invalid input"
+//	@Failure		404		{object}	map[string]string	"Webhook not found"
+//	@Failure		500		{object}	map[string]string	"Internal server error"
+//	@Router			/webhooks/{id} [put]
+func (h *Handler) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	log := h.logger(r.Context())
+	log.Debug("Incoming request to UpdateWebhook endpoint")
+
+	id, err := ValidID(r)
+	if err != nil {
+		log.Error("Converion id", zap.Error(err))
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	var req webhookRequest
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		log.Error("Failed to decode request body", zap.Error(err))
+		http.Error(w, `{"error":"failed to decode request"}`, http.StatusBadRequest)
+		return
+	}
+	hook := req.webhook()
+	hook.Id = id
+
+	hook, err = h.Webhooks.UpdateWebhook(r.Context(), hook)
+	if err != nil {
+		log.Error("service UpdateWebhook", zap.Error(err))
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), webhookStatus(err))
+		return
+	}
+	log.Info("Webhook updated", zap.Int("webhook", hook.Id), zap.String("url", hook.URL),
+		zap.Strings("events", hook.Events), zap.Bool("active", hook.Active))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(hook)
+	if err != nil {
+		log.Error("Failed to encode response", zap.Error(err))
+		return
+	}
+}
+
+// DeleteWebhook removes a webhook
+//
+//	@Summary		Delete a webhook
+//	@Description	Remove a webhook together with its delivery log, pending deliveries are not sent
+//	@Tags			Webhooks
+//	@Produce		json
+//	@Param			id	path		int					true	"Webhook ID"
+//	@Success		200	{object}	map[string]string	"Webhook deleted successfully"
+//	@Failure		400	{object}	map[string]string	"Invalid webhook ID"
+//	@Failure		404	{object}	map[string]string	"Webhook not found"
+//	@Failure		500	{object}	map[string]string	"Internal server error"
+//	@Router			/webhooks/{id} [delete]
+func (h *Handler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	log := h.logger(r.Context())
+	log.Debug("Incoming request to DeleteWebhook endpoint")
+
+	id, err := ValidID(r)
+	if err != nil {
+		log.Error("Converion id", zap.Error(err))
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	err = h.Webhooks.DeleteWebhook(r.Context(), id)
+	if err != nil {
+		log.Error("service DeleteWebhook", zap.Error(err))
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), webhookStatus(err))
+		return
+	}
+	log.Info("Webhook deleted", zap.Int("webhook", id))
+
+	res := map[string]string{"message": "webhook deleted successfully"}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(res)
+	if err != nil {
+		log.Error("Failed to encode response", zap.Error(err))
+		return
+	}
+}
+
+// ListDeliveries returns the delivery log of a webhook
+//
+//	@Summary		List webhook deliveries
+//	@Description	Retrieve the deliveries of a webhook, the newest first, with their status, number of attempts and the result of the last attempt
+//	@Tags			Webhooks
+//	@Produce		json
+//	@Param			id		path		int						true	"Webhook ID"
+//	@Param			limit	query		integer					false	"Limit the number of results"
+//	@Param			offset	query		integer					false	"Offset for pagination"
+//	@Success		200		{array}		models.WebhookDelivery	"List of deliveries"
+//	@Failure		400		{object}	map[string]string		"Invalid input"
+//	@Failure		404		{object}	map[string]string		"Webhook not found"
+//	@Failure		500		{object}	map[string]string		"Internal server error"
+//	@Router			/webhooks/{id}/deliveries [get]
+func (h *Handler) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	log := h.logger(r.Context())
+	log.Debug("Incoming request to ListDeliveries endpoint")
+
+	filters, err := ValidFiltres(r)
+	if err != nil {
+		log.Error("Failed to validate filters", zap.Error(err))
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	id, err := ValidID(r)
+	if err != nil {
+		log.Error("Converion id", zap.Error(err))
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	deliveries, err := h.Webhooks.ListDeliveries(r.Context(), id, filters.Limit, filters.Offset)
+	if err != nil {
+		log.Error("service ListDeliveries", zap.Error(err))
+		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), webhookStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(deliveries)
+	if err != nil {
+		log.Error("Failed to encode response", zap.Error(err))
+		return
+	}
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/SemenShakhray/list-of-song/internal/auth"
+	"github.com/SemenShakhray/list-of-song/internal/requestctx"
+	"github.com/SemenShakhray/list-of-song/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// WithAuth rejects requests without valid credentials. The authenticated
+// principal is stored in the request context, see auth.PrincipalFrom, and its
+// subject is recorded as the actor of changes.
+func WithAuth(a *auth.Authenticator, log *zap.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, err := a.Authenticate(r)
+			if err != nil {
+				if errors.Is(err, auth.ErrNoCredentials) || errors.Is(err, auth.ErrInvalidCredentials) {
+					logger.FromContext(r.Context(), log).Warn("Authentication failed",
+						zap.String("method", r.Method),
+						zap.String("url", r.URL.String()),
+						zap.Error(err),
+					)
+					w.Header().Set("WWW-Authenticate", `Bearer realm="songs"`)
+					http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+					return
+				}
+				logger.FromContext(r.Context(), log).Error("Failed to authenticate request", zap.Error(err))
+				http.Error(w, `{"error":"failed to authenticate request"}`, http.StatusInternalServerError)
+				return
+			}
+
+			ctx := auth.WithPrincipal(r.Context(), principal)
+			ctx = requestctx.WithActor(ctx, principal.Subject)
+			ctx = requestctx.WithSession(ctx, clientKey(r.WithContext(ctx)))
+			ctx = logger.WithFields(ctx, zap.String("subject", principal.Subject))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/SemenShakhray/list-of-song/internal/auth"
+	"github.com/SemenShakhray/list-of-song/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+type forbiddenResponse struct {
+	Error      string          `json:"error"`
+	Permission auth.Permission `json:"permission"`
+	Subject    string          `json:"subject"`
+	Roles      []auth.Role     `json:"roles"`
+}
+
+// Require lets the request through only when policy grants perm to one of the
+// roles of the authenticated principal, see WithAuth. Other requests get 403
+// with the missing permission in the body.
+func Require(policy auth.Policy, perm auth.Permission, log *zap.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, _ := auth.PrincipalFrom(r.Context())
+			if policy.Allows(principal.Roles, perm) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			Forbid(w, r, perm, log)
+		})
+	}
+}
+
+// Forbid answers 403 with the missing permission in the body. Handlers use it
+// for permissions that depend on the request beyond its route.
+func Forbid(w http.ResponseWriter, r *http.Request, perm auth.Permission, log *zap.Logger) {
+	principal, _ := auth.PrincipalFrom(r.Context())
+	logger.FromContext(r.Context(), log).Warn("Permission denied",
+		zap.String("method", r.Method),
+		zap.String("url", r.URL.String()),
+		zap.String("subject", principal.Subject),
+		zap.String("permission", string(perm)),
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	err := json.NewEncoder(w).Encode(forbiddenResponse{
+		Error:      "forbidden",
+		Permission: perm,
+		Subject:    principal.Subject,
+		Roles:      principal.Roles,
+	})
+	if err != nil {
+		logger.FromContext(r.Context(), log).Error("Failed to encode response", zap.Error(err))
+	}
+}
@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/SemenShakhray/list-of-song/internal/auth"
+
+	"go.uber.org/zap"
+)
+
+func TestRequire(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	for _, perm := range auth.Permissions {
+		t.Run(string(perm), func(t *testing.T) {
+			// holder is granted only perm, others everything but perm.
+			policy := auth.Policy{"holder": {perm}}
+			for _, p := range auth.Permissions {
+				if p != perm {
+					policy["others"] = append(policy["others"], p)
+				}
+			}
+			h := Require(policy, perm, zap.NewNop())(ok)
+
+			for _, tc := range []struct {
+				name  string
+				roles []auth.Role
+				want  int
+			}{
+				{name: "granted", roles: []auth.Role{"holder"}, want: http.StatusOK},
+				{name: "one of the roles granted", roles: []auth.Role{"others", "holder"}, want: http.StatusOK},
+				{name: "other permissions", roles: []auth.Role{"others"}, want: http.StatusForbidden},
+				{name: "unknown role", roles: []auth.Role{"stranger"}, want: http.StatusForbidden},
+				{name: "no roles", want: http.StatusForbidden},
+			} {
+				r := httptest.NewRequest("GET", "/songs", nil)
+				p := auth.Principal{Subject: "alice", Method: auth.MethodAPIKey, Roles: tc.roles}
+				r = r.WithContext(auth.WithPrincipal(r.Context(), p))
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, r)
+
+				if w.Code != tc.want {
+					t.Errorf("%s: status = %d, want %d", tc.name, w.Code, tc.want)
+				}
+				if w.Code == http.StatusForbidden {
+					checkForbidden(t, w, perm, "alice")
+				}
+			}
+		})
+	}
+}
+
+func TestRequireWithoutPrincipal(t *testing.T) {
+	h := Require(auth.DefaultPolicy, auth.PermRead, zap.NewNop())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler called without a principal")
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/songs", nil).WithContext(context.Background()))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
+
+// checkForbidden checks the body of a 403 response.
+func checkForbidden(t *testing.T, w *httptest.ResponseRecorder, perm auth.Permission, subject string) {
+	t.Helper()
+	var body forbiddenResponse
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatalf("decode 403 body: %v", err)
+	}
+	if body.Error != "forbidden" || body.Permission != perm || body.Subject != subject {
+		t.Errorf("403 body = %+v, want permission %s of %s", body, perm, subject)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+}
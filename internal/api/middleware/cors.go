@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/SemenShakhray/list-of-song/internal/config"
+)
+
+// exposedHeaders are the response headers browsers let scripts read.
+var exposedHeaders = strings.Join([]string{
+	RequestIDHeader, "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After",
+}, ", ")
+
+// CORS answers preflight requests and adds the CORS headers for allowed
+// origins. Its policy can be replaced while requests are served.
+type CORS struct {
+	policy atomic.Pointer[config.CORS]
+}
+
+func NewCORS(cfg config.CORS) *CORS {
+	c := &CORS{}
+	c.Set(cfg)
+	return c
+}
+
+// Set replaces the policy, requests already running keep the old one.
+func (c *CORS) Set(cfg config.CORS) {
+	c.policy.Store(&cfg)
+}
+
+func (c *CORS) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		policy := c.policy.Load()
+		if origin == "" || !originAllowed(policy.AllowedOrigins, origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h := w.Header()
+		h.Add("Vary", "Origin")
+		h.Set("Access-Control-Allow-Origin", origin)
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+			h.Set("Access-Control-Allow-Methods", strings.Join(policy.AllowedMethods, ", "))
+			h.Set("Access-Control-Allow-Headers", strings.Join(policy.AllowedHeaders, ", "))
+			if policy.MaxAge > 0 {
+				h.Set("Access-Control-Max-Age", strconv.Itoa(int(policy.MaxAge.Seconds())))
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		h.Set("Access-Control-Expose-Headers", exposedHeaders)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func originAllowed(allowed []string, origin string) bool {
+	return slices.Contains(allowed, "*") || slices.Contains(allowed, origin)
+}
@@ -4,6 +4,8 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/SemenShakhray/list-of-song/pkg/logger"
+
 	"go.uber.org/zap"
 )
 
@@ -17,10 +19,19 @@ func (sw *statusWriter) WriteHeader(code int) {
 	sw.ResponseWriter.WriteHeader(code)
 }
 
+// Unwrap lets http.ResponseController reach the underlying writer, so
+// handlers can still flush and extend deadlines through the wrapper.
+func (sw *statusWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
+
+// WithLogging logs the start and the end of every request. It runs after
+// WithRequestMeta, so both lines carry the request ID.
 func WithLogging(log *zap.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
+			log := logger.FromContext(r.Context(), log)
 
 			log.Info("Incoming request",
 				zap.String("method", r.Method),
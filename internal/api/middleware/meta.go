@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/SemenShakhray/list-of-song/internal/requestctx"
+	"github.com/SemenShakhray/list-of-song/pkg/logger"
+
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// RequestIDHeader carries the request ID in requests and responses.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLen bounds client supplied request IDs, longer ones are replaced.
+const maxRequestIDLen = 128
+
+// WithRequestMeta takes the request ID from the X-Request-ID header, or
+// generates one when the header is missing or invalid, and returns it in the
+// response. The ID is stored in the request context, it is recorded in the
+// song history and added to every line logged while serving the request.
+// The client address is stored as the session until WithAuth replaces it
+// with the authenticated client.
+func WithRequestMeta(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		fields := []zap.Field{zap.String("request_id", id)}
+		if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+			fields = append(fields, zap.Stringer("trace_id", sc.TraceID()))
+		}
+
+		ctx := requestctx.WithRequestID(r.Context(), id)
+		ctx = requestctx.WithSession(ctx, clientKey(r))
+		ctx = logger.WithFields(ctx, fields...)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// validRequestID accepts IDs of printable ASCII characters without spaces, so
+// they are safe to log and to send back in a header.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/SemenShakhray/list-of-song/internal/metrics"
+	"github.com/go-chi/chi"
+)
+
+// WithMetrics counts requests and measures their latency by route pattern, so
+// /songs/1 and /songs/2 are reported together as /songs/{song}.
+func WithMetrics(m *metrics.Metrics) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			m.HTTPInFlight.Inc()
+			defer m.HTTPInFlight.Dec()
+
+			wrappedWriter := &statusWriter{ResponseWriter: w, statusCode: http.StatusOK}
+			next.ServeHTTP(wrappedWriter, r)
+
+			// The pattern is known only after the router matched the request.
+			route := "unmatched"
+			if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+				route = rctx.RoutePattern()
+			}
+			status := strconv.Itoa(wrappedWriter.statusCode)
+			m.HTTPRequests.WithLabelValues(r.Method, route, status).Inc()
+			m.HTTPDuration.WithLabelValues(r.Method, route, status).Observe(time.Since(start).Seconds())
+		})
+	}
+}
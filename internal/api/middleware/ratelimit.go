@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/SemenShakhray/list-of-song/internal/auth"
+	"github.com/SemenShakhray/list-of-song/internal/ratelimit"
+	"github.com/SemenShakhray/list-of-song/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// WithRateLimit limits requests per client with l. Clients are told apart by
+// their API key or token subject, anonymous clients by IP address. The state
+// of the bucket is reported in RateLimit-* headers, rejected requests get 429
+// with Retry-After.
+func WithRateLimit(l *ratelimit.Limiter, group string, log *zap.Logger) func(http.Handler) http.Handler {
+	return rateLimit(l, group, clientKey, log)
+}
+
+// WithIPRateLimit limits requests per IP address with l. It goes in front of
+// authentication, so requests with missing or bad credentials are limited
+// before they cost a lookup of the API key.
+func WithIPRateLimit(l *ratelimit.Limiter, group string, log *zap.Logger) func(http.Handler) http.Handler {
+	return rateLimit(l, group, ipKey, log)
+}
+
+func rateLimit(l *ratelimit.Limiter, group string, keyFn func(*http.Request) string, log *zap.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !l.Enabled() {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key := keyFn(r)
+			res := l.Allow(key)
+
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+
+			if !res.Allowed {
+				logger.FromContext(r.Context(), log).Warn("Rate limit exceeded",
+					zap.String("group", group),
+					zap.String("client", key),
+					zap.String("url", r.URL.String()),
+				)
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+				http.Error(w, `{"error":"rate limit exceeded"}`, http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func clientKey(r *http.Request) string {
+	if principal, ok := auth.PrincipalFrom(r.Context()); ok {
+		if principal.KeyID != 0 {
+			return "key:" + strconv.Itoa(principal.KeyID)
+		}
+		return "sub:" + principal.Subject
+	}
+	return ipKey(r)
+}
+
+func ipKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+func ceilSeconds(d time.Duration) int {
+	if d > time.Duration(math.MaxInt32)*time.Second {
+		return math.MaxInt32
+	}
+	return int(math.Ceil(d.Seconds()))
+}
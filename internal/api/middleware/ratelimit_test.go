@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/SemenShakhray/list-of-song/internal/auth"
+	"github.com/SemenShakhray/list-of-song/internal/ratelimit"
+
+	"go.uber.org/zap"
+)
+
+func TestWithRateLimit(t *testing.T) {
+	// One request every 2 seconds.
+	l := ratelimit.NewLimiter(0.5, 1)
+	h := WithRateLimit(l, "reads", zap.NewNop())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	request := func(remoteAddr string, principal *auth.Principal) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/songs", nil)
+		r.RemoteAddr = remoteAddr
+		if principal != nil {
+			r = r.WithContext(auth.WithPrincipal(r.Context(), *principal))
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := request("10.0.0.1:1234", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("first request: status = %d, want 200", w.Code)
+	}
+	for name, want := range map[string]string{"RateLimit-Limit": "1", "RateLimit-Remaining": "0", "RateLimit-Reset": "2", "Retry-After": ""} {
+		if got := w.Header().Get(name); got != want {
+			t.Errorf("first request: %s = %q, want %q", name, got, want)
+		}
+	}
+
+	// Another port of the same address is the same client.
+	w = request("10.0.0.1:5678", nil)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("second request: status = %d, want 429", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Retry-After = %q, want the 2 seconds until the next token", got)
+	}
+
+	// Authenticated clients have their own buckets, whatever their address.
+	key := &auth.Principal{Subject: "ci", KeyID: 7}
+	if w := request("10.0.0.1:1234", key); w.Code != http.StatusOK {
+		t.Errorf("API key client: status = %d, want 200", w.Code)
+	}
+	if w := request("10.0.0.2:1234", key); w.Code != http.StatusTooManyRequests {
+		t.Errorf("API key client from another address: status = %d, want 429", w.Code)
+	}
+	if w := request("10.0.0.1:1234", &auth.Principal{Subject: "alice"}); w.Code != http.StatusOK {
+		t.Errorf("JWT client: status = %d, want 200", w.Code)
+	}
+
+	l.SetEnabled(false)
+	if w := request("10.0.0.1:1234", nil); w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "" {
+		t.Errorf("disabled limiter: status = %d with headers %v, want 200 without limit headers", w.Code, w.Header())
+	}
+}
+
+func TestWithIPRateLimit(t *testing.T) {
+	l := ratelimit.NewLimiter(0.5, 1)
+	h := WithIPRateLimit(l, "ip", zap.NewNop())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Credentials do not matter in front of authentication.
+	for i, want := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		r := httptest.NewRequest("GET", "/songs", nil)
+		r.RemoteAddr = "10.0.0.1:1234"
+		r = r.WithContext(auth.WithPrincipal(r.Context(), auth.Principal{Subject: "user", KeyID: i + 1}))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != want {
+			t.Errorf("request %d: status = %d, want %d", i+1, w.Code, want)
+		}
+	}
+}
@@ -6,23 +6,127 @@ import (
 	_ "github.com/SemenShakhray/list-of-song/docs"
 	"github.com/SemenShakhray/list-of-song/internal/api/handlers"
 	"github.com/SemenShakhray/list-of-song/internal/api/middleware"
+	"github.com/SemenShakhray/list-of-song/internal/auth"
+	"github.com/SemenShakhray/list-of-song/internal/metrics"
+	"github.com/SemenShakhray/list-of-song/internal/ratelimit"
 	"github.com/go-chi/chi"
 	httpSwagger "github.com/swaggo/http-swagger/v2"
 )
 
-func NewRouter(h *handlers.Handler) *chi.Mux {
+// Limiters are the rate limiters of the route groups, nil limiters are not applied.
+type Limiters struct {
+	// IP limits every request of an IP address before authentication.
+	IP     *ratelimit.Limiter
+	Reads  *ratelimit.Limiter
+	Writes *ratelimit.Limiter
+	// Enrichment limits requests that call the external API.
+	Enrichment *ratelimit.Limiter
+}
+
+type Options struct {
+	// Auth is nil when authentication is disabled.
+	Auth   *auth.Authenticator
+	Limits Limiters
+	// Metrics is nil when metrics are disabled.
+	Metrics *metrics.Metrics
+	// Tracing starts a span for every request.
+	Tracing bool
+	// CORS is nil when cross-origin requests are not answered.
+	CORS *middleware.CORS
+}
+
+// NewRouter builds the API routes. With authentication enabled every route
+// except the documentation and metrics is protected and needs the permission
+// h.Policy grants for it.
+func NewRouter(h *handlers.Handler, opts Options) *chi.Mux {
 
 	r := chi.NewRouter()
 
+	if opts.Tracing {
+		r.Use(middleware.WithTracing)
+	}
+	if opts.CORS != nil {
+		r.Use(opts.CORS.Handler)
+	}
+	if opts.Metrics != nil {
+		r.Use(middleware.WithMetrics(opts.Metrics))
+	}
+	r.Use(middleware.WithRequestMeta)
 	r.Use(middleware.WithLogging(h.Log))
 
-	r.Put("/songs/{id}", http.HandlerFunc(h.Update))
-	r.Get("/songs", http.HandlerFunc(h.GetAll))
-	r.Get("/songs/{song}", http.HandlerFunc(h.GetText))
-	r.Post("/songs", http.HandlerFunc(h.AddSong))
-	r.Delete("/songs/{id}", http.HandlerFunc(h.Delete))
-
 	r.Get("/swagger/*", httpSwagger.WrapHandler)
+	r.Get("/healthz", http.HandlerFunc(h.Healthz))
+	if h.Health != nil {
+		r.Get("/readyz", http.HandlerFunc(h.Readyz))
+	}
+	if opts.Metrics != nil {
+		r.Handle("/metrics", opts.Metrics.Handler())
+	}
+
+	authn, limits := opts.Auth, opts.Limits
+
+	require := func(perm auth.Permission) func(http.Handler) http.Handler {
+		if authn == nil {
+			return func(next http.Handler) http.Handler { return next }
+		}
+		return middleware.Require(h.Policy, perm, h.Log)
+	}
+	limit := func(l *ratelimit.Limiter, group string) func(http.Handler) http.Handler {
+		if l == nil {
+			return func(next http.Handler) http.Handler { return next }
+		}
+		return middleware.WithRateLimit(l, group, h.Log)
+	}
+	reads := limit(limits.Reads, "reads")
+	writes := limit(limits.Writes, "writes")
+	enrichment := limit(limits.Enrichment, "enrichment")
+
+	r.Group(func(r chi.Router) {
+		if limits.IP != nil {
+			r.Use(middleware.WithIPRateLimit(limits.IP, "ip", h.Log))
+		}
+		if authn != nil {
+			r.Use(middleware.WithAuth(authn, h.Log))
+		}
+
+		r.With(require(auth.PermRead), reads).Get("/songs", http.HandlerFunc(h.GetAll))
+		r.With(require(auth.PermRead), reads).Get("/songs/export", http.HandlerFunc(h.Export))
+		if h.Hub != nil {
+			r.With(require(auth.PermRead), reads).Get("/songs/events", http.HandlerFunc(h.StreamEvents))
+		}
+		r.With(require(auth.PermRead), reads).Get("/songs/{song}", http.HandlerFunc(h.GetText))
+		r.With(require(auth.PermRead), reads).Get("/songs/trash", http.HandlerFunc(h.GetTrash))
+		r.With(require(auth.PermRead), reads).Get("/songs/{id}/history", http.HandlerFunc(h.GetHistory))
+		r.With(require(auth.PermRead), reads).Get("/songs/{id}/history/{rev}", http.HandlerFunc(h.GetRevision))
+		r.With(require(auth.PermRead), reads).Get("/songs/{id}/diff", http.HandlerFunc(h.DiffLyrics))
+
+		r.With(require(auth.PermWrite), writes, enrichment).Post("/songs", http.HandlerFunc(h.AddSong))
+		r.With(require(auth.PermWrite), writes).Put("/songs/{id}", http.HandlerFunc(h.Update))
+		r.With(require(auth.PermWrite), writes).Post("/songs/{id}/restore", http.HandlerFunc(h.Restore))
+		r.With(require(auth.PermWrite), writes).Post("/songs/{id}/history/{rev}/revert", http.HandlerFunc(h.Revert))
+
+		r.With(require(auth.PermDelete), writes).Delete("/songs/{id}", http.HandlerFunc(h.Delete))
+		r.With(require(auth.PermImport), writes).Post("/songs/batch", http.HandlerFunc(h.Batch))
+		r.With(require(auth.PermPurge), writes).Post("/songs/trash/purge", http.HandlerFunc(h.PurgeTrash))
+
+		r.With(require(auth.PermKeys), writes).Post("/admin/api-keys", http.HandlerFunc(h.CreateKey))
+		r.With(require(auth.PermKeys), reads).Get("/admin/api-keys", http.HandlerFunc(h.ListKeys))
+		r.With(require(auth.PermKeys), writes).Delete("/admin/api-keys/{id}", http.HandlerFunc(h.RevokeKey))
+
+		if h.Webhooks != nil {
+			r.With(require(auth.PermWebhooks), writes).Post("/webhooks", http.HandlerFunc(h.CreateWebhook))
+			r.With(require(auth.PermWebhooks), reads).Get("/webhooks", http.HandlerFunc(h.ListWebhooks))
+			r.With(require(auth.PermWebhooks), reads).Get("/webhooks/{id}", http.HandlerFunc(h.GetWebhook))
+			r.With(require(auth.PermWebhooks), writes).Put("/webhooks/{id}", http.HandlerFunc(h.UpdateWebhook))
+			r.With(require(auth.PermWebhooks), writes).Delete("/webhooks/{id}", http.HandlerFunc(h.DeleteWebhook))
+			r.With(require(auth.PermWebhooks), reads).Get("/webhooks/{id}/deliveries", http.HandlerFunc(h.ListDeliveries))
+		}
+
+		if h.Levels != nil {
+			r.With(require(auth.PermLogs), reads).Get("/admin/log-level", http.HandlerFunc(h.GetLogLevel))
+			r.With(require(auth.PermLogs), writes).Put("/admin/log-level", http.HandlerFunc(h.SetLogLevel))
+		}
+	})
 
 	return r
 }
@@ -2,7 +2,7 @@ package app
 
 import (
 	"context"
-	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"net"
@@ -13,73 +13,258 @@ import (
 	"time"
 
 	"github.com/SemenShakhray/list-of-song/internal/api/handlers"
+	"github.com/SemenShakhray/list-of-song/internal/api/middleware"
 	"github.com/SemenShakhray/list-of-song/internal/api/router"
+	"github.com/SemenShakhray/list-of-song/internal/auth"
+	"github.com/SemenShakhray/list-of-song/internal/cache"
 	"github.com/SemenShakhray/list-of-song/internal/config"
+	"github.com/SemenShakhray/list-of-song/internal/enrichment"
+	"github.com/SemenShakhray/list-of-song/internal/health"
+	"github.com/SemenShakhray/list-of-song/internal/metrics"
+	"github.com/SemenShakhray/list-of-song/internal/ratelimit"
 	"github.com/SemenShakhray/list-of-song/internal/service"
 	"github.com/SemenShakhray/list-of-song/internal/storage/postgres"
+	"github.com/SemenShakhray/list-of-song/internal/tracing"
 	"github.com/SemenShakhray/list-of-song/pkg/logger"
-	"github.com/pressly/goose/v3"
 	"go.uber.org/zap"
 )
 
 type App struct {
-	db     *sql.DB
 	server *http.Server
 	Sigint chan os.Signal
 	cfg    config.Config
+	purger *service.Purger
+	// dispatcher is nil when webhooks are disabled.
+	dispatcher *service.Dispatcher
+	outbox     *service.OutboxCleaner
+	// hub is nil when the event stream is disabled.
+	hub       *service.Hub
+	reloader  *Reloader
+	lifecycle *Lifecycle
+	replicas  *postgres.ReplicaSet
 }
 
 func (a *App) Run() error {
 	log.Printf("Server is start: host - %s, port - %s\n", a.cfg.Server.Host, a.cfg.Server.Port)
+
+	a.lifecycle.Go("purger", a.purger.Run)
+	if a.dispatcher != nil {
+		a.lifecycle.Go("webhook dispatcher", a.dispatcher.Run)
+	}
+	a.lifecycle.Go("outbox cleaner", a.outbox.Run)
+	if a.hub != nil {
+		a.lifecycle.Go("event hub", a.hub.Run)
+	}
+	a.lifecycle.Go("config reloader", a.reloader.Run)
+	if a.replicas != nil {
+		a.lifecycle.Go("replica checker", a.replicas.Run)
+	}
+
 	return a.server.ListenAndServe()
 }
 
+// Stop reports the service as not ready, drains in-flight requests, waits for
+// background workers and closes the database last, see Lifecycle.
 func (a *App) Stop() error {
-	a.db.Close()
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-	return a.server.Shutdown(ctx)
+	return a.lifecycle.Shutdown()
 }
 
 func NewApp() (*App, error) {
 
-	cfg := config.Load()
+	cfgOpts := config.Options{EnvFile: "./.env", Args: os.Args[1:]}
+	cfg, err := config.Load(cfgOpts)
+	if err != nil {
+		return nil, err
+	}
 
-	log := logger.NewLogger()
-	if log == nil {
-		return nil, fmt.Errorf("failed to create logger")
+	log, levels, err := logger.New(loggerOptions(cfg.Log))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create logger: %w", err)
 	}
-	log.Info("Created logger")
+	log.Info("Created logger", zap.Stringer("level", levels.Base()))
+	log.Debug("Loaded config", zap.Stringer("config", cfg))
+
+	lifecycle := NewLifecycle(log.Named("lifecycle"), cfg.Server.ShutdownTimeout)
 
-	db, err := postgres.Connect(cfg)
+	reloader, err := NewReloader(cfgOpts, cfg, log.Named("config"))
 	if err != nil {
 		return nil, err
 	}
-	if db == nil {
-		return nil, fmt.Errorf("failed to create DB")
-	}
+	// Levels set with PUT /admin/log-level stay until the file changes them.
+	reloader.OnReload(func(cfg config.Config, changes config.Changes) error {
+		if changes.Reloaded("LOG_LEVEL") {
+			if err := levels.Set("", cfg.Log.Level); err != nil {
+				return err
+			}
+		}
+		if changes.Reloaded("LOG_LEVELS") {
+			return levels.SetPackages(cfg.Log.Levels)
+		}
+		return nil
+	})
 
-	err = goose.Up(db, cfg.Migration.Dir)
+	stopTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
 	if err != nil {
-		return nil, fmt.Errorf("failed to up migration")
+		return nil, err
 	}
+	traced := cfg.Tracing.Exporter != "" && cfg.Tracing.Exporter != tracing.ExporterNone
 
-	log.Info("Connected to database and applied migrations", zap.String("config", cfg.DB.User))
-
-	store := postgres.NewStore(db, log)
+	backend, err := openBackend(cfg, log, lifecycle)
+	if err != nil {
+		return nil, err
+	}
+	store := backend.store
 	if store == nil {
 		return nil, fmt.Errorf("failed to create store")
 	}
 
+	if traced {
+		store = tracing.Storer(store)
+	}
+
+	var m *metrics.Metrics
+	if cfg.Metrics.Enabled {
+		m = metrics.New()
+		m.AddDB(backend.dbName, backend.db)
+		if backend.pool != nil {
+			m.AddPgxPool("songs", backend.pool)
+		}
+		store = metrics.Storer(store, m)
+	}
+
+	// The cache wraps the measured store, so cache hits are not counted as
+	// storage calls. A failing cache server does not fail the readiness: the
+	// reads go to the database then.
+	switch cfg.Cache.Backend {
+	case "memory":
+		store = cache.Storer(store, cache.NewLRU(cfg.Cache.Size), cfg.Cache.TTL, m, log.Named("cache"))
+	case "redis":
+		redis := cache.NewRedis(cfg.Cache.RedisAddr, cfg.Cache.RedisPassword, cfg.Cache.RedisDB)
+		lifecycle.OnShutdown(PhaseClose, "cache", func(context.Context) error {
+			return redis.Close()
+		})
+		store = cache.Storer(store, redis, cfg.Cache.TTL, m, log.Named("cache"))
+	}
+
 	serv := service.NewService(store)
 	if serv == nil {
 		return nil, fmt.Errorf("failed to create server")
 	}
 
-	handler := handlers.NewHandler(log, serv)
+	purger := service.NewPurger(store, log.Named("purger"), cfg.Trash.Retention, cfg.Trash.PurgeInterval)
+
+	keys := service.NewKeyService(backend.keys)
+
+	var dispatcher *service.Dispatcher
+	if cfg.Webhooks.Enabled {
+		dispatcher = service.NewDispatcher(backend.webhooks, log.Named("webhooks"), m, cfg.Webhooks)
+	}
+	// Without a dispatcher nothing takes the events from the outbox, the
+	// cleaner skips them.
+	outbox := service.NewOutboxCleaner(backend.outbox, log.Named("outbox"), cfg.Webhooks.Retention,
+		cfg.Webhooks.PollInterval, !cfg.Webhooks.Enabled)
+
+	var (
+		authn  *auth.Authenticator
+		policy auth.Policy
+	)
+	if cfg.Auth.Enabled {
+		var verifier *auth.JWTVerifier
+		if cfg.Auth.JWTAlg != "" {
+			verifier, err = auth.NewJWTVerifier(cfg.Auth.JWTAlg, cfg.Auth.JWTSecret, cfg.Auth.JWTPublicKeyFile, cfg.Auth.JWTIssuer, cfg.Auth.JWTAudience)
+			if err != nil {
+				return nil, err
+			}
+		}
+		authn = auth.NewAuthenticator(backend.keys, verifier, cfg.Auth.BootstrapKeyHash)
+
+		policy, err = auth.LoadPolicy(cfg.Auth.PolicyFile)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		log.Warn("Authentication is disabled, the API is open to anyone")
+	}
+
+	handler := handlers.NewHandler(log.Named("handlers"), serv, keys)
+	handler.Levels = levels
+	if cfg.Webhooks.Enabled {
+		// Without the dispatcher subscriptions would never get a delivery.
+		handler.Webhooks = service.NewWebhookService(backend.webhooks)
+	}
+	var hub *service.Hub
+	if cfg.Events.Enabled {
+		hub = service.NewHub(backend.events, log.Named("events"), m, cfg.Events.LogSize)
+		handler.Hub = hub
+		handler.Heartbeat = cfg.Events.Heartbeat
+	}
+	handler.Policy = policy
+	handler.Enricher = enrichment.NewClient(cfg.API, m)
+	reloader.OnReload(func(cfg config.Config, _ config.Changes) error {
+		handler.Enricher.Configure(cfg.API)
+		return nil
+	})
 
-	router := router.NewRouter(&handler)
+	checker := health.NewChecker(cfg.Server.ReadyTimeout)
+	checker.Add("database", backend.ping)
+	checker.Add("migrations", backend.migrations)
+	checker.Add("enrichment", func(ctx context.Context) error {
+		if !handler.Enricher.Enabled() {
+			return health.ErrDisabled
+		}
+		return handler.Enricher.Ping(ctx)
+	})
+	handler.Health = checker
+	lifecycle.OnShutdown(PhaseDrain, "readiness", func(ctx context.Context) error {
+		checker.ShutDown()
+		// Give load balancers time to see the failing /readyz before the
+		// listener closes.
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(cfg.Server.ShutdownDelay):
+			return nil
+		}
+	})
+
+	// The limiters always exist, so rate limiting can be turned on by a
+	// config reload.
+	limits := router.Limiters{
+		IP:         ratelimit.NewLimiter(cfg.RateLimit.IP.Rate, cfg.RateLimit.IP.Burst),
+		Reads:      ratelimit.NewLimiter(cfg.RateLimit.Reads.Rate, cfg.RateLimit.Reads.Burst),
+		Writes:     ratelimit.NewLimiter(cfg.RateLimit.Writes.Rate, cfg.RateLimit.Writes.Burst),
+		Enrichment: ratelimit.NewLimiter(cfg.RateLimit.Enrichment.Rate, cfg.RateLimit.Enrichment.Burst),
+	}
+	applyLimits := func(cfg config.Config) error {
+		limits.IP.SetLimit(cfg.RateLimit.IP.Rate, cfg.RateLimit.IP.Burst)
+		limits.Reads.SetLimit(cfg.RateLimit.Reads.Rate, cfg.RateLimit.Reads.Burst)
+		limits.Writes.SetLimit(cfg.RateLimit.Writes.Rate, cfg.RateLimit.Writes.Burst)
+		limits.Enrichment.SetLimit(cfg.RateLimit.Enrichment.Rate, cfg.RateLimit.Enrichment.Burst)
+		limits.IP.SetEnabled(cfg.RateLimit.Enabled)
+		limits.Reads.SetEnabled(cfg.RateLimit.Enabled)
+		limits.Writes.SetEnabled(cfg.RateLimit.Enabled)
+		// Only requests that call the external API are limited by it.
+		limits.Enrichment.SetEnabled(cfg.RateLimit.Enabled && cfg.API.Call)
+		return nil
+	}
+	applyLimits(cfg)
+	reloader.OnReload(func(cfg config.Config, _ config.Changes) error {
+		return applyLimits(cfg)
+	})
+
+	cors := middleware.NewCORS(cfg.CORS)
+	reloader.OnReload(func(cfg config.Config, _ config.Changes) error {
+		cors.Set(cfg.CORS)
+		return nil
+	})
+
+	router := router.NewRouter(&handler, router.Options{
+		Auth:    authn,
+		Limits:  limits,
+		Metrics: m,
+		Tracing: traced,
+		CORS:    cors,
+	})
 	if router == nil {
 		return nil, fmt.Errorf("failed to create router")
 	}
@@ -95,12 +280,57 @@ func NewApp() (*App, error) {
 		IdleTimeout:  cfg.Server.IdleTimeout,
 	}
 
+	lifecycle.OnShutdown(PhaseDrain, "http server", func(ctx context.Context) error {
+		err := server.Shutdown(ctx)
+		if err != nil {
+			// Requests still running after the timeout are cut off.
+			return errors.Join(err, server.Close())
+		}
+		return nil
+	})
+	if hub != nil {
+		// Shutdown waits for the open event streams, they are ended as it
+		// starts and the clients reconnect to another instance.
+		server.RegisterOnShutdown(hub.Close)
+	}
+	lifecycle.OnShutdown(PhaseFlush, "tracing", stopTracing)
+	lifecycle.OnShutdown(PhaseClose, "logger", func(context.Context) error {
+		// Syncing stdout fails on some platforms, it is not worth reporting.
+		_ = log.Sync()
+		return nil
+	})
+
 	log.Info("Created App with server", zap.Any("server", cfg.Server))
 
 	return &App{
-		server: server,
-		db:     db,
-		Sigint: sigint,
-		cfg:    cfg,
+		server:     server,
+		Sigint:     sigint,
+		cfg:        cfg,
+		purger:     purger,
+		dispatcher: dispatcher,
+		outbox:     outbox,
+		hub:        hub,
+		reloader:   reloader,
+		lifecycle:  lifecycle,
+		replicas:   backend.replicas,
 	}, nil
 }
+
+// loggerOptions maps the log configuration to the options of the logger.
+func loggerOptions(cfg config.Log) logger.Options {
+	return logger.Options{
+		Level:   cfg.Level,
+		Levels:  cfg.Levels,
+		Format:  cfg.Format,
+		Outputs: cfg.Outputs,
+		File: logger.File{
+			Path:       cfg.File.Path,
+			MaxSizeMB:  cfg.File.MaxSizeMB,
+			MaxBackups: cfg.File.MaxBackups,
+			MaxAgeDays: cfg.File.MaxAgeDays,
+			Compress:   cfg.File.Compress,
+		},
+		SamplingInitial:    cfg.SamplingInitial,
+		SamplingThereafter: cfg.SamplingThereafter,
+	}
+}
@@ -0,0 +1,142 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Phase orders shutdown hooks, the phases run in the order they are declared.
+type Phase int
+
+const (
+	// PhaseDrain stops accepting traffic and waits for in-flight requests.
+	PhaseDrain Phase = iota
+	// PhaseWorkers runs after the background workers started with Go returned.
+	PhaseWorkers
+	// PhaseFlush flushes buffered telemetry.
+	PhaseFlush
+	// PhaseClose closes connections, the database is closed here so that
+	// nothing still uses it.
+	PhaseClose
+
+	phaseCount
+)
+
+var phaseNames = [phaseCount]string{"drain", "workers", "flush", "close"}
+
+func (p Phase) String() string {
+	return phaseNames[p]
+}
+
+// Hook is called on shutdown, ctx expires when the shutdown timeout is over.
+type Hook func(ctx context.Context) error
+
+type namedHook struct {
+	name string
+	hook Hook
+}
+
+// Lifecycle runs background workers and stops the application in phases:
+// traffic is drained first, then workers are stopped and waited for, and
+// connections are closed last.
+type Lifecycle struct {
+	log     *zap.Logger
+	timeout time.Duration
+
+	mu    sync.Mutex
+	hooks [phaseCount][]namedHook
+
+	// ctx is cancelled when shutdown reaches PhaseWorkers.
+	ctx     context.Context
+	cancel  context.CancelFunc
+	workers sync.WaitGroup
+
+	once sync.Once
+	err  error
+}
+
+// NewLifecycle creates a lifecycle whose shutdown takes at most timeout.
+// Hooks still run after the timeout, with an expired context, so that
+// connections are always closed.
+func NewLifecycle(log *zap.Logger, timeout time.Duration) *Lifecycle {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Lifecycle{
+		log:     log,
+		timeout: timeout,
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// OnShutdown registers a hook. Hooks of one phase run in the order they were
+// registered.
+func (l *Lifecycle) OnShutdown(phase Phase, name string, hook Hook) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.hooks[phase] = append(l.hooks[phase], namedHook{name: name, hook: hook})
+}
+
+// Go runs a background worker. Its context is cancelled on shutdown, which
+// waits for fn to return before PhaseWorkers hooks run.
+func (l *Lifecycle) Go(name string, fn func(ctx context.Context)) {
+	l.workers.Add(1)
+	go func() {
+		defer l.workers.Done()
+		fn(l.ctx)
+		l.log.Debug("Worker stopped", zap.String("worker", name))
+	}()
+}
+
+// Shutdown runs all phases and returns the errors of the hooks. Calling it
+// again returns the result of the first call.
+func (l *Lifecycle) Shutdown() error {
+	l.once.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), l.timeout)
+		defer cancel()
+
+		l.mu.Lock()
+		hooks := l.hooks
+		l.mu.Unlock()
+
+		var errs []error
+		for phase := PhaseDrain; phase < phaseCount; phase++ {
+			if phase == PhaseWorkers {
+				if err := l.stopWorkers(ctx); err != nil {
+					errs = append(errs, err)
+				}
+			}
+			for _, h := range hooks[phase] {
+				start := time.Now()
+				if err := h.hook(ctx); err != nil {
+					l.log.Error("Shutdown hook failed", zap.Stringer("phase", phase), zap.String("hook", h.name), zap.Error(err))
+					errs = append(errs, fmt.Errorf("%s: %w", h.name, err))
+					continue
+				}
+				l.log.Info("Shutdown hook done", zap.Stringer("phase", phase), zap.String("hook", h.name), zap.Duration("duration", time.Since(start)))
+			}
+		}
+		l.err = errors.Join(errs...)
+	})
+	return l.err
+}
+
+func (l *Lifecycle) stopWorkers(ctx context.Context) error {
+	l.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		l.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("background workers did not stop: %w", ctx.Err())
+	}
+}
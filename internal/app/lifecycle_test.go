@@ -0,0 +1,119 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// recorder records the order of shutdown steps.
+type recorder struct {
+	mu    sync.Mutex
+	steps []string
+}
+
+func (r *recorder) add(step string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.steps = append(r.steps, step)
+}
+
+func (r *recorder) hook(step string) Hook {
+	return func(context.Context) error {
+		r.add(step)
+		return nil
+	}
+}
+
+func TestLifecyclePhases(t *testing.T) {
+	l := NewLifecycle(zap.NewNop(), time.Second)
+	var rec recorder
+
+	// Registered out of order, run by phase.
+	l.OnShutdown(PhaseClose, "database", rec.hook("close database"))
+	l.OnShutdown(PhaseWorkers, "workers", rec.hook("after workers"))
+	l.OnShutdown(PhaseFlush, "tracing", rec.hook("flush"))
+	l.OnShutdown(PhaseDrain, "server", rec.hook("drain server"))
+	l.OnShutdown(PhaseDrain, "readiness", rec.hook("drain readiness"))
+	l.OnShutdown(PhaseClose, "cache", rec.hook("close cache"))
+	l.Go("worker", func(ctx context.Context) {
+		<-ctx.Done()
+		rec.add("worker stopped")
+	})
+
+	if err := l.Shutdown(); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	want := []string{
+		"drain server", "drain readiness",
+		"worker stopped", "after workers",
+		"flush",
+		"close database", "close cache",
+	}
+	if !reflect.DeepEqual(rec.steps, want) {
+		t.Errorf("shutdown steps = %q, want %q", rec.steps, want)
+	}
+
+	// A second call does not run the hooks again.
+	if err := l.Shutdown(); err != nil {
+		t.Errorf("second Shutdown: %v", err)
+	}
+	if len(rec.steps) != len(want) {
+		t.Errorf("second Shutdown ran %q", rec.steps[len(want):])
+	}
+}
+
+func TestLifecycleErrors(t *testing.T) {
+	l := NewLifecycle(zap.NewNop(), time.Second)
+	var rec recorder
+	errFlush := errors.New("exporter unreachable")
+
+	l.OnShutdown(PhaseFlush, "tracing", func(context.Context) error { return errFlush })
+	l.OnShutdown(PhaseClose, "database", rec.hook("close database"))
+
+	err := l.Shutdown()
+	if !errors.Is(err, errFlush) || !strings.Contains(err.Error(), "tracing") {
+		t.Errorf("Shutdown = %v, want the error of the tracing hook", err)
+	}
+	// A failing hook does not stop the ones after it.
+	if !reflect.DeepEqual(rec.steps, []string{"close database"}) {
+		t.Errorf("steps after the failure = %q, want the database closed", rec.steps)
+	}
+	if again := l.Shutdown(); again != err {
+		t.Errorf("second Shutdown = %v, want the first result %v", again, err)
+	}
+}
+
+func TestLifecycleTimeout(t *testing.T) {
+	const timeout = 50 * time.Millisecond
+	l := NewLifecycle(zap.NewNop(), timeout)
+	release := make(chan struct{})
+	defer close(release)
+
+	// The worker ignores the cancellation.
+	l.Go("stuck", func(context.Context) { <-release })
+	var closeErr error
+	l.OnShutdown(PhaseClose, "database", func(ctx context.Context) error {
+		closeErr = ctx.Err()
+		return nil
+	})
+
+	start := time.Now()
+	err := l.Shutdown()
+	if elapsed := time.Since(start); elapsed > 10*timeout {
+		t.Errorf("Shutdown took %s, want about the timeout %s", elapsed, timeout)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "workers did not stop") {
+		t.Errorf("Shutdown = %v, want the workers timed out", err)
+	}
+	// Connections are closed after the timeout too, with an expired context.
+	if !errors.Is(closeErr, context.DeadlineExceeded) {
+		t.Errorf("close hook context error = %v, want %v", closeErr, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,144 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/SemenShakhray/list-of-song/internal/config"
+
+	"go.uber.org/zap"
+)
+
+// watchInterval is how often the config file is checked for changes.
+const watchInterval = 2 * time.Second
+
+// Reloader loads the configuration again on SIGHUP or when the config file or
+// the dotenv file changes and applies the settings that can change at
+// runtime. Changed settings that need a restart are logged and otherwise
+// ignored.
+type Reloader struct {
+	opts config.Options
+	// files are the config file and the dotenv file, the ones that are set.
+	files []string
+	log   *zap.Logger
+
+	mu       sync.Mutex
+	current  config.Config
+	appliers []func(config.Config, config.Changes) error
+}
+
+// NewReloader creates a reloader of the configuration cfg was loaded from
+// with opts.
+func NewReloader(opts config.Options, cfg config.Config, log *zap.Logger) (*Reloader, error) {
+	file, err := opts.ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, f := range []string{file, opts.EnvFile} {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+	return &Reloader{opts: opts, files: files, log: log, current: cfg}, nil
+}
+
+// OnReload registers fn to apply a reloaded configuration. fn should read only
+// reloadable settings, the others keep their startup values. changes lists
+// the settings that differ from the running configuration, so fn can leave
+// alone what did not change, such as state changed at runtime through the API.
+func (r *Reloader) OnReload(fn func(cfg config.Config, changes config.Changes) error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.appliers = append(r.appliers, fn)
+}
+
+// Run reloads on SIGHUP and on changes of the files until ctx is cancelled.
+func (r *Reloader) Run(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	modTimes := r.modTimes()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			r.log.Info("Received SIGHUP, reloading configuration")
+		case <-ticker.C:
+			times := r.modTimes()
+			var changed []string
+			for i, t := range times {
+				if !t.Equal(modTimes[i]) {
+					changed = append(changed, r.files[i])
+				}
+			}
+			if len(changed) == 0 {
+				continue
+			}
+			modTimes = times
+			r.log.Info("Config files changed, reloading configuration", zap.Strings("files", changed))
+		}
+		// Failures are logged by Reload, the running configuration stays.
+		_ = r.Reload()
+	}
+}
+
+// modTimes returns the modification times of the files, zero for a missing
+// file.
+func (r *Reloader) modTimes() []time.Time {
+	times := make([]time.Time, len(r.files))
+	for i, file := range r.files {
+		if info, err := os.Stat(file); err == nil {
+			times[i] = info.ModTime()
+		}
+	}
+	return times
+}
+
+// Reload loads the configuration and applies the reloadable settings that
+// changed. An invalid configuration is rejected as a whole.
+func (r *Reloader) Reload() error {
+	next, err := config.Load(r.opts)
+	if err != nil {
+		r.log.Error("Failed to reload configuration, keeping the current one", zap.Error(err))
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	changes := r.current.Diff(next)
+	if len(changes.Static) > 0 {
+		r.log.Warn("Changed settings need a restart to take effect", zap.Strings("settings", changes.Static))
+	}
+	if len(changes.Reloadable) == 0 {
+		r.log.Info("No reloadable settings changed")
+		return nil
+	}
+
+	applied := r.current.Reloadable(next)
+	var errs []error
+	for _, apply := range r.appliers {
+		if err := apply(applied, changes); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		r.log.Error("Failed to apply reloaded settings", zap.Error(err))
+		return err
+	}
+
+	r.current = applied
+	r.log.Info("Configuration reloaded", zap.Strings("settings", changes.Reloadable))
+	return nil
+}
@@ -0,0 +1,148 @@
+package app
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/SemenShakhray/list-of-song/internal/config"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// reloadEnv creates a reloader of a config file with content and returns a
+// function that rewrites the file.
+func reloadEnv(t *testing.T, content string) (*Reloader, config.Config, func(string), *observer.ObservedLogs) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(content string) {
+		t.Helper()
+		// Authentication needs a bootstrap key or JWT, which the tests do
+		// not care about.
+		content = "auth:\n  enabled: false\n" + content
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(content)
+
+	opts := config.Options{
+		File:      path,
+		LookupEnv: func(string) (string, bool) { return "", false },
+	}
+	cfg, err := config.Load(opts)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	core, logs := observer.New(zapcore.InfoLevel)
+	r, err := NewReloader(opts, cfg, zap.New(core))
+	if err != nil {
+		t.Fatalf("NewReloader: %v", err)
+	}
+	return r, cfg, write, logs
+}
+
+// applied records the configurations handed to an applier.
+type applied struct {
+	configs []config.Config
+	changes []config.Changes
+	err     error
+}
+
+func (a *applied) apply(cfg config.Config, changes config.Changes) error {
+	a.configs = append(a.configs, cfg)
+	a.changes = append(a.changes, changes)
+	return a.err
+}
+
+func TestReload(t *testing.T) {
+	r, cfg, write, logs := reloadEnv(t, "api:\n  host: old-api\ndb:\n  host: old-db\n")
+	var a applied
+	r.OnReload(a.apply)
+
+	write("api:\n  host: new-api\ndb:\n  host: new-db\n")
+	if err := r.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if len(a.configs) != 1 {
+		t.Fatalf("applier called %d times, want once", len(a.configs))
+	}
+	got := a.configs[0]
+	if got.API.Host != "new-api" {
+		t.Errorf("applied API_HOST = %q, want new-api", got.API.Host)
+	}
+	// Static settings keep their startup values.
+	if got.DB.Host != cfg.DB.Host {
+		t.Errorf("applied DB_HOST = %q, want the running %q", got.DB.Host, cfg.DB.Host)
+	}
+	want := config.Changes{Reloadable: []string{"API_HOST"}, Static: []string{"DB_HOST"}}
+	if !reflect.DeepEqual(a.changes[0], want) {
+		t.Errorf("changes = %+v, want %+v", a.changes[0], want)
+	}
+	warnings := logs.FilterMessage("Changed settings need a restart to take effect").All()
+	if len(warnings) != 1 || !reflect.DeepEqual(warnings[0].ContextMap()["settings"], []interface{}{"DB_HOST"}) {
+		t.Errorf("restart warnings = %v, want one about DB_HOST", warnings)
+	}
+
+	// Only static changes: nothing to apply.
+	write("api:\n  host: new-api\ndb:\n  host: newer-db\n")
+	if err := r.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if len(a.configs) != 1 {
+		t.Errorf("applier called for static changes only")
+	}
+}
+
+func TestReloadRejectsInvalidConfig(t *testing.T) {
+	r, _, write, _ := reloadEnv(t, "api:\n  host: old-api\n")
+	var a applied
+	r.OnReload(a.apply)
+
+	// The valid reloadable change is not applied either.
+	write("api:\n  host: new-api\nlog:\n  level: loud\n")
+	var verr *config.ValidationError
+	if err := r.Reload(); !errors.As(err, &verr) {
+		t.Fatalf("Reload = %v, want a *config.ValidationError", err)
+	}
+	if len(a.configs) != 0 {
+		t.Errorf("applier called with an invalid config")
+	}
+
+	// The running config is kept, so fixing the file applies the change.
+	write("api:\n  host: new-api\n")
+	if err := r.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if len(a.configs) != 1 || a.configs[0].API.Host != "new-api" {
+		t.Errorf("applied %+v, want API_HOST new-api", a.configs)
+	}
+}
+
+func TestReloadApplierError(t *testing.T) {
+	r, _, write, _ := reloadEnv(t, "api:\n  host: old-api\n")
+	failing := applied{err: errors.New("cannot apply")}
+	var ok applied
+	r.OnReload(failing.apply)
+	r.OnReload(ok.apply)
+
+	write("api:\n  host: new-api\n")
+	if err := r.Reload(); !errors.Is(err, failing.err) {
+		t.Fatalf("Reload = %v, want the applier error", err)
+	}
+	// Every applier runs, and the change is offered again on the next reload.
+	if len(ok.configs) != 1 {
+		t.Errorf("other applier called %d times, want once", len(ok.configs))
+	}
+	failing.err = nil
+	if err := r.Reload(); err != nil {
+		t.Fatalf("second Reload: %v", err)
+	}
+	if len(failing.changes) != 2 || !failing.changes[1].Reloaded("API_HOST") {
+		t.Errorf("changes of the second reload = %+v, want API_HOST again", failing.changes)
+	}
+}
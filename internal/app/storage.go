@@ -0,0 +1,151 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/SemenShakhray/list-of-song/internal/config"
+	"github.com/SemenShakhray/list-of-song/internal/health"
+	"github.com/SemenShakhray/list-of-song/internal/storage"
+	"github.com/SemenShakhray/list-of-song/internal/storage/postgres"
+	"github.com/SemenShakhray/list-of-song/internal/storage/sqlite"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pressly/goose/v3"
+	"go.uber.org/zap"
+)
+
+// backend is the storage of songs, API keys, webhooks and song events
+// selected by DB_BACKEND.
+type backend struct {
+	db *sql.DB
+	// dbName labels the pool metrics of db.
+	dbName string
+	// pool serves the songs instead of db with the pgx backend.
+	pool *pgxpool.Pool
+	// ping checks the connections of the pools in use.
+	ping     health.Check
+	store    storage.Storer
+	keys     storage.KeyStorer
+	webhooks storage.WebhookStorer
+	events   storage.EventStorer
+	outbox   storage.OutboxStorer
+	replicas *postgres.ReplicaSet
+	// migrations fails while the schema is behind the migrations.
+	migrations health.Check
+}
+
+// openBackend connects to the database, applies the migrations and registers
+// closing the connections with lifecycle.
+func openBackend(cfg config.Config, log *zap.Logger, lifecycle *Lifecycle) (backend, error) {
+	isolation, err := storage.ParseIsolation(cfg.DB.TxIsolation)
+	if err != nil {
+		return backend{}, err
+	}
+	txOpts := []storage.TxOption{storage.WithIsolation(isolation), storage.WithRetries(cfg.DB.TxRetries)}
+
+	if cfg.DB.Backend == "sqlite" {
+		return openSQLite(cfg.DB, log.Named("sqlite"), lifecycle, txOpts)
+	}
+	return openPostgres(cfg, log.Named("postgres"), lifecycle, txOpts)
+}
+
+func openSQLite(cfg config.DB, log *zap.Logger, lifecycle *Lifecycle, txOpts []storage.TxOption) (backend, error) {
+	db, err := sqlite.Open(cfg.Path)
+	if err != nil {
+		return backend{}, err
+	}
+	lifecycle.OnShutdown(PhaseClose, "database", func(context.Context) error {
+		return db.Close()
+	})
+
+	if err := sqlite.Migrate(context.Background(), db); err != nil {
+		return backend{}, err
+	}
+	log.Info("Opened database and applied migrations", zap.String("path", cfg.Path))
+
+	return backend{
+		db:       db,
+		dbName:   "songs",
+		ping:     db.PingContext,
+		store:    sqlite.NewStore(db, log, txOpts...),
+		keys:     sqlite.NewKeyStore(db, log),
+		webhooks: sqlite.NewWebhookStore(db, log),
+		events:   sqlite.NewEventStore(db, log),
+		outbox:   sqlite.NewOutboxStore(db, log),
+		migrations: func(ctx context.Context) error {
+			return sqlite.CheckMigrations(ctx, db)
+		},
+	}, nil
+}
+
+func openPostgres(cfg config.Config, log *zap.Logger, lifecycle *Lifecycle, txOpts []storage.TxOption) (backend, error) {
+	db, err := postgres.Connect(context.Background(), cfg.DB, log)
+	if err != nil {
+		return backend{}, err
+	}
+	if db == nil {
+		return backend{}, fmt.Errorf("failed to create DB")
+	}
+	lifecycle.OnShutdown(PhaseClose, "database", func(context.Context) error {
+		return db.Close()
+	})
+
+	err = goose.Up(db, cfg.Migration.Dir)
+	if err != nil {
+		return backend{}, fmt.Errorf("failed to up migration")
+	}
+	log.Info("Connected to database and applied migrations", zap.String("config", cfg.DB.User))
+
+	b := backend{
+		db:       db,
+		dbName:   "songs",
+		ping:     db.PingContext,
+		keys:     postgres.NewKeyStore(db, log),
+		webhooks: postgres.NewWebhookStore(db, log),
+		events:   postgres.NewEventStore(db, log),
+		outbox:   postgres.NewOutboxStore(db, log),
+		migrations: func(ctx context.Context) error {
+			return postgres.CheckMigrations(ctx, db, cfg.Migration.Dir)
+		},
+	}
+
+	switch {
+	case cfg.DB.Backend == "pgx":
+		pool, err := postgres.ConnectPool(context.Background(), cfg.DB, log)
+		if err != nil {
+			return backend{}, err
+		}
+		lifecycle.OnShutdown(PhaseClose, "database pool", func(context.Context) error {
+			pool.Close()
+			return nil
+		})
+		b.store = postgres.NewPgxStore(pool, log, txOpts...)
+		b.pool = pool
+		// The songs go through the pool, the database/sql connections are
+		// left to the migrations, keys, webhooks and events.
+		b.dbName = "songs_sql"
+		b.ping = func(ctx context.Context) error {
+			return errors.Join(pool.Ping(ctx), db.PingContext(ctx))
+		}
+	case len(cfg.DB.Replicas) > 0:
+		replicas := postgres.NewReplicaSet(cfg.DB.ReadYourWritesWindow, cfg.DB.ReplicaCheckInterval, log)
+		lifecycle.OnShutdown(PhaseClose, "replicas", func(context.Context) error {
+			return replicas.Close()
+		})
+		for _, addr := range cfg.DB.Replicas {
+			replicaDB, err := postgres.OpenReplica(cfg.DB, addr)
+			if err != nil {
+				return backend{}, err
+			}
+			replicas.Add(addr, replicaDB)
+		}
+		b.store = postgres.NewReplicatedStore(db, replicas, log, txOpts...)
+		b.replicas = replicas
+	default:
+		b.store = postgres.NewStore(db, log, txOpts...)
+	}
+	return b, nil
+}
@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+const (
+	keyPrefix = "sk_"
+	// keyBytes is the amount of randomness in a generated key.
+	keyBytes = 32
+	// displayPrefixLen is how much of a key is kept in clear to tell keys apart.
+	displayPrefixLen = len(keyPrefix) + 6
+)
+
+// GenerateKey returns a new random API key. Only its hash is ever stored.
+func GenerateKey() (string, error) {
+	b := make([]byte, keyBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	return keyPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashKey returns the hex encoded SHA-256 of key. Keys are random, so a fast
+// hash is enough and allows looking keys up by their hash.
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// KeyPrefix returns the part of key that may be shown to identify it.
+func KeyPrefix(key string) string {
+	if len(key) < displayPrefixLen {
+		return key
+	}
+	return key[:displayPrefixLen]
+}
@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"context"
+	"errors"
+)
+
+// Authentication methods.
+const (
+	MethodAPIKey = "api_key"
+	MethodJWT    = "jwt"
+)
+
+var (
+	ErrNoCredentials      = errors.New("missing credentials")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	Subject string `json:"subject"`
+	Method  string `json:"method"`
+	Roles   []Role `json:"roles"`
+	// KeyID is the id of the API key used, zero for other methods.
+	KeyID int `json:"key_id,omitempty"`
+}
+
+type ctxKey struct{}
+
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, ctxKey{}, p)
+}
+
+// PrincipalFrom returns the principal stored in ctx by the authentication middleware.
+func PrincipalFrom(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(ctxKey{}).(Principal)
+	return p, ok
+}
@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/SemenShakhray/list-of-song/internal/storage"
+)
+
+// BootstrapSubject is the subject of the principal using the bootstrap key.
+const BootstrapSubject = "bootstrap"
+
+// Authenticator identifies callers by API key or JWT bearer token.
+type Authenticator struct {
+	keys storage.KeyStorer
+	// jwt is nil when bearer tokens are not accepted.
+	jwt *JWTVerifier
+	// bootstrapHash is the hash of a static key from the configuration,
+	// used to create the first keys through the admin endpoints.
+	bootstrapHash string
+}
+
+func NewAuthenticator(keys storage.KeyStorer, jwt *JWTVerifier, bootstrapKeyHash string) *Authenticator {
+	return &Authenticator{
+		keys:          keys,
+		jwt:           jwt,
+		bootstrapHash: strings.ToLower(bootstrapKeyHash),
+	}
+}
+
+// Authenticate reads the credentials of r. API keys are accepted in the
+// X-API-Key header or as a bearer token, other bearer tokens must be JWTs.
+func (a *Authenticator) Authenticate(r *http.Request) (Principal, error) {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return a.authenticateKey(r.Context(), key)
+	}
+
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return Principal{}, ErrNoCredentials
+	}
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return Principal{}, fmt.Errorf("%w: unsupported authorization scheme", ErrInvalidCredentials)
+	}
+
+	if strings.HasPrefix(token, keyPrefix) {
+		return a.authenticateKey(r.Context(), token)
+	}
+	if a.jwt == nil {
+		return Principal{}, fmt.Errorf("%w: bearer tokens are not enabled", ErrInvalidCredentials)
+	}
+	return a.jwt.Verify(token)
+}
+
+func (a *Authenticator) authenticateKey(ctx context.Context, key string) (Principal, error) {
+	hash := HashKey(key)
+	if a.bootstrapHash != "" && subtle.ConstantTimeCompare([]byte(hash), []byte(a.bootstrapHash)) == 1 {
+		return Principal{Subject: BootstrapSubject, Method: MethodAPIKey, Roles: []Role{RoleAdmin}}, nil
+	}
+
+	apiKey, err := a.keys.GetAPIKeyByHash(ctx, hash)
+	if err != nil {
+		if errors.Is(err, storage.ErrKeyNotFound) {
+			return Principal{}, fmt.Errorf("%w: unknown API key", ErrInvalidCredentials)
+		}
+		return Principal{}, err
+	}
+	if apiKey.RevokedAt != nil {
+		return Principal{}, fmt.Errorf("%w: API key is revoked", ErrInvalidCredentials)
+	}
+
+	return Principal{Subject: apiKey.Name, Method: MethodAPIKey, Roles: []Role{Role(apiKey.Role)}, KeyID: apiKey.Id}, nil
+}
@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SemenShakhray/list-of-song/internal/models"
+	"github.com/SemenShakhray/list-of-song/internal/storage"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// fakeKeys serves API keys by their hash, err fails every lookup.
+type fakeKeys struct {
+	storage.KeyStorer
+	keys map[string]models.APIKey
+	err  error
+}
+
+func (f *fakeKeys) GetAPIKeyByHash(_ context.Context, hash string) (models.APIKey, error) {
+	if f.err != nil {
+		return models.APIKey{}, f.err
+	}
+	key, ok := f.keys[hash]
+	if !ok {
+		return models.APIKey{}, storage.ErrKeyNotFound
+	}
+	return key, nil
+}
+
+func TestAuthenticator(t *testing.T) {
+	const (
+		editorKey    = "sk_editor"
+		revokedKey   = "sk_revoked"
+		bootstrapKey = "sk_bootstrap"
+	)
+	revokedAt := time.Now()
+	keys := &fakeKeys{keys: map[string]models.APIKey{
+		HashKey(editorKey):  {Id: 7, Name: "ci", Role: string(RoleEditor)},
+		HashKey(revokedKey): {Id: 8, Name: "old", Role: string(RoleAdmin), RevokedAt: &revokedAt},
+	}}
+	verifier, err := NewJWTVerifier("HS256", testSecret, "", "", "")
+	if err != nil {
+		t.Fatalf("NewJWTVerifier: %v", err)
+	}
+	token := sign(t, jwt.SigningMethodHS256, []byte(testSecret), claims(nil))
+
+	// The configured hash may be upper case.
+	withJWT := NewAuthenticator(keys, verifier, strings.ToUpper(HashKey(bootstrapKey)))
+	keysOnly := NewAuthenticator(keys, nil, "")
+
+	editor := Principal{Subject: "ci", Method: MethodAPIKey, Roles: []Role{RoleEditor}, KeyID: 7}
+	for _, tc := range []struct {
+		name    string
+		authn   *Authenticator
+		headers map[string]string
+		want    Principal
+		wantErr error
+	}{
+		{name: "no credentials", authn: withJWT, wantErr: ErrNoCredentials},
+		{name: "X-API-Key", authn: withJWT, headers: map[string]string{"X-API-Key": editorKey}, want: editor},
+		{name: "API key as bearer token", authn: withJWT, headers: map[string]string{"Authorization": "Bearer " + editorKey}, want: editor},
+		{name: "lower case scheme", authn: withJWT, headers: map[string]string{"Authorization": "bearer " + editorKey}, want: editor},
+		{
+			name:    "X-API-Key wins over Authorization",
+			authn:   withJWT,
+			headers: map[string]string{"X-API-Key": editorKey, "Authorization": "Bearer " + token},
+			want:    editor,
+		},
+		{name: "unknown key", authn: withJWT, headers: map[string]string{"X-API-Key": "sk_unknown"}, wantErr: ErrInvalidCredentials},
+		{name: "revoked key", authn: withJWT, headers: map[string]string{"X-API-Key": revokedKey}, wantErr: ErrInvalidCredentials},
+		{
+			name:    "bootstrap key",
+			authn:   withJWT,
+			headers: map[string]string{"X-API-Key": bootstrapKey},
+			want:    Principal{Subject: BootstrapSubject, Method: MethodAPIKey, Roles: []Role{RoleAdmin}},
+		},
+		{name: "bootstrap key not configured", authn: keysOnly, headers: map[string]string{"X-API-Key": bootstrapKey}, wantErr: ErrInvalidCredentials},
+		{name: "basic auth", authn: withJWT, headers: map[string]string{"Authorization": "Basic dXNlcjpwYXNz"}, wantErr: ErrInvalidCredentials},
+		{name: "empty bearer token", authn: withJWT, headers: map[string]string{"Authorization": "Bearer "}, wantErr: ErrInvalidCredentials},
+		{
+			name:    "JWT",
+			authn:   withJWT,
+			headers: map[string]string{"Authorization": "Bearer " + token},
+			want:    Principal{Subject: "alice", Method: MethodJWT, Roles: []Role{RoleEditor}},
+		},
+		{name: "JWT not enabled", authn: keysOnly, headers: map[string]string{"Authorization": "Bearer " + token}, wantErr: ErrInvalidCredentials},
+		{name: "invalid JWT", authn: withJWT, headers: map[string]string{"Authorization": "Bearer " + token + "x"}, wantErr: ErrInvalidCredentials},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/songs", nil)
+			for name, value := range tc.headers {
+				r.Header.Set(name, value)
+			}
+			p, err := tc.authn.Authenticate(r)
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("Authenticate = %+v, %v, want %v", p, err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authenticate: %v", err)
+			}
+			if !reflect.DeepEqual(p, tc.want) {
+				t.Errorf("Authenticate = %+v, want %+v", p, tc.want)
+			}
+		})
+	}
+}
+
+func TestAuthenticatorStoreError(t *testing.T) {
+	// A failing database is not a wrong key, the caller answers 500, not 401.
+	errDB := errors.New("connection refused")
+	authn := NewAuthenticator(&fakeKeys{err: errDB}, nil, "")
+	r := httptest.NewRequest("GET", "/songs", nil)
+	r.Header.Set("X-API-Key", "sk_any")
+
+	_, err := authn.Authenticate(r)
+	if !errors.Is(err, errDB) || errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Authenticate = %v, want the store error", err)
+	}
+}
+
+func TestGenerateKey(t *testing.T) {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	other, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	if !strings.HasPrefix(key, keyPrefix) || key == other {
+		t.Errorf("GenerateKey = %q and %q, want distinct keys starting with %s", key, other, keyPrefix)
+	}
+	if hash := HashKey(key); len(hash) != 64 || hash == HashKey(other) || strings.Contains(hash, key) {
+		t.Errorf("HashKey(%q) = %q, want a distinct 64 digit hex hash", key, hash)
+	}
+	if prefix := KeyPrefix(key); prefix != key[:displayPrefixLen] {
+		t.Errorf("KeyPrefix = %q, want the first %d characters", prefix, displayPrefixLen)
+	}
+}
@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWTVerifier validates HS256 or RS256 bearer tokens.
+type JWTVerifier struct {
+	alg      string
+	key      any
+	issuer   string
+	audience string
+}
+
+// NewJWTVerifier creates a verifier for alg. HS256 uses secret as the shared
+// key, RS256 reads a PEM encoded public key from publicKeyFile. Empty issuer
+// or audience are not checked.
+func NewJWTVerifier(alg, secret, publicKeyFile, issuer, audience string) (*JWTVerifier, error) {
+	v := &JWTVerifier{
+		alg:      strings.ToUpper(alg),
+		issuer:   issuer,
+		audience: audience,
+	}
+
+	switch v.alg {
+	case "HS256":
+		if secret == "" {
+			return nil, fmt.Errorf("HS256 requires a secret")
+		}
+		v.key = []byte(secret)
+	case "RS256":
+		pem, err := os.ReadFile(publicKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JWT public key: %w", err)
+		}
+		key, err := jwt.ParseRSAPublicKeyFromPEM(pem)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse JWT public key: %w", err)
+		}
+		v.key = key
+	default:
+		return nil, fmt.Errorf("unsupported JWT algorithm: %q", alg)
+	}
+	return v, nil
+}
+
+// Verify checks the signature, expiry, issuer and audience of token and
+// returns the principal named by its subject.
+func (v *JWTVerifier) Verify(token string) (Principal, error) {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{v.alg}),
+		jwt.WithExpirationRequired(),
+	}
+	if v.issuer != "" {
+		opts = append(opts, jwt.WithIssuer(v.issuer))
+	}
+	if v.audience != "" {
+		opts = append(opts, jwt.WithAudience(v.audience))
+	}
+
+	var claims tokenClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(*jwt.Token) (any, error) {
+		return v.key, nil
+	}, opts...)
+	if err != nil {
+		return Principal{}, fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+	}
+	if claims.Subject == "" {
+		return Principal{}, fmt.Errorf("%w: token has no subject", ErrInvalidCredentials)
+	}
+
+	return Principal{Subject: claims.Subject, Method: MethodJWT, Roles: claims.Roles}, nil
+}
+
+// tokenClaims are the registered claims and the roles of the subject.
+type tokenClaims struct {
+	jwt.RegisteredClaims
+	Roles []Role `json:"roles"`
+}
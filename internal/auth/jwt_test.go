@@ -0,0 +1,213 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testSecret = "test-secret"
+
+// rsaKey creates an RSA key and writes its public key to a PEM file.
+func rsaKey(t *testing.T) (*rsa.PrivateKey, string, []byte) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	path := filepath.Join(t.TempDir(), "public.pem")
+	if err := os.WriteFile(path, public, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return key, path, public
+}
+
+// claims returns valid claims of the subject alice, changed by edit.
+func claims(edit func(*tokenClaims)) tokenClaims {
+	now := time.Now()
+	c := tokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "alice",
+			Issuer:    "songs-issuer",
+			Audience:  jwt.ClaimStrings{"songs-api"},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+		},
+		Roles: []Role{RoleEditor},
+	}
+	if edit != nil {
+		edit(&c)
+	}
+	return c
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, key any, c tokenClaims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(method, c).SignedString(key)
+	if err != nil {
+		t.Fatalf("sign %s: %v", method.Alg(), err)
+	}
+	return token
+}
+
+func TestJWTVerifier(t *testing.T) {
+	rsaPrivate, publicFile, publicPEM := rsaKey(t)
+	otherPrivate, _, _ := rsaKey(t)
+
+	hs256, err := NewJWTVerifier("HS256", testSecret, "", "songs-issuer", "songs-api")
+	if err != nil {
+		t.Fatalf("NewJWTVerifier(HS256): %v", err)
+	}
+	rs256, err := NewJWTVerifier("rs256", "", publicFile, "songs-issuer", "songs-api")
+	if err != nil {
+		t.Fatalf("NewJWTVerifier(RS256): %v", err)
+	}
+	unchecked, err := NewJWTVerifier("HS256", testSecret, "", "", "")
+	if err != nil {
+		t.Fatalf("NewJWTVerifier(HS256): %v", err)
+	}
+
+	hsKey := []byte(testSecret)
+	for _, tc := range []struct {
+		name     string
+		verifier *JWTVerifier
+		token    string
+		wantErr  bool
+	}{
+		{name: "HS256", verifier: hs256, token: sign(t, jwt.SigningMethodHS256, hsKey, claims(nil))},
+		{name: "RS256", verifier: rs256, token: sign(t, jwt.SigningMethodRS256, rsaPrivate, claims(nil))},
+		{
+			name:     "issuer and audience not checked",
+			verifier: unchecked,
+			token: sign(t, jwt.SigningMethodHS256, hsKey, claims(func(c *tokenClaims) {
+				c.Issuer, c.Audience = "", nil
+			})),
+		},
+		{
+			name:     "alg none",
+			verifier: hs256,
+			token:    sign(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, claims(nil)),
+			wantErr:  true,
+		},
+		{
+			name:     "alg none for RS256",
+			verifier: rs256,
+			token:    sign(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, claims(nil)),
+			wantErr:  true,
+		},
+		{
+			// The classic confusion attack: the public key is known, so it
+			// is used as the HMAC secret.
+			name:     "RS256 switched to HS256 with the public key",
+			verifier: rs256,
+			token:    sign(t, jwt.SigningMethodHS256, publicPEM, claims(nil)),
+			wantErr:  true,
+		},
+		{name: "other HMAC alg", verifier: hs256, token: sign(t, jwt.SigningMethodHS384, hsKey, claims(nil)), wantErr: true},
+		{name: "wrong secret", verifier: hs256, token: sign(t, jwt.SigningMethodHS256, []byte("other"), claims(nil)), wantErr: true},
+		{name: "other RSA key", verifier: rs256, token: sign(t, jwt.SigningMethodRS256, otherPrivate, claims(nil)), wantErr: true},
+		{
+			name:     "expired",
+			verifier: hs256,
+			token: sign(t, jwt.SigningMethodHS256, hsKey, claims(func(c *tokenClaims) {
+				c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+			})),
+			wantErr: true,
+		},
+		{
+			name:     "no expiry",
+			verifier: hs256,
+			token: sign(t, jwt.SigningMethodHS256, hsKey, claims(func(c *tokenClaims) {
+				c.ExpiresAt = nil
+			})),
+			wantErr: true,
+		},
+		{
+			name:     "not valid yet",
+			verifier: hs256,
+			token: sign(t, jwt.SigningMethodHS256, hsKey, claims(func(c *tokenClaims) {
+				c.NotBefore = jwt.NewNumericDate(time.Now().Add(time.Minute))
+			})),
+			wantErr: true,
+		},
+		{
+			name:     "wrong issuer",
+			verifier: hs256,
+			token: sign(t, jwt.SigningMethodHS256, hsKey, claims(func(c *tokenClaims) {
+				c.Issuer = "someone-else"
+			})),
+			wantErr: true,
+		},
+		{
+			name:     "wrong audience",
+			verifier: hs256,
+			token: sign(t, jwt.SigningMethodHS256, hsKey, claims(func(c *tokenClaims) {
+				c.Audience = jwt.ClaimStrings{"other-api"}
+			})),
+			wantErr: true,
+		},
+		{
+			name:     "no subject",
+			verifier: hs256,
+			token: sign(t, jwt.SigningMethodHS256, hsKey, claims(func(c *tokenClaims) {
+				c.Subject = ""
+			})),
+			wantErr: true,
+		},
+		{name: "garbage", verifier: hs256, token: "not.a.token", wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := tc.verifier.Verify(tc.token)
+			if tc.wantErr {
+				if !errors.Is(err, ErrInvalidCredentials) {
+					t.Fatalf("Verify = %+v, %v, want ErrInvalidCredentials", p, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			want := Principal{Subject: "alice", Method: MethodJWT, Roles: []Role{RoleEditor}}
+			if !reflect.DeepEqual(p, want) {
+				t.Errorf("Verify = %+v, want %+v", p, want)
+			}
+		})
+	}
+}
+
+func TestNewJWTVerifierErrors(t *testing.T) {
+	badPEM := filepath.Join(t.TempDir(), "bad.pem")
+	if err := os.WriteFile(badPEM, []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name, alg, secret, file string
+	}{
+		{name: "unknown alg", alg: "ES256", secret: testSecret},
+		{name: "none", alg: "none", secret: testSecret},
+		{name: "HS256 without secret", alg: "HS256"},
+		{name: "RS256 without key file", alg: "RS256", file: filepath.Join(t.TempDir(), "missing.pem")},
+		{name: "RS256 with a bad key", alg: "RS256", file: badPEM},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := NewJWTVerifier(tc.alg, tc.secret, tc.file, "", ""); err == nil {
+				t.Error("NewJWTVerifier succeeded, want an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+)
+
+type Role string
+
+const (
+	RoleViewer Role = "viewer"
+	RoleEditor Role = "editor"
+	RoleAdmin  Role = "admin"
+)
+
+type Permission string
+
+const (
+	PermRead   Permission = "songs:read"
+	PermWrite  Permission = "songs:write"
+	PermDelete Permission = "songs:delete"
+	PermImport Permission = "songs:import"
+	PermPurge  Permission = "trash:purge"
+	PermKeys   Permission = "admin:keys"
+	PermLogs   Permission = "admin:logs"
+	// PermWebhooks manages the webhook subscriptions, which receive every
+	// song change.
+	PermWebhooks Permission = "admin:webhooks"
+)
+
+// Permissions are all the permissions routes are checked against.
+var Permissions = []Permission{PermRead, PermWrite, PermDelete, PermImport, PermPurge, PermKeys, PermLogs, PermWebhooks}
+
+// requiredRoles are the roles the code hands out itself: new API keys get
+// viewer by default and the bootstrap key is admin.
+var requiredRoles = []Role{RoleViewer, RoleAdmin}
+
+// Policy lists the permissions granted to every role.
+type Policy map[Role][]Permission
+
+// DefaultPolicy lets viewers read, editors also create and change songs, and
+// admins do everything else.
+var DefaultPolicy = Policy{
+	RoleViewer: {PermRead},
+	RoleEditor: {PermRead, PermWrite},
+	RoleAdmin:  {PermRead, PermWrite, PermDelete, PermImport, PermPurge, PermKeys, PermLogs, PermWebhooks},
+}
+
+// LoadPolicy reads a policy from a JSON file mapping role names to lists of
+// permissions. An empty path returns DefaultPolicy. A policy with an unknown
+// permission or without the viewer or admin role is rejected.
+func LoadPolicy(path string) (Policy, error) {
+	if path == "" {
+		return DefaultPolicy, nil
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy: %w", err)
+	}
+	var p Policy
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, fmt.Errorf("failed to decode policy: %w", err)
+	}
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("invalid policy %s: %w", path, err)
+	}
+	return p, nil
+}
+
+func (p Policy) validate() error {
+	var errs []error
+	for _, role := range requiredRoles {
+		if !p.ValidRole(role) {
+			errs = append(errs, fmt.Errorf("role %q is missing", role))
+		}
+	}
+	for role, perms := range p {
+		for _, perm := range perms {
+			if !slices.Contains(Permissions, perm) {
+				errs = append(errs, fmt.Errorf("role %q has unknown permission %q", role, perm))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Allows reports whether any of roles is granted perm.
+func (p Policy) Allows(roles []Role, perm Permission) bool {
+	for _, role := range roles {
+		if slices.Contains(p[role], perm) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidRole reports whether role is defined in the policy.
+func (p Policy) ValidRole(role Role) bool {
+	_, ok := p[role]
+	return ok
+}
@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDefaultPolicy(t *testing.T) {
+	granted := map[Role][]Permission{
+		RoleViewer: {PermRead},
+		RoleEditor: {PermRead, PermWrite},
+		RoleAdmin:  Permissions,
+	}
+	for _, role := range []Role{RoleViewer, RoleEditor, RoleAdmin, "guest"} {
+		for _, perm := range Permissions {
+			want := false
+			for _, p := range granted[role] {
+				want = want || p == perm
+			}
+			if got := DefaultPolicy.Allows([]Role{role}, perm); got != want {
+				t.Errorf("%s allowed %s = %v, want %v", role, perm, got, want)
+			}
+		}
+	}
+
+	if err := DefaultPolicy.validate(); err != nil {
+		t.Errorf("default policy is invalid: %v", err)
+	}
+	// Any of the roles is enough.
+	if !DefaultPolicy.Allows([]Role{"guest", RoleViewer}, PermRead) {
+		t.Error("guest and viewer are not allowed to read, want allowed by viewer")
+	}
+	if DefaultPolicy.Allows(nil, PermRead) {
+		t.Error("no roles are allowed to read, want nothing allowed")
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		file    string
+		want    Policy
+		wantErr bool
+	}{
+		{
+			name: "custom roles",
+			file: `{"viewer": [], "auditor": ["songs:read"], "admin": ["songs:read", "admin:keys"]}`,
+			want: Policy{
+				RoleViewer: {},
+				"auditor":  {PermRead},
+				RoleAdmin:  {PermRead, PermKeys},
+			},
+		},
+		{name: "unknown permission", file: `{"viewer": ["songs:read", "songs:fly"], "admin": []}`, wantErr: true},
+		{name: "missing viewer", file: `{"admin": ["songs:read"]}`, wantErr: true},
+		{name: "missing admin", file: `{"viewer": ["songs:read"]}`, wantErr: true},
+		{name: "not a policy", file: `["songs:read"]`, wantErr: true},
+		{name: "broken JSON", file: `{"viewer": [`, wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "policy.json")
+			if err := os.WriteFile(path, []byte(tc.file), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			p, err := LoadPolicy(path)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("LoadPolicy = %v, want an error", p)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadPolicy: %v", err)
+			}
+			if !reflect.DeepEqual(p, tc.want) {
+				t.Errorf("LoadPolicy = %v, want %v", p, tc.want)
+			}
+		})
+	}
+
+	if p, err := LoadPolicy(""); err != nil || !reflect.DeepEqual(p, DefaultPolicy) {
+		t.Errorf("LoadPolicy without a file = %v, %v, want the default policy", p, err)
+	}
+	if _, err := LoadPolicy(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("LoadPolicy of a missing file succeeded, want an error")
+	}
+}
+
+func TestPolicyValidRole(t *testing.T) {
+	p := Policy{RoleViewer: {}, RoleAdmin: {PermRead}}
+	for role, want := range map[Role]bool{RoleViewer: true, RoleAdmin: true, RoleEditor: false, "": false} {
+		if got := p.ValidRole(role); got != want {
+			t.Errorf("ValidRole(%q) = %v, want %v", role, got, want)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+// Package cache keeps the results of song reads so that hot songs are not
+// read from the database on every request. Values live in a Backend: an LRU
+// in the process or a server speaking the Redis protocol shared by all
+// instances.
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// Backend stores opaque values by key. A zero ttl keeps the value until it is
+// deleted or evicted.
+type Backend interface {
+	// Get returns false when there is no value for key.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+}
@@ -0,0 +1,103 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func get(t *testing.T, b Backend, key string) (string, bool) {
+	t.Helper()
+	value, ok, err := b.Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Get(%q): %v", key, err)
+	}
+	return string(value), ok
+}
+
+func set(t *testing.T, b Backend, key, value string, ttl time.Duration) {
+	t.Helper()
+	if err := b.Set(context.Background(), key, []byte(value), ttl); err != nil {
+		t.Fatalf("Set(%q): %v", key, err)
+	}
+}
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewLRU(2)
+	set(t, c, "a", "1", 0)
+	set(t, c, "b", "2", 0)
+	// Reading a makes b the least recently used.
+	if v, ok := get(t, c, "a"); !ok || v != "1" {
+		t.Fatalf("Get(a) = %q, %v, want 1", v, ok)
+	}
+	set(t, c, "c", "3", 0)
+
+	if _, ok := get(t, c, "b"); ok {
+		t.Error("b is still cached, want it evicted")
+	}
+	for key, want := range map[string]string{"a": "1", "c": "3"} {
+		if v, ok := get(t, c, key); !ok || v != want {
+			t.Errorf("Get(%s) = %q, %v, want %q", key, v, ok, want)
+		}
+	}
+	if c.Len() != 2 {
+		t.Errorf("Len = %d, want 2", c.Len())
+	}
+
+	// Replacing a value does not grow the cache.
+	set(t, c, "a", "10", 0)
+	if v, _ := get(t, c, "a"); v != "10" || c.Len() != 2 {
+		t.Errorf("Get(a) = %q with %d values, want 10 with 2", v, c.Len())
+	}
+}
+
+func TestLRUExpiresValues(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	c := NewLRU(10)
+	c.now = func() time.Time { return now }
+
+	set(t, c, "short", "1", time.Second)
+	set(t, c, "forever", "2", 0)
+
+	now = now.Add(999 * time.Millisecond)
+	if _, ok := get(t, c, "short"); !ok {
+		t.Error("value expired before its ttl")
+	}
+	now = now.Add(time.Millisecond)
+	if _, ok := get(t, c, "short"); ok {
+		t.Error("value is still cached after its ttl")
+	}
+	if c.Len() != 1 {
+		t.Errorf("Len = %d, want the expired value dropped", c.Len())
+	}
+
+	now = now.Add(24 * time.Hour)
+	if _, ok := get(t, c, "forever"); !ok {
+		t.Error("value without ttl expired")
+	}
+
+	// Setting a value again restarts its ttl.
+	set(t, c, "short", "3", time.Second)
+	now = now.Add(500 * time.Millisecond)
+	set(t, c, "short", "4", time.Second)
+	now = now.Add(800 * time.Millisecond)
+	if v, ok := get(t, c, "short"); !ok || v != "4" {
+		t.Errorf("Get(short) = %q, %v, want 4", v, ok)
+	}
+}
+
+func TestLRUDelete(t *testing.T) {
+	c := NewLRU(10)
+	set(t, c, "a", "1", 0)
+	set(t, c, "b", "2", 0)
+
+	if err := c.Delete(context.Background(), "a", "missing"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, ok := get(t, c, "a"); ok {
+		t.Error("a is still cached after Delete")
+	}
+	if _, ok := get(t, c, "b"); !ok {
+		t.Error("b was deleted with a")
+	}
+}
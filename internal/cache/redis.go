@@ -0,0 +1,254 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// redisTimeout bounds a command whose context has no deadline.
+	redisTimeout = time.Second
+	// redisMaxIdle connections are kept open between commands.
+	redisMaxIdle = 8
+)
+
+var errRedisClosed = errors.New("redis client is closed")
+
+// RedisError is an error reply of the server.
+type RedisError string
+
+func (e RedisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// Redis is a Backend on a server speaking the Redis protocol (RESP), such as
+// Redis, Valkey or KeyDB. Only the few commands the cache needs are
+// implemented.
+type Redis struct {
+	addr     string
+	password string
+	db       int
+	dialer   net.Dialer
+
+	mu     sync.Mutex
+	idle   []*redisConn
+	closed bool
+}
+
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// NewRedis creates a client of the server at addr. Connections are opened on
+// first use, authenticated with password when it is not empty and switched to
+// database db.
+func NewRedis(addr, password string, db int) *Redis {
+	return &Redis{addr: addr, password: password, db: db}
+}
+
+func (c *Redis) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	reply, err := c.do(ctx, "GET", key)
+	if err != nil {
+		return nil, false, err
+	}
+	if reply == nil {
+		return nil, false, nil
+	}
+	value, ok := reply.([]byte)
+	if !ok {
+		return nil, false, fmt.Errorf("unexpected reply to GET: %v", reply)
+	}
+	return value, true, nil
+}
+
+func (c *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	args := []string{"SET", key, string(value)}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(max(ttl.Milliseconds(), 1), 10))
+	}
+	_, err := c.do(ctx, args...)
+	return err
+}
+
+func (c *Redis) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	_, err := c.do(ctx, append([]string{"DEL"}, keys...)...)
+	return err
+}
+
+// Ping checks that the server answers.
+func (c *Redis) Ping(ctx context.Context) error {
+	_, err := c.do(ctx, "PING")
+	return err
+}
+
+// Close closes the idle connections, connections in use are closed when
+// their command is done.
+func (c *Redis) Close() error {
+	c.mu.Lock()
+	idle := c.idle
+	c.idle, c.closed = nil, true
+	c.mu.Unlock()
+
+	var errs []error
+	for _, conn := range idle {
+		errs = append(errs, conn.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// do runs a command and returns its reply: nil, a string, an int64, a []byte
+// or a []any. An error reply is returned as a RedisError.
+func (c *Redis) do(ctx context.Context, args ...string) (any, error) {
+	conn, err := c.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := conn.do(ctx, args...)
+	var redisErr RedisError
+	if err != nil && !errors.As(err, &redisErr) {
+		// The connection is in an unknown state after an I/O error.
+		conn.Close()
+		return nil, fmt.Errorf("failed to run redis %s: %w", args[0], err)
+	}
+	c.put(conn)
+	return reply, err
+}
+
+func (c *Redis) conn(ctx context.Context) (*redisConn, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, errRedisClosed
+	}
+	if n := len(c.idle); n > 0 {
+		conn := c.idle[n-1]
+		c.idle = c.idle[:n-1]
+		c.mu.Unlock()
+		return conn, nil
+	}
+	c.mu.Unlock()
+
+	netConn, err := c.dialer.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+	conn := &redisConn{Conn: netConn, r: bufio.NewReader(netConn)}
+
+	if c.password != "" {
+		if _, err := conn.do(ctx, "AUTH", c.password); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to authenticate to redis: %w", err)
+		}
+	}
+	if c.db != 0 {
+		if _, err := conn.do(ctx, "SELECT", strconv.Itoa(c.db)); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to select redis database: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+func (c *Redis) put(conn *redisConn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed || len(c.idle) >= redisMaxIdle {
+		conn.Close()
+		return
+	}
+	c.idle = append(c.idle, conn)
+}
+
+func (conn *redisConn) do(ctx context.Context, args ...string) (any, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(redisTimeout)
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	// Commands are sent as arrays of bulk strings.
+	buf := make([]byte, 0, 64)
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(args)), 10)
+	buf = append(buf, "\r\n"...)
+	for _, arg := range args {
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(arg)), 10)
+		buf = append(buf, "\r\n"...)
+		buf = append(buf, arg...)
+		buf = append(buf, "\r\n"...)
+	}
+	if _, err := conn.Write(buf); err != nil {
+		return nil, err
+	}
+	return readReply(conn.r)
+}
+
+func readReply(r *bufio.Reader) (any, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("malformed redis reply %q", line)
+	}
+	kind, line := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return line, nil
+	case '-':
+		return nil, RedisError(line)
+	case ':':
+		return strconv.ParseInt(line, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line)
+		if err != nil || n < -1 {
+			return nil, fmt.Errorf("malformed redis bulk length %q", line)
+		}
+		if n == -1 {
+			return nil, nil
+		}
+		value := make([]byte, n+2)
+		if _, err := io.ReadFull(r, value); err != nil {
+			return nil, err
+		}
+		return value[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line)
+		if err != nil || n < -1 {
+			return nil, fmt.Errorf("malformed redis array length %q", line)
+		}
+		if n == -1 {
+			return nil, nil
+		}
+		items := make([]any, n)
+		for i := range items {
+			items[i], err = readReply(r)
+			var redisErr RedisError
+			if errors.As(err, &redisErr) {
+				// The rest of the array follows an error element.
+				items[i] = redisErr
+			} else if err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("unknown redis reply type %q", kind)
+	}
+}
@@ -0,0 +1,267 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis is a server that speaks enough of the Redis protocol for the
+// client: AUTH, SELECT, PING, GET, SET with PX and DEL.
+type fakeRedis struct {
+	ln       net.Listener
+	password string
+
+	mu       sync.Mutex
+	data     map[string]fakeValue
+	commands []string
+	conns    []net.Conn
+}
+
+type fakeValue struct {
+	value   string
+	expires time.Time
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedis{ln: ln, password: password, data: make(map[string]fakeValue)}
+	t.Cleanup(func() {
+		ln.Close()
+		f.dropConns()
+	})
+	go f.serve()
+	return f
+}
+
+func (f *fakeRedis) addr() string {
+	return f.ln.Addr().String()
+}
+
+func (f *fakeRedis) serve() {
+	for {
+		conn, err := f.ln.Accept()
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		f.conns = append(f.conns, conn)
+		f.mu.Unlock()
+		go f.handle(conn)
+	}
+}
+
+// dropConns closes every open connection, as a restarting server would.
+func (f *fakeRedis) dropConns() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, conn := range f.conns {
+		conn.Close()
+	}
+	f.conns = nil
+}
+
+func (f *fakeRedis) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	authed := f.password == ""
+	for {
+		reply, err := readReply(r)
+		if err != nil {
+			return
+		}
+		items, _ := reply.([]any)
+		args := make([]string, len(items))
+		for i, item := range items {
+			b, _ := item.([]byte)
+			args[i] = string(b)
+		}
+		if len(args) == 0 {
+			return
+		}
+
+		cmd := strings.ToUpper(args[0])
+		f.mu.Lock()
+		f.commands = append(f.commands, cmd)
+		f.mu.Unlock()
+
+		var out string
+		switch {
+		case cmd == "AUTH":
+			if len(args) == 2 && args[1] == f.password {
+				authed = true
+				out = "+OK\r\n"
+			} else {
+				out = "-WRONGPASS invalid password\r\n"
+			}
+		case !authed:
+			out = "-NOAUTH Authentication required.\r\n"
+		case cmd == "SELECT", cmd == "PING" && len(args) == 1:
+			out = "+OK\r\n"
+		case cmd == "GET" && len(args) == 2:
+			out = f.get(args[1])
+		case cmd == "SET" && (len(args) == 3 || len(args) == 5 && strings.ToUpper(args[3]) == "PX"):
+			out = f.set(args)
+		case cmd == "DEL":
+			out = f.del(args[1:])
+		default:
+			out = "-ERR unknown command '" + args[0] + "'\r\n"
+		}
+		if _, err := conn.Write([]byte(out)); err != nil {
+			return
+		}
+	}
+}
+
+func (f *fakeRedis) get(key string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	v, ok := f.data[key]
+	if !ok || !v.expires.IsZero() && !time.Now().Before(v.expires) {
+		return "$-1\r\n"
+	}
+	return fmt.Sprintf("$%d\r\n%s\r\n", len(v.value), v.value)
+}
+
+func (f *fakeRedis) set(args []string) string {
+	v := fakeValue{value: args[2]}
+	if len(args) == 5 {
+		ms, err := strconv.Atoi(args[4])
+		if err != nil || ms <= 0 {
+			return "-ERR invalid expire time in 'set' command\r\n"
+		}
+		v.expires = time.Now().Add(time.Duration(ms) * time.Millisecond)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.data[args[1]] = v
+	return "+OK\r\n"
+}
+
+func (f *fakeRedis) del(keys []string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, key := range keys {
+		if _, ok := f.data[key]; ok {
+			delete(f.data, key)
+			n++
+		}
+	}
+	return ":" + strconv.Itoa(n) + "\r\n"
+}
+
+func (f *fakeRedis) count(cmd string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, c := range f.commands {
+		if c == cmd {
+			n++
+		}
+	}
+	return n
+}
+
+func TestRedis(t *testing.T) {
+	f := newFakeRedis(t, "")
+	c := NewRedis(f.addr(), "", 0)
+	defer c.Close()
+	ctx := context.Background()
+
+	if _, ok := get(t, c, "missing"); ok {
+		t.Error("Get of a missing key found a value")
+	}
+
+	// Values are binary safe.
+	value := "line 1\r\nline 2 $-1 *3 \x00 песня"
+	set(t, c, "song", value, 0)
+	if v, ok := get(t, c, "song"); !ok || v != value {
+		t.Errorf("Get = %q, %v, want %q", v, ok, value)
+	}
+	set(t, c, "empty", "", 0)
+	if v, ok := get(t, c, "empty"); !ok || v != "" {
+		t.Errorf("Get of an empty value = %q, %v, want an empty value", v, ok)
+	}
+
+	set(t, c, "short", "1", 50*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	if _, ok := get(t, c, "short"); ok {
+		t.Error("value is still cached after its ttl")
+	}
+
+	if err := c.Delete(ctx, "song", "empty", "missing"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, ok := get(t, c, "song"); ok {
+		t.Error("value is still cached after Delete")
+	}
+	if err := c.Ping(ctx); err != nil {
+		t.Errorf("Ping: %v", err)
+	}
+
+	// Sequential commands reuse one connection.
+	f.mu.Lock()
+	conns := len(f.conns)
+	f.mu.Unlock()
+	if conns != 1 {
+		t.Errorf("client opened %d connections, want 1", conns)
+	}
+}
+
+func TestRedisErrors(t *testing.T) {
+	f := newFakeRedis(t, "secret")
+	ctx := context.Background()
+
+	bad := NewRedis(f.addr(), "wrong", 0)
+	defer bad.Close()
+	var redisErr RedisError
+	if _, _, err := bad.Get(ctx, "key"); !errors.As(err, &redisErr) || !strings.HasPrefix(string(redisErr), "WRONGPASS") {
+		t.Errorf("Get with a wrong password = %v, want WRONGPASS", err)
+	}
+
+	c := NewRedis(f.addr(), "secret", 2)
+	defer c.Close()
+	set(t, c, "key", "value", 0)
+	if f.count("AUTH") != 2 || f.count("SELECT") != 1 {
+		t.Errorf("AUTH sent %d times and SELECT %d times, want 2 and 1", f.count("AUTH"), f.count("SELECT"))
+	}
+
+	// An error reply leaves the connection usable.
+	if _, err := c.do(ctx, "FLUSHALL"); !errors.As(err, &redisErr) {
+		t.Errorf("unknown command = %v, want an error reply", err)
+	}
+	if v, ok := get(t, c, "key"); !ok || v != "value" {
+		t.Errorf("Get after an error reply = %q, %v, want value", v, ok)
+	}
+
+	// A dropped connection fails one command, the next one reconnects.
+	f.dropConns()
+	if _, _, err := c.Get(ctx, "key"); err == nil {
+		t.Error("Get on a dropped connection succeeded, want an error")
+	}
+	if v, ok := get(t, c, "key"); !ok || v != "value" {
+		t.Errorf("Get after reconnecting = %q, %v, want value", v, ok)
+	}
+
+	c.Close()
+	if _, _, err := c.Get(ctx, "key"); !errors.Is(err, errRedisClosed) {
+		t.Errorf("Get after Close = %v, want %v", err, errRedisClosed)
+	}
+
+	down := NewRedis(f.addr(), "", 0)
+	f.ln.Close()
+	if err := down.Ping(ctx); err == nil {
+		t.Error("Ping of a stopped server succeeded, want an error")
+	}
+}
@@ -0,0 +1,391 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SemenShakhray/list-of-song/internal/metrics"
+	"github.com/SemenShakhray/list-of-song/internal/models"
+	"github.com/SemenShakhray/list-of-song/internal/requestctx"
+	"github.com/SemenShakhray/list-of-song/internal/storage"
+	"github.com/SemenShakhray/list-of-song/pkg/logger"
+
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+)
+
+// Keys of the cached values. Song lists depend on every song, so they are
+// stored under a generation that each write replaces; the lists of older
+// generations are never read again and expire. Texts are stored in full per
+// song and deleted by the writes to that song.
+const (
+	keyGeneration = "songs:generation"
+	keyListPrefix = "songs:list:"
+	keyTextPrefix = "songs:text:"
+)
+
+// allVerses asks the store for the whole text of a song, the pages are cut
+// from the cached text.
+var allVerses = models.Filters{Limit: math.MaxInt32}
+
+// storer serves GetAll and GetText of the wrapped Storer from a Backend.
+// Concurrent misses of the same key share one read of the store.
+type storer struct {
+	next    storage.Storer
+	backend Backend
+	ttl     time.Duration
+	m       *metrics.Metrics
+	logger  *zap.Logger
+	group   *singleflight.Group
+
+	// loads holds the number of the shared read of each key in progress.
+	// invalidate removes the key, so the read knows that what it loaded may be
+	// older than the write.
+	mu    sync.Mutex
+	loads map[string]uint64
+	seq   uint64
+}
+
+// Storer wraps next so that song lists and texts are cached in backend for
+// ttl. Writes through the returned Storer invalidate what they change. m may
+// be nil.
+//
+// Misses are read from the primary database, a lagging replica would put a
+// value older than the last invalidation into the cache. Reads that start
+// after a write do not share a read that started before it, and such an older
+// read drops what it cached.
+func Storer(next storage.Storer, backend Backend, ttl time.Duration, m *metrics.Metrics, log *zap.Logger) storage.Storer {
+	return &storer{next: next, backend: backend, ttl: ttl, m: m, logger: log, group: &singleflight.Group{}, loads: make(map[string]uint64)}
+}
+
+func (s *storer) log(ctx context.Context) *zap.Logger {
+	return logger.FromContext(ctx, s.logger)
+}
+
+func (s *storer) count(method, result string) {
+	if s.m != nil {
+		s.m.CacheRequests.WithLabelValues(method, result).Inc()
+	}
+}
+
+// cached returns the value of key from the backend, or loads it with load and
+// stores it. A failing backend only costs the read of the store.
+func cached[T any](ctx context.Context, s *storer, method, key string, load func(context.Context) (T, error)) (T, error) {
+	value, ok, err := s.backend.Get(ctx, key)
+	if err != nil {
+		s.count(method, "error")
+		s.log(ctx).Warn("Failed to read cache", zap.String("key", key), zap.Error(err))
+	} else if ok {
+		var v T
+		if err := json.Unmarshal(value, &v); err == nil {
+			s.count(method, "hit")
+			return v, nil
+		}
+		s.log(ctx).Warn("Dropping undecodable cache value", zap.String("key", key))
+	} else {
+		s.count(method, "miss")
+	}
+
+	// The shared read must not fail for every caller when the one that
+	// started it goes away, so it does not inherit the cancellation.
+	ch := s.group.DoChan(key, func() (any, error) {
+		ctx := context.WithoutCancel(ctx)
+		n := s.startLoad(key)
+		v, err := load(requestctx.WithPrimary(ctx))
+		if err != nil {
+			s.endLoad(key, n)
+			return v, err
+		}
+		if value, err := json.Marshal(v); err == nil {
+			if err := s.backend.Set(ctx, key, value, s.ttl); err != nil {
+				s.log(ctx).Warn("Failed to write cache", zap.String("key", key), zap.Error(err))
+			}
+		}
+		// A write invalidated the key during the read. Its Delete may have
+		// come before the Set above, so the value is deleted again.
+		if !s.endLoad(key, n) {
+			if err := s.backend.Delete(ctx, key); err != nil {
+				s.log(ctx).Error("Failed to drop outdated cache value", zap.String("key", key), zap.Error(err))
+			}
+		}
+		return v, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	case res := <-ch:
+		v, _ := res.Val.(T)
+		return v, res.Err
+	}
+}
+
+// startLoad registers a shared read of key and returns its number.
+func (s *storer) startLoad(key string) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	s.loads[key] = s.seq
+	return s.seq
+}
+
+// endLoad unregisters the read n of key and reports whether key was not
+// invalidated while it ran.
+func (s *storer) endLoad(key string, n uint64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.loads[key] != n {
+		return false
+	}
+	delete(s.loads, key)
+	return true
+}
+
+// forget makes the reads of keys in progress outdated, the next reads of keys
+// start their own.
+func (s *storer) forget(keys ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		delete(s.loads, key)
+		s.group.Forget(key)
+	}
+}
+
+// generation returns the current generation of the song lists, starting a new
+// one when there is none.
+func (s *storer) generation(ctx context.Context) (string, error) {
+	gen, ok, err := s.backend.Get(ctx, keyGeneration)
+	if err != nil {
+		return "", err
+	}
+	if ok {
+		return string(gen), nil
+	}
+	return s.newGeneration(ctx)
+}
+
+func (s *storer) newGeneration(ctx context.Context) (string, error) {
+	gen := strconv.FormatInt(time.Now().UnixNano(), 36) + strconv.FormatUint(uint64(rand.Uint32()), 36)
+	if err := s.backend.Set(ctx, keyGeneration, []byte(gen), 0); err != nil {
+		return "", err
+	}
+	return gen, nil
+}
+
+func listKey(gen string, filters models.Filters) string {
+	b, _ := json.Marshal(filters)
+	sum := sha256.Sum256(b)
+	return keyListPrefix + gen + ":" + hex.EncodeToString(sum[:])
+}
+
+func textKey(id int) string {
+	return keyTextPrefix + strconv.Itoa(id)
+}
+
+// invalidate drops the song lists and the texts of ids after a write.
+func (s *storer) invalidate(ctx context.Context, ids ...int) {
+	if _, err := s.newGeneration(ctx); err != nil {
+		s.log(ctx).Error("Failed to invalidate cached song lists", zap.Error(err))
+	}
+	if len(ids) == 0 {
+		return
+	}
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = textKey(id)
+	}
+	s.forget(keys...)
+	if err := s.backend.Delete(ctx, keys...); err != nil {
+		s.log(ctx).Error("Failed to invalidate cached song texts", zap.Ints("songs", ids), zap.Error(err))
+	}
+}
+
+func (s *storer) GetAll(ctx context.Context, filters models.Filters) ([]models.Song, error) {
+	gen, err := s.generation(ctx)
+	if err != nil {
+		s.count("GetAll", "error")
+		s.log(ctx).Warn("Failed to read cache", zap.String("key", keyGeneration), zap.Error(err))
+		return s.next.GetAll(ctx, filters)
+	}
+	return cached(ctx, s, "GetAll", listKey(gen, filters), func(ctx context.Context) ([]models.Song, error) {
+		return s.next.GetAll(ctx, filters)
+	})
+}
+
+func (s *storer) GetText(ctx context.Context, filters models.Filters, id int) (string, error) {
+	text, err := cached(ctx, s, "GetText", textKey(id), func(ctx context.Context) (string, error) {
+		return s.next.GetText(ctx, allVerses, id)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	verses := strings.Split(text, "\n")
+	if filters.Offset >= len(verses) {
+		return "", nil
+	}
+	end := min(filters.Offset+filters.Limit, len(verses))
+	return strings.Join(verses[filters.Offset:end], "\n"), nil
+}
+
+func (s *storer) AddSong(ctx context.Context, song models.Song) error {
+	if err := s.next.AddSong(ctx, song); err != nil {
+		return err
+	}
+	s.invalidate(ctx)
+	return nil
+}
+
+func (s *storer) Update(ctx context.Context, song models.Song) error {
+	if err := s.next.Update(ctx, song); err != nil {
+		return err
+	}
+	s.invalidate(ctx, song.Id)
+	return nil
+}
+
+func (s *storer) Delete(ctx context.Context, id int) error {
+	if err := s.next.Delete(ctx, id); err != nil {
+		return err
+	}
+	s.invalidate(ctx, id)
+	return nil
+}
+
+func (s *storer) Restore(ctx context.Context, id int) error {
+	if err := s.next.Restore(ctx, id); err != nil {
+		return err
+	}
+	s.invalidate(ctx, id)
+	return nil
+}
+
+func (s *storer) Revert(ctx context.Context, id int, revision int) error {
+	if err := s.next.Revert(ctx, id, revision); err != nil {
+		return err
+	}
+	s.invalidate(ctx, id)
+	return nil
+}
+
+// Export, the trash and the history are not cached, purged songs are
+// already out of the cache since they were deleted.
+func (s *storer) Export(ctx context.Context, filters models.Filters, fn func(models.Song) error) error {
+	return s.next.Export(ctx, filters, fn)
+}
+
+func (s *storer) GetTrash(ctx context.Context, filters models.Filters) ([]models.Song, error) {
+	return s.next.GetTrash(ctx, filters)
+}
+
+func (s *storer) Purge(ctx context.Context, before time.Time) (int64, error) {
+	return s.next.Purge(ctx, before)
+}
+
+func (s *storer) GetHistory(ctx context.Context, id int, limit, offset int) ([]models.Revision, error) {
+	return s.next.GetHistory(ctx, id, limit, offset)
+}
+
+func (s *storer) GetRevision(ctx context.Context, id int, revision int) (models.Revision, error) {
+	return s.next.GetRevision(ctx, id, revision)
+}
+
+// WithTx reads from the store inside the transaction, so fn sees its own
+// writes, and invalidates what the transaction changed once it is committed.
+func (s *storer) WithTx(ctx context.Context, fn func(storage.Storer) error, opts ...storage.TxOption) error {
+	var writes txWrites
+	err := s.next.WithTx(ctx, func(tx storage.Storer) error {
+		return fn(&txStorer{Storer: tx, writes: &writes})
+	}, opts...)
+	if err != nil {
+		return err
+	}
+	if ids, ok := writes.take(); ok {
+		s.invalidate(ctx, ids...)
+	}
+	return nil
+}
+
+// txWrites collects the songs written in a transaction. The transaction may
+// be retried, so it can collect the same song more than once.
+type txWrites struct {
+	mu    sync.Mutex
+	wrote bool
+	ids   []int
+}
+
+func (w *txWrites) add(ids ...int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.wrote = true
+	w.ids = append(w.ids, ids...)
+}
+
+func (w *txWrites) take() ([]int, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.ids, w.wrote
+}
+
+// txStorer records the writes made through a transaction Storer.
+type txStorer struct {
+	storage.Storer
+	writes *txWrites
+}
+
+func (s *txStorer) AddSong(ctx context.Context, song models.Song) error {
+	if err := s.Storer.AddSong(ctx, song); err != nil {
+		return err
+	}
+	s.writes.add()
+	return nil
+}
+
+func (s *txStorer) Update(ctx context.Context, song models.Song) error {
+	if err := s.Storer.Update(ctx, song); err != nil {
+		return err
+	}
+	s.writes.add(song.Id)
+	return nil
+}
+
+func (s *txStorer) Delete(ctx context.Context, id int) error {
+	if err := s.Storer.Delete(ctx, id); err != nil {
+		return err
+	}
+	s.writes.add(id)
+	return nil
+}
+
+func (s *txStorer) Restore(ctx context.Context, id int) error {
+	if err := s.Storer.Restore(ctx, id); err != nil {
+		return err
+	}
+	s.writes.add(id)
+	return nil
+}
+
+func (s *txStorer) Revert(ctx context.Context, id int, revision int) error {
+	if err := s.Storer.Revert(ctx, id, revision); err != nil {
+		return err
+	}
+	s.writes.add(id)
+	return nil
+}
+
+// WithTx joins the transaction, which the wrapped Storer does as well.
+func (s *txStorer) WithTx(ctx context.Context, fn func(storage.Storer) error, opts ...storage.TxOption) error {
+	return s.Storer.WithTx(ctx, func(tx storage.Storer) error {
+		return fn(&txStorer{Storer: tx, writes: s.writes})
+	}, opts...)
+}
@@ -0,0 +1,381 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SemenShakhray/list-of-song/internal/metrics"
+	"github.com/SemenShakhray/list-of-song/internal/models"
+	"github.com/SemenShakhray/list-of-song/internal/requestctx"
+	"github.com/SemenShakhray/list-of-song/internal/storage"
+	"github.com/SemenShakhray/list-of-song/internal/storage/sqlite"
+	"github.com/SemenShakhray/list-of-song/internal/storage/storetest"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+)
+
+// TestConformance checks that the cache does not change what the store
+// returns, in particular that writes are visible to the next read.
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) storage.Storer {
+		db, err := sqlite.Open(filepath.Join(t.TempDir(), "songs.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		if err := sqlite.Migrate(context.Background(), db); err != nil {
+			t.Fatal(err)
+		}
+		return Storer(sqlite.NewStore(db, zap.NewNop()), NewLRU(1000), time.Minute, nil, zap.NewNop())
+	})
+}
+
+// countingStore serves one song and counts the reads that reach it, under
+// "replica" also the ones that did not ask for the primary database.
+type countingStore struct {
+	storage.Storer
+
+	mu    sync.Mutex
+	text  string
+	reads map[string]int
+	// release blocks GetText after it read the text until it is closed, when
+	// it is not nil.
+	release chan struct{}
+}
+
+func newCountingStore(text string) *countingStore {
+	return &countingStore{text: text, reads: make(map[string]int)}
+}
+
+func (s *countingStore) count(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reads[method]
+}
+
+func (s *countingStore) GetAll(ctx context.Context, filters models.Filters) ([]models.Song, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reads["GetAll"]++
+	if !requestctx.Primary(ctx) {
+		s.reads["replica"]++
+	}
+	return []models.Song{{Id: 1, Song: "Song", Group: "Group", Text: s.text}}, nil
+}
+
+func (s *countingStore) GetText(ctx context.Context, filters models.Filters, id int) (string, error) {
+	s.mu.Lock()
+	s.reads["GetText"]++
+	if !requestctx.Primary(ctx) {
+		s.reads["replica"]++
+	}
+	text := s.text
+	s.mu.Unlock()
+
+	if s.release != nil {
+		<-s.release
+	}
+	if id != 1 {
+		return "", errors.New("song not found")
+	}
+	verses := strings.Split(text, "\n")
+	end := min(filters.Offset+filters.Limit, len(verses))
+	return strings.Join(verses[filters.Offset:end], "\n"), nil
+}
+
+func (s *countingStore) Update(ctx context.Context, song models.Song) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.text = song.Text
+	return nil
+}
+
+func (s *countingStore) AddSong(ctx context.Context, song models.Song) error {
+	return nil
+}
+
+func (s *countingStore) WithTx(ctx context.Context, fn func(storage.Storer) error, opts ...storage.TxOption) error {
+	return fn(s)
+}
+
+func TestStorerCachesReads(t *testing.T) {
+	ctx := context.Background()
+	next := newCountingStore("one\ntwo\nthree")
+	m := metrics.New()
+	s := Storer(next, NewLRU(100), time.Minute, m, zap.NewNop())
+
+	for i := 0; i < 3; i++ {
+		if _, err := s.GetAll(ctx, models.Filters{Limit: 10}); err != nil {
+			t.Fatalf("GetAll: %v", err)
+		}
+	}
+	if _, err := s.GetAll(ctx, models.Filters{Limit: 10, Offset: 10}); err != nil {
+		t.Fatalf("GetAll: %v", err)
+	}
+	if n := next.count("GetAll"); n != 2 {
+		t.Errorf("store read %d lists, want one per distinct filters", n)
+	}
+
+	// Pages of the text are cut from the cached whole text.
+	for _, tt := range []struct {
+		filters models.Filters
+		want    string
+	}{
+		{models.Filters{Limit: 2}, "one\ntwo"},
+		{models.Filters{Limit: 2, Offset: 2}, "three"},
+		{models.Filters{Limit: 2, Offset: 3}, ""},
+	} {
+		text, err := s.GetText(ctx, tt.filters, 1)
+		if err != nil {
+			t.Fatalf("GetText: %v", err)
+		}
+		if text != tt.want {
+			t.Errorf("GetText(%+v) = %q, want %q", tt.filters, text, tt.want)
+		}
+	}
+	if n := next.count("GetText"); n != 1 {
+		t.Errorf("store read the text %d times, want once", n)
+	}
+
+	// Errors are not cached.
+	for i := 0; i < 2; i++ {
+		if _, err := s.GetText(ctx, models.Filters{Limit: 2}, 2); err == nil {
+			t.Fatal("GetText of a missing song succeeded, want an error")
+		}
+	}
+	if n := next.count("GetText"); n != 3 {
+		t.Errorf("store read texts %d times, want every read of the missing song", n)
+	}
+	// A replica behind the primary would cache what was just invalidated.
+	if n := next.count("replica"); n != 0 {
+		t.Errorf("%d misses were read from a replica, want all from the primary", n)
+	}
+
+	for _, tt := range []struct {
+		method, result string
+		want           float64
+	}{
+		{"GetAll", "hit", 2},
+		{"GetAll", "miss", 2},
+		{"GetText", "hit", 2},
+		{"GetText", "miss", 3},
+	} {
+		if got := testutil.ToFloat64(m.CacheRequests.WithLabelValues(tt.method, tt.result)); got != tt.want {
+			t.Errorf("%s %s = %v, want %v", tt.method, tt.result, got, tt.want)
+		}
+	}
+}
+
+func TestStorerInvalidatesOnWrites(t *testing.T) {
+	ctx := context.Background()
+	next := newCountingStore("old")
+	s := Storer(next, NewLRU(100), time.Minute, nil, zap.NewNop())
+
+	read := func() (string, string) {
+		t.Helper()
+		songs, err := s.GetAll(ctx, models.Filters{Limit: 10})
+		if err != nil {
+			t.Fatalf("GetAll: %v", err)
+		}
+		text, err := s.GetText(ctx, models.Filters{Limit: 10}, 1)
+		if err != nil {
+			t.Fatalf("GetText: %v", err)
+		}
+		return songs[0].Text, text
+	}
+
+	read()
+	if err := s.Update(ctx, models.Song{Id: 1, Text: "new"}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if list, text := read(); list != "new" || text != "new" {
+		t.Errorf("after Update the list has %q and the text is %q, want both new", list, text)
+	}
+
+	// Adding a song drops the lists but keeps the texts.
+	lists, texts := next.count("GetAll"), next.count("GetText")
+	if err := s.AddSong(ctx, models.Song{Song: "Other", Group: "Group"}); err != nil {
+		t.Fatalf("AddSong: %v", err)
+	}
+	read()
+	if next.count("GetAll") != lists+1 || next.count("GetText") != texts {
+		t.Errorf("after AddSong the store read %d lists and %d texts, want 1 and 0",
+			next.count("GetAll")-lists, next.count("GetText")-texts)
+	}
+
+	// Writes in a transaction invalidate once it is committed.
+	err := s.WithTx(ctx, func(tx storage.Storer) error {
+		return tx.Update(ctx, models.Song{Id: 1, Text: "in tx"})
+	})
+	if err != nil {
+		t.Fatalf("WithTx: %v", err)
+	}
+	if list, text := read(); list != "in tx" || text != "in tx" {
+		t.Errorf("after the transaction the list has %q and the text is %q, want both in tx", list, text)
+	}
+}
+
+func TestStorerReadDuringWrite(t *testing.T) {
+	ctx := context.Background()
+	next := newCountingStore("old")
+	next.release = make(chan struct{})
+	s := Storer(next, NewLRU(100), time.Minute, nil, zap.NewNop())
+
+	getText := func(texts chan<- string) {
+		text, err := s.GetText(ctx, models.Filters{Limit: 10}, 1)
+		if err != nil {
+			t.Errorf("GetText: %v", err)
+		}
+		texts <- text
+	}
+	waitReads := func(n int) {
+		t.Helper()
+		for deadline := time.Now().Add(time.Second); next.count("GetText") < n; {
+			if time.Now().After(deadline) {
+				t.Fatalf("store got %d reads of the text, want %d", next.count("GetText"), n)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// The first read loads the old text and is still running when the
+	// update is written.
+	before := make(chan string, 1)
+	go getText(before)
+	waitReads(1)
+	if err := s.Update(ctx, models.Song{Id: 1, Text: "new"}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	// A read after the update does not wait for the outdated one.
+	after := make(chan string, 1)
+	go getText(after)
+	waitReads(2)
+	close(next.release)
+
+	if text := <-before; text != "old" {
+		t.Errorf("read started before the update got %q, want old", text)
+	}
+	if text := <-after; text != "new" {
+		t.Errorf("read started after the update got %q, want new", text)
+	}
+	// The outdated read did not leave the old text in the cache.
+	if text, err := s.GetText(ctx, models.Filters{Limit: 10}, 1); err != nil || text != "new" {
+		t.Errorf("GetText after both reads = %q, %v, want new", text, err)
+	}
+}
+
+func TestStorerSharesMisses(t *testing.T) {
+	ctx := context.Background()
+	next := newCountingStore("text")
+	next.release = make(chan struct{})
+	s := Storer(next, NewLRU(100), time.Minute, nil, zap.NewNop())
+
+	const readers = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, readers)
+	for i := 0; i < readers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			text, err := s.GetText(ctx, models.Filters{Limit: 10}, 1)
+			if err == nil && text != "text" {
+				err = errors.New("got text " + text)
+			}
+			errs <- err
+		}()
+	}
+	// Readers that come after the shared read find the text in the cache.
+	time.Sleep(50 * time.Millisecond)
+	close(next.release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("GetText: %v", err)
+		}
+	}
+	if n := next.count("GetText"); n != 1 {
+		t.Errorf("store read the text %d times for %d concurrent readers, want once", n, readers)
+	}
+}
+
+func TestStorerCancelledReader(t *testing.T) {
+	next := newCountingStore("text")
+	next.release = make(chan struct{})
+	s := Storer(next, NewLRU(100), time.Minute, nil, zap.NewNop())
+
+	// The reader that starts the shared read gives up, the others still get
+	// the text.
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := s.GetText(ctx, models.Filters{Limit: 10}, 1)
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled GetText = %v, want %v", err, context.Canceled)
+	}
+
+	go func() {
+		_, err := s.GetText(context.Background(), models.Filters{Limit: 10}, 1)
+		done <- err
+	}()
+	close(next.release)
+	if err := <-done; err != nil {
+		t.Errorf("GetText: %v", err)
+	}
+	if n := next.count("GetText"); n != 1 {
+		t.Errorf("store read the text %d times, want once", n)
+	}
+}
+
+// failingBackend is a cache server that is down.
+type failingBackend struct{}
+
+var errDown = errors.New("connection refused")
+
+func (failingBackend) Get(context.Context, string) ([]byte, bool, error) {
+	return nil, false, errDown
+}
+
+func (failingBackend) Set(context.Context, string, []byte, time.Duration) error {
+	return errDown
+}
+
+func (failingBackend) Delete(context.Context, ...string) error {
+	return errDown
+}
+
+func TestStorerBackendDown(t *testing.T) {
+	ctx := context.Background()
+	next := newCountingStore("text")
+	m := metrics.New()
+	s := Storer(next, failingBackend{}, time.Minute, m, zap.NewNop())
+
+	if _, err := s.GetAll(ctx, models.Filters{Limit: 10}); err != nil {
+		t.Errorf("GetAll: %v", err)
+	}
+	if text, err := s.GetText(ctx, models.Filters{Limit: 10}, 1); err != nil || text != "text" {
+		t.Errorf("GetText = %q, %v, want the text from the store", text, err)
+	}
+	if err := s.Update(ctx, models.Song{Id: 1, Text: "new"}); err != nil {
+		t.Errorf("Update: %v", err)
+	}
+
+	for _, method := range []string{"GetAll", "GetText"} {
+		if got := testutil.ToFloat64(m.CacheRequests.WithLabelValues(method, "error")); got != 1 {
+			t.Errorf("%s errors = %v, want 1", method, got)
+		}
+	}
+}
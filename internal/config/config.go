@@ -1,95 +1,350 @@
 package config
 
 import (
-	"log"
-	"os"
-	"strconv"
 	"time"
-
-	"github.com/goloop/env"
 )
 
+// Config is the service configuration. Load fills it from, in increasing
+// priority, Default, a YAML or TOML file, environment variables and command
+// line flags.
+//
+// Every setting has a file key, given by the yaml and toml tags, and an
+// environment variable, given by the env tag. The env tag of a nested struct
+// is a prefix of the variables of its fields. The flag of a setting is its
+// variable in lower case with dashes, e.g. --db-host for DB_HOST. Settings
+// tagged secret are redacted when the config is printed, settings tagged
+// reload can change while the service runs, see Reloadable. The reload tag of
+// a nested struct applies to all its fields.
 type Config struct {
-	DB        DB
-	API       API
-	Server    Server
-	Migration Migration
+	DB        DB        `yaml:"db" toml:"db"`
+	API       API       `yaml:"api" toml:"api"`
+	Server    Server    `yaml:"server" toml:"server"`
+	Migration Migration `yaml:"migration" toml:"migration"`
+	Trash     Trash     `yaml:"trash" toml:"trash"`
+	Auth      Auth      `yaml:"auth" toml:"auth"`
+	RateLimit RateLimit `yaml:"rate_limit" toml:"rate_limit"`
+	Cache     Cache     `yaml:"cache" toml:"cache"`
+	Webhooks  Webhooks  `yaml:"webhooks" toml:"webhooks"`
+	Events    Events    `yaml:"events" toml:"events"`
+	Metrics   Metrics   `yaml:"metrics" toml:"metrics"`
+	Tracing   Tracing   `yaml:"tracing" toml:"tracing"`
+	Log       Log       `yaml:"log" toml:"log"`
+	CORS      CORS      `yaml:"cors" toml:"cors" reload:"true"`
 }
 
 type DB struct {
-	Host string
-	Port string
-	User string
-	Pass string
-	Name string
+	// Backend is the driver of the song storage: sql for database/sql with the
+	// pgx shim, pgx for a native pgx pool with prepared statements, or sqlite
+	// for an embedded database file that needs no server.
+	Backend string `yaml:"backend" toml:"backend" env:"DB_BACKEND"`
+	// Path is the database file of the sqlite backend.
+	Path string `yaml:"path" toml:"path" env:"DB_PATH"`
+
+	Host string `yaml:"host" toml:"host" env:"DB_HOST"`
+	Port string `yaml:"port" toml:"port" env:"DB_PORT"`
+	User string `yaml:"user" toml:"user" env:"DB_USER"`
+	Pass string `yaml:"pass" toml:"pass" env:"DB_PASS" secret:"true"`
+	Name string `yaml:"name" toml:"name" env:"DB_NAME"`
+	// TxIsolation is the default isolation level of storage transactions, empty for the database default.
+	TxIsolation string `yaml:"tx_isolation" toml:"tx_isolation" env:"DB_TX_ISOLATION"`
+	// TxRetries is how many times a transaction is retried after a serialization failure.
+	TxRetries int `yaml:"tx_retries" toml:"tx_retries" env:"DB_TX_RETRIES"`
+
+	// SSLMode is disable, allow, prefer, require, verify-ca or verify-full.
+	SSLMode string `yaml:"sslmode" toml:"sslmode" env:"DB_SSLMODE"`
+	// SSLRootCert is the CA certificate the server certificate is verified with.
+	SSLRootCert string `yaml:"sslrootcert" toml:"sslrootcert" env:"DB_SSLROOTCERT"`
+	// SSLCert and SSLKey are the client certificate and its key.
+	SSLCert string `yaml:"sslcert" toml:"sslcert" env:"DB_SSLCERT"`
+	SSLKey  string `yaml:"sslkey" toml:"sslkey" env:"DB_SSLKEY"`
+	// ApplicationName is shown in pg_stat_activity.
+	ApplicationName string `yaml:"application_name" toml:"application_name" env:"DB_APPLICATION_NAME"`
+	// StatementTimeout aborts statements running longer, zero means no limit.
+	StatementTimeout time.Duration `yaml:"statement_timeout" toml:"statement_timeout" env:"DB_STATEMENT_TIMEOUT"`
+
+	// MaxOpenConns limits the connections of the pool, zero means no limit.
+	MaxOpenConns int `yaml:"max_open_conns" toml:"max_open_conns" env:"DB_MAX_OPEN_CONNS"`
+	MaxIdleConns int `yaml:"max_idle_conns" toml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS"`
+	// ConnMaxLifetime and ConnMaxIdleTime close older connections, zero keeps them.
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" toml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" toml:"conn_max_idle_time" env:"DB_CONN_MAX_IDLE_TIME"`
+
+	// ConnectRetries is how many more times the first connection is tried
+	// when the database is not up yet.
+	ConnectRetries int `yaml:"connect_retries" toml:"connect_retries" env:"DB_CONNECT_RETRIES"`
+
+	// Replicas are the host:port addresses of the read replicas, the other
+	// connection settings are shared with the primary.
+	Replicas []string `yaml:"replicas" toml:"replicas" env:"DB_REPLICAS"`
+	// ReplicaCheckInterval is how often the replicas are pinged.
+	ReplicaCheckInterval time.Duration `yaml:"replica_check_interval" toml:"replica_check_interval" env:"DB_REPLICA_CHECK_INTERVAL"`
+	// ReadYourWritesWindow is how long a client reads from the primary after
+	// its own write, zero always reads from the replicas.
+	ReadYourWritesWindow time.Duration `yaml:"read_your_writes_window" toml:"read_your_writes_window" env:"DB_READ_YOUR_WRITES_WINDOW"`
 }
 
 type API struct {
-	Call bool
-	Host string
-	Port string
+	Call bool   `yaml:"call" toml:"call" env:"API_CALL" reload:"true"`
+	Host string `yaml:"host" toml:"host" env:"API_HOST" reload:"true"`
+	Port string `yaml:"port" toml:"port" env:"API_PORT" reload:"true"`
 }
 
 type Server struct {
-	Host        string
-	Port        string
-	Timeout     time.Duration
-	IdleTimeout time.Duration
+	Host        string        `yaml:"host" toml:"host" env:"SERVER_HOST"`
+	Port        string        `yaml:"port" toml:"port" env:"SERVER_PORT"`
+	Timeout     time.Duration `yaml:"timeout" toml:"timeout" env:"SERVER_TIMEOUT"`
+	IdleTimeout time.Duration `yaml:"idle_timeout" toml:"idle_timeout" env:"IDLE_TIMEOUT"`
+	// ReadyTimeout bounds the dependency checks of /readyz.
+	ReadyTimeout time.Duration `yaml:"ready_timeout" toml:"ready_timeout" env:"READY_TIMEOUT"`
+	// ShutdownTimeout bounds draining requests and stopping workers on shutdown.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+	// ShutdownDelay is how long /readyz fails before the listener closes.
+	ShutdownDelay time.Duration `yaml:"shutdown_delay" toml:"shutdown_delay" env:"SHUTDOWN_DELAY"`
+}
+
+type Trash struct {
+	// Retention is how long deleted songs stay in the trash before they are purged.
+	Retention     time.Duration `yaml:"retention" toml:"retention" env:"TRASH_RETENTION"`
+	PurgeInterval time.Duration `yaml:"purge_interval" toml:"purge_interval" env:"TRASH_PURGE_INTERVAL"`
+}
+
+type Auth struct {
+	Enabled bool `yaml:"enabled" toml:"enabled" env:"AUTH_ENABLED"`
+	// BootstrapKeyHash is the hex SHA-256 of a static API key that is always
+	// accepted, it is used to create the first keys.
+	BootstrapKeyHash string `yaml:"bootstrap_key_hash" toml:"bootstrap_key_hash" env:"AUTH_BOOTSTRAP_KEY_HASH" secret:"true"`
+	// JWTAlg is HS256 or RS256, empty disables bearer tokens.
+	JWTAlg           string `yaml:"jwt_alg" toml:"jwt_alg" env:"AUTH_JWT_ALG"`
+	JWTSecret        string `yaml:"jwt_secret" toml:"jwt_secret" env:"AUTH_JWT_SECRET" secret:"true"`
+	JWTPublicKeyFile string `yaml:"jwt_public_key_file" toml:"jwt_public_key_file" env:"AUTH_JWT_PUBLIC_KEY_FILE"`
+	JWTIssuer        string `yaml:"jwt_issuer" toml:"jwt_issuer" env:"AUTH_JWT_ISSUER"`
+	JWTAudience      string `yaml:"jwt_audience" toml:"jwt_audience" env:"AUTH_JWT_AUDIENCE"`
+	// PolicyFile is a JSON file mapping roles to permissions, empty for the default policy.
+	PolicyFile string `yaml:"policy_file" toml:"policy_file" env:"AUTH_POLICY_FILE"`
+}
+
+type RateLimit struct {
+	Enabled bool `yaml:"enabled" toml:"enabled" env:"RATE_LIMIT_ENABLED" reload:"true"`
+	// IP limits the requests of an IP address before they are authenticated,
+	// the other limits apply per API key or token subject after it.
+	IP         Limit `yaml:"ip" toml:"ip" env:"RATE_LIMIT_IP" reload:"true"`
+	Reads      Limit `yaml:"reads" toml:"reads" env:"RATE_LIMIT_READS" reload:"true"`
+	Writes     Limit `yaml:"writes" toml:"writes" env:"RATE_LIMIT_WRITES" reload:"true"`
+	Enrichment Limit `yaml:"enrichment" toml:"enrichment" env:"RATE_LIMIT_ENRICHMENT" reload:"true"`
+}
+
+// Limit is a token bucket: Rate requests per second with bursts of up to Burst requests.
+type Limit struct {
+	Rate  float64 `yaml:"rate" toml:"rate" env:"RATE"`
+	Burst int     `yaml:"burst" toml:"burst" env:"BURST"`
+}
+
+type Cache struct {
+	// Backend is none, memory for an LRU cache in each instance, or redis for
+	// a server shared by all instances. A memory cache of one instance is not
+	// invalidated by writes to another, they see them only after TTL.
+	Backend string `yaml:"backend" toml:"backend" env:"CACHE_BACKEND"`
+	// TTL is how long song lists and texts stay cached.
+	TTL time.Duration `yaml:"ttl" toml:"ttl" env:"CACHE_TTL"`
+	// Size is the number of values the memory cache holds.
+	Size          int    `yaml:"size" toml:"size" env:"CACHE_SIZE"`
+	RedisAddr     string `yaml:"redis_addr" toml:"redis_addr" env:"CACHE_REDIS_ADDR"`
+	RedisPassword string `yaml:"redis_password" toml:"redis_password" env:"CACHE_REDIS_PASSWORD" secret:"true"`
+	RedisDB       int    `yaml:"redis_db" toml:"redis_db" env:"CACHE_REDIS_DB"`
+}
+
+type Webhooks struct {
+	// Enabled runs the dispatcher that sends song events to the webhooks.
+	// Events are written to the outbox either way, while it is off they are
+	// marked dispatched every PollInterval and never sent.
+	Enabled bool `yaml:"enabled" toml:"enabled" env:"WEBHOOKS_ENABLED"`
+	// PollInterval is how often the dispatcher looks for new events and for
+	// deliveries due for a retry.
+	PollInterval time.Duration `yaml:"poll_interval" toml:"poll_interval" env:"WEBHOOKS_POLL_INTERVAL"`
+	// Timeout limits one delivery request.
+	Timeout time.Duration `yaml:"timeout" toml:"timeout" env:"WEBHOOKS_TIMEOUT"`
+	// MaxAttempts is how many times a delivery is tried before it fails.
+	MaxAttempts int `yaml:"max_attempts" toml:"max_attempts" env:"WEBHOOKS_MAX_ATTEMPTS"`
+	// RetryBackoff is the delay before the first retry, it doubles on every
+	// attempt up to RetryMaxBackoff.
+	RetryBackoff    time.Duration `yaml:"retry_backoff" toml:"retry_backoff" env:"WEBHOOKS_RETRY_BACKOFF"`
+	RetryMaxBackoff time.Duration `yaml:"retry_max_backoff" toml:"retry_max_backoff" env:"WEBHOOKS_RETRY_MAX_BACKOFF"`
+	// Retention is how long finished deliveries stay in the delivery log and
+	// dispatched events in the outbox.
+	Retention time.Duration `yaml:"retention" toml:"retention" env:"WEBHOOKS_RETENTION"`
+}
+
+type Events struct {
+	// Enabled serves the stream of song events at /songs/events.
+	Enabled bool `yaml:"enabled" toml:"enabled" env:"EVENTS_ENABLED"`
+	// LogSize is how many of the newest events are kept in memory for
+	// clients resuming the stream.
+	LogSize int `yaml:"log_size" toml:"log_size" env:"EVENTS_LOG_SIZE"`
+	// Heartbeat is how often an idle stream gets a comment, so proxies do not
+	// close it.
+	Heartbeat time.Duration `yaml:"heartbeat" toml:"heartbeat" env:"EVENTS_HEARTBEAT"`
+}
+
+type Metrics struct {
+	// Enabled serves Prometheus metrics on /metrics.
+	Enabled bool `yaml:"enabled" toml:"enabled" env:"METRICS_ENABLED"`
+}
+
+type Tracing struct {
+	// Exporter is none, otlp, stdout or file.
+	Exporter string `yaml:"exporter" toml:"exporter" env:"TRACING_EXPORTER"`
+	// Endpoint is the host:port of the OTLP HTTP receiver.
+	Endpoint string `yaml:"otlp_endpoint" toml:"otlp_endpoint" env:"TRACING_OTLP_ENDPOINT"`
+	Insecure bool   `yaml:"otlp_insecure" toml:"otlp_insecure" env:"TRACING_OTLP_INSECURE"`
+	// File receives the spans as JSON lines with the file exporter.
+	File string `yaml:"file" toml:"file" env:"TRACING_FILE"`
+	// SampleRatio is the share of new traces that are recorded.
+	SampleRatio float64 `yaml:"sample_ratio" toml:"sample_ratio" env:"TRACING_SAMPLE_RATIO"`
+}
+
+type Log struct {
+	// Level is debug, info, warn or error.
+	Level string `yaml:"level" toml:"level" env:"LOG_LEVEL" reload:"true"`
+	// Format is console or json.
+	Format string `yaml:"format" toml:"format" env:"LOG_FORMAT"`
+	// Outputs are the sinks of the log: stdout and file.
+	Outputs []string `yaml:"outputs" toml:"outputs" env:"LOG_OUTPUTS"`
+	File    LogFile  `yaml:"file" toml:"file"`
+	// SamplingInitial entries with the same level and message are written
+	// every second, then only every SamplingThereafter-th. Zero disables sampling.
+	SamplingInitial    int `yaml:"sampling_initial" toml:"sampling_initial" env:"LOG_SAMPLING_INITIAL"`
+	SamplingThereafter int `yaml:"sampling_thereafter" toml:"sampling_thereafter" env:"LOG_SAMPLING_THEREAFTER"`
+	// Levels overrides Level for packages, the keys are logger names such as
+	// postgres or handlers.
+	Levels map[string]string `yaml:"levels" toml:"levels" env:"LOG_LEVELS" reload:"true"`
+}
+
+// LogFile is a log file rotated when it reaches MaxSizeMB.
+type LogFile struct {
+	Path       string `yaml:"path" toml:"path" env:"LOG_FILE"`
+	MaxSizeMB  int    `yaml:"max_size_mb" toml:"max_size_mb" env:"LOG_FILE_MAX_SIZE_MB"`
+	MaxBackups int    `yaml:"max_backups" toml:"max_backups" env:"LOG_FILE_MAX_BACKUPS"`
+	MaxAgeDays int    `yaml:"max_age_days" toml:"max_age_days" env:"LOG_FILE_MAX_AGE_DAYS"`
+	Compress   bool   `yaml:"compress" toml:"compress" env:"LOG_FILE_COMPRESS"`
+}
+
+// CORS lets browsers on other origins call the API. No allowed origins
+// disables CORS, "*" allows every origin.
+type CORS struct {
+	AllowedOrigins []string      `yaml:"allowed_origins" toml:"allowed_origins" env:"CORS_ALLOWED_ORIGINS"`
+	AllowedMethods []string      `yaml:"allowed_methods" toml:"allowed_methods" env:"CORS_ALLOWED_METHODS"`
+	AllowedHeaders []string      `yaml:"allowed_headers" toml:"allowed_headers" env:"CORS_ALLOWED_HEADERS"`
+	MaxAge         time.Duration `yaml:"max_age" toml:"max_age" env:"CORS_MAX_AGE"`
 }
 
 type Migration struct {
-	Dir  string
-	DSN  string
-	Name string
+	Dir string `yaml:"dir" toml:"dir" env:"MIGRATION_DIR"`
+	// DSN is used by the Makefile goose targets, it contains the password.
+	DSN  string `yaml:"dsn" toml:"dsn" env:"MIGRATION_DSN" secret:"true"`
+	Name string `yaml:"name" toml:"name" env:"MIGRATION_NAME"`
 }
 
-func Load() Config {
-	cfg := Config{}
-	err := env.Load("./.env")
-	if err != nil {
-		log.Fatal(err)
-	}
-	cfg = Config{
+// Default returns the configuration used for settings no source sets.
+func Default() Config {
+	return Config{
 		DB: DB{
-			Host: os.Getenv("DB_HOST"),
-			Port: os.Getenv("DB_PORT"),
-			User: os.Getenv("DB_USER"),
-			Pass: os.Getenv("DB_PASS"),
-			Name: os.Getenv("DB_NAME"),
+			Backend:     "sql",
+			Path:        "songs.db",
+			Host:        "localhost",
+			Port:        "5432",
+			User:        "postgres",
+			Name:        "songs",
+			TxIsolation: "read committed",
+			TxRetries:   3,
+
+			SSLMode:         "disable",
+			ApplicationName: "list-of-song",
+
+			MaxOpenConns:    25,
+			MaxIdleConns:    10,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+
+			ConnectRetries: 10,
+
+			ReplicaCheckInterval: 5 * time.Second,
+			ReadYourWritesWindow: 5 * time.Second,
 		},
 		API: API{
-			Host: os.Getenv("API_HOST"),
-			Port: os.Getenv("API_PORT"),
+			Host: "localhost",
+			Port: "8081",
 		},
 		Server: Server{
-			Host: os.Getenv("SERVER_HOST"),
-			Port: os.Getenv("SERVER_PORT"),
+			Host:            "0.0.0.0",
+			Port:            "8080",
+			Timeout:         4 * time.Second,
+			IdleTimeout:     60 * time.Second,
+			ReadyTimeout:    2 * time.Second,
+			ShutdownTimeout: 10 * time.Second,
 		},
 		Migration: Migration{
-			Dir:  os.Getenv("MIGRATION_DIR"),
-			DSN:  os.Getenv("MIGRATION_DSN"),
-			Name: os.Getenv("MIGRATION_NAME"),
+			Dir:  "./migrations",
+			Name: "songs",
+		},
+		Trash: Trash{
+			Retention:     30 * 24 * time.Hour,
+			PurgeInterval: time.Hour,
+		},
+		Auth: Auth{
+			Enabled: true,
+		},
+		RateLimit: RateLimit{
+			Enabled:    true,
+			IP:         Limit{Rate: 50, Burst: 100},
+			Reads:      Limit{Rate: 20, Burst: 40},
+			Writes:     Limit{Rate: 5, Burst: 10},
+			Enrichment: Limit{Rate: 1, Burst: 5},
+		},
+		Cache: Cache{
+			Backend:   "none",
+			TTL:       time.Minute,
+			Size:      10000,
+			RedisAddr: "localhost:6379",
+		},
+		Webhooks: Webhooks{
+			Enabled:         true,
+			PollInterval:    time.Second,
+			Timeout:         10 * time.Second,
+			MaxAttempts:     8,
+			RetryBackoff:    10 * time.Second,
+			RetryMaxBackoff: time.Hour,
+			Retention:       7 * 24 * time.Hour,
+		},
+		Events: Events{
+			Enabled:   true,
+			LogSize:   1000,
+			Heartbeat: 15 * time.Second,
+		},
+		Metrics: Metrics{
+			Enabled: true,
+		},
+		Tracing: Tracing{
+			Exporter:    "none",
+			Endpoint:    "localhost:4318",
+			Insecure:    true,
+			File:        "./traces.json",
+			SampleRatio: 1,
+		},
+		Log: Log{
+			Level:   "info",
+			Format:  "console",
+			Outputs: []string{"stdout"},
+			File: LogFile{
+				Path:       "./logs/songs.log",
+				MaxSizeMB:  100,
+				MaxBackups: 5,
+				MaxAgeDays: 28,
+			},
+		},
+		CORS: CORS{
+			AllowedMethods: []string{"GET", "POST", "PUT", "DELETE"},
+			AllowedHeaders: []string{"Content-Type", "Authorization", "X-API-Key", "X-Request-ID", "Last-Event-ID"},
+			MaxAge:         10 * time.Minute,
 		},
 	}
-
-	callApi, err := strconv.ParseBool(os.Getenv("API_CALL"))
-	if err != nil {
-		log.Fatal(err)
-	}
-	timeout, err := time.ParseDuration(os.Getenv("SERVER_TIMEOUT"))
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	idleTimeout, err := time.ParseDuration(os.Getenv("IDLE_TIMEOUT"))
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	cfg.API.Call = callApi
-	cfg.Server.Timeout = timeout
-	cfg.Server.IdleTimeout = idleTimeout
-
-	log.Println(cfg)
-	return cfg
 }
@@ -0,0 +1,343 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Options select the sources Load reads. The zero value reads only the
+// process environment.
+type Options struct {
+	// File is a YAML (.yaml, .yml) or TOML (.toml) config file. The
+	// CONFIG_FILE variable and the --config flag override it, empty skips
+	// the file layer.
+	File string
+	// EnvFile is a dotenv file read as the layer below the config file, it
+	// does not change the process environment. A missing file is skipped.
+	EnvFile string
+	// LookupEnv reads environment variables, os.LookupEnv when nil. Tests set
+	// it to read from a map instead of the process environment.
+	LookupEnv func(key string) (string, bool)
+	// Args are the command line arguments without the program name.
+	Args []string
+	// Output receives the flag usage and parse messages, os.Stderr when nil.
+	Output io.Writer
+}
+
+// Load builds the configuration from Default, the dotenv file, the config
+// file, the environment and the command line flags, each layer overriding the
+// settings it sets. Parse and validation problems of all layers are returned
+// together as a *ValidationError.
+func Load(opts Options) (Config, error) {
+	cfg := Default()
+	lookup := opts.LookupEnv
+	if lookup == nil {
+		lookup = os.LookupEnv
+	}
+
+	dotenv, err := opts.readEnvFile(lookup)
+	if err != nil {
+		return cfg, err
+	}
+
+	fs, flagValues := newFlagSet(&cfg, opts.Output)
+	configFlag := fs.String("config", "", "YAML or TOML config file")
+	if err := fs.Parse(opts.Args); err != nil {
+		return cfg, err
+	}
+	file := opts.configFile(lookup, dotenv, *configFlag)
+
+	var problems []string
+	for _, s := range settings(&cfg) {
+		v, ok := dotenv[s.env]
+		if !ok {
+			continue
+		}
+		if err := s.set(v); err != nil {
+			problems = append(problems, fmt.Sprintf("env file %s: %s: %v", opts.EnvFile, s.env, err))
+		}
+	}
+
+	if file != "" {
+		p, err := loadFile(&cfg, file)
+		if err != nil {
+			return cfg, err
+		}
+		problems = append(problems, p...)
+	}
+
+	for _, s := range settings(&cfg) {
+		v, ok := lookup(s.env)
+		if !ok {
+			continue
+		}
+		if err := s.set(v); err != nil {
+			problems = append(problems, fmt.Sprintf("env %s: %v", s.env, err))
+		}
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		s, ok := flagValues[f.Name]
+		if !ok {
+			return
+		}
+		if err := s.set(f.Value.String()); err != nil {
+			problems = append(problems, fmt.Sprintf("flag --%s: %v", f.Name, err))
+		}
+	})
+
+	if err := cfg.Validate(); err != nil {
+		var verr *ValidationError
+		if !errors.As(err, &verr) {
+			return cfg, err
+		}
+		problems = append(problems, verr.Problems...)
+	}
+	if len(problems) > 0 {
+		return cfg, &ValidationError{Problems: problems}
+	}
+	return cfg, nil
+}
+
+// ConfigFile returns the config file Load reads with opts, empty when there
+// is none.
+func (opts Options) ConfigFile() (string, error) {
+	lookup := opts.LookupEnv
+	if lookup == nil {
+		lookup = os.LookupEnv
+	}
+	fs, _ := newFlagSet(&Config{}, io.Discard)
+	configFlag := fs.String("config", "", "YAML or TOML config file")
+	if err := fs.Parse(opts.Args); err != nil {
+		return "", err
+	}
+	dotenv, err := opts.readEnvFile(lookup)
+	if err != nil {
+		return "", err
+	}
+	return opts.configFile(lookup, dotenv, *configFlag), nil
+}
+
+// configFile picks the config file: the --config flag, then the CONFIG_FILE
+// variable of the environment and of the dotenv file, then Options.File.
+func (opts Options) configFile(lookup func(string) (string, bool), dotenv map[string]string, flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	if v, ok := lookup("CONFIG_FILE"); ok && v != "" {
+		return v
+	}
+	if v := dotenv["CONFIG_FILE"]; v != "" {
+		return v
+	}
+	return opts.File
+}
+
+// readEnvFile reads the variables of Options.EnvFile, none when it is not
+// set or missing.
+func (opts Options) readEnvFile(lookup func(string) (string, bool)) (map[string]string, error) {
+	if opts.EnvFile == "" {
+		return nil, nil
+	}
+	vars, err := readEnvFile(opts.EnvFile, lookup)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", opts.EnvFile, err)
+	}
+	return vars, nil
+}
+
+// loadFile decodes a YAML or TOML file over cfg. Unknown keys are reported as
+// problems, so typos do not go unnoticed.
+func loadFile(cfg *Config, path string) ([]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(b))
+		dec.KnownFields(true)
+		if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return []string{fmt.Sprintf("file %s: %v", path, err)}, nil
+		}
+		return nil, nil
+	case ".toml":
+		md, err := toml.Decode(string(b), cfg)
+		if err != nil {
+			return []string{fmt.Sprintf("file %s: %v", path, err)}, nil
+		}
+		var problems []string
+		for _, key := range md.Undecoded() {
+			problems = append(problems, fmt.Sprintf("file %s: unknown key %q", path, key.String()))
+		}
+		return problems, nil
+	}
+	return nil, fmt.Errorf("unsupported config file format: %s", path)
+}
+
+// newFlagSet registers a flag for every setting. Flags are strings parsed by
+// the setting, so they accept the same values as the variables.
+func newFlagSet(cfg *Config, output io.Writer) (*flag.FlagSet, map[string]setting) {
+	fs := flag.NewFlagSet("list-of-song", flag.ContinueOnError)
+	if output != nil {
+		fs.SetOutput(output)
+	}
+
+	values := make(map[string]setting)
+	for _, s := range settings(cfg) {
+		name := strings.ReplaceAll(strings.ToLower(s.env), "_", "-")
+		def := s.String()
+		if s.secret {
+			def = ""
+		}
+		fs.String(name, def, "overrides "+s.env)
+		values[name] = s
+	}
+	return fs, values
+}
+
+// setting is one configurable value, a leaf field of Config.
+type setting struct {
+	env    string
+	secret bool
+	reload bool
+	value  reflect.Value
+}
+
+// settings lists the leaf fields of cfg with their variable names.
+func settings(cfg *Config) []setting {
+	var out []setting
+	collect(reflect.ValueOf(cfg).Elem(), "", false, &out)
+	return out
+}
+
+func collect(v reflect.Value, prefix string, reload bool, out *[]setting) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := f.Tag.Get("env")
+		if prefix != "" && name != "" {
+			name = prefix + "_" + name
+		}
+
+		fieldReload := reload || f.Tag.Get("reload") == "true"
+
+		if f.Type.Kind() == reflect.Struct {
+			if name == "" {
+				name = prefix
+			}
+			collect(v.Field(i), name, fieldReload, out)
+			continue
+		}
+		if f.Tag.Get("env") == "" {
+			continue
+		}
+		*out = append(*out, setting{env: name, secret: f.Tag.Get("secret") == "true", reload: fieldReload, value: v.Field(i)})
+	}
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// set parses s into the setting.
+func (s setting) set(str string) error {
+	v := s.value
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(str)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", str)
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(str)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(str)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", str)
+		}
+		v.SetBool(b)
+	case v.Kind() == reflect.Int:
+		n, err := strconv.Atoi(str)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", str)
+		}
+		v.SetInt(int64(n))
+	case v.Kind() == reflect.Float64:
+		f, err := strconv.ParseFloat(str, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", str)
+		}
+		v.SetFloat(f)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		v.Set(reflect.ValueOf(parseList(str)))
+	case v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String && v.Type().Elem().Kind() == reflect.String:
+		m, err := parseLevels(str)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(m))
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+	return nil
+}
+
+// String formats the setting the way set parses it.
+func (s setting) String() string {
+	v := s.value
+	switch {
+	case v.Type() == durationType:
+		return time.Duration(v.Int()).String()
+	case v.Kind() == reflect.Slice:
+		return strings.Join(v.Interface().([]string), ",")
+	case v.Kind() == reflect.Map:
+		var pairs []string
+		for name, level := range v.Interface().(map[string]string) {
+			pairs = append(pairs, name+"="+level)
+		}
+		sort.Strings(pairs)
+		return strings.Join(pairs, ",")
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// parseList splits a comma separated list, empty items are dropped.
+func parseList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// parseLevels reads a list of name=value pairs such as "postgres=warn,handlers=info".
+func parseLevels(s string) (map[string]string, error) {
+	levels := make(map[string]string)
+	for _, item := range parseList(s) {
+		name, level, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid pair %q, want name=value", item)
+		}
+		levels[strings.TrimSpace(name)] = strings.TrimSpace(level)
+	}
+	return levels, nil
+}
@@ -0,0 +1,209 @@
+package config
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mapEnv is an environment for Options.LookupEnv. Authentication is turned
+// off unless the test sets it, it needs a bootstrap key or JWT.
+func mapEnv(vars map[string]string) func(string) (string, bool) {
+	env := map[string]string{"AUTH_ENABLED": "false"}
+	for k, v := range vars {
+		env[k] = v
+	}
+	return func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	envFile := writeFile(t, ".env", `
+# every layer above overrides some of these
+DB_HOST=dotenv-host
+DB_PORT=1111
+DB_USER=dotenv
+export DB_NAME="dotenv"
+DB_PASS='pa$$word'
+MIGRATION_DSN="host=${DB_HOST} user=${DB_USER} password=${DB_PASS}"
+SERVER_PORT=9000 # inline comment
+`)
+	file := writeFile(t, "config.yaml", `
+db:
+  port: "2222"
+  user: file
+  name: file
+`)
+
+	cfg, err := Load(Options{
+		File:    file,
+		EnvFile: envFile,
+		LookupEnv: mapEnv(map[string]string{
+			"DB_USER": "env",
+			"DB_NAME": "env",
+		}),
+		Args:   []string{"--db-name=flag"},
+		Output: io.Discard,
+	})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	for _, tc := range []struct {
+		setting, got, want string
+	}{
+		{"DB_HOST from the dotenv file", cfg.DB.Host, "dotenv-host"},
+		{"DB_PORT from the config file", cfg.DB.Port, "2222"},
+		{"DB_USER from the environment", cfg.DB.User, "env"},
+		{"DB_NAME from the flag", cfg.DB.Name, "flag"},
+		{"single quoted DB_PASS", cfg.DB.Pass, "pa$$word"},
+		// Variables expand to the environment first, then to earlier lines.
+		{"expanded MIGRATION_DSN", cfg.Migration.DSN, "host=dotenv-host user=env password=pa$$word"},
+		{"SERVER_PORT without the comment", cfg.Server.Port, "9000"},
+		{"default SERVER_TIMEOUT", cfg.Server.Timeout.String(), Default().Server.Timeout.String()},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("%s = %q, want %q", tc.setting, tc.got, tc.want)
+		}
+	}
+
+	// The dotenv file is a layer, not an environment.
+	if v, ok := os.LookupEnv("DB_HOST"); ok && v == "dotenv-host" {
+		t.Error("the dotenv file was loaded into the process environment")
+	}
+}
+
+func TestLoadEnvironmentExpandsDotenv(t *testing.T) {
+	envFile := writeFile(t, ".env", "DB_HOST=${PGHOST}\nDB_USER=$USERNAME\n")
+	cfg, err := Load(Options{
+		EnvFile:   envFile,
+		LookupEnv: mapEnv(map[string]string{"PGHOST": "db.internal", "USERNAME": "songs"}),
+	})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.DB.Host != "db.internal" || cfg.DB.User != "songs" {
+		t.Errorf("DB_HOST = %q and DB_USER = %q, want the expanded environment", cfg.DB.Host, cfg.DB.User)
+	}
+}
+
+func TestLoadConfigFileChoice(t *testing.T) {
+	options := writeFile(t, "options.yaml", "db:\n  host: options\n")
+	dotenv := writeFile(t, "dotenv.yaml", "db:\n  host: dotenv\n")
+	env := writeFile(t, "env.toml", "[db]\nhost = \"env\"\n")
+	flagFile := writeFile(t, "flag.yml", "db:\n  host: flag\n")
+	envFile := writeFile(t, ".env", "CONFIG_FILE="+dotenv+"\n")
+
+	for _, tc := range []struct {
+		name string
+		opts Options
+		want string
+	}{
+		{name: "options", opts: Options{File: options}, want: "options"},
+		{name: "dotenv file", opts: Options{File: options, EnvFile: envFile}, want: "dotenv"},
+		{
+			name: "environment",
+			opts: Options{File: options, EnvFile: envFile, LookupEnv: mapEnv(map[string]string{"CONFIG_FILE": env})},
+			want: "env",
+		},
+		{
+			name: "flag",
+			opts: Options{File: options, EnvFile: envFile, LookupEnv: mapEnv(map[string]string{"CONFIG_FILE": env}), Args: []string{"--config", flagFile}},
+			want: "flag",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.opts.LookupEnv == nil {
+				tc.opts.LookupEnv = mapEnv(nil)
+			}
+			cfg, err := Load(tc.opts)
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if cfg.DB.Host != tc.want {
+				t.Errorf("DB_HOST = %q, want %q", cfg.DB.Host, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoadValidationError(t *testing.T) {
+	envFile := writeFile(t, ".env", "TRASH_RETENTION=forever\n")
+	file := writeFile(t, "config.yaml", "db:\n  hots: typo\n")
+
+	_, err := Load(Options{
+		File:    file,
+		EnvFile: envFile,
+		LookupEnv: mapEnv(map[string]string{
+			"DB_BACKEND":     "mongo",
+			"SERVER_TIMEOUT": "soon",
+			"AUTH_ENABLED":   "true",
+		}),
+		Args:   []string{"--api-call=maybe"},
+		Output: io.Discard,
+	})
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Load = %v, want a *ValidationError", err)
+	}
+
+	// Every layer reports its problems, and validation runs anyway.
+	for _, want := range []string{
+		"env file " + envFile + ": TRASH_RETENTION",
+		"file " + file,
+		"env SERVER_TIMEOUT",
+		"flag --api-call",
+		"DB_BACKEND must be one of",
+		"AUTH_ENABLED requires",
+	} {
+		found := false
+		for _, p := range verr.Problems {
+			found = found || strings.Contains(p, want)
+		}
+		if !found {
+			t.Errorf("problems %q do not mention %q", verr.Problems, want)
+		}
+	}
+	if !strings.HasPrefix(err.Error(), "invalid configuration:\n  - ") {
+		t.Errorf("Error() = %q, want one problem per line", err.Error())
+	}
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := Load(Options{LookupEnv: mapEnv(nil), EnvFile: filepath.Join(t.TempDir(), "missing.env")})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	want := Default()
+	want.Auth.Enabled = false
+	if cfg.String() != want.String() {
+		t.Errorf("Load without sources = %s, want the defaults %s", cfg, want)
+	}
+	if cfg.Server.ShutdownTimeout != 10*time.Second {
+		t.Errorf("SHUTDOWN_TIMEOUT = %s, want 10s", cfg.Server.ShutdownTimeout)
+	}
+}
+
+func TestReadEnvFileErrors(t *testing.T) {
+	for _, content := range []string{"NO_EQUALS\n", "=value\n", "TWO WORDS=value\n"} {
+		path := writeFile(t, ".env", content)
+		if _, err := readEnvFile(path, mapEnv(nil)); err == nil {
+			t.Errorf("readEnvFile(%q) succeeded, want an error", content)
+		}
+	}
+}
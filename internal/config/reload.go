@@ -0,0 +1,47 @@
+package config
+
+import "slices"
+
+// Changes lists the settings that differ between two configurations by their
+// variable names.
+type Changes struct {
+	// Reloadable settings are applied while the service runs.
+	Reloadable []string
+	// Static settings take effect only after a restart.
+	Static []string
+}
+
+// Reloaded reports whether the reloadable setting with the variable name env
+// changed.
+func (c Changes) Reloaded(env string) bool {
+	return slices.Contains(c.Reloadable, env)
+}
+
+// Diff compares c with next.
+func (c Config) Diff(next Config) Changes {
+	var changes Changes
+	nextSettings := settings(&next)
+	for i, s := range settings(&c) {
+		if s.String() == nextSettings[i].String() {
+			continue
+		}
+		if s.reload {
+			changes.Reloadable = append(changes.Reloadable, s.env)
+		} else {
+			changes.Static = append(changes.Static, s.env)
+		}
+	}
+	return changes
+}
+
+// Reloadable returns c with the reloadable settings taken from next, the
+// configuration the service runs with after next was applied.
+func (c Config) Reloadable(next Config) Config {
+	nextSettings := settings(&next)
+	for i, s := range settings(&c) {
+		if s.reload {
+			s.value.Set(nextSettings[i].value)
+		}
+	}
+	return c
+}
@@ -0,0 +1,46 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	current := Default()
+	next := Default()
+	next.DB.Host = "other-db"
+	next.API.Host = "songs-api"
+	next.RateLimit.Reads.Rate = 100
+	next.Log.Level = "debug"
+	next.CORS.AllowedOrigins = []string{"https://example.com"}
+	// Secrets are compared too, a rotated password needs a restart.
+	next.DB.Pass = "rotated"
+
+	changes := current.Diff(next)
+	want := Changes{
+		Reloadable: []string{"API_HOST", "RATE_LIMIT_READS_RATE", "LOG_LEVEL", "CORS_ALLOWED_ORIGINS"},
+		Static:     []string{"DB_HOST", "DB_PASS"},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("Diff = %+v, want %+v", changes, want)
+	}
+	if !changes.Reloaded("LOG_LEVEL") || changes.Reloaded("LOG_LEVELS") || changes.Reloaded("DB_HOST") {
+		t.Errorf("Reloaded reports wrong settings for %+v", changes)
+	}
+	if diff := current.Diff(current); len(diff.Reloadable)+len(diff.Static) != 0 {
+		t.Errorf("Diff of the same config = %+v, want no changes", diff)
+	}
+
+	// The running config takes the reloadable settings only.
+	applied := current.Reloadable(next)
+	if applied.API.Host != "songs-api" || applied.RateLimit.Reads.Rate != 100 || applied.Log.Level != "debug" ||
+		!reflect.DeepEqual(applied.CORS.AllowedOrigins, next.CORS.AllowedOrigins) {
+		t.Errorf("Reloadable did not take the reloadable settings: %+v", applied)
+	}
+	if applied.DB.Host != current.DB.Host || applied.DB.Pass != current.DB.Pass {
+		t.Errorf("Reloadable took static settings: DB_HOST %q, DB_PASS %q", applied.DB.Host, applied.DB.Pass)
+	}
+	if d := applied.Diff(next); !reflect.DeepEqual(d.Reloadable, []string(nil)) {
+		t.Errorf("reloadable settings left after Reloadable: %v", d.Reloadable)
+	}
+}
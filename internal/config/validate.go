@@ -0,0 +1,187 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// ValidationError lists every problem found while loading a configuration.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+var backends = []string{"sql", "pgx", "sqlite"}
+
+var sslModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
+var logLevels = []string{"debug", "info", "warn", "error", "dpanic", "panic", "fatal"}
+
+// Validate checks the settings and their combinations. All problems are
+// returned together in a *ValidationError.
+func (c Config) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(slices.Contains(backends, c.DB.Backend), "DB_BACKEND must be one of %s, got %q", strings.Join(backends, ", "), c.DB.Backend)
+	if c.DB.Backend == "sqlite" {
+		check(c.DB.Path != "", "DB_PATH is required for the sqlite backend")
+	} else {
+		check(c.DB.Host != "", "DB_HOST is required")
+		check(c.DB.Port != "", "DB_PORT is required")
+		check(c.DB.User != "", "DB_USER is required")
+		check(c.DB.Name != "", "DB_NAME is required")
+	}
+	check(c.DB.TxRetries >= 0, "DB_TX_RETRIES must not be negative")
+	check(slices.Contains(sslModes, c.DB.SSLMode), "DB_SSLMODE must be one of %s, got %q", strings.Join(sslModes, ", "), c.DB.SSLMode)
+	check((c.DB.SSLCert == "") == (c.DB.SSLKey == ""), "DB_SSLCERT and DB_SSLKEY must be set together")
+	check(c.DB.StatementTimeout >= 0, "DB_STATEMENT_TIMEOUT must not be negative")
+	check(c.DB.MaxOpenConns >= 0 && c.DB.MaxIdleConns >= 0, "DB_MAX_OPEN_CONNS and DB_MAX_IDLE_CONNS must not be negative")
+	check(c.DB.MaxOpenConns == 0 || c.DB.MaxIdleConns <= c.DB.MaxOpenConns, "DB_MAX_IDLE_CONNS must not exceed DB_MAX_OPEN_CONNS")
+	check(c.DB.ConnMaxLifetime >= 0 && c.DB.ConnMaxIdleTime >= 0, "DB_CONN_MAX_LIFETIME and DB_CONN_MAX_IDLE_TIME must not be negative")
+	check(c.DB.ConnectRetries >= 0, "DB_CONNECT_RETRIES must not be negative")
+	for _, replica := range c.DB.Replicas {
+		_, _, err := net.SplitHostPort(replica)
+		check(err == nil, "DB_REPLICAS must contain host:port addresses, got %q", replica)
+	}
+	if len(c.DB.Replicas) > 0 {
+		check(c.DB.Backend == "sql", "DB_REPLICAS are supported by the sql backend only")
+		check(c.DB.ReplicaCheckInterval > 0, "DB_REPLICA_CHECK_INTERVAL must be positive")
+	}
+	check(c.DB.ReadYourWritesWindow >= 0, "DB_READ_YOUR_WRITES_WINDOW must not be negative")
+
+	if c.API.Call {
+		check(c.API.Host != "" && c.API.Port != "", "API_HOST and API_PORT are required when API_CALL is set")
+	}
+
+	check(c.Server.Port != "", "SERVER_PORT is required")
+	check(c.Server.Timeout > 0, "SERVER_TIMEOUT must be positive")
+	check(c.Server.IdleTimeout > 0, "IDLE_TIMEOUT must be positive")
+	check(c.Server.ReadyTimeout > 0, "READY_TIMEOUT must be positive")
+	check(c.Server.ShutdownTimeout > 0, "SHUTDOWN_TIMEOUT must be positive")
+	check(c.Server.ShutdownDelay >= 0, "SHUTDOWN_DELAY must not be negative")
+
+	check(c.Migration.Dir != "", "MIGRATION_DIR is required")
+
+	check(c.Trash.Retention > 0, "TRASH_RETENTION must be positive")
+	check(c.Trash.PurgeInterval > 0, "TRASH_PURGE_INTERVAL must be positive")
+
+	// Keys are created through the API by an admin, without a bootstrap key
+	// or JWT nobody could create the first one.
+	check(!c.Auth.Enabled || c.Auth.BootstrapKeyHash != "" || c.Auth.JWTAlg != "",
+		"AUTH_ENABLED requires AUTH_BOOTSTRAP_KEY_HASH or AUTH_JWT_ALG, set AUTH_ENABLED=false to run without authentication")
+	switch c.Auth.JWTAlg {
+	case "":
+	case "HS256":
+		check(c.Auth.JWTSecret != "", "AUTH_JWT_SECRET is required for HS256")
+	case "RS256":
+		check(c.Auth.JWTPublicKeyFile != "", "AUTH_JWT_PUBLIC_KEY_FILE is required for RS256")
+	default:
+		check(false, "AUTH_JWT_ALG must be HS256 or RS256, got %q", c.Auth.JWTAlg)
+	}
+
+	if c.RateLimit.Enabled {
+		limits := []struct {
+			name  string
+			limit Limit
+		}{{"IP", c.RateLimit.IP}, {"READS", c.RateLimit.Reads}, {"WRITES", c.RateLimit.Writes}, {"ENRICHMENT", c.RateLimit.Enrichment}}
+		for _, l := range limits {
+			check(l.limit.Rate > 0, "RATE_LIMIT_%s_RATE must be positive", l.name)
+			check(l.limit.Burst > 0, "RATE_LIMIT_%s_BURST must be positive", l.name)
+		}
+	}
+
+	switch c.Cache.Backend {
+	case "", "none":
+	case "memory":
+		check(c.Cache.Size > 0, "CACHE_SIZE must be positive")
+	case "redis":
+		_, _, err := net.SplitHostPort(c.Cache.RedisAddr)
+		check(err == nil, "CACHE_REDIS_ADDR must be a host:port address, got %q", c.Cache.RedisAddr)
+		check(c.Cache.RedisDB >= 0, "CACHE_REDIS_DB must not be negative")
+	default:
+		check(false, "CACHE_BACKEND must be none, memory or redis, got %q", c.Cache.Backend)
+	}
+	if c.Cache.Backend == "memory" || c.Cache.Backend == "redis" {
+		check(c.Cache.TTL > 0, "CACHE_TTL must be positive")
+	}
+
+	// The outbox is cleaned with webhooks disabled too.
+	check(c.Webhooks.PollInterval > 0, "WEBHOOKS_POLL_INTERVAL must be positive")
+	check(c.Webhooks.Retention > 0, "WEBHOOKS_RETENTION must be positive")
+	if c.Webhooks.Enabled {
+		check(c.Webhooks.Timeout > 0, "WEBHOOKS_TIMEOUT must be positive")
+		check(c.Webhooks.MaxAttempts > 0, "WEBHOOKS_MAX_ATTEMPTS must be positive")
+		check(c.Webhooks.RetryBackoff > 0, "WEBHOOKS_RETRY_BACKOFF must be positive")
+		check(c.Webhooks.RetryMaxBackoff >= c.Webhooks.RetryBackoff, "WEBHOOKS_RETRY_MAX_BACKOFF must not be less than WEBHOOKS_RETRY_BACKOFF")
+	}
+	if c.Events.Enabled {
+		check(c.Events.LogSize > 0, "EVENTS_LOG_SIZE must be positive")
+		check(c.Events.Heartbeat > 0, "EVENTS_HEARTBEAT must be positive")
+	}
+
+	switch c.Tracing.Exporter {
+	case "", "none", "stdout":
+	case "otlp":
+		check(c.Tracing.Endpoint != "", "TRACING_OTLP_ENDPOINT is required for the otlp exporter")
+	case "file":
+		check(c.Tracing.File != "", "TRACING_FILE is required for the file exporter")
+	default:
+		check(false, "TRACING_EXPORTER must be none, otlp, stdout or file, got %q", c.Tracing.Exporter)
+	}
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "TRACING_SAMPLE_RATIO must be between 0 and 1")
+
+	check(c.Log.Level == "" || slices.Contains(logLevels, strings.ToLower(c.Log.Level)), "LOG_LEVEL must be one of %s, got %q", strings.Join(logLevels, ", "), c.Log.Level)
+	names := make([]string, 0, len(c.Log.Levels))
+	for name := range c.Log.Levels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		level := c.Log.Levels[name]
+		check(slices.Contains(logLevels, strings.ToLower(level)), "LOG_LEVELS: level of %s must be one of %s, got %q", name, strings.Join(logLevels, ", "), level)
+	}
+	check(c.Log.Format == "" || c.Log.Format == "console" || c.Log.Format == "json", "LOG_FORMAT must be console or json, got %q", c.Log.Format)
+	for _, output := range c.Log.Outputs {
+		check(output == "stdout" || output == "file", "LOG_OUTPUTS must contain only stdout and file, got %q", output)
+		if output == "file" {
+			check(c.Log.File.Path != "", "LOG_FILE is required for the file output")
+		}
+	}
+	check(c.Log.SamplingInitial >= 0 && c.Log.SamplingThereafter >= 0, "LOG_SAMPLING_INITIAL and LOG_SAMPLING_THEREAFTER must not be negative")
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// redacted is the mask printed instead of secret values.
+const redacted = "[REDACTED]"
+
+// Redacted returns a copy of c with the secret settings masked.
+func (c Config) Redacted() Config {
+	for _, s := range settings(&c) {
+		if s.secret && s.value.Kind() == reflect.String && s.value.String() != "" {
+			s.value.SetString(redacted)
+		}
+	}
+	return c
+}
+
+// String prints the configuration with the secrets masked, so it is safe to log.
+func (c Config) String() string {
+	type plain Config
+	return fmt.Sprintf("%+v", plain(c.Redacted()))
+}
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedacted(t *testing.T) {
+	cfg := Default()
+	cfg.DB.Pass = "db-password"
+	cfg.Migration.DSN = "host=db password=db-password"
+	cfg.Auth.JWTSecret = "jwt-secret"
+	cfg.Auth.BootstrapKeyHash = "bootstrap-hash"
+	cfg.DB.User = "songs"
+
+	r := cfg.Redacted()
+	for _, tc := range []struct {
+		setting, got, want string
+	}{
+		{"DB_PASS", r.DB.Pass, redacted},
+		{"MIGRATION_DSN", r.Migration.DSN, redacted},
+		{"AUTH_JWT_SECRET", r.Auth.JWTSecret, redacted},
+		{"AUTH_BOOTSTRAP_KEY_HASH", r.Auth.BootstrapKeyHash, redacted},
+		// Unset secrets stay empty, so it is visible that they are not set.
+		{"CACHE_REDIS_PASSWORD", r.Cache.RedisPassword, ""},
+		{"DB_USER", r.DB.User, "songs"},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("redacted %s = %q, want %q", tc.setting, tc.got, tc.want)
+		}
+	}
+	if cfg.DB.Pass != "db-password" {
+		t.Errorf("Redacted changed the original DB_PASS to %q", cfg.DB.Pass)
+	}
+
+	s := cfg.String()
+	for _, secret := range []string{"db-password", "jwt-secret", "bootstrap-hash"} {
+		if strings.Contains(s, secret) {
+			t.Errorf("String() contains the secret %q: %s", secret, s)
+		}
+	}
+	if !strings.Contains(s, redacted) || !strings.Contains(s, "songs") {
+		t.Errorf("String() = %s, want the redacted secrets and the other settings", s)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := Default()
+	valid.Auth.BootstrapKeyHash = "hash"
+
+	for _, tc := range []struct {
+		name string
+		edit func(*Config)
+		want []string
+	}{
+		{name: "defaults with a bootstrap key", edit: func(*Config) {}},
+		{name: "JWT instead of a bootstrap key", edit: func(c *Config) {
+			c.Auth.BootstrapKeyHash, c.Auth.JWTAlg, c.Auth.JWTSecret = "", "HS256", "secret"
+		}},
+		{name: "authentication disabled", edit: func(c *Config) {
+			c.Auth.Enabled, c.Auth.BootstrapKeyHash = false, ""
+		}},
+		{
+			name: "authentication nobody can pass",
+			edit: func(c *Config) { c.Auth.BootstrapKeyHash = "" },
+			want: []string{"AUTH_ENABLED requires AUTH_BOOTSTRAP_KEY_HASH or AUTH_JWT_ALG"},
+		},
+		{
+			name: "every problem at once",
+			edit: func(c *Config) {
+				c.DB.Backend = "mongo"
+				c.Auth.JWTAlg = "HS256"
+				c.Log.Levels = map[string]string{"postgres": "loud"}
+			},
+			want: []string{
+				"DB_BACKEND must be one of",
+				"AUTH_JWT_SECRET is required for HS256",
+				"LOG_LEVELS: level of postgres",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := valid
+			tc.edit(&cfg)
+			err := cfg.Validate()
+			if len(tc.want) == 0 {
+				if err != nil {
+					t.Fatalf("Validate: %v", err)
+				}
+				return
+			}
+			verr, ok := err.(*ValidationError)
+			if !ok {
+				t.Fatalf("Validate = %v, want a *ValidationError", err)
+			}
+			if len(verr.Problems) != len(tc.want) {
+				t.Errorf("problems = %q, want %d", verr.Problems, len(tc.want))
+			}
+			for i, want := range tc.want {
+				if i < len(verr.Problems) && !strings.HasPrefix(verr.Problems[i], want) {
+					t.Errorf("problem %d = %q, want %q", i, verr.Problems[i], want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+// Package enrichment fetches song details from the external song info API.
+package enrichment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	"github.com/SemenShakhray/list-of-song/internal/config"
+	"github.com/SemenShakhray/list-of-song/internal/metrics"
+	"github.com/SemenShakhray/list-of-song/internal/models"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// requestTimeout bounds a single call to the external API.
+const requestTimeout = 10 * time.Second
+
+type Client struct {
+	api     atomic.Pointer[config.API]
+	http    *http.Client
+	metrics *metrics.Metrics
+}
+
+// NewClient creates a client of the API at cfg.Host:cfg.Port. m may be nil.
+func NewClient(cfg config.API, m *metrics.Metrics) *Client {
+	c := &Client{
+		http: &http.Client{
+			Timeout: requestTimeout,
+			// The transport traces the call and propagates the trace context
+			// to the API.
+			Transport: otelhttp.NewTransport(http.DefaultTransport),
+		},
+		metrics: m,
+	}
+	c.api.Store(&cfg)
+	return c
+}
+
+// Configure switches the client to another API or turns enrichment on or
+// off, requests already running finish with the old settings.
+func (c *Client) Configure(cfg config.API) {
+	c.api.Store(&cfg)
+}
+
+// Enabled reports whether songs should be enriched, see config.API.Call.
+func (c *Client) Enabled() bool {
+	return c.api.Load().Call
+}
+
+func (c *Client) hostPort() string {
+	api := c.api.Load()
+	return net.JoinHostPort(api.Host, api.Port)
+}
+
+// Enrich fills the details of song from the /info endpoint, the song is
+// looked up by its group and name.
+func (c *Client) Enrich(ctx context.Context, song *models.Song) (err error) {
+	start := time.Now()
+	defer func() {
+		if c.metrics == nil {
+			return
+		}
+		c.metrics.EnrichmentDuration.Observe(time.Since(start).Seconds())
+		result := "success"
+		if err != nil {
+			result = "failure"
+		}
+		c.metrics.EnrichmentRequests.WithLabelValues(result).Inc()
+	}()
+
+	apiURL := fmt.Sprintf("http://%s/info?group=%s&song=%s", c.hostPort(), url.QueryEscape(song.Group), url.QueryEscape(song.Song))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch song details: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch song details: unexpected status %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(song); err != nil {
+		return fmt.Errorf("failed to decode API response: %w", err)
+	}
+	return nil
+}
+
+// Ping checks that the API answers. Any response below 500 counts, the
+// request has no song to look up.
+func (c *Client) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://%s/info", c.hostPort()), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach API: %w", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("API is unavailable: status %d", resp.StatusCode)
+	}
+	return nil
+}
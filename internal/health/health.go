@@ -0,0 +1,111 @@
+// Package health reports whether the service and its dependencies are up.
+package health
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusOK   Status = "ok"
+	StatusFail Status = "fail"
+	// StatusShuttingDown is reported once the service started to stop.
+	StatusShuttingDown Status = "shutting_down"
+	// StatusDisabled is reported by checks of dependencies that are turned
+	// off, they do not fail the report.
+	StatusDisabled Status = "disabled"
+)
+
+// ErrDisabled is returned by a check whose dependency is turned off.
+var ErrDisabled = errors.New("disabled")
+
+// Check returns an error when the dependency it checks is not usable.
+type Check func(ctx context.Context) error
+
+type Result struct {
+	Status Status `json:"status"`
+	// LatencyMs is how long the check took in milliseconds.
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type Report struct {
+	Status Status            `json:"status"`
+	Checks map[string]Result `json:"checks,omitempty"`
+}
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checker runs the readiness checks of the service dependencies.
+type Checker struct {
+	timeout      time.Duration
+	checks       []namedCheck
+	shuttingDown atomic.Bool
+}
+
+// NewChecker creates a checker that gives every check up to timeout.
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+// Add registers a check. It must be called before the checker is used.
+func (c *Checker) Add(name string, check Check) {
+	c.checks = append(c.checks, namedCheck{name: name, check: check})
+}
+
+// ShutDown makes the checker report the service as not ready, so load
+// balancers stop sending requests before the server stops.
+func (c *Checker) ShutDown() {
+	c.shuttingDown.Store(true)
+}
+
+// Ready runs all checks concurrently. The report is ok only when every check
+// passed and the service is not shutting down.
+func (c *Checker) Ready(ctx context.Context) Report {
+	if c.shuttingDown.Load() {
+		return Report{Status: StatusShuttingDown}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]Result, len(c.checks))}
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for _, nc := range c.checks {
+		wg.Add(1)
+		go func(nc namedCheck) {
+			defer wg.Done()
+
+			start := time.Now()
+			err := nc.check(ctx)
+			res := Result{Status: StatusOK, LatencyMs: float64(time.Since(start).Microseconds()) / 1000}
+			switch {
+			case errors.Is(err, ErrDisabled):
+				res.Status = StatusDisabled
+			case err != nil:
+				res.Status = StatusFail
+				res.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[nc.name] = res
+			if res.Status == StatusFail {
+				report.Status = StatusFail
+			}
+		}(nc)
+	}
+	wg.Wait()
+	return report
+}
@@ -0,0 +1,122 @@
+// Package metrics holds the Prometheus metrics of the service.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "songs"
+
+type Metrics struct {
+	registry *prometheus.Registry
+
+	HTTPRequests       *prometheus.CounterVec
+	HTTPDuration       *prometheus.HistogramVec
+	HTTPInFlight       prometheus.Gauge
+	EnrichmentRequests *prometheus.CounterVec
+	EnrichmentDuration prometheus.Histogram
+	StorageDuration    *prometheus.HistogramVec
+	StorageErrors      *prometheus.CounterVec
+	CacheRequests      *prometheus.CounterVec
+	WebhookDeliveries  *prometheus.CounterVec
+	EventSubscribers   prometheus.Gauge
+}
+
+// New creates the metrics in their own registry together with the Go runtime
+// and process collectors. The connection pools are added with AddDB and
+// AddPgxPool.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		HTTPRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by method, route pattern and status.",
+		}, []string{"method", "route", "status"}),
+		HTTPDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by method, route pattern and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		HTTPInFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "http_requests_in_flight",
+			Help:      "HTTP requests being served.",
+		}),
+		EnrichmentRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "enrichment_requests_total",
+			Help:      "Calls to the external song info API by result.",
+		}, []string{"result"}),
+		EnrichmentDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "enrichment_request_duration_seconds",
+			Help:      "Latency of calls to the external song info API.",
+			Buckets:   prometheus.DefBuckets,
+		}),
+		StorageDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "storage_query_duration_seconds",
+			Help:      "Latency of storage methods.",
+			Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		}, []string{"method"}),
+		StorageErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "storage_errors_total",
+			Help:      "Failed storage method calls.",
+		}, []string{"method"}),
+		CacheRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "cache_requests_total",
+			Help:      "Cached storage reads by method and result: hit, miss or error.",
+		}, []string{"method", "result"}),
+		WebhookDeliveries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "webhook_delivery_attempts_total",
+			Help:      "Webhook delivery attempts by result: delivered, retry or failed.",
+		}, []string{"result"}),
+		EventSubscribers: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "event_stream_subscribers",
+			Help:      "Clients connected to the song event stream.",
+		}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.HTTPRequests,
+		m.HTTPDuration,
+		m.HTTPInFlight,
+		m.EnrichmentRequests,
+		m.EnrichmentDuration,
+		m.StorageDuration,
+		m.StorageErrors,
+		m.CacheRequests,
+		m.WebhookDeliveries,
+		m.EventSubscribers,
+	)
+	return m
+}
+
+// AddDB exports the connection pool statistics of db labelled with name.
+func (m *Metrics) AddDB(name string, db *sql.DB) {
+	m.registry.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// AddPgxPool exports the statistics of a pgx pool labelled with name.
+func (m *Metrics) AddPgxPool(name string, pool *pgxpool.Pool) {
+	m.registry.MustRegister(newPgxPoolCollector(pool, name))
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
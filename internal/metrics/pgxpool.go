@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// pgxPoolCollector exports the statistics of a pgx connection pool, the
+// counterpart of the database/sql DBStatsCollector.
+type pgxPoolCollector struct {
+	pool *pgxpool.Pool
+
+	maxConns          *prometheus.Desc
+	totalConns        *prometheus.Desc
+	acquiredConns     *prometheus.Desc
+	idleConns         *prometheus.Desc
+	constructingConns *prometheus.Desc
+	acquires          *prometheus.Desc
+	acquireDuration   *prometheus.Desc
+	emptyAcquires     *prometheus.Desc
+	canceledAcquires  *prometheus.Desc
+	newConns          *prometheus.Desc
+	lifetimeDestroys  *prometheus.Desc
+	idleDestroys      *prometheus.Desc
+}
+
+func newPgxPoolCollector(pool *pgxpool.Pool, name string) *pgxPoolCollector {
+	desc := func(metric, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "pgxpool", metric), help,
+			nil, prometheus.Labels{"db_name": name})
+	}
+	return &pgxPoolCollector{
+		pool:              pool,
+		maxConns:          desc("max_conns", "Maximum size of the pool."),
+		totalConns:        desc("total_conns", "Connections in the pool: acquired, idle and being constructed."),
+		acquiredConns:     desc("acquired_conns", "Connections in use."),
+		idleConns:         desc("idle_conns", "Idle connections."),
+		constructingConns: desc("constructing_conns", "Connections being established."),
+		acquires:          desc("acquires_total", "Successful acquires of a connection."),
+		acquireDuration:   desc("acquire_duration_seconds_total", "Total time spent acquiring connections."),
+		emptyAcquires:     desc("empty_acquires_total", "Acquires that waited for a connection because the pool was empty."),
+		canceledAcquires:  desc("canceled_acquires_total", "Acquires cancelled by their context."),
+		newConns:          desc("new_conns_total", "Connections opened."),
+		lifetimeDestroys:  desc("max_lifetime_destroys_total", "Connections closed because they reached their maximum lifetime."),
+		idleDestroys:      desc("max_idle_destroys_total", "Connections closed because they were idle too long."),
+	}
+}
+
+func (c *pgxPoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.maxConns
+	ch <- c.totalConns
+	ch <- c.acquiredConns
+	ch <- c.idleConns
+	ch <- c.constructingConns
+	ch <- c.acquires
+	ch <- c.acquireDuration
+	ch <- c.emptyAcquires
+	ch <- c.canceledAcquires
+	ch <- c.newConns
+	ch <- c.lifetimeDestroys
+	ch <- c.idleDestroys
+}
+
+func (c *pgxPoolCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.pool.Stat()
+	ch <- prometheus.MustNewConstMetric(c.maxConns, prometheus.GaugeValue, float64(s.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(c.totalConns, prometheus.GaugeValue, float64(s.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(c.acquiredConns, prometheus.GaugeValue, float64(s.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(c.idleConns, prometheus.GaugeValue, float64(s.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(c.constructingConns, prometheus.GaugeValue, float64(s.ConstructingConns()))
+	ch <- prometheus.MustNewConstMetric(c.acquires, prometheus.CounterValue, float64(s.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.acquireDuration, prometheus.CounterValue, s.AcquireDuration().Seconds())
+	ch <- prometheus.MustNewConstMetric(c.emptyAcquires, prometheus.CounterValue, float64(s.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.canceledAcquires, prometheus.CounterValue, float64(s.CanceledAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.newConns, prometheus.CounterValue, float64(s.NewConnsCount()))
+	ch <- prometheus.MustNewConstMetric(c.lifetimeDestroys, prometheus.CounterValue, float64(s.MaxLifetimeDestroyCount()))
+	ch <- prometheus.MustNewConstMetric(c.idleDestroys, prometheus.CounterValue, float64(s.MaxIdleDestroyCount()))
+}
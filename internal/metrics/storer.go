@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/SemenShakhray/list-of-song/internal/models"
+	"github.com/SemenShakhray/list-of-song/internal/storage"
+)
+
+// storer records the latency and errors of every method of the wrapped Storer.
+type storer struct {
+	next storage.Storer
+	m    *Metrics
+}
+
+// Storer wraps next so that its calls are measured.
+func Storer(next storage.Storer, m *Metrics) storage.Storer {
+	return &storer{next: next, m: m}
+}
+
+// observe is deferred with a pointer to the named error result, so it sees
+// the error the method returned.
+func (s *storer) observe(method string, start time.Time, err *error) {
+	s.m.StorageDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	if *err != nil {
+		s.m.StorageErrors.WithLabelValues(method).Inc()
+	}
+}
+
+func (s *storer) GetAll(ctx context.Context, filters models.Filters) (songs []models.Song, err error) {
+	defer s.observe("GetAll", time.Now(), &err)
+	return s.next.GetAll(ctx, filters)
+}
+
+func (s *storer) AddSong(ctx context.Context, song models.Song) (err error) {
+	defer s.observe("AddSong", time.Now(), &err)
+	return s.next.AddSong(ctx, song)
+}
+
+func (s *storer) Update(ctx context.Context, song models.Song) (err error) {
+	defer s.observe("Update", time.Now(), &err)
+	return s.next.Update(ctx, song)
+}
+
+func (s *storer) Delete(ctx context.Context, id int) (err error) {
+	defer s.observe("Delete", time.Now(), &err)
+	return s.next.Delete(ctx, id)
+}
+
+func (s *storer) GetText(ctx context.Context, filters models.Filters, id int) (text string, err error) {
+	defer s.observe("GetText", time.Now(), &err)
+	return s.next.GetText(ctx, filters, id)
+}
+
+func (s *storer) Export(ctx context.Context, filters models.Filters, fn func(models.Song) error) (err error) {
+	defer s.observe("Export", time.Now(), &err)
+	return s.next.Export(ctx, filters, fn)
+}
+
+func (s *storer) GetTrash(ctx context.Context, filters models.Filters) (songs []models.Song, err error) {
+	defer s.observe("GetTrash", time.Now(), &err)
+	return s.next.GetTrash(ctx, filters)
+}
+
+func (s *storer) Restore(ctx context.Context, id int) (err error) {
+	defer s.observe("Restore", time.Now(), &err)
+	return s.next.Restore(ctx, id)
+}
+
+func (s *storer) Purge(ctx context.Context, before time.Time) (n int64, err error) {
+	defer s.observe("Purge", time.Now(), &err)
+	return s.next.Purge(ctx, before)
+}
+
+func (s *storer) GetHistory(ctx context.Context, id int, limit, offset int) (revisions []models.Revision, err error) {
+	defer s.observe("GetHistory", time.Now(), &err)
+	return s.next.GetHistory(ctx, id, limit, offset)
+}
+
+func (s *storer) GetRevision(ctx context.Context, id int, revision int) (rev models.Revision, err error) {
+	defer s.observe("GetRevision", time.Now(), &err)
+	return s.next.GetRevision(ctx, id, revision)
+}
+
+func (s *storer) Revert(ctx context.Context, id int, revision int) (err error) {
+	defer s.observe("Revert", time.Now(), &err)
+	return s.next.Revert(ctx, id, revision)
+}
+
+// WithTx measures the whole transaction and the calls made inside it.
+func (s *storer) WithTx(ctx context.Context, fn func(storage.Storer) error, opts ...storage.TxOption) (err error) {
+	defer s.observe("WithTx", time.Now(), &err)
+	return s.next.WithTx(ctx, func(tx storage.Storer) error {
+		return fn(&storer{next: tx, m: s.m})
+	}, opts...)
+}
@@ -1,5 +1,11 @@
 package models
 
+import (
+	"time"
+
+	"github.com/SemenShakhray/list-of-song/pkg/textdiff"
+)
+
 type Song struct {
 	Id    int    `json:"id"`
 	Song  string `json:"song"`
@@ -7,6 +13,8 @@ type Song struct {
 	Text  string `json:"text"`
 	Link  string `json:"link"`
 	Date  string `json:"date"`
+	// DeletedAt is set for songs in the trash.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
 
 type Filters struct {
@@ -18,3 +26,85 @@ type Filters struct {
 	Limit  int
 	Offset int
 }
+
+// Batch operation kinds.
+const (
+	OpCreate = "create"
+	OpUpdate = "update"
+	OpDelete = "delete"
+)
+
+// Batch operation result statuses.
+const (
+	StatusOK         = "ok"
+	StatusFailed     = "failed"
+	StatusRolledBack = "rolled_back"
+	StatusSkipped    = "skipped"
+)
+
+type BatchOperation struct {
+	Op   string `json:"op"`
+	Id   int    `json:"id,omitempty"`
+	Song Song   `json:"song"`
+}
+
+type BatchRequest struct {
+	// BestEffort applies every operation on its own and reports each result,
+	// by default the whole batch runs in one transaction.
+	BestEffort bool             `json:"best_effort"`
+	Operations []BatchOperation `json:"operations"`
+}
+
+type BatchResult struct {
+	Index  int    `json:"index"`
+	Op     string `json:"op"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Revision actions.
+const (
+	RevisionCreate  = "create"
+	RevisionUpdate  = "update"
+	RevisionDelete  = "delete"
+	RevisionRestore = "restore"
+	RevisionRevert  = "revert"
+)
+
+// Revision is an immutable record of one change to a song. Before is empty
+// for the revision that created the song.
+type Revision struct {
+	SongId    int       `json:"song_id"`
+	Revision  int       `json:"revision"`
+	Action    string    `json:"action"`
+	Before    *Song     `json:"before,omitempty"`
+	After     *Song     `json:"after,omitempty"`
+	Actor     string    `json:"actor"`
+	RequestId string    `json:"request_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// LyricsDiff is the difference between the song text after revision From and
+// after revision To. Revision 0 stands for the empty text before the song was created.
+type LyricsDiff struct {
+	SongId int             `json:"song_id"`
+	From   int             `json:"from"`
+	To     int             `json:"to"`
+	Lines  []textdiff.Line `json:"lines"`
+
+	OldText string `json:"-"`
+	NewText string `json:"-"`
+}
+
+// APIKey is a key used to authenticate requests. Key holds the plain key and
+// is only filled in the response that created it.
+type APIKey struct {
+	Id        int        `json:"id"`
+	Name      string     `json:"name"`
+	Prefix    string     `json:"prefix"`
+	Role      string     `json:"role"`
+	Hash      string     `json:"-"`
+	Key       string     `json:"key,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Song event types webhooks subscribe to.
+const (
+	EventSongCreated = "song.created"
+	EventSongUpdated = "song.updated"
+	EventSongDeleted = "song.deleted"
+)
+
+// EventTypes lists every song event type.
+var EventTypes = []string{EventSongCreated, EventSongUpdated, EventSongDeleted}
+
+// RevisionEvent returns the type of the event raised by a revision action. A
+// restored song appears again and a reverted one changes.
+func RevisionEvent(action string) string {
+	switch action {
+	case RevisionCreate, RevisionRestore:
+		return EventSongCreated
+	case RevisionDelete:
+		return EventSongDeleted
+	default:
+		return EventSongUpdated
+	}
+}
+
+// Event is a change of a song as it is sent to webhooks. Data holds a
+// SongChange.
+type Event struct {
+	Id        int64           `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// SongChange is the data of a song event: the revision that recorded the
+// change and the song before and after it.
+type SongChange struct {
+	SongId   int    `json:"song_id"`
+	Revision int    `json:"revision"`
+	Action   string `json:"action"`
+	Song     *Song  `json:"song,omitempty"`
+	Previous *Song  `json:"previous,omitempty"`
+}
+
+// Webhook is a subscription to song events. Secret signs the deliveries and
+// is only filled in the response that created the webhook.
+type Webhook struct {
+	Id        int       `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Webhook delivery statuses.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookDelivery is the log entry of sending one event to one webhook. A
+// pending delivery is tried again at NextAttemptAt.
+type WebhookDelivery struct {
+	Id             int64      `json:"id"`
+	WebhookId      int        `json:"webhook_id"`
+	EventId        int64      `json:"event_id"`
+	EventType      string     `json:"event_type"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at"`
+	LastStatusCode int        `json:"last_status_code,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+}
+
+// DueDelivery is a delivery claimed for an attempt, with the event and the
+// endpoint it goes to.
+type DueDelivery struct {
+	WebhookDelivery
+	Event  Event
+	URL    string
+	Secret string
+}
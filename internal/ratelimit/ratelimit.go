@@ -0,0 +1,122 @@
+// Package ratelimit implements per-client token buckets.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// sweepInterval is how often buckets that are full again are dropped.
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter keeps one token bucket per key. Every bucket holds up to burst
+// tokens and refills at rate tokens per second, a request takes one token.
+type Limiter struct {
+	mu        sync.Mutex
+	rate      float64
+	burst     int
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+	disabled  atomic.Bool
+}
+
+func NewLimiter(rate float64, burst int) *Limiter {
+	return &Limiter{
+		rate:    rate,
+		burst:   burst,
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// SetEnabled turns the limiter on or off, a disabled limiter is skipped by
+// the middleware. Limiters start enabled.
+func (l *Limiter) SetEnabled(enabled bool) {
+	l.disabled.Store(!enabled)
+}
+
+func (l *Limiter) Enabled() bool {
+	return !l.disabled.Load()
+}
+
+// Result describes the bucket of a key after a request.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is the time until the next request is allowed, zero when
+	// this one was.
+	RetryAfter time.Duration
+}
+
+// Allow takes a token from the bucket of key if there is one.
+func (l *Limiter) Allow(key string) Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.burst), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(l.burst), b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	res := Result{Limit: l.burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = l.refillTime(1 - b.tokens)
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = l.refillTime(float64(l.burst) - b.tokens)
+	return res
+}
+
+// SetLimit changes the rate and burst of all buckets.
+func (l *Limiter) SetLimit(rate float64, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.rate = rate
+	l.burst = burst
+}
+
+func (l *Limiter) refillTime(tokens float64) time.Duration {
+	if tokens <= 0 {
+		return 0
+	}
+	if l.rate <= 0 {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(tokens / l.rate * float64(time.Second))
+}
+
+// sweep drops buckets that have refilled completely, they are recreated full
+// on the next request, so this only frees memory.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= float64(l.burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package ratelimit
+
+import (
+	"sort"
+	"testing"
+	"time"
+)
+
+// newTestLimiter returns a limiter on a clock that only advance moves.
+func newTestLimiter(rate float64, burst int) (*Limiter, func(time.Duration)) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	l := NewLimiter(rate, burst)
+	l.now = func() time.Time { return now }
+	return l, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestLimiterBurst(t *testing.T) {
+	l, _ := newTestLimiter(2, 4)
+
+	for i := 0; i < 4; i++ {
+		res := l.Allow("a")
+		if !res.Allowed || res.Remaining != 3-i || res.Limit != 4 || res.RetryAfter != 0 {
+			t.Fatalf("request %d = %+v, want allowed with %d remaining", i+1, res, 3-i)
+		}
+	}
+	res := l.Allow("a")
+	if res.Allowed || res.Remaining != 0 {
+		t.Fatalf("request over the burst = %+v, want rejected", res)
+	}
+	if res.RetryAfter != 500*time.Millisecond {
+		t.Errorf("RetryAfter = %s, want the time of one token, 500ms", res.RetryAfter)
+	}
+	if res.Reset != 2*time.Second {
+		t.Errorf("Reset = %s, want the time to refill 4 tokens, 2s", res.Reset)
+	}
+}
+
+func TestLimiterRefill(t *testing.T) {
+	l, advance := newTestLimiter(2, 4)
+	for i := 0; i < 4; i++ {
+		l.Allow("a")
+	}
+
+	advance(250 * time.Millisecond)
+	if res := l.Allow("a"); res.Allowed || res.RetryAfter != 250*time.Millisecond {
+		t.Errorf("after half a token = %+v, want rejected for 250ms more", res)
+	}
+	advance(250 * time.Millisecond)
+	if res := l.Allow("a"); !res.Allowed {
+		t.Errorf("after one token = %+v, want allowed", res)
+	}
+	if res := l.Allow("a"); res.Allowed {
+		t.Errorf("second request after one token = %+v, want rejected", res)
+	}
+
+	// The bucket never holds more than the burst.
+	advance(time.Hour)
+	if res := l.Allow("a"); !res.Allowed || res.Remaining != 3 {
+		t.Errorf("after an hour = %+v, want allowed with 3 remaining", res)
+	}
+}
+
+func TestLimiterKeys(t *testing.T) {
+	l, _ := newTestLimiter(1, 1)
+	if !l.Allow("a").Allowed || l.Allow("a").Allowed {
+		t.Fatal("a did not get exactly one request")
+	}
+	if res := l.Allow("b"); !res.Allowed {
+		t.Errorf("b = %+v after a used its bucket, want allowed", res)
+	}
+}
+
+func TestLimiterSweepsIdleBuckets(t *testing.T) {
+	l, advance := newTestLimiter(1, 100)
+	for i := 0; i < 100; i++ {
+		l.Allow("busy")
+	}
+	l.Allow("idle")
+
+	// idle is full again after 61s, busy has 61 of 100 tokens.
+	advance(sweepInterval + time.Second)
+	l.Allow("new")
+
+	var keys []string
+	for key := range l.buckets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if len(keys) != 2 || keys[0] != "busy" || keys[1] != "new" {
+		t.Errorf("buckets after the sweep = %v, want busy and new", keys)
+	}
+	// A swept bucket comes back full.
+	if res := l.Allow("idle"); !res.Allowed || res.Remaining != 99 {
+		t.Errorf("idle after the sweep = %+v, want a full bucket", res)
+	}
+}
+
+func TestLimiterSetLimit(t *testing.T) {
+	l, advance := newTestLimiter(1, 1)
+	l.Allow("a")
+
+	l.SetLimit(10, 5)
+	advance(time.Second)
+	res := l.Allow("a")
+	if !res.Allowed || res.Limit != 5 || res.Remaining != 4 {
+		t.Errorf("after SetLimit = %+v, want the new rate and burst", res)
+	}
+
+	l.SetLimit(0, 1)
+	l.Allow("b")
+	if res := l.Allow("b"); res.Allowed || res.RetryAfter <= 0 {
+		t.Errorf("with rate 0 = %+v, want rejected with a retry time", res)
+	}
+}
+
+func TestLimiterEnabled(t *testing.T) {
+	l := NewLimiter(1, 1)
+	if !l.Enabled() {
+		t.Error("new limiter is disabled, want enabled")
+	}
+	l.SetEnabled(false)
+	if l.Enabled() {
+		t.Error("limiter is enabled after SetEnabled(false)")
+	}
+}
@@ -0,0 +1,57 @@
+package requestctx
+
+import "context"
+
+type ctxKey int
+
+const (
+	actorKey ctxKey = iota
+	requestIDKey
+	sessionKey
+	primaryKey
+)
+
+// WithActor returns a copy of ctx carrying the name of the caller making the change.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey, actor)
+}
+
+// Actor returns the caller stored in ctx, or an empty string.
+func Actor(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey).(string)
+	return actor
+}
+
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID returns the request ID stored in ctx, or an empty string.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// WithSession returns a copy of ctx carrying the key of the client session,
+// the storage reads the writes of a session back from the primary database.
+func WithSession(ctx context.Context, session string) context.Context {
+	return context.WithValue(ctx, sessionKey, session)
+}
+
+// Session returns the session stored in ctx, or an empty string.
+func Session(ctx context.Context) string {
+	session, _ := ctx.Value(sessionKey).(string)
+	return session
+}
+
+// WithPrimary returns a copy of ctx whose reads go to the primary database,
+// for reads that must see every committed write.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey, true)
+}
+
+// Primary reports whether the reads of ctx must go to the primary database.
+func Primary(ctx context.Context) bool {
+	primary, _ := ctx.Value(primaryKey).(bool)
+	return primary
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/SemenShakhray/list-of-song/internal/models"
+	"github.com/SemenShakhray/list-of-song/internal/storage"
+)
+
+// ErrBatchAborted is returned when an atomic batch was rolled back.
+var ErrBatchAborted = errors.New("batch aborted")
+
+// Batch applies ops in order. An atomic batch stops at the first failing
+// operation and rolls back everything, the results then tell which operation
+// failed. A best-effort batch applies every operation independently.
+func (s *Service) Batch(ctx context.Context, ops []models.BatchOperation, atomic bool) (results []models.BatchResult, err error) {
+	ctx, end := startSpan(ctx, "Batch")
+	defer end(&err)
+
+	return s.batch(ctx, ops, atomic)
+}
+
+func (s *Service) batch(ctx context.Context, ops []models.BatchOperation, atomic bool) ([]models.BatchResult, error) {
+	results := make([]models.BatchResult, len(ops))
+	for i, op := range ops {
+		results[i] = models.BatchResult{Index: i, Op: op.Op, Status: models.StatusSkipped}
+	}
+
+	if !atomic {
+		for i, op := range ops {
+			if err := applyOperation(ctx, s.storage, op); err != nil {
+				results[i].Status = models.StatusFailed
+				results[i].Error = err.Error()
+				continue
+			}
+			results[i].Status = models.StatusOK
+		}
+		return results, nil
+	}
+
+	failed := -1
+	err := s.storage.WithTx(ctx, func(tx storage.Storer) error {
+		// The transaction may be retried, start every attempt from scratch.
+		failed = -1
+		for i := range results {
+			results[i].Status = models.StatusSkipped
+			results[i].Error = ""
+		}
+		for i, op := range ops {
+			if err := applyOperation(ctx, tx, op); err != nil {
+				failed = i
+				results[i].Status = models.StatusFailed
+				results[i].Error = err.Error()
+				return fmt.Errorf("%w: operation %d (%s): %w", ErrBatchAborted, i, op.Op, err)
+			}
+			results[i].Status = models.StatusOK
+		}
+		return nil
+	})
+	if err != nil {
+		for i := range results {
+			if results[i].Status == models.StatusOK {
+				results[i].Status = models.StatusRolledBack
+			}
+		}
+		if failed < 0 {
+			// The operations went through but the commit did not.
+			return results, fmt.Errorf("%w: %w", ErrBatchAborted, err)
+		}
+		return results, err
+	}
+
+	return results, nil
+}
+
+func applyOperation(ctx context.Context, store storage.Storer, op models.BatchOperation) error {
+	switch op.Op {
+	case models.OpCreate:
+		return store.AddSong(ctx, op.Song)
+	case models.OpUpdate:
+		if op.Id <= 0 {
+			return fmt.Errorf("invalid id: %d", op.Id)
+		}
+		op.Song.Id = op.Id
+		return store.Update(ctx, op.Song)
+	case models.OpDelete:
+		if op.Id <= 0 {
+			return fmt.Errorf("invalid id: %d", op.Id)
+		}
+		return store.Delete(ctx, op.Id)
+	}
+	return fmt.Errorf("unknown operation: %q", op.Op)
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/SemenShakhray/list-of-song/internal/models"
+	"github.com/SemenShakhray/list-of-song/pkg/textdiff"
+)
+
+// DiffLyrics compares the song text after revision from with the text after
+// revision to. A zero to means the latest revision, a zero from means the
+// revision before to, so by default the last change is shown.
+func (s *Service) DiffLyrics(ctx context.Context, id int, from, to int) (diff models.LyricsDiff, err error) {
+	ctx, end := startSpan(ctx, "DiffLyrics")
+	defer end(&err)
+
+	return s.diffLyrics(ctx, id, from, to)
+}
+
+func (s *Service) diffLyrics(ctx context.Context, id int, from, to int) (models.LyricsDiff, error) {
+	var (
+		newRev models.Revision
+		err    error
+	)
+	if to == 0 {
+		history, err := s.storage.GetHistory(ctx, id, 1, 0)
+		if err != nil {
+			return models.LyricsDiff{}, err
+		}
+		if len(history) == 0 {
+			return models.LyricsDiff{}, fmt.Errorf("song has no history")
+		}
+		newRev = history[0]
+	} else {
+		newRev, err = s.storage.GetRevision(ctx, id, to)
+		if err != nil {
+			return models.LyricsDiff{}, err
+		}
+	}
+
+	diff := models.LyricsDiff{
+		SongId:  id,
+		To:      newRev.Revision,
+		NewText: revisionText(newRev.After),
+	}
+
+	if from == 0 {
+		diff.From = newRev.Revision - 1
+		diff.OldText = revisionText(newRev.Before)
+	} else {
+		oldRev, err := s.storage.GetRevision(ctx, id, from)
+		if err != nil {
+			return models.LyricsDiff{}, err
+		}
+		diff.From = oldRev.Revision
+		diff.OldText = revisionText(oldRev.After)
+	}
+
+	diff.Lines, err = textdiff.Lines(diff.OldText, diff.NewText)
+	if err != nil {
+		return models.LyricsDiff{}, err
+	}
+	return diff, nil
+}
+
+func revisionText(song *models.Song) string {
+	if song == nil {
+		return ""
+	}
+	return song.Text
+}
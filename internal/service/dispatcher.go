@@ -0,0 +1,310 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/SemenShakhray/list-of-song/internal/config"
+	"github.com/SemenShakhray/list-of-song/internal/metrics"
+	"github.com/SemenShakhray/list-of-song/internal/models"
+	"github.com/SemenShakhray/list-of-song/internal/storage"
+
+	"go.uber.org/zap"
+)
+
+// Headers of the webhook delivery requests.
+const (
+	HeaderWebhookEvent     = "X-Webhook-Event"
+	HeaderWebhookEventID   = "X-Webhook-Event-Id"
+	HeaderWebhookDelivery  = "X-Webhook-Delivery"
+	HeaderWebhookTimestamp = "X-Webhook-Timestamp"
+	HeaderWebhookSignature = "X-Webhook-Signature"
+)
+
+const (
+	// dispatchBatch is how many events or deliveries the dispatcher takes at
+	// once.
+	dispatchBatch = 50
+	// webhookBatch is how many deliveries of one webhook the dispatcher takes
+	// at once. They are sent one after another, so it bounds how long a
+	// claimed delivery waits for its turn.
+	webhookBatch = 5
+	// leaseMargin is added to the time the deliveries of one webhook take at
+	// most to get how long a claimed delivery is kept from other instances.
+	leaseMargin = 30 * time.Second
+	// pruneInterval is how often the delivery log is pruned.
+	pruneInterval = time.Hour
+	// maxResponseBody is how much of a response is read to reuse the connection.
+	maxResponseBody = 64 << 10
+)
+
+// SignWebhook returns the signature of a delivery: the hex encoded
+// HMAC-SHA256 with secret of the timestamp in Unix seconds, a dot and the
+// body. Receivers compute it the same way and reject old timestamps, so a
+// captured request cannot be replayed later.
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Dispatcher sends song events to the webhooks. It moves new events from the
+// outbox to the deliveries and sends the deliveries that are due, a failed
+// delivery is retried with exponential backoff until it runs out of attempts.
+// Every instance may run a dispatcher, a delivery is claimed by one of them
+// at a time. An event is delivered at least once, receivers tell repeated
+// deliveries apart by the event ID.
+type Dispatcher struct {
+	storage storage.WebhookStorer
+	log     *zap.Logger
+	metrics *metrics.Metrics
+	cfg     config.Webhooks
+	client  *http.Client
+
+	// busy are the webhooks whose deliveries are being sent, senders are the
+	// goroutines sending them.
+	mu      sync.Mutex
+	busy    map[int]bool
+	senders sync.WaitGroup
+}
+
+func NewDispatcher(store storage.WebhookStorer, log *zap.Logger, m *metrics.Metrics, cfg config.Webhooks) *Dispatcher {
+	return &Dispatcher{
+		storage: store,
+		log:     log,
+		metrics: m,
+		cfg:     cfg,
+		busy:    make(map[int]bool),
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+			// A redirect is a failed delivery, the webhook URL has to be
+			// changed instead.
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// Run dispatches events and sends deliveries once and then every poll
+// interval until ctx is cancelled. It returns once the deliveries being sent
+// are done.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.cfg.PollInterval)
+	defer ticker.Stop()
+	defer d.senders.Wait()
+
+	var pruned time.Time
+	for {
+		d.dispatch(ctx)
+		d.deliver(ctx)
+		if time.Since(pruned) >= pruneInterval {
+			d.prune(ctx)
+			pruned = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dispatch turns the events in the outbox into deliveries.
+func (d *Dispatcher) dispatch(ctx context.Context) {
+	for ctx.Err() == nil {
+		n, err := d.storage.DispatchEvents(ctx, dispatchBatch)
+		if err != nil {
+			if ctx.Err() == nil {
+				d.log.Error("Failed to dispatch song events", zap.Error(err))
+			}
+			return
+		}
+		if n > 0 {
+			d.log.Debug("Song events dispatched", zap.Int("events", n))
+		}
+		if n < dispatchBatch {
+			return
+		}
+	}
+}
+
+// deliver claims the deliveries that are due, a batch at a time, and starts
+// sending them. Every webhook has its own sender, which sends the deliveries
+// in the order of their events, so a slow webhook holds up only its own
+// deliveries. The webhooks that still have a sender are not claimed for. A
+// retried delivery may still arrive after later events, the revision in the
+// event tells the order of the changes.
+func (d *Dispatcher) deliver(ctx context.Context) {
+	// The deliveries of a webhook are sent one after another, each within
+	// the timeout of the client.
+	lease := webhookBatch*d.cfg.Timeout + leaseMargin
+	for ctx.Err() == nil {
+		due, err := d.storage.ClaimDeliveries(ctx, dispatchBatch, webhookBatch, d.busyWebhooks(), lease)
+		if err != nil {
+			if ctx.Err() == nil {
+				d.log.Error("Failed to claim webhook deliveries", zap.Error(err))
+			}
+			return
+		}
+
+		byWebhook := make(map[int][]models.DueDelivery)
+		for _, delivery := range due {
+			byWebhook[delivery.WebhookId] = append(byWebhook[delivery.WebhookId], delivery)
+		}
+		for webhookID, deliveries := range byWebhook {
+			d.setBusy(webhookID, true)
+			d.senders.Add(1)
+			go func() {
+				defer d.senders.Done()
+				defer d.setBusy(webhookID, false)
+				for _, delivery := range deliveries {
+					d.attempt(ctx, delivery)
+				}
+			}()
+		}
+
+		if len(due) < dispatchBatch {
+			return
+		}
+	}
+}
+
+func (d *Dispatcher) busyWebhooks() []int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	ids := make([]int, 0, len(d.busy))
+	for id := range d.busy {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func (d *Dispatcher) setBusy(webhookID int, busy bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if busy {
+		d.busy[webhookID] = true
+	} else {
+		delete(d.busy, webhookID)
+	}
+}
+
+// attempt sends a delivery once and records the result. An attempt cut off
+// by shutdown is not recorded, the delivery is claimed again after its lease.
+func (d *Dispatcher) attempt(ctx context.Context, due models.DueDelivery) {
+	log := d.log.With(zap.Int64("delivery", due.Id), zap.Int("webhook", due.WebhookId),
+		zap.Int64("event", due.EventId), zap.String("type", due.EventType))
+
+	code, err := d.send(ctx, due)
+	if ctx.Err() != nil {
+		return
+	}
+
+	delivery := due.WebhookDelivery
+	delivery.Attempts++
+	delivery.LastStatusCode = code
+	delivery.LastError = ""
+	now := time.Now()
+
+	var result string
+	switch {
+	case err == nil:
+		result = models.DeliveryDelivered
+		delivery.Status = models.DeliveryDelivered
+		delivery.NextAttemptAt = now
+		delivery.DeliveredAt = &now
+		log.Debug("Webhook delivered", zap.Int("attempt", delivery.Attempts), zap.Int("status", code))
+	case delivery.Attempts >= d.cfg.MaxAttempts:
+		result = models.DeliveryFailed
+		delivery.Status = models.DeliveryFailed
+		delivery.NextAttemptAt = now
+		delivery.LastError = err.Error()
+		log.Warn("Webhook delivery failed, no attempts left", zap.Int("attempt", delivery.Attempts), zap.Error(err))
+	default:
+		result = "retry"
+		delivery.NextAttemptAt = now.Add(d.backoff(delivery.Attempts))
+		delivery.LastError = err.Error()
+		log.Info("Webhook delivery failed, retrying", zap.Int("attempt", delivery.Attempts),
+			zap.Time("next_attempt", delivery.NextAttemptAt), zap.Error(err))
+	}
+	if d.metrics != nil {
+		d.metrics.WebhookDeliveries.WithLabelValues(result).Inc()
+	}
+
+	if err := d.storage.RecordAttempt(ctx, delivery); err != nil {
+		log.Error("Failed to record webhook delivery", zap.Error(err))
+	}
+}
+
+// send posts the event of a delivery and returns the response status. Any
+// status but 2xx is an error.
+func (d *Dispatcher) send(ctx context.Context, due models.DueDelivery) (int, error) {
+	body, err := json.Marshal(due.Event)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, due.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderWebhookEvent, due.EventType)
+	req.Header.Set(HeaderWebhookEventID, strconv.FormatInt(due.EventId, 10))
+	req.Header.Set(HeaderWebhookDelivery, strconv.FormatInt(due.Id, 10))
+	req.Header.Set(HeaderWebhookTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderWebhookSignature, SignWebhook(due.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBody))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff returns the delay after the given failed attempt: RetryBackoff
+// doubled on every attempt up to RetryMaxBackoff, with jitter so the retries
+// of many deliveries spread out.
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	delay := d.cfg.RetryBackoff
+	for i := 1; i < attempt && delay < d.cfg.RetryMaxBackoff; i++ {
+		delay *= 2
+	}
+	delay = min(delay, d.cfg.RetryMaxBackoff)
+	return delay/2 + rand.N(delay/2+1)
+}
+
+func (d *Dispatcher) prune(ctx context.Context) {
+	n, err := d.storage.PruneDeliveries(ctx, time.Now().Add(-d.cfg.Retention))
+	if err != nil {
+		if ctx.Err() == nil {
+			d.log.Error("Failed to prune webhook deliveries", zap.Error(err))
+		}
+		return
+	}
+	if n > 0 {
+		d.log.Info("Webhook deliveries pruned", zap.Int64("deliveries", n), zap.Duration("retention", d.cfg.Retention))
+	}
+}
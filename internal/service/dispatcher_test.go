@@ -0,0 +1,454 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SemenShakhray/list-of-song/internal/config"
+	"github.com/SemenShakhray/list-of-song/internal/metrics"
+	"github.com/SemenShakhray/list-of-song/internal/models"
+	"github.com/SemenShakhray/list-of-song/internal/storage"
+	"github.com/SemenShakhray/list-of-song/internal/storage/sqlite"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+)
+
+var testWebhooks = config.Webhooks{
+	Enabled:         true,
+	PollInterval:    10 * time.Millisecond,
+	Timeout:         time.Second,
+	MaxAttempts:     3,
+	RetryBackoff:    time.Millisecond,
+	RetryMaxBackoff: 4 * time.Millisecond,
+	Retention:       time.Hour,
+}
+
+type webhookEnv struct {
+	store    storage.Storer
+	webhooks storage.WebhookStorer
+	outbox   storage.OutboxStorer
+	events   storage.EventStorer
+	service  WebhookServicer
+}
+
+func newWebhookEnv(t *testing.T) webhookEnv {
+	db, err := sqlite.Open(filepath.Join(t.TempDir(), "songs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := sqlite.Migrate(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+
+	webhooks := sqlite.NewWebhookStore(db, zap.NewNop())
+	return webhookEnv{
+		store:    sqlite.NewStore(db, zap.NewNop()),
+		webhooks: webhooks,
+		outbox:   sqlite.NewOutboxStore(db, zap.NewNop()),
+		events:   sqlite.NewEventStore(db, zap.NewNop()),
+		service:  NewWebhookService(webhooks),
+	}
+}
+
+func (e webhookEnv) subscribe(t *testing.T, url string, events ...string) models.Webhook {
+	t.Helper()
+	hook, err := e.service.CreateWebhook(context.Background(), models.Webhook{URL: url, Events: events, Active: true})
+	if err != nil {
+		t.Fatalf("CreateWebhook: %v", err)
+	}
+	return hook
+}
+
+func (e webhookEnv) deliveries(t *testing.T, hook models.Webhook) []models.WebhookDelivery {
+	t.Helper()
+	deliveries, err := e.service.ListDeliveries(context.Background(), hook.Id, 100, 0)
+	if err != nil {
+		t.Fatalf("ListDeliveries: %v", err)
+	}
+	return deliveries
+}
+
+// receiver is a webhook endpoint that checks the signature of every request
+// and answers with the queued statuses, 200 once they run out.
+type receiver struct {
+	t      *testing.T
+	secret string
+
+	mu       sync.Mutex
+	events   []models.Event
+	statuses []int
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		rc.t.Errorf("read body: %v", err)
+		return
+	}
+	timestamp, err := strconv.ParseInt(r.Header.Get(HeaderWebhookTimestamp), 10, 64)
+	if err != nil {
+		rc.t.Errorf("bad timestamp header: %v", err)
+	}
+	if got, want := r.Header.Get(HeaderWebhookSignature), SignWebhook(rc.secret, timestamp, body); got != want {
+		rc.t.Errorf("signature = %q, want %q", got, want)
+	}
+
+	var event models.Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		rc.t.Errorf("decode event: %v", err)
+	}
+	if r.Header.Get(HeaderWebhookEvent) != event.Type || r.Header.Get(HeaderWebhookEventID) != strconv.FormatInt(event.Id, 10) {
+		rc.t.Errorf("event headers %q %q do not match event %d %s",
+			r.Header.Get(HeaderWebhookEvent), r.Header.Get(HeaderWebhookEventID), event.Id, event.Type)
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.events = append(rc.events, event)
+	status := http.StatusOK
+	if len(rc.statuses) > 0 {
+		status, rc.statuses = rc.statuses[0], rc.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func (rc *receiver) received() []models.Event {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return append([]models.Event(nil), rc.events...)
+}
+
+// serve starts a receiver for hook and points the webhook at it.
+func (e webhookEnv) serve(t *testing.T, events []string, statuses ...int) (*receiver, models.Webhook) {
+	t.Helper()
+	rc := &receiver{t: t, statuses: statuses}
+	srv := httptest.NewServer(rc)
+	t.Cleanup(srv.Close)
+
+	hook := e.subscribe(t, srv.URL, events...)
+	rc.secret = hook.Secret
+	return rc, hook
+}
+
+// runOnce does what one tick of Run does and waits for the deliveries to be
+// sent.
+func runOnce(ctx context.Context, d *Dispatcher) {
+	d.dispatch(ctx)
+	d.deliver(ctx)
+	d.senders.Wait()
+}
+
+func TestDispatcherSendsSignedEvents(t *testing.T) {
+	ctx := context.Background()
+	env := newWebhookEnv(t)
+	all, _ := env.serve(t, nil)
+	deletes, deletesHook := env.serve(t, []string{models.EventSongDeleted})
+	inactive, inactiveHook := env.serve(t, nil)
+	inactiveHook.Active = false
+	if _, err := env.service.UpdateWebhook(ctx, inactiveHook); err != nil {
+		t.Fatalf("UpdateWebhook: %v", err)
+	}
+
+	if err := env.store.AddSong(ctx, models.Song{Song: "Song", Group: "Group", Text: "one"}); err != nil {
+		t.Fatalf("AddSong: %v", err)
+	}
+	songs, err := env.store.GetAll(ctx, models.Filters{Limit: 1})
+	if err != nil || len(songs) != 1 {
+		t.Fatalf("GetAll = %v, %v", songs, err)
+	}
+	song := songs[0]
+	song.Text = "two"
+	if err := env.store.Update(ctx, song); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if err := env.store.Delete(ctx, song.Id); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	d := NewDispatcher(env.webhooks, zap.NewNop(), nil, testWebhooks)
+	runOnce(ctx, d)
+
+	got := all.received()
+	wantTypes := []string{models.EventSongCreated, models.EventSongUpdated, models.EventSongDeleted}
+	if len(got) != len(wantTypes) {
+		t.Fatalf("received %d events, want %d", len(got), len(wantTypes))
+	}
+	for i, event := range got {
+		if event.Type != wantTypes[i] {
+			t.Errorf("event %d is %s, want %s", i, event.Type, wantTypes[i])
+		}
+		var change models.SongChange
+		if err := json.Unmarshal(event.Data, &change); err != nil {
+			t.Fatalf("decode event data: %v", err)
+		}
+		if change.SongId != song.Id || change.Revision != i+1 {
+			t.Errorf("event %d is about song %d revision %d, want song %d revision %d",
+				i, change.SongId, change.Revision, song.Id, i+1)
+		}
+		if i == 1 && (change.Previous == nil || change.Previous.Text != "one" || change.Song == nil || change.Song.Text != "two") {
+			t.Errorf("update event has %+v before and %+v after, want text one and two", change.Previous, change.Song)
+		}
+	}
+
+	if got := deletes.received(); len(got) != 1 || got[0].Type != models.EventSongDeleted {
+		t.Errorf("webhook subscribed to deletes received %+v, want the delete only", got)
+	}
+	if got := inactive.received(); len(got) != 0 {
+		t.Errorf("inactive webhook received %d events", len(got))
+	}
+
+	log := env.deliveries(t, deletesHook)
+	if len(log) != 1 || log[0].Status != models.DeliveryDelivered || log[0].Attempts != 1 ||
+		log[0].LastStatusCode != http.StatusOK || log[0].DeliveredAt == nil {
+		t.Errorf("delivery log = %+v, want one delivery delivered on the first attempt", log)
+	}
+
+	// Delivered events are not sent again.
+	runOnce(ctx, d)
+	if n := len(all.received()); n != 3 {
+		t.Errorf("received %d events after another run, want 3", n)
+	}
+}
+
+func TestDispatcherRetries(t *testing.T) {
+	ctx := context.Background()
+	env := newWebhookEnv(t)
+	flaky, flakyHook := env.serve(t, nil, http.StatusInternalServerError, http.StatusBadGateway)
+	_, downHook := env.serve(t, nil, http.StatusInternalServerError, http.StatusInternalServerError, http.StatusServiceUnavailable)
+
+	if err := env.store.AddSong(ctx, models.Song{Song: "Song", Group: "Group"}); err != nil {
+		t.Fatalf("AddSong: %v", err)
+	}
+
+	m := metrics.New()
+	d := NewDispatcher(env.webhooks, zap.NewNop(), m, testWebhooks)
+	for i := 0; i < 50 && len(flaky.received()) < 3; i++ {
+		runOnce(ctx, d)
+		time.Sleep(5 * time.Millisecond)
+	}
+	runOnce(ctx, d)
+
+	if n := len(flaky.received()); n != 3 {
+		t.Fatalf("flaky webhook received %d requests, want 3", n)
+	}
+	log := env.deliveries(t, flakyHook)
+	if len(log) != 1 || log[0].Status != models.DeliveryDelivered || log[0].Attempts != 3 || log[0].LastError != "" {
+		t.Errorf("flaky delivery = %+v, want delivered on the third attempt", log)
+	}
+
+	log = env.deliveries(t, downHook)
+	if len(log) != 1 || log[0].Status != models.DeliveryFailed || log[0].Attempts != testWebhooks.MaxAttempts ||
+		log[0].LastStatusCode != http.StatusServiceUnavailable || log[0].LastError == "" {
+		t.Errorf("down delivery = %+v, want failed after %d attempts", log, testWebhooks.MaxAttempts)
+	}
+
+	for _, tt := range []struct {
+		result string
+		want   float64
+	}{
+		{"delivered", 1},
+		{"retry", 4},
+		{"failed", 1},
+	} {
+		if got := testutil.ToFloat64(m.WebhookDeliveries.WithLabelValues(tt.result)); got != tt.want {
+			t.Errorf("%s attempts = %v, want %v", tt.result, got, tt.want)
+		}
+	}
+}
+
+func TestOutboxFollowsTransactions(t *testing.T) {
+	ctx := context.Background()
+	env := newWebhookEnv(t)
+	rc, _ := env.serve(t, nil)
+
+	// A rolled back change raises no event.
+	errAbort := errors.New("abort")
+	err := env.store.WithTx(ctx, func(tx storage.Storer) error {
+		if err := tx.AddSong(ctx, models.Song{Song: "Rolled back", Group: "Group"}); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("WithTx = %v, want %v", err, errAbort)
+	}
+
+	// A committed change is sent by a dispatcher started after it, as after
+	// a restart.
+	if err := env.store.AddSong(ctx, models.Song{Song: "Committed", Group: "Group"}); err != nil {
+		t.Fatalf("AddSong: %v", err)
+	}
+	runOnce(ctx, NewDispatcher(env.webhooks, zap.NewNop(), nil, testWebhooks))
+
+	got := rc.received()
+	if len(got) != 1 {
+		t.Fatalf("received %d events, want 1", len(got))
+	}
+	var change models.SongChange
+	if err := json.Unmarshal(got[0].Data, &change); err != nil {
+		t.Fatalf("decode event data: %v", err)
+	}
+	if change.Song == nil || change.Song.Song != "Committed" {
+		t.Errorf("event is about %+v, want the committed song", change.Song)
+	}
+}
+
+func TestOutboxCleaner(t *testing.T) {
+	ctx := context.Background()
+	env := newWebhookEnv(t)
+	rc, _ := env.serve(t, nil)
+
+	// The events of the time webhooks were off are not sent when they are
+	// turned on.
+	if err := env.store.AddSong(ctx, models.Song{Song: "While off", Group: "Group"}); err != nil {
+		t.Fatalf("AddSong: %v", err)
+	}
+	NewOutboxCleaner(env.outbox, zap.NewNop(), time.Hour, testWebhooks.PollInterval, true).skipEvents(ctx)
+	if err := env.store.AddSong(ctx, models.Song{Song: "Turned on", Group: "Group"}); err != nil {
+		t.Fatalf("AddSong: %v", err)
+	}
+	runOnce(ctx, NewDispatcher(env.webhooks, zap.NewNop(), nil, testWebhooks))
+
+	got := rc.received()
+	if len(got) != 1 {
+		t.Fatalf("received %d events, want 1", len(got))
+	}
+	var change models.SongChange
+	if err := json.Unmarshal(got[0].Data, &change); err != nil {
+		t.Fatalf("decode event data: %v", err)
+	}
+	if change.Song == nil || change.Song.Song != "Turned on" {
+		t.Errorf("event is about %+v, want the song added with webhooks on", change.Song)
+	}
+
+	// Skipped and dispatched events are both pruned.
+	if n, err := env.outbox.PruneEvents(ctx, time.Now().Add(time.Minute)); err != nil || n != 2 {
+		t.Errorf("PruneEvents = %d, %v, want 2", n, err)
+	}
+	if events, err := env.events.RecentEvents(ctx, 10); err != nil || len(events) != 0 {
+		t.Errorf("RecentEvents after pruning = %d events, %v, want none", len(events), err)
+	}
+}
+
+func TestSlowWebhookDoesNotHoldOthers(t *testing.T) {
+	ctx := context.Background()
+	env := newWebhookEnv(t)
+	fast, _ := env.serve(t, nil)
+
+	release := make(chan struct{})
+	var slowRequests sync.WaitGroup
+	slowRequests.Add(1)
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		slowRequests.Done()
+		<-release
+	}))
+	t.Cleanup(slow.Close)
+	slowHook := env.subscribe(t, slow.URL)
+
+	if err := env.store.AddSong(ctx, models.Song{Song: "Song", Group: "Group"}); err != nil {
+		t.Fatalf("AddSong: %v", err)
+	}
+	d := NewDispatcher(env.webhooks, zap.NewNop(), nil, testWebhooks)
+	d.dispatch(ctx)
+	d.deliver(ctx)
+
+	// The fast webhook gets the event while the slow one is still busy.
+	slowRequests.Wait()
+	for start := time.Now(); len(fast.received()) == 0 || len(d.busyWebhooks()) > 1; time.Sleep(time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("fast webhook received nothing while the slow one was busy")
+		}
+	}
+
+	// The busy webhook is not claimed for again.
+	if err := env.store.AddSong(ctx, models.Song{Song: "Other", Group: "Group"}); err != nil {
+		t.Fatalf("AddSong: %v", err)
+	}
+	d.dispatch(ctx)
+	if due, err := env.webhooks.ClaimDeliveries(ctx, 10, webhookBatch, d.busyWebhooks(), time.Minute); err != nil || len(due) != 1 || due[0].WebhookId == slowHook.Id {
+		t.Errorf("ClaimDeliveries skipping the busy webhooks = %+v, %v, want the delivery to the fast one", due, err)
+	}
+
+	close(release)
+	d.senders.Wait()
+	if busy := d.busyWebhooks(); len(busy) != 0 {
+		t.Errorf("busy webhooks after sending = %v, want none", busy)
+	}
+}
+
+func TestClaimDeliveriesPerWebhook(t *testing.T) {
+	ctx := context.Background()
+	env := newWebhookEnv(t)
+	first := env.subscribe(t, "http://127.0.0.1:1/first")
+	second := env.subscribe(t, "http://127.0.0.1:1/second")
+	for _, title := range []string{"One", "Two", "Three"} {
+		if err := env.store.AddSong(ctx, models.Song{Song: title, Group: "Group"}); err != nil {
+			t.Fatalf("AddSong: %v", err)
+		}
+	}
+	if _, err := env.webhooks.DispatchEvents(ctx, 10); err != nil {
+		t.Fatalf("DispatchEvents: %v", err)
+	}
+
+	due, err := env.webhooks.ClaimDeliveries(ctx, 10, 2, nil, time.Minute)
+	if err != nil {
+		t.Fatalf("ClaimDeliveries: %v", err)
+	}
+	perWebhook := make(map[int][]int64)
+	for _, delivery := range due {
+		perWebhook[delivery.WebhookId] = append(perWebhook[delivery.WebhookId], delivery.EventId)
+	}
+	if len(perWebhook[first.Id]) != 2 || len(perWebhook[second.Id]) != 2 {
+		t.Fatalf("claimed events per webhook = %v, want 2 of each", perWebhook)
+	}
+	if events := perWebhook[first.Id]; events[0] > events[1] {
+		t.Errorf("claimed events %v, want the oldest first", events)
+	}
+
+	due, err = env.webhooks.ClaimDeliveries(ctx, 10, 2, []int{first.Id}, time.Minute)
+	if err != nil || len(due) != 1 || due[0].WebhookId != second.Id {
+		t.Errorf("ClaimDeliveries skipping the first webhook = %+v, %v, want the last delivery to the second", due, err)
+	}
+}
+
+func TestClaimedDeliveryIsRetriedAfterLease(t *testing.T) {
+	ctx := context.Background()
+	env := newWebhookEnv(t)
+	env.subscribe(t, "http://127.0.0.1:1/hook")
+	if err := env.store.AddSong(ctx, models.Song{Song: "Song", Group: "Group"}); err != nil {
+		t.Fatalf("AddSong: %v", err)
+	}
+	if _, err := env.webhooks.DispatchEvents(ctx, 10); err != nil {
+		t.Fatalf("DispatchEvents: %v", err)
+	}
+
+	// An instance claims the delivery and stops before recording the attempt.
+	const lease = 100 * time.Millisecond
+	due, err := env.webhooks.ClaimDeliveries(ctx, 10, webhookBatch, nil, lease)
+	if err != nil || len(due) != 1 {
+		t.Fatalf("ClaimDeliveries = %d deliveries, %v, want 1", len(due), err)
+	}
+	if due[0].Event.Type != models.EventSongCreated || len(due[0].Event.Data) == 0 || due[0].Secret == "" {
+		t.Errorf("claimed delivery = %+v, want the created event with the secret", due[0])
+	}
+
+	if again, err := env.webhooks.ClaimDeliveries(ctx, 10, webhookBatch, nil, lease); err != nil || len(again) != 0 {
+		t.Errorf("ClaimDeliveries during the lease = %d deliveries, %v, want none", len(again), err)
+	}
+	time.Sleep(lease + 20*time.Millisecond)
+	again, err := env.webhooks.ClaimDeliveries(ctx, 10, webhookBatch, nil, lease)
+	if err != nil || len(again) != 1 || again[0].Id != due[0].Id {
+		t.Errorf("ClaimDeliveries after the lease = %d deliveries, %v, want the claimed one", len(again), err)
+	}
+}
@@ -0,0 +1,270 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SemenShakhray/list-of-song/internal/metrics"
+	"github.com/SemenShakhray/list-of-song/internal/models"
+	"github.com/SemenShakhray/list-of-song/internal/storage"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// subscriberBuffer is how many events a subscriber may fall behind before
+	// it is dropped.
+	subscriberBuffer = 256
+	// watchBackoff and watchMaxBackoff bound the delay before the hub watches
+	// the events again after the database failed.
+	watchBackoff    = time.Second
+	watchMaxBackoff = 30 * time.Second
+)
+
+// Hub publishes the song events to the subscribers of the event stream. It
+// watches the outbox, so the changes made through any instance reach the
+// subscribers of every instance, and keeps the newest events in a log for
+// subscribers resuming after a disconnect.
+type Hub struct {
+	storage storage.EventStorer
+	log     *zap.Logger
+	metrics *metrics.Metrics
+	size    int
+
+	mu          sync.Mutex
+	events      []hubEvent
+	seen        map[int64]struct{}
+	lastID      int64
+	subscribers map[*Subscription]struct{}
+	closed      bool
+}
+
+type hubEvent struct {
+	event  models.Event
+	groups []string
+}
+
+// Subscription receives the events of the groups it was made for.
+type Subscription struct {
+	// Events is closed when the subscriber falls too far behind or the hub
+	// is closed, the client resumes from the log when it reconnects.
+	Events <-chan models.Event
+
+	events chan models.Event
+	groups []string
+}
+
+// NewHub creates a hub keeping size events in its log.
+func NewHub(store storage.EventStorer, log *zap.Logger, m *metrics.Metrics, size int) *Hub {
+	return &Hub{
+		storage:     store,
+		log:         log,
+		metrics:     m,
+		size:        size,
+		seen:        make(map[int64]struct{}, size),
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Run loads the newest events into the log and then publishes the events
+// until ctx is cancelled. When the database fails, it watches again with
+// exponential backoff and catches up on the events it missed meanwhile.
+func (h *Hub) Run(ctx context.Context) {
+	loaded := false
+	delay := watchBackoff
+	for {
+		started := time.Now()
+		if !loaded {
+			events, err := h.storage.RecentEvents(ctx, h.size)
+			if err == nil {
+				h.load(events)
+				loaded = true
+			} else if ctx.Err() == nil {
+				h.log.Error("Failed to load song events", zap.Error(err))
+			}
+		}
+		if loaded {
+			err := h.storage.WatchEvents(ctx, h.last(), h.publish)
+			if ctx.Err() == nil {
+				h.log.Error("Failed to watch song events", zap.Error(err), zap.Duration("retry_in", delay))
+			}
+		}
+		if time.Since(started) > watchMaxBackoff {
+			delay = watchBackoff
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, watchMaxBackoff)
+	}
+}
+
+// Subscribe starts a subscription to the events of groups, of all groups when
+// there are none. With resume set it also returns the events of the log after
+// the event lastID, the ones the client missed.
+func (h *Hub) Subscribe(groups []string, lastID int64, resume bool) (*Subscription, []models.Event) {
+	events := make(chan models.Event, subscriberBuffer)
+	sub := &Subscription{Events: events, events: events, groups: groups}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		close(events)
+		return sub, nil
+	}
+	h.subscribers[sub] = struct{}{}
+	h.countSubscribers()
+
+	if !resume {
+		return sub, nil
+	}
+	// The log is in the order events were published, which may differ from
+	// the order of the IDs. The events after lastID in the log are the ones
+	// the client has not seen, when lastID is not in the log the ones with a
+	// greater ID are.
+	start, found := 0, false
+	for i, e := range h.events {
+		if e.event.Id == lastID {
+			start, found = i+1, true
+			break
+		}
+	}
+	var missed []models.Event
+	for _, e := range h.events[start:] {
+		if (found || e.event.Id > lastID) && sub.matches(e.groups) {
+			missed = append(missed, e.event)
+		}
+	}
+	return sub, missed
+}
+
+// Unsubscribe ends a subscription.
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.remove(sub)
+}
+
+// Close ends every subscription, the streams are closed so the server can
+// shut down. Later subscriptions are closed at once.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for sub := range h.subscribers {
+		h.remove(sub)
+	}
+}
+
+// remove closes a subscription unless it was removed already. h.mu is held.
+func (h *Hub) remove(sub *Subscription) {
+	if _, ok := h.subscribers[sub]; !ok {
+		return
+	}
+	delete(h.subscribers, sub)
+	close(sub.events)
+	h.countSubscribers()
+}
+
+func (h *Hub) countSubscribers() {
+	if h.metrics != nil {
+		h.metrics.EventSubscribers.Set(float64(len(h.subscribers)))
+	}
+}
+
+// last returns the greatest event ID published.
+func (h *Hub) last() int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.lastID
+}
+
+// load adds the events committed before the hub started to the log, they are
+// only sent to resuming subscribers.
+func (h *Hub) load(events []models.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, event := range events {
+		h.add(hubEvent{event: event, groups: eventGroups(event)})
+	}
+}
+
+// publish adds an event to the log and sends it to the subscribers of its
+// groups. An event published before is ignored.
+func (h *Hub) publish(event models.Event) {
+	e := hubEvent{event: event, groups: eventGroups(event)}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.add(e) {
+		return
+	}
+	for sub := range h.subscribers {
+		if !sub.matches(e.groups) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			h.log.Warn("Dropping event stream subscriber that fell behind", zap.Int64("event", event.Id))
+			h.remove(sub)
+		}
+	}
+}
+
+// add appends an event to the log, evicting the oldest one when the log is
+// full. It reports false for an event in the log already. h.mu is held.
+func (h *Hub) add(e hubEvent) bool {
+	if _, ok := h.seen[e.event.Id]; ok {
+		return false
+	}
+	if len(h.events) == h.size {
+		delete(h.seen, h.events[0].event.Id)
+		copy(h.events, h.events[1:])
+		h.events = h.events[:len(h.events)-1]
+	}
+	h.events = append(h.events, e)
+	h.seen[e.event.Id] = struct{}{}
+	h.lastID = max(h.lastID, e.event.Id)
+	return true
+}
+
+func (s *Subscription) matches(groups []string) bool {
+	if len(s.groups) == 0 {
+		return true
+	}
+	for _, want := range s.groups {
+		for _, group := range groups {
+			if strings.EqualFold(want, group) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// eventGroups returns the groups of the song before and after the change, a
+// song moved to another group concerns both.
+func eventGroups(event models.Event) []string {
+	var change models.SongChange
+	if err := json.Unmarshal(event.Data, &change); err != nil {
+		return nil
+	}
+	var groups []string
+	if change.Song != nil {
+		groups = append(groups, change.Song.Group)
+	}
+	if change.Previous != nil && (change.Song == nil || change.Previous.Group != change.Song.Group) {
+		groups = append(groups, change.Previous.Group)
+	}
+	return groups
+}
@@ -0,0 +1,243 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/SemenShakhray/list-of-song/internal/models"
+	"github.com/SemenShakhray/list-of-song/internal/storage/sqlite"
+
+	"go.uber.org/zap"
+)
+
+// fakeEvents serves recent from RecentEvents and passes the events sent to
+// live to WatchEvents.
+type fakeEvents struct {
+	recent []models.Event
+	live   chan models.Event
+	after  chan int64
+}
+
+func (f *fakeEvents) RecentEvents(_ context.Context, limit int) ([]models.Event, error) {
+	return f.recent[max(len(f.recent)-limit, 0):], nil
+}
+
+func (f *fakeEvents) WatchEvents(ctx context.Context, after int64, fn func(models.Event)) error {
+	f.after <- after
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event := <-f.live:
+			fn(event)
+		}
+	}
+}
+
+func songEvent(t *testing.T, id int64, group, previousGroup string) models.Event {
+	t.Helper()
+	change := models.SongChange{SongId: 1, Action: "update"}
+	if group != "" {
+		change.Song = &models.Song{Id: 1, Song: "Song", Group: group}
+	}
+	if previousGroup != "" {
+		change.Previous = &models.Song{Id: 1, Song: "Song", Group: previousGroup}
+	}
+	data, err := json.Marshal(change)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return models.Event{Id: id, Type: models.EventSongUpdated, Data: data}
+}
+
+func eventIDs(events []models.Event) []int64 {
+	ids := make([]int64, 0, len(events))
+	for _, event := range events {
+		ids = append(ids, event.Id)
+	}
+	return ids
+}
+
+func receive(t *testing.T, sub *Subscription) models.Event {
+	t.Helper()
+	select {
+	case event, ok := <-sub.Events:
+		if !ok {
+			t.Fatal("subscription closed")
+		}
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event received")
+	}
+	return models.Event{}
+}
+
+func TestHubResume(t *testing.T) {
+	store := &fakeEvents{live: make(chan models.Event), after: make(chan int64, 1)}
+	for id := int64(1); id <= 5; id++ {
+		store.recent = append(store.recent, songEvent(t, id, "Group", ""))
+	}
+	hub := NewHub(store, zap.NewNop(), nil, 3)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		hub.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	if after := <-store.after; after != 5 {
+		t.Errorf("WatchEvents after %d, want 5", after)
+	}
+
+	for _, tc := range []struct {
+		lastID int64
+		resume bool
+		want   []int64
+	}{
+		{lastID: 3, resume: true, want: []int64{4, 5}},
+		{lastID: 5, resume: true, want: []int64{}},
+		// Event 1 fell out of the log, the client gets all of it.
+		{lastID: 1, resume: true, want: []int64{3, 4, 5}},
+		{lastID: 0, resume: false, want: []int64{}},
+	} {
+		sub, missed := hub.Subscribe(nil, tc.lastID, tc.resume)
+		if got := eventIDs(missed); !slices.Equal(got, tc.want) {
+			t.Errorf("Subscribe after %d = %v, want %v", tc.lastID, got, tc.want)
+		}
+		hub.Unsubscribe(sub)
+	}
+
+	sub, _ := hub.Subscribe(nil, 0, false)
+	defer hub.Unsubscribe(sub)
+	store.live <- songEvent(t, 5, "Group", "")
+	store.live <- songEvent(t, 6, "Group", "")
+	if event := receive(t, sub); event.Id != 6 {
+		t.Errorf("received event %d, want 6 once the repeated 5 is skipped", event.Id)
+	}
+}
+
+func TestHubGroups(t *testing.T) {
+	hub := NewHub(&fakeEvents{}, zap.NewNop(), nil, 10)
+	hub.publish(songEvent(t, 1, "Muse", ""))
+	hub.publish(songEvent(t, 2, "Queen", ""))
+	hub.publish(songEvent(t, 3, "Queen", "muse"))
+	hub.publish(songEvent(t, 4, "", "MUSE"))
+
+	sub, missed := hub.Subscribe([]string{"muse"}, 0, true)
+	defer hub.Unsubscribe(sub)
+	if got := eventIDs(missed); !slices.Equal(got, []int64{1, 3, 4}) {
+		t.Errorf("missed events of muse = %v, want [1 3 4]", got)
+	}
+
+	hub.publish(songEvent(t, 5, "Queen", ""))
+	hub.publish(songEvent(t, 6, "Muse", ""))
+	if event := receive(t, sub); event.Id != 6 {
+		t.Errorf("received event %d, want 6", event.Id)
+	}
+}
+
+func TestHubDropsSlowSubscriber(t *testing.T) {
+	hub := NewHub(&fakeEvents{}, zap.NewNop(), nil, 10)
+	slow, _ := hub.Subscribe(nil, 0, false)
+	fast, _ := hub.Subscribe(nil, 0, false)
+	defer hub.Unsubscribe(fast)
+
+	for id := int64(1); id <= subscriberBuffer+1; id++ {
+		hub.publish(songEvent(t, id, "Group", ""))
+		if event := receive(t, fast); event.Id != id {
+			t.Fatalf("received event %d, want %d", event.Id, id)
+		}
+	}
+
+	received := 0
+	for range slow.Events {
+		received++
+	}
+	if received != subscriberBuffer {
+		t.Errorf("slow subscriber received %d events before it was dropped, want %d", received, subscriberBuffer)
+	}
+	// Unsubscribing a dropped subscription is fine.
+	hub.Unsubscribe(slow)
+}
+
+func TestHubClose(t *testing.T) {
+	hub := NewHub(&fakeEvents{}, zap.NewNop(), nil, 10)
+	sub, _ := hub.Subscribe(nil, 0, false)
+	hub.Close()
+	if _, ok := <-sub.Events; ok {
+		t.Error("subscription open after Close")
+	}
+
+	late, _ := hub.Subscribe(nil, 0, false)
+	if _, ok := <-late.Events; ok {
+		t.Error("subscription after Close is open")
+	}
+	hub.publish(songEvent(t, 1, "Group", ""))
+}
+
+func TestHubPublishesStoredEvents(t *testing.T) {
+	ctx := context.Background()
+	db, err := sqlite.Open(filepath.Join(t.TempDir(), "songs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := sqlite.Migrate(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	store := sqlite.NewStore(db, zap.NewNop())
+
+	if err := store.AddSong(ctx, models.Song{Song: "Before", Group: "Group"}); err != nil {
+		t.Fatalf("AddSong: %v", err)
+	}
+	events := &sqlite.EventStore{DB: db, Log: zap.NewNop(), PollInterval: 10 * time.Millisecond}
+	hub := NewHub(events, zap.NewNop(), nil, 10)
+
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		hub.Run(runCtx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	// Events committed before the log is loaded are not sent live.
+	for hub.last() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	sub, _ := hub.Subscribe([]string{"group"}, 0, false)
+	defer hub.Unsubscribe(sub)
+	if err := store.AddSong(ctx, models.Song{Song: "Other", Group: "Other"}); err != nil {
+		t.Fatalf("AddSong: %v", err)
+	}
+	if err := store.AddSong(ctx, models.Song{Song: "After", Group: "Group"}); err != nil {
+		t.Fatalf("AddSong: %v", err)
+	}
+
+	event := receive(t, sub)
+	var change models.SongChange
+	if err := json.Unmarshal(event.Data, &change); err != nil {
+		t.Fatalf("decode event: %v", err)
+	}
+	if event.Type != models.EventSongCreated || change.Song == nil || change.Song.Song != "After" {
+		t.Errorf("received %s of %+v, want song.created of After", event.Type, change.Song)
+	}
+
+	// The event added before the hub ran was loaded into the log.
+	_, missed := hub.Subscribe(nil, 0, true)
+	if len(missed) != 3 {
+		t.Errorf("log has %d events, want 3", len(missed))
+	}
+}
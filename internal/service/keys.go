@@ -0,0 +1,61 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/SemenShakhray/list-of-song/internal/auth"
+	"github.com/SemenShakhray/list-of-song/internal/models"
+	"github.com/SemenShakhray/list-of-song/internal/storage"
+)
+
+type KeyService struct {
+	storage storage.KeyStorer
+}
+
+type KeyServicer interface {
+	// CreateKey generates a new API key, the plain key is returned only here.
+	CreateKey(ctx context.Context, name string, role string) (models.APIKey, error)
+	ListKeys(ctx context.Context) ([]models.APIKey, error)
+	RevokeKey(ctx context.Context, id int) error
+}
+
+func NewKeyService(store storage.KeyStorer) KeyServicer {
+	return &KeyService{
+		storage: store,
+	}
+}
+
+func (s *KeyService) CreateKey(ctx context.Context, name string, role string) (models.APIKey, error) {
+	if name == "" {
+		return models.APIKey{}, fmt.Errorf("key name is required")
+	}
+	if role == "" {
+		return models.APIKey{}, fmt.Errorf("key role is required")
+	}
+
+	plain, err := auth.GenerateKey()
+	if err != nil {
+		return models.APIKey{}, err
+	}
+
+	key, err := s.storage.CreateAPIKey(ctx, models.APIKey{
+		Name:   name,
+		Prefix: auth.KeyPrefix(plain),
+		Role:   role,
+		Hash:   auth.HashKey(plain),
+	})
+	if err != nil {
+		return models.APIKey{}, err
+	}
+	key.Key = plain
+	return key, nil
+}
+
+func (s *KeyService) ListKeys(ctx context.Context) ([]models.APIKey, error) {
+	return s.storage.ListAPIKeys(ctx)
+}
+
+func (s *KeyService) RevokeKey(ctx context.Context, id int) error {
+	return s.storage.RevokeAPIKey(ctx, id)
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/SemenShakhray/list-of-song/internal/storage"
+
+	"go.uber.org/zap"
+)
+
+// OutboxCleaner keeps the outbox of song events from growing, whether or not
+// a dispatcher runs. It removes the events dispatched longer than the
+// retention ago. With skip set, for instances with webhooks disabled, it also
+// marks the new events dispatched, so that turning webhooks on later does
+// not send the events of the time they were off.
+type OutboxCleaner struct {
+	storage   storage.OutboxStorer
+	log       *zap.Logger
+	retention time.Duration
+	interval  time.Duration
+	skip      bool
+}
+
+// NewOutboxCleaner creates a cleaner that skips events every interval when
+// skip is set and prunes the outbox every pruneInterval.
+func NewOutboxCleaner(store storage.OutboxStorer, log *zap.Logger, retention, interval time.Duration, skip bool) *OutboxCleaner {
+	return &OutboxCleaner{
+		storage:   store,
+		log:       log,
+		retention: retention,
+		interval:  interval,
+		skip:      skip,
+	}
+}
+
+// Run cleans the outbox once and then periodically until ctx is cancelled.
+func (c *OutboxCleaner) Run(ctx context.Context) {
+	interval := pruneInterval
+	if c.skip {
+		interval = c.interval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var pruned time.Time
+	for {
+		if c.skip {
+			c.skipEvents(ctx)
+		}
+		if time.Since(pruned) >= pruneInterval {
+			c.prune(ctx)
+			pruned = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *OutboxCleaner) skipEvents(ctx context.Context) {
+	n, err := c.storage.SkipEvents(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			c.log.Error("Failed to skip song events", zap.Error(err))
+		}
+		return
+	}
+	if n > 0 {
+		c.log.Debug("Song events skipped, webhooks are disabled", zap.Int64("events", n))
+	}
+}
+
+func (c *OutboxCleaner) prune(ctx context.Context) {
+	n, err := c.storage.PruneEvents(ctx, time.Now().Add(-c.retention))
+	if err != nil {
+		if ctx.Err() == nil {
+			c.log.Error("Failed to prune song events", zap.Error(err))
+		}
+		return
+	}
+	if n > 0 {
+		c.log.Info("Song events pruned", zap.Int64("events", n), zap.Duration("retention", c.retention))
+	}
+}
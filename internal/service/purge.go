@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/SemenShakhray/list-of-song/internal/storage"
+
+	"go.uber.org/zap"
+)
+
+// Purger periodically removes songs that have been in the trash longer than
+// the retention period.
+type Purger struct {
+	storage   storage.Storer
+	log       *zap.Logger
+	retention time.Duration
+	interval  time.Duration
+}
+
+func NewPurger(store storage.Storer, log *zap.Logger, retention, interval time.Duration) *Purger {
+	return &Purger{
+		storage:   store,
+		log:       log,
+		retention: retention,
+		interval:  interval,
+	}
+}
+
+// Run purges the trash once and then every interval until ctx is cancelled.
+func (p *Purger) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.purge(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *Purger) purge(ctx context.Context) {
+	n, err := p.storage.Purge(ctx, time.Now().Add(-p.retention))
+	if err != nil {
+		p.log.Error("Failed to purge trash", zap.Error(err))
+		return
+	}
+	if n > 0 {
+		p.log.Info("Trash purged", zap.Int64("songs", n), zap.Duration("retention", p.retention))
+	}
+}
@@ -2,11 +2,26 @@ package service
 
 import (
 	"context"
+	"time"
 
 	"github.com/SemenShakhray/list-of-song/internal/models"
 	"github.com/SemenShakhray/list-of-song/internal/storage"
+	"github.com/SemenShakhray/list-of-song/internal/tracing"
+
+	"go.opentelemetry.io/otel"
 )
 
+var tracer = otel.Tracer("github.com/SemenShakhray/list-of-song/internal/service")
+
+// startSpan starts the span of a service method. The returned function is
+// deferred with a pointer to the error result and ends the span.
+func startSpan(ctx context.Context, method string) (context.Context, func(*error)) {
+	ctx, span := tracer.Start(ctx, "Service."+method)
+	return ctx, func(err *error) {
+		tracing.End(span, *err)
+	}
+}
+
 type Service struct {
 	storage storage.Storer
 }
@@ -17,6 +32,15 @@ type Servicer interface {
 	Update(ctx context.Context, song models.Song) error
 	Delete(ctx context.Context, id int) error
 	GetText(ctx context.Context, filtres models.Filters, id int) (string, error)
+	Export(ctx context.Context, filtres models.Filters, fn func(models.Song) error) error
+	GetTrash(ctx context.Context, filtres models.Filters) ([]models.Song, error)
+	Restore(ctx context.Context, id int) error
+	Purge(ctx context.Context, before time.Time) (int64, error)
+	GetHistory(ctx context.Context, id int, limit, offset int) ([]models.Revision, error)
+	GetRevision(ctx context.Context, id int, revision int) (models.Revision, error)
+	Revert(ctx context.Context, id int, revision int) error
+	DiffLyrics(ctx context.Context, id int, from, to int) (models.LyricsDiff, error)
+	Batch(ctx context.Context, ops []models.BatchOperation, atomic bool) ([]models.BatchResult, error)
 }
 
 func NewService(store storage.Storer) Servicer {
@@ -25,22 +49,86 @@ func NewService(store storage.Storer) Servicer {
 	}
 }
 
-func (s *Service) AddSong(ctx context.Context, song models.Song) error {
+func (s *Service) AddSong(ctx context.Context, song models.Song) (err error) {
+	ctx, end := startSpan(ctx, "AddSong")
+	defer end(&err)
+
 	return s.storage.AddSong(ctx, song)
 }
 
-func (s *Service) GetAll(ctx context.Context, filters models.Filters) ([]models.Song, error) {
+func (s *Service) GetAll(ctx context.Context, filters models.Filters) (songs []models.Song, err error) {
+	ctx, end := startSpan(ctx, "GetAll")
+	defer end(&err)
+
 	return s.storage.GetAll(ctx, filters)
 }
 
-func (s *Service) Update(ctx context.Context, song models.Song) error {
+func (s *Service) Update(ctx context.Context, song models.Song) (err error) {
+	ctx, end := startSpan(ctx, "Update")
+	defer end(&err)
+
 	return s.storage.Update(ctx, song)
 }
 
-func (s *Service) Delete(ctx context.Context, id int) error {
+func (s *Service) Delete(ctx context.Context, id int) (err error) {
+	ctx, end := startSpan(ctx, "Delete")
+	defer end(&err)
+
 	return s.storage.Delete(ctx, id)
 }
 
-func (s *Service) GetText(ctx context.Context, filters models.Filters, id int) (string, error) {
+func (s *Service) GetText(ctx context.Context, filters models.Filters, id int) (text string, err error) {
+	ctx, end := startSpan(ctx, "GetText")
+	defer end(&err)
+
 	return s.storage.GetText(ctx, filters, id)
 }
+
+func (s *Service) Export(ctx context.Context, filters models.Filters, fn func(models.Song) error) (err error) {
+	ctx, end := startSpan(ctx, "Export")
+	defer end(&err)
+
+	return s.storage.Export(ctx, filters, fn)
+}
+
+func (s *Service) GetTrash(ctx context.Context, filters models.Filters) (songs []models.Song, err error) {
+	ctx, end := startSpan(ctx, "GetTrash")
+	defer end(&err)
+
+	return s.storage.GetTrash(ctx, filters)
+}
+
+func (s *Service) Restore(ctx context.Context, id int) (err error) {
+	ctx, end := startSpan(ctx, "Restore")
+	defer end(&err)
+
+	return s.storage.Restore(ctx, id)
+}
+
+func (s *Service) Purge(ctx context.Context, before time.Time) (n int64, err error) {
+	ctx, end := startSpan(ctx, "Purge")
+	defer end(&err)
+
+	return s.storage.Purge(ctx, before)
+}
+
+func (s *Service) GetHistory(ctx context.Context, id int, limit, offset int) (revisions []models.Revision, err error) {
+	ctx, end := startSpan(ctx, "GetHistory")
+	defer end(&err)
+
+	return s.storage.GetHistory(ctx, id, limit, offset)
+}
+
+func (s *Service) GetRevision(ctx context.Context, id int, revision int) (rev models.Revision, err error) {
+	ctx, end := startSpan(ctx, "GetRevision")
+	defer end(&err)
+
+	return s.storage.GetRevision(ctx, id, revision)
+}
+
+func (s *Service) Revert(ctx context.Context, id int, revision int) (err error) {
+	ctx, end := startSpan(ctx, "Revert")
+	defer end(&err)
+
+	return s.storage.Revert(ctx, id, revision)
+}
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+
+	"github.com/SemenShakhray/list-of-song/internal/models"
+	"github.com/SemenShakhray/list-of-song/internal/storage"
+)
+
+// ErrInvalidWebhook is wrapped by the errors about a webhook that cannot be
+// saved as it is.
+var ErrInvalidWebhook = errors.New("invalid webhook")
+
+const (
+	secretPrefix = "whsec_"
+	// secretBytes is the amount of randomness in a generated secret.
+	secretBytes = 32
+)
+
+type WebhookService struct {
+	storage storage.WebhookStorer
+}
+
+type WebhookServicer interface {
+	// CreateWebhook subscribes a URL to song events. No events means all of
+	// them. The secret that signs the deliveries is returned only here.
+	CreateWebhook(ctx context.Context, hook models.Webhook) (models.Webhook, error)
+	ListWebhooks(ctx context.Context) ([]models.Webhook, error)
+	GetWebhook(ctx context.Context, id int) (models.Webhook, error)
+	UpdateWebhook(ctx context.Context, hook models.Webhook) (models.Webhook, error)
+	DeleteWebhook(ctx context.Context, id int) error
+	ListDeliveries(ctx context.Context, id int, limit, offset int) ([]models.WebhookDelivery, error)
+}
+
+func NewWebhookService(store storage.WebhookStorer) WebhookServicer {
+	return &WebhookService{
+		storage: store,
+	}
+}
+
+func (s *WebhookService) CreateWebhook(ctx context.Context, hook models.Webhook) (models.Webhook, error) {
+	hook, err := validWebhook(hook)
+	if err != nil {
+		return models.Webhook{}, err
+	}
+
+	b := make([]byte, secretBytes)
+	if _, err := rand.Read(b); err != nil {
+		return models.Webhook{}, fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	hook.Secret = secretPrefix + base64.RawURLEncoding.EncodeToString(b)
+
+	return s.storage.CreateWebhook(ctx, hook)
+}
+
+func (s *WebhookService) ListWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	hooks, err := s.storage.ListWebhooks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range hooks {
+		hooks[i].Secret = ""
+	}
+	return hooks, nil
+}
+
+func (s *WebhookService) GetWebhook(ctx context.Context, id int) (models.Webhook, error) {
+	hook, err := s.storage.GetWebhook(ctx, id)
+	if err != nil {
+		return models.Webhook{}, err
+	}
+	hook.Secret = ""
+	return hook, nil
+}
+
+func (s *WebhookService) UpdateWebhook(ctx context.Context, hook models.Webhook) (models.Webhook, error) {
+	hook, err := validWebhook(hook)
+	if err != nil {
+		return models.Webhook{}, err
+	}
+
+	hook, err = s.storage.UpdateWebhook(ctx, hook)
+	if err != nil {
+		return models.Webhook{}, err
+	}
+	hook.Secret = ""
+	return hook, nil
+}
+
+func (s *WebhookService) DeleteWebhook(ctx context.Context, id int) error {
+	return s.storage.DeleteWebhook(ctx, id)
+}
+
+// ListDeliveries returns storage.ErrWebhookNotFound for an unknown webhook
+// rather than no deliveries.
+func (s *WebhookService) ListDeliveries(ctx context.Context, id int, limit, offset int) ([]models.WebhookDelivery, error) {
+	if _, err := s.storage.GetWebhook(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.storage.ListDeliveries(ctx, id, limit, offset)
+}
+
+// validWebhook checks the URL and the event types of hook and returns it with
+// the event types sorted and without duplicates.
+func validWebhook(hook models.Webhook) (models.Webhook, error) {
+	u, err := url.Parse(hook.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return models.Webhook{}, fmt.Errorf("%w: url must be an absolute http or https URL", ErrInvalidWebhook)
+	}
+
+	if len(hook.Events) == 0 {
+		hook.Events = models.EventTypes
+	}
+	for _, event := range hook.Events {
+		if !slices.Contains(models.EventTypes, event) {
+			return models.Webhook{}, fmt.Errorf("%w: unknown event %q", ErrInvalidWebhook, event)
+		}
+	}
+	events := slices.Clone(hook.Events)
+	slices.Sort(events)
+	hook.Events = slices.Compact(events)
+	return hook, nil
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/SemenShakhray/list-of-song/internal/models"
+	"github.com/SemenShakhray/list-of-song/internal/storage"
+)
+
+func TestWebhookService(t *testing.T) {
+	ctx := context.Background()
+	env := newWebhookEnv(t)
+
+	for _, hook := range []models.Webhook{
+		{URL: "ftp://example.com/hook"},
+		{URL: "/hook"},
+		{URL: "http://example.com/hook", Events: []string{"song.renamed"}},
+	} {
+		if _, err := env.service.CreateWebhook(ctx, hook); !errors.Is(err, ErrInvalidWebhook) {
+			t.Errorf("CreateWebhook(%+v) = %v, want %v", hook, err, ErrInvalidWebhook)
+		}
+	}
+
+	created := env.subscribe(t, "https://example.com/hook")
+	if !strings.HasPrefix(created.Secret, secretPrefix) {
+		t.Errorf("secret = %q, want a generated secret", created.Secret)
+	}
+	if !slices.Equal(created.Events, []string{models.EventSongCreated, models.EventSongDeleted, models.EventSongUpdated}) {
+		t.Errorf("events = %v, want all of them", created.Events)
+	}
+
+	got, err := env.service.GetWebhook(ctx, created.Id)
+	if err != nil {
+		t.Fatalf("GetWebhook: %v", err)
+	}
+	if got.Secret != "" || got.URL != created.URL {
+		t.Errorf("GetWebhook = %+v, want the webhook without its secret", got)
+	}
+
+	updated, err := env.service.UpdateWebhook(ctx, models.Webhook{
+		Id:     created.Id,
+		URL:    "https://example.com/other",
+		Events: []string{models.EventSongUpdated, models.EventSongUpdated},
+	})
+	if err != nil {
+		t.Fatalf("UpdateWebhook: %v", err)
+	}
+	if updated.Active || updated.URL != "https://example.com/other" || !slices.Equal(updated.Events, []string{models.EventSongUpdated}) {
+		t.Errorf("UpdateWebhook = %+v", updated)
+	}
+	stored, err := env.webhooks.GetWebhook(ctx, created.Id)
+	if err != nil || stored.Secret != created.Secret {
+		t.Errorf("secret after update = %q, %v, want it kept", stored.Secret, err)
+	}
+
+	if err := env.service.DeleteWebhook(ctx, created.Id); err != nil {
+		t.Fatalf("DeleteWebhook: %v", err)
+	}
+	for name, err := range map[string]error{
+		"GetWebhook":     func() error { _, err := env.service.GetWebhook(ctx, created.Id); return err }(),
+		"UpdateWebhook":  func() error { _, err := env.service.UpdateWebhook(ctx, updated); return err }(),
+		"DeleteWebhook":  env.service.DeleteWebhook(ctx, created.Id),
+		"ListDeliveries": func() error { _, err := env.service.ListDeliveries(ctx, created.Id, 10, 0); return err }(),
+	} {
+		if !errors.Is(err, storage.ErrWebhookNotFound) {
+			t.Errorf("%s of a deleted webhook = %v, want %v", name, err, storage.ErrWebhookNotFound)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/SemenShakhray/list-of-song/internal/models"
+	"github.com/SemenShakhray/list-of-song/internal/storage"
+
+	"go.uber.org/zap"
+)
+
+// benchSongs is how many songs are added before the read benchmarks.
+const benchSongs = 1000
+
+// BenchmarkStore compares the database/sql store with the native pgx store.
+// It writes to the database described by the DB_* variables, which should be
+// a scratch database since song revisions cannot be deleted:
+//
+//	BENCH_DB=1 DB_HOST=localhost DB_NAME=songs_bench go test -run '^$' -bench Store ./internal/storage/postgres
+func BenchmarkStore(b *testing.B) {
+	db, pool := openTestDB(b, "BENCH_DB")
+	ctx := context.Background()
+
+	stores := []struct {
+		name  string
+		store storage.Storer
+	}{
+		{"sql", NewStore(db, zap.NewNop())},
+		{"pgx", NewPgxStore(pool, zap.NewNop())},
+	}
+
+	// Every run adds songs under its own group, so runs do not conflict.
+	group := "bench-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	for i := 0; i < benchSongs; i++ {
+		song := models.Song{Song: fmt.Sprintf("song %d", i), Group: group, Text: "verse 1\nverse 2\nverse 3\nverse 4"}
+		if err := stores[0].store.AddSong(ctx, song); err != nil {
+			b.Fatal(err)
+		}
+	}
+	seeded, err := stores[0].store.GetAll(ctx, models.Filters{Group: group, Limit: benchSongs})
+	if err != nil {
+		b.Fatal(err)
+	}
+	if len(seeded) == 0 {
+		b.Fatal("no songs were added")
+	}
+
+	for _, st := range stores {
+		b.Run(st.name+"/AddSong", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				song := models.Song{Song: fmt.Sprintf("%s song %d", st.name, i), Group: group + "-add-" + strconv.Itoa(b.N)}
+				if err := st.store.AddSong(ctx, song); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(st.name+"/Update", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				song := models.Song{Id: seeded[i%len(seeded)].Id, Link: fmt.Sprintf("https://example.com/%s/%d", st.name, i)}
+				if err := st.store.Update(ctx, song); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(st.name+"/GetAll", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_, err := st.store.GetAll(ctx, models.Filters{Group: group, Limit: 20, Offset: i % benchSongs})
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(st.name+"/GetText", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_, err := st.store.GetText(ctx, models.Filters{Limit: 2, Offset: 1}, seeded[i%len(seeded)].Id)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/SemenShakhray/list-of-song/internal/config"
+	"github.com/SemenShakhray/list-of-song/internal/storage"
+	"github.com/SemenShakhray/list-of-song/internal/storage/storetest"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pressly/goose/v3"
+	"go.uber.org/zap"
+)
+
+// openTestDB connects both stores to the database described by the DB_*
+// variables and applies the migrations, unless the variable gate is not set.
+// Tests and benchmarks write to the database, so it must be a scratch one.
+func openTestDB(tb testing.TB, gate string) (*sql.DB, *pgxpool.Pool) {
+	if os.Getenv(gate) == "" {
+		tb.Skipf("set %s=1 and the DB_* variables to run against PostgreSQL", gate)
+	}
+	cfg, err := config.Load(config.Options{})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	cfg.DB.ConnectRetries = 0
+
+	ctx := context.Background()
+	db, err := Connect(ctx, cfg.DB, zap.NewNop())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { db.Close() })
+	if err := goose.Up(db, "../../../migrations"); err != nil {
+		tb.Fatal(err)
+	}
+
+	pool, err := ConnectPool(ctx, cfg.DB, zap.NewNop())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(pool.Close)
+	return db, pool
+}
+
+// TestConformance runs the storetest suite against both stores. Every test
+// starts from empty tables. make test-db runs it in a throwaway container,
+// against a running server it is:
+//
+//	TEST_DB=1 DB_HOST=localhost DB_NAME=songs_test go test ./internal/storage/postgres
+func TestConformance(t *testing.T) {
+	db, pool := openTestDB(t, "TEST_DB")
+
+	empty := func(t *testing.T) {
+		_, err := db.Exec("TRUNCATE songs, song_revisions, song_events RESTART IDENTITY")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("sql", func(t *testing.T) {
+		storetest.Run(t, func(t *testing.T) storage.Storer {
+			empty(t)
+			return NewStore(db, zap.NewNop())
+		})
+	})
+	t.Run("pgx", func(t *testing.T) {
+		storetest.Run(t, func(t *testing.T) storage.Storer {
+			empty(t)
+			return NewPgxStore(pool, zap.NewNop())
+		})
+	})
+}
@@ -1,12 +1,20 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/SemenShakhray/list-of-song/internal/config"
 	"github.com/SemenShakhray/list-of-song/internal/storage"
+	"github.com/SemenShakhray/list-of-song/pkg/logger"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"go.uber.org/zap"
 )
@@ -14,24 +22,165 @@ import (
 type Store struct {
 	DB  *sql.DB
 	Log *zap.Logger
+
+	txOpts   storage.TxOptions
+	tx       *sql.Tx
+	replicas *ReplicaSet
+}
+
+// querier is the part of *sql.DB and *sql.Tx used by the store methods.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// conn returns the transaction the store is bound to, or the pool otherwise.
+func (s *Store) conn() querier {
+	if s.tx != nil {
+		return tracedQuerier{q: s.tx}
+	}
+	return tracedQuerier{q: s.DB}
+}
+
+// log returns the store logger with the fields of the request ctx belongs to.
+func (s *Store) log(ctx context.Context) *zap.Logger {
+	return logger.FromContext(ctx, s.Log)
+}
+
+// NewStore creates a store on db. opts set the defaults for WithTx.
+func NewStore(db *sql.DB, log *zap.Logger, opts ...storage.TxOption) storage.Storer {
+	return &Store{
+		DB:     db,
+		Log:    log,
+		txOpts: storage.TxOptions{}.Apply(opts...),
+	}
 }
 
-func NewStore(db *sql.DB, log *zap.Logger) storage.Storer {
+// NewReplicatedStore creates a store that writes to primary and reads songs
+// and texts from replicas, see ReplicaSet.
+func NewReplicatedStore(primary *sql.DB, replicas *ReplicaSet, log *zap.Logger, opts ...storage.TxOption) storage.Storer {
 	return &Store{
-		DB:  db,
-		Log: log,
+		DB:       primary,
+		Log:      log,
+		txOpts:   storage.TxOptions{}.Apply(opts...),
+		replicas: replicas,
 	}
 }
 
-func Connect(cfg config.Config) (*sql.DB, error) {
-	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable", cfg.DB.Host, cfg.DB.Port, cfg.DB.User, cfg.DB.Pass, cfg.DB.Name)
-	db, err := sql.Open("pgx", dsn)
+const (
+	// connectBaseDelay is the wait before the first connect retry, it doubles
+	// on every attempt.
+	connectBaseDelay = 500 * time.Millisecond
+	connectMaxDelay  = 10 * time.Second
+)
+
+// Connect opens the connection pool described by cfg and waits until the
+// database answers. While it is starting up or unreachable the connection is
+// tried again up to cfg.ConnectRetries times with a growing delay.
+func Connect(ctx context.Context, cfg config.DB, log *zap.Logger) (*sql.DB, error) {
+	db, err := Open(cfg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create database connection pool: %w", err)
+		return nil, err
+	}
+	if err := waitReady(ctx, cfg, log, db.PingContext); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// waitReady pings the database until it answers, see Connect.
+func waitReady(ctx context.Context, cfg config.DB, log *zap.Logger, ping func(context.Context) error) error {
+	delay := connectBaseDelay
+	for attempt := 0; ; attempt++ {
+		err := ping(ctx)
+		if err == nil {
+			return nil
+		}
+		if !isConnectRetryable(err) || attempt >= cfg.ConnectRetries {
+			return fmt.Errorf("failed to ping database: %w", err)
+		}
+
+		log.Warn("Database is not available, retrying", zap.Int("attempt", attempt+1), zap.Duration("delay", delay), zap.Error(err))
+		select {
+		case <-ctx.Done():
+			return errors.Join(fmt.Errorf("failed to ping database: %w", err), ctx.Err())
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, connectMaxDelay)
 	}
+}
 
-	if err := db.Ping(); err != nil {
-		return nil, fmt.Errorf("failed to ping database: %w", err)
+// Open creates the connection pool described by cfg without connecting.
+func Open(cfg config.DB) (*sql.DB, error) {
+	db, err := sql.Open("pgx", DSN(cfg))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create database connection pool: %w", err)
 	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
 	return db, nil
 }
+
+// OpenReplica creates the connection pool of the replica at addr, which
+// shares every other setting with the primary described by cfg. A replica
+// that is down at start is not waited for, the ReplicaSet picks it up once
+// it answers.
+func OpenReplica(cfg config.DB, addr string) (*sql.DB, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid replica address %q: %w", addr, err)
+	}
+	cfg.Host, cfg.Port = host, port
+	return Open(cfg)
+}
+
+// isConnectRetryable reports whether a failed ping may succeed later. Errors
+// the server answered with, such as a wrong password, are final, except
+// while the server is starting up.
+func isConnectRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return true
+	}
+	return pgErr.Code == "57P03" // cannot_connect_now
+}
+
+// DSN returns the connection string of cfg.
+func DSN(cfg config.DB) string {
+	params := [][2]string{
+		{"host", cfg.Host},
+		{"port", cfg.Port},
+		{"user", cfg.User},
+		{"password", cfg.Pass},
+		{"dbname", cfg.Name},
+		{"sslmode", cfg.SSLMode},
+		{"sslrootcert", cfg.SSLRootCert},
+		{"sslcert", cfg.SSLCert},
+		{"sslkey", cfg.SSLKey},
+		{"application_name", cfg.ApplicationName},
+	}
+	if cfg.StatementTimeout > 0 {
+		params = append(params, [2]string{"statement_timeout", strconv.FormatInt(cfg.StatementTimeout.Milliseconds(), 10)})
+	}
+
+	var parts []string
+	for _, p := range params {
+		if p[1] != "" {
+			parts = append(parts, p[0]+"="+quoteDSNValue(p[1]))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// quoteDSNValue quotes values with spaces, quotes or backslashes, as the
+// key=value connection string format requires.
+func quoteDSNValue(v string) string {
+	if !strings.ContainsAny(v, ` '\`) {
+		return v
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v) + "'"
+}
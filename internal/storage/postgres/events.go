@@ -0,0 +1,141 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/SemenShakhray/list-of-song/internal/models"
+	"github.com/SemenShakhray/list-of-song/internal/storage"
+	"github.com/SemenShakhray/list-of-song/pkg/logger"
+
+	"github.com/jackc/pgx/v5/stdlib"
+	"go.uber.org/zap"
+)
+
+// eventsChannel is notified with the ID of every song event on commit, see
+// the song_events_notify trigger.
+const eventsChannel = "song_events"
+
+const eventColumns = "id, type, data, created_at"
+
+type EventStore struct {
+	DB  *sql.DB
+	Log *zap.Logger
+}
+
+func NewEventStore(db *sql.DB, log *zap.Logger) storage.EventStorer {
+	return &EventStore{
+		DB:  db,
+		Log: log,
+	}
+}
+
+func (s *EventStore) log(ctx context.Context) *zap.Logger {
+	return logger.FromContext(ctx, s.Log)
+}
+
+func (s *EventStore) conn() querier {
+	return tracedQuerier{q: s.DB}
+}
+
+func scanEvent(row rowScanner) (models.Event, error) {
+	var (
+		event models.Event
+		data  []byte
+	)
+	err := row.Scan(&event.Id, &event.Type, &data, &event.CreatedAt)
+	event.Data = data
+	event.CreatedAt = event.CreatedAt.UTC()
+	return event, err
+}
+
+func (s *EventStore) queryEvents(ctx context.Context, query string, args ...any) ([]models.Event, error) {
+	rows, err := s.conn().QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query song events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []models.Event
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan song event: %w", err)
+		}
+		events = append(events, event)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating through song events: %w", err)
+	}
+	return events, nil
+}
+
+func (s *EventStore) RecentEvents(ctx context.Context, limit int) ([]models.Event, error) {
+	query := "SELECT " + eventColumns + " FROM (SELECT " + eventColumns +
+		" FROM song_events ORDER BY id DESC LIMIT $1) recent ORDER BY id"
+	return s.queryEvents(ctx, query, limit)
+}
+
+// WatchEvents listens to eventsChannel on a connection of its own, which is
+// taken from the pool for as long as it runs. The events committed before
+// listening started are read from the table.
+func (s *EventStore) WatchEvents(ctx context.Context, after int64, fn func(models.Event)) error {
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn any) error {
+		listener := driverConn.(*stdlib.Conn).Conn()
+		if _, err := listener.Exec(ctx, "LISTEN "+eventsChannel); err != nil {
+			return fmt.Errorf("failed to listen to song events: %w", err)
+		}
+		defer func() {
+			// The connection goes back to the pool, it must not keep
+			// collecting notifications there. A broken connection fails
+			// here and is discarded by the pool.
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Second)
+			defer cancel()
+			_, _ = listener.Exec(ctx, "UNLISTEN "+eventsChannel)
+		}()
+
+		events, err := s.queryEvents(ctx, "SELECT "+eventColumns+" FROM song_events WHERE id > $1 ORDER BY id", after)
+		if err != nil {
+			return err
+		}
+		for _, event := range events {
+			fn(event)
+		}
+
+		query := "SELECT " + eventColumns + " FROM song_events WHERE id = $1"
+		for {
+			notification, err := listener.WaitForNotification(ctx)
+			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				return fmt.Errorf("failed to wait for song events: %w", err)
+			}
+			id, err := strconv.ParseInt(notification.Payload, 10, 64)
+			if err != nil {
+				s.log(ctx).Warn("Ignoring malformed song event notification", zap.String("payload", notification.Payload))
+				continue
+			}
+
+			event, err := scanEvent(s.conn().QueryRowContext(ctx, query, id))
+			if errors.Is(err, sql.ErrNoRows) {
+				// Pruned already.
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("failed to get song event: %w", err)
+			}
+			fn(event)
+		}
+	})
+}
@@ -0,0 +1,202 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/SemenShakhray/list-of-song/internal/models"
+	"github.com/SemenShakhray/list-of-song/internal/requestctx"
+	"github.com/SemenShakhray/list-of-song/internal/storage"
+
+	"go.uber.org/zap"
+)
+
+// lockSong reads a song and locks its row until the end of the transaction.
+// deleted selects whether the song must be in the trash or not.
+func (s *Store) lockSong(ctx context.Context, id int, deleted bool) (models.Song, error) {
+	song, err := scanSong(s.conn().QueryRowContext(ctx, queryLockSong, id, deleted))
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return models.Song{}, fmt.Errorf("failed to read song: %w", err)
+	}
+	return song, err
+}
+
+// addRevision appends the next revision of a song to its history and the
+// event of the change to the outbox. It must run in the transaction that made
+// the change, so the event is sent exactly when the change is committed.
+func (s *Store) addRevision(ctx context.Context, action string, before, after *models.Song) error {
+	songID, args, err := revisionArgs(ctx, action, before, after)
+	if err != nil {
+		return err
+	}
+
+	var revision int
+	err = s.conn().QueryRowContext(ctx, queryAddRevision, args...).Scan(&revision)
+	if err != nil {
+		return fmt.Errorf("failed to record song revision: %w", err)
+	}
+
+	args, err = eventArgs(songID, revision, action, before, after)
+	if err != nil {
+		return err
+	}
+	if _, err := s.conn().ExecContext(ctx, queryAddEvent, args...); err != nil {
+		return fmt.Errorf("failed to record song event: %w", err)
+	}
+	s.log(ctx).Debug("Song revision recorded", zap.Int("song", songID), zap.Int("revision", revision), zap.String("action", action))
+	return nil
+}
+
+// revisionArgs returns the song the revision belongs to and the arguments of
+// queryAddRevision.
+func revisionArgs(ctx context.Context, action string, before, after *models.Song) (int, []any, error) {
+	songID := 0
+	if after != nil {
+		songID = after.Id
+	} else if before != nil {
+		songID = before.Id
+	}
+
+	beforeJSON, err := snapshot(before)
+	if err != nil {
+		return 0, nil, err
+	}
+	afterJSON, err := snapshot(after)
+	if err != nil {
+		return 0, nil, err
+	}
+	return songID, []any{songID, action, beforeJSON, afterJSON, requestctx.Actor(ctx), requestctx.RequestID(ctx)}, nil
+}
+
+// eventArgs returns the arguments of queryAddEvent.
+func eventArgs(songID, revision int, action string, before, after *models.Song) ([]any, error) {
+	data, err := json.Marshal(models.SongChange{
+		SongId:   songID,
+		Revision: revision,
+		Action:   action,
+		Song:     after,
+		Previous: before,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode song event: %w", err)
+	}
+	return []any{models.RevisionEvent(action), songID, revision, data}, nil
+}
+
+func snapshot(song *models.Song) ([]byte, error) {
+	if song == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(song)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode song snapshot: %w", err)
+	}
+	return b, nil
+}
+
+func scanRevision(row rowScanner) (models.Revision, error) {
+	var (
+		rev           models.Revision
+		before, after []byte
+	)
+	err := row.Scan(&rev.SongId, &rev.Revision, &rev.Action, &before, &after, &rev.Actor, &rev.RequestId, &rev.CreatedAt)
+	if err != nil {
+		return models.Revision{}, err
+	}
+	if before != nil {
+		rev.Before = &models.Song{}
+		if err := json.Unmarshal(before, rev.Before); err != nil {
+			return models.Revision{}, fmt.Errorf("failed to decode song snapshot: %w", err)
+		}
+	}
+	if after != nil {
+		rev.After = &models.Song{}
+		if err := json.Unmarshal(after, rev.After); err != nil {
+			return models.Revision{}, fmt.Errorf("failed to decode song snapshot: %w", err)
+		}
+	}
+	return rev, nil
+}
+
+// GetHistory returns the revisions of a song, the newest first.
+func (s *Store) GetHistory(ctx context.Context, id int, limit, offset int) ([]models.Revision, error) {
+	s.log(ctx).Debug("Get song history", zap.Int("song", id))
+
+	rows, err := s.conn().QueryContext(ctx, queryGetHistory, id, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query song history: %w", err)
+	}
+	defer rows.Close()
+
+	var revisions []models.Revision
+	for rows.Next() {
+		rev, err := scanRevision(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan revision: %w", err)
+		}
+		revisions = append(revisions, rev)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating through song history: %w", err)
+	}
+	s.log(ctx).Debug("Song history has been successfully received", zap.Int("total", len(revisions)))
+	return revisions, nil
+}
+
+func (s *Store) GetRevision(ctx context.Context, id int, revision int) (models.Revision, error) {
+	s.log(ctx).Debug("Get song revision", zap.Int("song", id), zap.Int("revision", revision))
+
+	rev, err := scanRevision(s.conn().QueryRowContext(ctx, queryGetRevision, id, revision))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Revision{}, fmt.Errorf("revision not found")
+		}
+		return models.Revision{}, fmt.Errorf("failed to get song revision: %w", err)
+	}
+	return rev, nil
+}
+
+// Revert sets a song back to its state after the given revision, including
+// whether it was in the trash, and records that as a new revision.
+func (s *Store) Revert(ctx context.Context, id int, revision int) error {
+	s.log(ctx).Debug("Attempting to revert song", zap.Int("song", id), zap.Int("revision", revision))
+
+	return s.inTx(ctx, func(tx *Store) error {
+		rev, err := tx.GetRevision(ctx, id, revision)
+		if err != nil {
+			return err
+		}
+		if rev.After == nil {
+			return fmt.Errorf("revision %d has no song state to revert to", revision)
+		}
+
+		before, err := scanSong(tx.conn().QueryRowContext(ctx, queryLockAnySong, id))
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("song not found")
+			}
+			return fmt.Errorf("failed to read song: %w", err)
+		}
+
+		target := rev.After
+		row := tx.conn().QueryRowContext(ctx, queryRevertSong, target.Song, target.Group, target.Text, target.Link, target.Date, target.DeletedAt, id)
+		after, err := scanSong(row)
+		if isUniqueViolation(err) {
+			return storage.ErrSongExists
+		}
+		if err != nil {
+			return fmt.Errorf("failed to revert song: %w", err)
+		}
+
+		err = tx.addRevision(ctx, models.RevisionRevert, &before, &after)
+		if err != nil {
+			return err
+		}
+		s.log(ctx).Debug("Song successfully reverted", zap.Int("song", id), zap.Int("revision", revision))
+		return nil
+	})
+}
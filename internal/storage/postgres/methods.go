@@ -3,150 +3,167 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"strings"
 
 	"github.com/SemenShakhray/list-of-song/internal/models"
+	"github.com/SemenShakhray/list-of-song/internal/storage"
 
 	"go.uber.org/zap"
 )
 
 func (s *Store) AddSong(ctx context.Context, song models.Song) error {
 
-	s.Log.Debug("Attempting to add song",
+	s.log(ctx).Debug("Attempting to add song",
 		zap.String("song", song.Song),
 		zap.String("group", song.Group),
 	)
 
-	query := `INSERT INTO songs (song, group_name, text, link, date_release) VALUES ($1, $2, $3, $4, $5)
-	ON CONFLICT (song, group_name) DO NOTHING;`
-
-	row, err := s.DB.ExecContext(ctx, query, song.Song, song.Group, song.Text, song.Link, song.Date)
-	if err != nil {
-		return fmt.Errorf("failed to add song in storage: %w", err)
-	}
-	n, err := row.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("failed to retrieve rows affected: %w", err)
-	}
-	if n == 0 {
-		s.Log.Warn("Song already exists in the storage",
-			zap.String("song", song.Song),
-			zap.String("group", song.Group),
-		)
-	}
-	s.Log.Debug("Song successfully added")
-	return nil
+	return s.inTx(ctx, func(tx *Store) error {
+		row := tx.conn().QueryRowContext(ctx, queryAddSong, song.Song, song.Group, song.Text, song.Link, song.Date)
+		added, err := scanSong(row)
+		if errors.Is(err, sql.ErrNoRows) {
+			s.log(ctx).Warn("Song already exists in the storage",
+				zap.String("song", song.Song),
+				zap.String("group", song.Group),
+			)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to add song in storage: %w", err)
+		}
 
+		err = tx.addRevision(ctx, models.RevisionCreate, nil, &added)
+		if err != nil {
+			return err
+		}
+		s.log(ctx).Debug("Song successfully added")
+		return nil
+	})
 }
 
 func (s *Store) Update(ctx context.Context, song models.Song) error {
 
-	s.Log.Debug("Updating info about song",
+	s.log(ctx).Debug("Updating info about song",
 		zap.Int("song", song.Id),
 	)
 
-	query := `UPDATE songs SET 
-	song = COALESCE(NULLIF($1, ''), song),
-	group_name = COALESCE(NULLIF($1, ''), group_name),
-	text = COALESCE(NULLIF($1, ''), text),
-    link = COALESCE(NULLIF($2, ''), link),
-    date_release = COALESCE(NULLIF($3, ''), date_release)
-	WHERE id = $4`
+	return s.inTx(ctx, func(tx *Store) error {
+		before, err := tx.lockSong(ctx, song.Id, false)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("song not found")
+		}
+		if err != nil {
+			return err
+		}
 
-	row, err := s.DB.ExecContext(ctx, query, song.Song, song.Group, song.Text, song.Link, song.Date, song.Id)
-	if err != nil {
-		return fmt.Errorf("failed to update info about song: %w", err)
-	}
-	n, err := row.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("failed to retrieve rows affected: %w", err)
-	}
-	if n == 0 {
-		return fmt.Errorf("song not found")
-	}
-	s.Log.Debug("Song info successfully updated")
-	return nil
+		row := tx.conn().QueryRowContext(ctx, queryUpdateSong, song.Song, song.Group, song.Text, song.Link, song.Date, song.Id)
+		after, err := scanSong(row)
+		if isUniqueViolation(err) {
+			return storage.ErrSongExists
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update info about song: %w", err)
+		}
+
+		err = tx.addRevision(ctx, models.RevisionUpdate, &before, &after)
+		if err != nil {
+			return err
+		}
+		s.log(ctx).Debug("Song info successfully updated")
+		return nil
+	})
 }
 
-func (s *Store) GetAll(ctx context.Context, filters models.Filters) ([]models.Song, error) {
+type rowScanner interface {
+	Scan(dest ...any) error
+}
 
-	s.Log.Debug("Get songs", zap.Any("filters_song", filters))
+func scanSong(row rowScanner) (models.Song, error) {
+	var song models.Song
+	err := row.Scan(&song.Id, &song.Song, &song.Group, &song.Text, &song.Link, &song.Date, &song.DeletedAt)
+	return song, err
+}
 
-	query := `SELECT id, song, group_name, text, link, date_release FROM songs
-WHERE (song ILIKE '%' || $1 || '%') AND 
-( group_name ILIKE '%' || $2 || '%') AND 
-(text ILIKE '%' || $3 || '%') AND 
-(link ILIKE '%' || $4 || '%') AND 
-(date_release = $5)
-LIMIT $6 OFFSET $7;`
+func (s *Store) GetAll(ctx context.Context, filters models.Filters) ([]models.Song, error) {
 
-	var songs []models.Song
-	rows, err := s.DB.QueryContext(ctx, query,
-		filters.Song,
-		filters.Group,
-		filters.Text,
-		filters.Link,
-		filters.Date,
-		filters.Limit,
-		filters.Offset,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to query songs: %w", err)
-	}
-	defer rows.Close()
+	s.log(ctx).Debug("Get songs", zap.Any("filters_song", filters))
 
-	for rows.Next() {
-		var song models.Song
-		err := rows.Scan(&song.Id, &song.Song, &song.Group, &song.Text, &song.Link, &song.Date)
+	var songs []models.Song
+	err := s.read(ctx, func(q querier) error {
+		songs = nil
+		rows, err := q.QueryContext(ctx, queryGetAll,
+			filters.Song,
+			filters.Group,
+			filters.Text,
+			filters.Link,
+			filters.Date,
+			filters.Limit,
+			filters.Offset,
+		)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan song: %w", err)
+			return fmt.Errorf("failed to query songs: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var song models.Song
+			err := rows.Scan(&song.Id, &song.Song, &song.Group, &song.Text, &song.Link, &song.Date)
+			if err != nil {
+				return fmt.Errorf("failed to scan song: %w", err)
+			}
+			songs = append(songs, song)
 		}
-		songs = append(songs, song)
-	}
 
-	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating through songs: %w", err)
+		if err = rows.Err(); err != nil {
+			return fmt.Errorf("error iterating through songs: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	s.Log.Debug("List of songs has been successfully received", zap.Int("total", len(songs)))
+	s.log(ctx).Debug("List of songs has been successfully received", zap.Int("total", len(songs)))
 	return songs, nil
 }
 
 func (s *Store) Delete(ctx context.Context, id int) error {
-	s.Log.Debug("Attempting to delete song",
+	s.log(ctx).Debug("Attempting to delete song",
 		zap.Int("song", id),
 	)
 
-	query := "DELETE FROM songs WHERE id = $1;"
-	row, err := s.DB.ExecContext(ctx, query, id)
-	if err != nil {
-		return fmt.Errorf("failed to delete song: %w", err)
-	}
+	return s.inTx(ctx, func(tx *Store) error {
+		before, err := tx.lockSong(ctx, id, false)
+		if errors.Is(err, sql.ErrNoRows) {
+			s.log(ctx).Debug("No songs deleted",
+				zap.Int("song", id),
+			)
+			return fmt.Errorf("failed delete the song")
+		}
+		if err != nil {
+			return err
+		}
 
-	n, err := row.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("failed to retrieve rows affected: %w", err)
-	}
-	if n == 0 {
-		s.Log.Debug("No songs deleted",
-			zap.Int("song", id),
-		)
-		return fmt.Errorf("failed delete the song")
-	}
-	return nil
+		after, err := scanSong(tx.conn().QueryRowContext(ctx, queryDeleteSong, id))
+		if err != nil {
+			return fmt.Errorf("failed to delete song: %w", err)
+		}
+
+		return tx.addRevision(ctx, models.RevisionDelete, &before, &after)
+	})
 }
 
 func (s *Store) GetText(ctx context.Context, filters models.Filters, id int) (string, error) {
-	s.Log.Debug("Attemting get text of song")
-
-	query := "SELECT text FROM songs WHERE id = $1"
-	row := s.DB.QueryRowContext(ctx, query, id)
+	s.log(ctx).Debug("Attemting get text of song")
 
 	var text string
-	err := row.Scan(&text)
+	err := s.read(ctx, func(q querier) error {
+		return q.QueryRowContext(ctx, queryGetText, id).Scan(&text)
+	})
 	if err != nil {
 		if err == sql.ErrNoRows {
-			s.Log.Warn("Song not found", zap.String("song", filters.Song))
+			s.log(ctx).Warn("Song not found", zap.String("song", filters.Song))
 			return "", fmt.Errorf("failed to get text of the song: %w", err)
 		}
 		return "", fmt.Errorf("failed to retrieve text of the song: %w", err)
@@ -154,7 +171,7 @@ func (s *Store) GetText(ctx context.Context, filters models.Filters, id int) (st
 
 	verses := strings.Split(text, "\n")
 	if filters.Offset >= len(verses) {
-		s.Log.Debug("Offset exceeds number of verses", zap.Int("offset", filters.Offset), zap.Int("len(verses)", len(verses)))
+		s.log(ctx).Debug("Offset exceeds number of verses", zap.Int("offset", filters.Offset), zap.Int("len(verses)", len(verses)))
 		text = ""
 		return text, nil
 	}
@@ -164,6 +181,6 @@ func (s *Store) GetText(ctx context.Context, filters models.Filters, id int) (st
 	}
 	text = strings.Join(verses[filters.Offset:end], "\n")
 
-	s.Log.Debug("Text of the song successfully received", zap.String("song", filters.Song))
+	s.log(ctx).Debug("Text of the song successfully received", zap.String("song", filters.Song))
 	return text, nil
 }
@@ -0,0 +1,32 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/pressly/goose/v3"
+)
+
+// CheckMigrations returns an error when the database schema is behind the
+// newest migration in dir.
+func CheckMigrations(ctx context.Context, db *sql.DB, dir string) error {
+	current, err := goose.GetDBVersionContext(ctx, db)
+	if err != nil {
+		return fmt.Errorf("failed to get database version: %w", err)
+	}
+
+	migrations, err := goose.CollectMigrations(dir, 0, goose.MaxVersion)
+	if err != nil {
+		return fmt.Errorf("failed to collect migrations: %w", err)
+	}
+	last, err := migrations.Last()
+	if err != nil {
+		return fmt.Errorf("failed to get latest migration: %w", err)
+	}
+
+	if current < last.Version {
+		return fmt.Errorf("database version %d is behind migration %d", current, last.Version)
+	}
+	return nil
+}
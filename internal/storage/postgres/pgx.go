@@ -0,0 +1,195 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/SemenShakhray/list-of-song/internal/config"
+	"github.com/SemenShakhray/list-of-song/internal/storage"
+	"github.com/SemenShakhray/list-of-song/pkg/logger"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+// PgxStore is the Storer on a native pgx connection pool. Every statement it
+// runs is prepared once per connection, and the independent queries of one
+// operation are sent to the database together as a batch.
+type PgxStore struct {
+	Pool *pgxpool.Pool
+	Log  *zap.Logger
+
+	txOpts storage.TxOptions
+	tx     pgx.Tx
+}
+
+// pgxQuerier is the part of *pgxpool.Pool and pgx.Tx used by the store methods.
+type pgxQuerier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
+}
+
+// statements are prepared on every new connection of the pool. They are
+// prepared under their own text, so the store runs them by passing the query.
+var statements = []string{
+	queryAddSong,
+	queryUpdateSong,
+	queryGetAll,
+	queryDeleteSong,
+	queryGetText,
+	queryExport,
+	queryGetTrash,
+	queryRestoreSong,
+	queryPurge,
+	queryLockSong,
+	queryLockAnySong,
+	queryAddRevision,
+	queryAddEvent,
+	queryGetHistory,
+	queryGetRevision,
+	queryRevertSong,
+}
+
+// NewPgxStore creates a store on pool. opts set the defaults for WithTx.
+func NewPgxStore(pool *pgxpool.Pool, log *zap.Logger, opts ...storage.TxOption) storage.Storer {
+	return &PgxStore{
+		Pool:   pool,
+		Log:    log,
+		txOpts: storage.TxOptions{}.Apply(opts...),
+	}
+}
+
+// ConnectPool opens the pgx pool described by cfg and waits for the database
+// like Connect. The store statements are prepared on every connection, so the
+// migrations must have been applied before.
+func ConnectPool(ctx context.Context, cfg config.DB, log *zap.Logger) (*pgxpool.Pool, error) {
+	poolCfg, err := pgxpool.ParseConfig(DSN(cfg))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse database config: %w", err)
+	}
+	if cfg.MaxOpenConns > 0 {
+		poolCfg.MaxConns = int32(cfg.MaxOpenConns)
+	}
+	if cfg.ConnMaxLifetime > 0 {
+		poolCfg.MaxConnLifetime = cfg.ConnMaxLifetime
+	}
+	if cfg.ConnMaxIdleTime > 0 {
+		poolCfg.MaxConnIdleTime = cfg.ConnMaxIdleTime
+	}
+	poolCfg.ConnConfig.Tracer = pgxTracer{}
+	poolCfg.AfterConnect = prepareStatements
+
+	pool, err := pgxpool.NewWithConfig(ctx, poolCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create database connection pool: %w", err)
+	}
+	if err := waitReady(ctx, cfg, log, pool.Ping); err != nil {
+		pool.Close()
+		return nil, err
+	}
+	return pool, nil
+}
+
+func prepareStatements(ctx context.Context, conn *pgx.Conn) error {
+	for _, query := range statements {
+		if _, err := conn.Prepare(ctx, query, query); err != nil {
+			return fmt.Errorf("failed to prepare statement: %w", err)
+		}
+	}
+	return nil
+}
+
+// conn returns the transaction the store is bound to, or the pool otherwise.
+func (s *PgxStore) conn() pgxQuerier {
+	if s.tx != nil {
+		return s.tx
+	}
+	return s.Pool
+}
+
+// log returns the store logger with the fields of the request ctx belongs to.
+func (s *PgxStore) log(ctx context.Context) *zap.Logger {
+	return logger.FromContext(ctx, s.Log)
+}
+
+// WithTx runs fn inside a database transaction, see Store.WithTx.
+func (s *PgxStore) WithTx(ctx context.Context, fn func(storage.Storer) error, opts ...storage.TxOption) error {
+	if s.tx != nil {
+		return fn(s)
+	}
+
+	o := s.txOpts.Apply(opts...)
+	delay := retryBaseDelay
+	for attempt := 0; ; attempt++ {
+		err := s.runTx(ctx, fn, o)
+		if err == nil || !isRetryable(err) || attempt >= o.MaxRetries {
+			return err
+		}
+
+		s.log(ctx).Debug("Retrying transaction", zap.Int("attempt", attempt+1), zap.Error(err))
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(delay/2 + rand.N(delay/2+1)):
+		}
+		delay = min(delay*2, retryMaxDelay)
+	}
+}
+
+// inTx is WithTx for the store methods, which need the concrete store.
+func (s *PgxStore) inTx(ctx context.Context, fn func(tx *PgxStore) error) error {
+	return s.WithTx(ctx, func(st storage.Storer) error {
+		return fn(st.(*PgxStore))
+	})
+}
+
+func (s *PgxStore) runTx(ctx context.Context, fn func(storage.Storer) error, o storage.TxOptions) error {
+	txOpts := pgx.TxOptions{IsoLevel: pgxIsolation(o.Isolation)}
+	if o.ReadOnly {
+		txOpts.AccessMode = pgx.ReadOnly
+	}
+	tx, err := s.Pool.BeginTx(ctx, txOpts)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	s.log(ctx).Debug("Transaction started", zap.Stringer("isolation", o.Isolation))
+
+	err = fn(&PgxStore{Pool: s.Pool, Log: s.Log, txOpts: s.txOpts, tx: tx})
+	if err != nil {
+		// The rollback must also run when ctx is the reason fn failed.
+		if rbErr := tx.Rollback(context.WithoutCancel(ctx)); rbErr != nil {
+			return errors.Join(err, fmt.Errorf("failed to rollback transaction: %w", rbErr))
+		}
+		s.log(ctx).Debug("Transaction rolled back", zap.Error(err))
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	s.log(ctx).Debug("Transaction committed")
+	return nil
+}
+
+// pgxIsolation converts level to pgx, the zero value is the database default.
+func pgxIsolation(level sql.IsolationLevel) pgx.TxIsoLevel {
+	switch level {
+	case sql.LevelReadUncommitted:
+		return pgx.ReadUncommitted
+	case sql.LevelReadCommitted:
+		return pgx.ReadCommitted
+	case sql.LevelRepeatableRead:
+		return pgx.RepeatableRead
+	case sql.LevelSerializable:
+		return pgx.Serializable
+	}
+	return ""
+}
@@ -0,0 +1,414 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/SemenShakhray/list-of-song/internal/models"
+	"github.com/SemenShakhray/list-of-song/internal/storage"
+
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+func (s *PgxStore) AddSong(ctx context.Context, song models.Song) error {
+	s.log(ctx).Debug("Attempting to add song",
+		zap.String("song", song.Song),
+		zap.String("group", song.Group),
+	)
+
+	return s.inTx(ctx, func(tx *PgxStore) error {
+		row := tx.conn().QueryRow(ctx, queryAddSong, song.Song, song.Group, song.Text, song.Link, song.Date)
+		added, err := scanSong(row)
+		if errors.Is(err, sql.ErrNoRows) {
+			s.log(ctx).Warn("Song already exists in the storage",
+				zap.String("song", song.Song),
+				zap.String("group", song.Group),
+			)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to add song in storage: %w", err)
+		}
+
+		err = tx.addRevision(ctx, models.RevisionCreate, nil, &added)
+		if err != nil {
+			return err
+		}
+		s.log(ctx).Debug("Song successfully added")
+		return nil
+	})
+}
+
+func (s *PgxStore) Update(ctx context.Context, song models.Song) error {
+	s.log(ctx).Debug("Updating info about song",
+		zap.Int("song", song.Id),
+	)
+
+	return s.inTx(ctx, func(tx *PgxStore) error {
+		before, after, err := tx.lockAndChange(ctx, song.Id, false,
+			queryUpdateSong, song.Song, song.Group, song.Text, song.Link, song.Date, song.Id)
+		if errors.Is(err, errSongNotLocked) {
+			return fmt.Errorf("song not found")
+		}
+		if isUniqueViolation(err) {
+			return storage.ErrSongExists
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update info about song: %w", err)
+		}
+
+		err = tx.addRevision(ctx, models.RevisionUpdate, &before, &after)
+		if err != nil {
+			return err
+		}
+		s.log(ctx).Debug("Song info successfully updated")
+		return nil
+	})
+}
+
+func (s *PgxStore) Delete(ctx context.Context, id int) error {
+	s.log(ctx).Debug("Attempting to delete song",
+		zap.Int("song", id),
+	)
+
+	return s.inTx(ctx, func(tx *PgxStore) error {
+		before, after, err := tx.lockAndChange(ctx, id, false, queryDeleteSong, id)
+		if errors.Is(err, errSongNotLocked) {
+			s.log(ctx).Debug("No songs deleted",
+				zap.Int("song", id),
+			)
+			return fmt.Errorf("failed delete the song")
+		}
+		if err != nil {
+			return fmt.Errorf("failed to delete song: %w", err)
+		}
+
+		return tx.addRevision(ctx, models.RevisionDelete, &before, &after)
+	})
+}
+
+func (s *PgxStore) Restore(ctx context.Context, id int) error {
+	s.log(ctx).Debug("Attempting to restore song",
+		zap.Int("song", id),
+	)
+
+	return s.inTx(ctx, func(tx *PgxStore) error {
+		before, after, err := tx.lockAndChange(ctx, id, true, queryRestoreSong, id)
+		if errors.Is(err, errSongNotLocked) {
+			return fmt.Errorf("song not found in trash")
+		}
+		if isUniqueViolation(err) {
+			return storage.ErrSongExists
+		}
+		if err != nil {
+			return fmt.Errorf("failed to restore song: %w", err)
+		}
+
+		err = tx.addRevision(ctx, models.RevisionRestore, &before, &after)
+		if err != nil {
+			return err
+		}
+		s.log(ctx).Debug("Song successfully restored")
+		return nil
+	})
+}
+
+// errSongNotLocked is returned by lockAndChange when the song to change does
+// not exist or is not in the expected state.
+var errSongNotLocked = errors.New("song not locked")
+
+// lockAndChange locks a song like Store.lockSong and runs change on it in the
+// same round trip. change must not match a song the lock did not find, it
+// returns the song as it is after the change.
+func (s *PgxStore) lockAndChange(ctx context.Context, id int, deleted bool, change string, args ...any) (before, after models.Song, err error) {
+	b := &pgx.Batch{}
+	b.Queue(queryLockSong, id, deleted)
+	b.Queue(change, args...)
+
+	br := s.conn().SendBatch(ctx, b)
+	defer func() {
+		if closeErr := br.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+
+	before, err = scanSong(br.QueryRow())
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Song{}, models.Song{}, errSongNotLocked
+	}
+	if err != nil {
+		return models.Song{}, models.Song{}, fmt.Errorf("failed to read song: %w", err)
+	}
+
+	after, err = scanSong(br.QueryRow())
+	if err != nil {
+		return models.Song{}, models.Song{}, err
+	}
+	return before, after, nil
+}
+
+// addRevision appends the next revision of a song to its history and the
+// event of the change to the outbox, see Store.addRevision.
+func (s *PgxStore) addRevision(ctx context.Context, action string, before, after *models.Song) error {
+	songID, args, err := revisionArgs(ctx, action, before, after)
+	if err != nil {
+		return err
+	}
+
+	var revision int
+	err = s.conn().QueryRow(ctx, queryAddRevision, args...).Scan(&revision)
+	if err != nil {
+		return fmt.Errorf("failed to record song revision: %w", err)
+	}
+
+	args, err = eventArgs(songID, revision, action, before, after)
+	if err != nil {
+		return err
+	}
+	if _, err := s.conn().Exec(ctx, queryAddEvent, args...); err != nil {
+		return fmt.Errorf("failed to record song event: %w", err)
+	}
+	s.log(ctx).Debug("Song revision recorded", zap.Int("song", songID), zap.Int("revision", revision), zap.String("action", action))
+	return nil
+}
+
+func (s *PgxStore) GetAll(ctx context.Context, filters models.Filters) ([]models.Song, error) {
+	s.log(ctx).Debug("Get songs", zap.Any("filters_song", filters))
+
+	var songs []models.Song
+	err := s.querySongs(ctx, queryGetAll, filters, func(rows pgx.Rows) error {
+		var song models.Song
+		err := rows.Scan(&song.Id, &song.Song, &song.Group, &song.Text, &song.Link, &song.Date)
+		if err != nil {
+			return fmt.Errorf("failed to scan song: %w", err)
+		}
+		songs = append(songs, song)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.log(ctx).Debug("List of songs has been successfully received", zap.Int("total", len(songs)))
+	return songs, nil
+}
+
+// Export streams every song matching filters to fn in id order, see
+// Store.Export.
+func (s *PgxStore) Export(ctx context.Context, filters models.Filters, fn func(models.Song) error) error {
+	s.log(ctx).Debug("Export songs", zap.Any("filters_song", filters))
+
+	total := 0
+	err := s.querySongs(ctx, queryExport, filters, func(rows pgx.Rows) error {
+		var song models.Song
+		err := rows.Scan(&song.Id, &song.Song, &song.Group, &song.Text, &song.Link, &song.Date)
+		if err != nil {
+			return fmt.Errorf("failed to scan song: %w", err)
+		}
+		if err := fn(song); err != nil {
+			return err
+		}
+		total++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.log(ctx).Debug("Songs have been successfully exported", zap.Int("total", total))
+	return nil
+}
+
+// GetTrash returns deleted songs matching filters, the most recently deleted first.
+func (s *PgxStore) GetTrash(ctx context.Context, filters models.Filters) ([]models.Song, error) {
+	s.log(ctx).Debug("Get deleted songs", zap.Any("filters_song", filters))
+
+	var songs []models.Song
+	err := s.querySongs(ctx, queryGetTrash, filters, func(rows pgx.Rows) error {
+		var song models.Song
+		err := rows.Scan(&song.Id, &song.Song, &song.Group, &song.Text, &song.Link, &song.Date, &song.DeletedAt)
+		if err != nil {
+			return fmt.Errorf("failed to scan song: %w", err)
+		}
+		songs = append(songs, song)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.log(ctx).Debug("List of deleted songs has been successfully received", zap.Int("total", len(songs)))
+	return songs, nil
+}
+
+// querySongs runs a query taking the arguments of filterWhere, limit and
+// offset, and calls fn for every row.
+func (s *PgxStore) querySongs(ctx context.Context, query string, filters models.Filters, fn func(pgx.Rows) error) error {
+	rows, err := s.conn().Query(ctx, query,
+		filters.Song,
+		filters.Group,
+		filters.Text,
+		filters.Link,
+		filters.Date,
+		filters.Limit,
+		filters.Offset,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to query songs: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := fn(rows); err != nil {
+			return err
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("error iterating through songs: %w", err)
+	}
+	return nil
+}
+
+func (s *PgxStore) GetText(ctx context.Context, filters models.Filters, id int) (string, error) {
+	s.log(ctx).Debug("Attemting get text of song")
+
+	var text string
+	err := s.conn().QueryRow(ctx, queryGetText, id).Scan(&text)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.log(ctx).Warn("Song not found", zap.String("song", filters.Song))
+			return "", fmt.Errorf("failed to get text of the song: %w", err)
+		}
+		return "", fmt.Errorf("failed to retrieve text of the song: %w", err)
+	}
+
+	verses := strings.Split(text, "\n")
+	if filters.Offset >= len(verses) {
+		s.log(ctx).Debug("Offset exceeds number of verses", zap.Int("offset", filters.Offset), zap.Int("len(verses)", len(verses)))
+		return "", nil
+	}
+	end := min(filters.Offset+filters.Limit, len(verses))
+	text = strings.Join(verses[filters.Offset:end], "\n")
+
+	s.log(ctx).Debug("Text of the song successfully received", zap.String("song", filters.Song))
+	return text, nil
+}
+
+func (s *PgxStore) Purge(ctx context.Context, before time.Time) (int64, error) {
+	s.log(ctx).Debug("Purging deleted songs", zap.Time("before", before))
+
+	tag, err := s.conn().Exec(ctx, queryPurge, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge songs: %w", err)
+	}
+
+	n := tag.RowsAffected()
+	s.log(ctx).Debug("Deleted songs purged", zap.Int64("total", n))
+	return n, nil
+}
+
+// GetHistory returns the revisions of a song, the newest first.
+func (s *PgxStore) GetHistory(ctx context.Context, id int, limit, offset int) ([]models.Revision, error) {
+	s.log(ctx).Debug("Get song history", zap.Int("song", id))
+
+	rows, err := s.conn().Query(ctx, queryGetHistory, id, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query song history: %w", err)
+	}
+	defer rows.Close()
+
+	var revisions []models.Revision
+	for rows.Next() {
+		rev, err := scanRevision(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan revision: %w", err)
+		}
+		revisions = append(revisions, rev)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating through song history: %w", err)
+	}
+	s.log(ctx).Debug("Song history has been successfully received", zap.Int("total", len(revisions)))
+	return revisions, nil
+}
+
+func (s *PgxStore) GetRevision(ctx context.Context, id int, revision int) (models.Revision, error) {
+	s.log(ctx).Debug("Get song revision", zap.Int("song", id), zap.Int("revision", revision))
+
+	rev, err := scanRevision(s.conn().QueryRow(ctx, queryGetRevision, id, revision))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Revision{}, fmt.Errorf("revision not found")
+		}
+		return models.Revision{}, fmt.Errorf("failed to get song revision: %w", err)
+	}
+	return rev, nil
+}
+
+// Revert sets a song back to its state after the given revision, see
+// Store.Revert. The revision and the song are read in one round trip.
+func (s *PgxStore) Revert(ctx context.Context, id int, revision int) error {
+	s.log(ctx).Debug("Attempting to revert song", zap.Int("song", id), zap.Int("revision", revision))
+
+	return s.inTx(ctx, func(tx *PgxStore) error {
+		rev, before, err := tx.lockRevision(ctx, id, revision)
+		if err != nil {
+			return err
+		}
+		if rev.After == nil {
+			return fmt.Errorf("revision %d has no song state to revert to", revision)
+		}
+
+		target := rev.After
+		row := tx.conn().QueryRow(ctx, queryRevertSong, target.Song, target.Group, target.Text, target.Link, target.Date, target.DeletedAt, id)
+		after, err := scanSong(row)
+		if isUniqueViolation(err) {
+			return storage.ErrSongExists
+		}
+		if err != nil {
+			return fmt.Errorf("failed to revert song: %w", err)
+		}
+
+		err = tx.addRevision(ctx, models.RevisionRevert, &before, &after)
+		if err != nil {
+			return err
+		}
+		s.log(ctx).Debug("Song successfully reverted", zap.Int("song", id), zap.Int("revision", revision))
+		return nil
+	})
+}
+
+// lockRevision reads a revision of a song and locks the song in any state.
+func (s *PgxStore) lockRevision(ctx context.Context, id int, revision int) (rev models.Revision, song models.Song, err error) {
+	b := &pgx.Batch{}
+	b.Queue(queryGetRevision, id, revision)
+	b.Queue(queryLockAnySong, id)
+
+	br := s.conn().SendBatch(ctx, b)
+	defer func() {
+		if closeErr := br.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+
+	rev, err = scanRevision(br.QueryRow())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Revision{}, models.Song{}, fmt.Errorf("revision not found")
+		}
+		return models.Revision{}, models.Song{}, fmt.Errorf("failed to get song revision: %w", err)
+	}
+
+	song, err = scanSong(br.QueryRow())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Revision{}, models.Song{}, fmt.Errorf("song not found")
+		}
+		return models.Revision{}, models.Song{}, fmt.Errorf("failed to read song: %w", err)
+	}
+	return rev, song, nil
+}
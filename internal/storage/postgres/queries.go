@@ -0,0 +1,73 @@
+package postgres
+
+// songColumns are the columns read by scanSong.
+const songColumns = "id, song, group_name, text, link, date_release, deleted_at"
+
+// filterWhere matches the first five query arguments against models.Filters:
+// song, group, text and link are partial matches, date is exact when set.
+const filterWhere = `(song ILIKE '%' || $1 || '%') AND
+(group_name ILIKE '%' || $2 || '%') AND
+(text ILIKE '%' || $3 || '%') AND
+(link ILIKE '%' || $4 || '%') AND
+($5 = '' OR date_release = $5)`
+
+const revisionColumns = "song_id, revision, action, before, after, actor, request_id, created_at"
+
+// The statements of both stores. PgxStore prepares each of them on every
+// connection under its name in statements.
+const (
+	queryAddSong = `INSERT INTO songs (song, group_name, text, link, date_release) VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (song, group_name) WHERE deleted_at IS NULL DO NOTHING
+	RETURNING ` + songColumns + `;`
+
+	queryUpdateSong = `UPDATE songs SET
+	song = COALESCE(NULLIF($1, ''), song),
+	group_name = COALESCE(NULLIF($2, ''), group_name),
+	text = COALESCE(NULLIF($3, ''), text),
+    link = COALESCE(NULLIF($4, ''), link),
+    date_release = COALESCE(NULLIF($5, ''), date_release)
+	WHERE id = $6 AND deleted_at IS NULL
+	RETURNING ` + songColumns
+
+	queryGetAll = `SELECT id, song, group_name, text, link, date_release FROM songs
+WHERE deleted_at IS NULL AND ` + filterWhere + `
+ORDER BY id
+LIMIT $6 OFFSET $7;`
+
+	queryDeleteSong = "UPDATE songs SET deleted_at = now() WHERE id = $1 AND deleted_at IS NULL RETURNING " + songColumns
+
+	queryGetText = "SELECT text FROM songs WHERE id = $1 AND deleted_at IS NULL"
+
+	queryExport = `SELECT id, song, group_name, text, link, date_release FROM songs
+WHERE deleted_at IS NULL AND ` + filterWhere + `
+ORDER BY id
+LIMIT NULLIF($6, 0) OFFSET $7;`
+
+	queryGetTrash = `SELECT id, song, group_name, text, link, date_release, deleted_at FROM songs
+WHERE deleted_at IS NOT NULL AND ` + filterWhere + `
+ORDER BY deleted_at DESC
+LIMIT $6 OFFSET $7;`
+
+	queryRestoreSong = "UPDATE songs SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL RETURNING " + songColumns
+
+	queryPurge = "DELETE FROM songs WHERE deleted_at < $1;"
+
+	// queryLockSong selects whether the song must be in the trash or not with $2.
+	queryLockSong = "SELECT " + songColumns + " FROM songs WHERE id = $1 AND (deleted_at IS NOT NULL) = $2 FOR UPDATE"
+
+	queryLockAnySong = "SELECT " + songColumns + " FROM songs WHERE id = $1 FOR UPDATE"
+
+	queryAddRevision = `INSERT INTO song_revisions (song_id, revision, action, before, after, actor, request_id)
+	SELECT $1, COALESCE(MAX(revision), 0) + 1, $2, $3, $4, $5, $6 FROM song_revisions WHERE song_id = $1
+	RETURNING revision;`
+
+	queryAddEvent = "INSERT INTO song_events (type, song_id, revision, data) VALUES ($1, $2, $3, $4)"
+
+	queryGetHistory = "SELECT " + revisionColumns + ` FROM song_revisions WHERE song_id = $1
+	ORDER BY revision DESC LIMIT $2 OFFSET $3;`
+
+	queryGetRevision = "SELECT " + revisionColumns + " FROM song_revisions WHERE song_id = $1 AND revision = $2"
+
+	queryRevertSong = `UPDATE songs SET song = $1, group_name = $2, text = $3, link = $4, date_release = $5, deleted_at = $6
+	WHERE id = $7 RETURNING ` + songColumns
+)
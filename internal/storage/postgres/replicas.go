@@ -0,0 +1,213 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/SemenShakhray/list-of-song/internal/requestctx"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+)
+
+// ReplicaSet spreads reads over the read replicas that answered the last
+// health check. A client that has just written reads from the primary for a
+// while, so that it sees its own changes before they reach the replicas.
+//
+// A nil *ReplicaSet has no replicas and sends every read to the primary.
+type ReplicaSet struct {
+	log      *zap.Logger
+	window   time.Duration
+	interval time.Duration
+
+	replicas []*replica
+	next     atomic.Uint64
+
+	mu     sync.Mutex
+	writes map[string]time.Time
+	swept  time.Time
+}
+
+type replica struct {
+	name    string
+	db      *sql.DB
+	healthy atomic.Bool
+}
+
+// NewReplicaSet creates an empty replica set. Sessions read from the primary
+// for window after their last write, replicas are checked every interval.
+func NewReplicaSet(window, interval time.Duration, log *zap.Logger) *ReplicaSet {
+	return &ReplicaSet{
+		log:      log,
+		window:   window,
+		interval: interval,
+		writes:   make(map[string]time.Time),
+	}
+}
+
+// Add registers the replica db under name. It receives reads after its first
+// successful check. Add must not be called once the set is in use.
+func (rs *ReplicaSet) Add(name string, db *sql.DB) {
+	rs.replicas = append(rs.replicas, &replica{name: name, db: db})
+}
+
+// Run checks the replicas every interval until ctx is done.
+func (rs *ReplicaSet) Run(ctx context.Context) {
+	ticker := time.NewTicker(rs.interval)
+	defer ticker.Stop()
+
+	for {
+		rs.Check(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check pings every replica and updates which of them receive reads.
+func (rs *ReplicaSet) Check(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, r := range rs.replicas {
+		wg.Add(1)
+		go func(r *replica) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, rs.interval)
+			defer cancel()
+
+			err := r.db.PingContext(ctx)
+			if err != nil {
+				rs.markDown(r, err)
+				return
+			}
+			if r.healthy.CompareAndSwap(false, true) {
+				rs.log.Info("Replica is up", zap.String("replica", r.name))
+			}
+		}(r)
+	}
+	wg.Wait()
+}
+
+// Close closes the connection pools of the replicas.
+func (rs *ReplicaSet) Close() error {
+	var errs []error
+	for _, r := range rs.replicas {
+		errs = append(errs, r.db.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// pick returns the next healthy replica, or nil if there is none.
+func (rs *ReplicaSet) pick() *replica {
+	n := uint64(len(rs.replicas))
+	start := rs.next.Add(1)
+	for i := uint64(0); i < n; i++ {
+		r := rs.replicas[(start+i)%n]
+		if r.healthy.Load() {
+			return r
+		}
+	}
+	return nil
+}
+
+// markDown stops reads from r until it passes a check again.
+func (rs *ReplicaSet) markDown(r *replica, err error) {
+	if r.healthy.CompareAndSwap(true, false) {
+		rs.log.Warn("Replica is down", zap.String("replica", r.name), zap.Error(err))
+	}
+}
+
+// recordWrite notes that session has written just now.
+func (rs *ReplicaSet) recordWrite(session string) {
+	if rs == nil || rs.window <= 0 || session == "" {
+		return
+	}
+
+	now := time.Now()
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	rs.writes[session] = now
+	if now.Sub(rs.swept) < rs.window {
+		return
+	}
+	for s, at := range rs.writes {
+		if now.Sub(at) >= rs.window {
+			delete(rs.writes, s)
+		}
+	}
+	rs.swept = now
+}
+
+// readsPrimary reports whether session wrote within the window.
+func (rs *ReplicaSet) readsPrimary(session string) bool {
+	if rs.window <= 0 || session == "" {
+		return false
+	}
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	at, ok := rs.writes[session]
+	return ok && time.Since(at) < rs.window
+}
+
+// read runs fn on a replica unless the store is in a transaction, has no
+// healthy replica, ctx asks for the primary or the session has just written,
+// otherwise on the primary.
+// When the replica fails rather than the query, it is marked down and fn
+// runs again on the primary.
+func (s *Store) read(ctx context.Context, fn func(q querier) error) error {
+	if s.tx != nil || s.replicas == nil || requestctx.Primary(ctx) || s.replicas.readsPrimary(requestctx.Session(ctx)) {
+		return fn(s.conn())
+	}
+	r := s.replicas.pick()
+	if r == nil {
+		return fn(s.conn())
+	}
+
+	err := fn(tracedQuerier{q: r.db})
+	if err == nil || !isReplicaFailure(ctx, err) {
+		return err
+	}
+	s.replicas.markDown(r, err)
+	s.log(ctx).Warn("Read from replica failed, reading from primary", zap.String("replica", r.name), zap.Error(err))
+	return fn(s.conn())
+}
+
+// isReplicaFailure reports whether err means the replica is unreachable or
+// shutting down: a broken connection, a network error, a failed connect or a
+// shutdown reported by the server. Other errors belong to the query itself
+// and would fail on the primary too.
+func isReplicaFailure(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var connectErr *pgconn.ConnectError
+	if errors.As(err, &connectErr) {
+		return true
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "57P01", "57P02", "57P03": // admin_shutdown, crash_shutdown, cannot_connect_now
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,281 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SemenShakhray/list-of-song/internal/models"
+	"github.com/SemenShakhray/list-of-song/internal/requestctx"
+	"github.com/SemenShakhray/list-of-song/internal/storage"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+)
+
+// fakeServer is a database/sql connector standing in for a PostgreSQL
+// server. Every query returns one row holding the name of the server, so a
+// test can tell which server answered.
+type fakeServer struct {
+	name string
+
+	mu         sync.Mutex
+	connectErr error
+	queryErr   error
+	queries    int
+}
+
+func (s *fakeServer) Connect(context.Context) (driver.Conn, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.connectErr != nil {
+		return nil, s.connectErr
+	}
+	return &fakeConn{server: s}, nil
+}
+
+func (s *fakeServer) Driver() driver.Driver { return fakeDriver{} }
+
+// fail makes new and open connections fail with connectErr, as when the
+// server went away, and the queries with queryErr. Nil errors make the server
+// work again.
+func (s *fakeServer) fail(connectErr, queryErr error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.connectErr, s.queryErr = connectErr, queryErr
+}
+
+func (s *fakeServer) queried() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.queries
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("fake driver is used through its connector")
+}
+
+type fakeConn struct {
+	server *fakeServer
+}
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements are not supported")
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) { return fakeTx{}, nil }
+
+func (c *fakeConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	return fakeTx{}, nil
+}
+
+func (c *fakeConn) Ping(context.Context) error {
+	c.server.mu.Lock()
+	defer c.server.mu.Unlock()
+	return c.server.connectErr
+}
+
+func (c *fakeConn) QueryContext(context.Context, string, []driver.NamedValue) (driver.Rows, error) {
+	c.server.mu.Lock()
+	defer c.server.mu.Unlock()
+	if c.server.connectErr != nil {
+		return nil, c.server.connectErr
+	}
+	c.server.queries++
+	if c.server.queryErr != nil {
+		return nil, c.server.queryErr
+	}
+	return &fakeRows{values: []string{c.server.name}}, nil
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeRows struct {
+	values []string
+}
+
+func (r *fakeRows) Columns() []string { return []string{"text"} }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	dest[0], r.values = r.values[0], r.values[1:]
+	return nil
+}
+
+// newReplicatedStore creates a store on a fake primary and fake replicas that
+// all passed a health check.
+func newReplicatedStore(t *testing.T, window time.Duration, replicas ...string) (*Store, *fakeServer, []*fakeServer) {
+	t.Helper()
+	open := func(name string) (*fakeServer, *sql.DB) {
+		server := &fakeServer{name: name}
+		db := sql.OpenDB(server)
+		t.Cleanup(func() { db.Close() })
+		return server, db
+	}
+
+	primary, primaryDB := open("primary")
+	set := NewReplicaSet(window, time.Second, zap.NewNop())
+	var servers []*fakeServer
+	for _, name := range replicas {
+		server, db := open(name)
+		set.Add(name, db)
+		servers = append(servers, server)
+	}
+	set.Check(context.Background())
+
+	store := NewReplicatedStore(primaryDB, set, zap.NewNop()).(*Store)
+	return store, primary, servers
+}
+
+// readFrom returns the name of the server GetText read from.
+func readFrom(t *testing.T, ctx context.Context, s *Store) string {
+	t.Helper()
+	text, err := s.GetText(ctx, models.Filters{Limit: 1}, 1)
+	if err != nil {
+		t.Fatalf("GetText: %v", err)
+	}
+	return text
+}
+
+func TestReplicaRouting(t *testing.T) {
+	s, primary, _ := newReplicatedStore(t, 0, "replica-1", "replica-2")
+	ctx := context.Background()
+
+	counts := make(map[string]int)
+	for i := 0; i < 4; i++ {
+		counts[readFrom(t, ctx, s)]++
+	}
+	if counts["replica-1"] != 2 || counts["replica-2"] != 2 {
+		t.Errorf("reads = %v, want 2 from each replica", counts)
+	}
+	if primary.queried() != 0 {
+		t.Errorf("primary served %d reads, want 0", primary.queried())
+	}
+	if got := readFrom(t, requestctx.WithPrimary(ctx), s); got != "primary" {
+		t.Errorf("read asking for the primary from %s, want primary", got)
+	}
+
+	err := s.WithTx(ctx, func(tx storage.Storer) error {
+		if got := readFrom(t, ctx, tx.(*Store)); got != "primary" {
+			t.Errorf("read in a transaction from %s, want primary", got)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithTx: %v", err)
+	}
+}
+
+func TestReplicaFailover(t *testing.T) {
+	pgShutdown := &pgconn.PgError{Code: "57P01"}
+	netErr := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	// Nothing listens on port 1, pgconn fails to connect.
+	_, connectErr := pgconn.Connect(context.Background(), "postgres://songs@127.0.0.1:1/songs?connect_timeout=1")
+	if !errors.As(connectErr, new(*pgconn.ConnectError)) {
+		t.Fatalf("pgconn.Connect = %v, want a *pgconn.ConnectError", connectErr)
+	}
+
+	for _, tc := range []struct {
+		name       string
+		connectErr error
+		queryErr   error
+		wantFrom   string
+		wantErr    bool
+		wantDown   bool
+	}{
+		{name: "network error", connectErr: netErr, wantFrom: "primary", wantDown: true},
+		{name: "connect error", connectErr: connectErr, wantFrom: "primary", wantDown: true},
+		{name: "bad connection", queryErr: driver.ErrBadConn, wantFrom: "primary", wantDown: true},
+		{name: "server shutdown", queryErr: pgShutdown, wantFrom: "primary", wantDown: true},
+		{name: "query error", queryErr: &pgconn.PgError{Code: "42P01"}, wantErr: true},
+		{name: "other error", queryErr: errors.New("unexpected column type"), wantErr: true},
+		{name: "no rows", queryErr: fmt.Errorf("scan: %w", sql.ErrNoRows), wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s, primary, replicas := newReplicatedStore(t, 0, "replica")
+			replica := replicas[0]
+			ctx := context.Background()
+
+			replica.fail(tc.connectErr, tc.queryErr)
+			text, err := s.GetText(ctx, models.Filters{Limit: 1}, 1)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("GetText = %q, want the error of the replica", text)
+				}
+				if primary.queried() != 0 {
+					t.Errorf("query error was retried on the primary")
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("GetText: %v", err)
+				}
+				if text != tc.wantFrom {
+					t.Errorf("read from %s, want %s", text, tc.wantFrom)
+				}
+			}
+
+			if down := s.replicas.pick() == nil; down != tc.wantDown {
+				t.Errorf("replica down = %v, want %v", down, tc.wantDown)
+			}
+
+			// A replica that was marked down gets reads again once it passes
+			// a check.
+			replica.fail(nil, nil)
+			s.replicas.Check(ctx)
+			if got := readFrom(t, ctx, s); got != "replica" {
+				t.Errorf("read after recovery from %s, want replica", got)
+			}
+		})
+	}
+}
+
+func TestReadYourWrites(t *testing.T) {
+	const window = 200 * time.Millisecond
+	s, _, _ := newReplicatedStore(t, window, "replica")
+	writer := requestctx.WithSession(context.Background(), "key:1")
+	other := requestctx.WithSession(context.Background(), "key:2")
+
+	readOnly := func(storage.Storer) error { return nil }
+	if err := s.WithTx(writer, readOnly, storage.WithReadOnly()); err != nil {
+		t.Fatalf("WithTx: %v", err)
+	}
+	if got := readFrom(t, writer, s); got != "replica" {
+		t.Errorf("read after a read-only transaction from %s, want replica", got)
+	}
+
+	if err := s.WithTx(writer, func(storage.Storer) error { return nil }); err != nil {
+		t.Fatalf("WithTx: %v", err)
+	}
+	written := time.Now()
+	if got := readFrom(t, writer, s); got != "primary" && time.Since(written) < window {
+		t.Errorf("read of the writer from %s, want primary", got)
+	}
+	if got := readFrom(t, other, s); got != "replica" {
+		t.Errorf("read of another session from %s, want replica", got)
+	}
+	if got := readFrom(t, context.Background(), s); got != "replica" {
+		t.Errorf("read without a session from %s, want replica", got)
+	}
+
+	time.Sleep(window)
+	if got := readFrom(t, writer, s); got != "replica" {
+		t.Errorf("read of the writer after the window from %s, want replica", got)
+	}
+}
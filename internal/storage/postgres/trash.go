@@ -0,0 +1,97 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/SemenShakhray/list-of-song/internal/models"
+	"github.com/SemenShakhray/list-of-song/internal/storage"
+
+	"go.uber.org/zap"
+)
+
+// GetTrash returns deleted songs matching filters, the most recently deleted first.
+func (s *Store) GetTrash(ctx context.Context, filters models.Filters) ([]models.Song, error) {
+
+	s.log(ctx).Debug("Get deleted songs", zap.Any("filters_song", filters))
+
+	var songs []models.Song
+	rows, err := s.conn().QueryContext(ctx, queryGetTrash,
+		filters.Song,
+		filters.Group,
+		filters.Text,
+		filters.Link,
+		filters.Date,
+		filters.Limit,
+		filters.Offset,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query deleted songs: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var song models.Song
+		err := rows.Scan(&song.Id, &song.Song, &song.Group, &song.Text, &song.Link, &song.Date, &song.DeletedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan song: %w", err)
+		}
+		songs = append(songs, song)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating through deleted songs: %w", err)
+	}
+	s.log(ctx).Debug("List of deleted songs has been successfully received", zap.Int("total", len(songs)))
+	return songs, nil
+}
+
+func (s *Store) Restore(ctx context.Context, id int) error {
+	s.log(ctx).Debug("Attempting to restore song",
+		zap.Int("song", id),
+	)
+
+	return s.inTx(ctx, func(tx *Store) error {
+		before, err := tx.lockSong(ctx, id, true)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("song not found in trash")
+		}
+		if err != nil {
+			return err
+		}
+
+		after, err := scanSong(tx.conn().QueryRowContext(ctx, queryRestoreSong, id))
+		if isUniqueViolation(err) {
+			return storage.ErrSongExists
+		}
+		if err != nil {
+			return fmt.Errorf("failed to restore song: %w", err)
+		}
+
+		err = tx.addRevision(ctx, models.RevisionRestore, &before, &after)
+		if err != nil {
+			return err
+		}
+		s.log(ctx).Debug("Song successfully restored")
+		return nil
+	})
+}
+
+func (s *Store) Purge(ctx context.Context, before time.Time) (int64, error) {
+	s.log(ctx).Debug("Purging deleted songs", zap.Time("before", before))
+
+	row, err := s.conn().ExecContext(ctx, queryPurge, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge songs: %w", err)
+	}
+
+	n, err := row.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to retrieve rows affected: %w", err)
+	}
+	s.log(ctx).Debug("Deleted songs purged", zap.Int64("total", n))
+	return n, nil
+}
@@ -0,0 +1,273 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/SemenShakhray/list-of-song/internal/models"
+	"github.com/SemenShakhray/list-of-song/internal/storage"
+	"github.com/SemenShakhray/list-of-song/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+type WebhookStore struct {
+	DB  *sql.DB
+	Log *zap.Logger
+}
+
+func NewWebhookStore(db *sql.DB, log *zap.Logger) storage.WebhookStorer {
+	return &WebhookStore{
+		DB:  db,
+		Log: log,
+	}
+}
+
+func (s *WebhookStore) log(ctx context.Context) *zap.Logger {
+	return logger.FromContext(ctx, s.Log)
+}
+
+func (s *WebhookStore) conn() querier {
+	return tracedQuerier{q: s.DB}
+}
+
+const (
+	webhookColumns  = "id, url, events, active, secret, created_at"
+	deliveryColumns = "id, webhook_id, event_id, event_type, status, attempts, next_attempt_at, last_status_code, last_error, created_at, delivered_at"
+
+	// queryDispatchEvents moves a batch of events from the outbox to the
+	// deliveries in one statement. Instances dispatching at the same time
+	// take different events.
+	queryDispatchEvents = `WITH batch AS (
+		SELECT id, type, data, created_at FROM song_events WHERE dispatched_at IS NULL
+		ORDER BY id LIMIT $1 FOR UPDATE SKIP LOCKED
+	), deliveries AS (
+		INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, event_data, event_created_at)
+		SELECT w.id, b.id, b.type, b.data, b.created_at FROM batch b
+		JOIN webhooks w ON w.active AND w.events @> jsonb_build_array(b.type)
+		ON CONFLICT (webhook_id, event_id) DO NOTHING
+	)
+	UPDATE song_events SET dispatched_at = now() WHERE id IN (SELECT id FROM batch);`
+
+	// queryClaimDeliveries takes the first deliveries of every webhook. An
+	// instance claiming the same delivery at the same time waits for the row
+	// and then skips it, as it is no longer due.
+	queryClaimDeliveries = `UPDATE webhook_deliveries d SET next_attempt_at = now() + make_interval(secs => $2)
+	FROM webhooks w
+	WHERE w.id = d.webhook_id AND d.status = 'pending' AND d.next_attempt_at <= now() AND d.id IN (
+		SELECT id FROM (
+			SELECT due.id, due.next_attempt_at,
+				row_number() OVER (PARTITION BY due.webhook_id ORDER BY due.next_attempt_at, due.id) AS n
+			FROM webhook_deliveries due JOIN webhooks hook ON hook.id = due.webhook_id
+			WHERE due.status = 'pending' AND due.next_attempt_at <= now() AND hook.active
+				AND NOT due.webhook_id = ANY($4::int[])
+		) ranked
+		WHERE n <= $3
+		ORDER BY next_attempt_at, id LIMIT $1
+	)
+	RETURNING d.id, d.webhook_id, d.event_id, d.event_type, d.status, d.attempts, d.next_attempt_at,
+		d.last_status_code, d.last_error, d.created_at, d.delivered_at, d.event_data, d.event_created_at, w.url, w.secret;`
+)
+
+func scanWebhook(row rowScanner) (models.Webhook, error) {
+	var (
+		hook   models.Webhook
+		events []byte
+	)
+	err := row.Scan(&hook.Id, &hook.URL, &events, &hook.Active, &hook.Secret, &hook.CreatedAt)
+	if err != nil {
+		return models.Webhook{}, err
+	}
+	if err := json.Unmarshal(events, &hook.Events); err != nil {
+		return models.Webhook{}, fmt.Errorf("failed to decode webhook events: %w", err)
+	}
+	return hook, nil
+}
+
+func scanDelivery(row rowScanner, extra ...any) (models.WebhookDelivery, error) {
+	var d models.WebhookDelivery
+	dest := []any{&d.Id, &d.WebhookId, &d.EventId, &d.EventType, &d.Status, &d.Attempts, &d.NextAttemptAt,
+		&d.LastStatusCode, &d.LastError, &d.CreatedAt, &d.DeliveredAt}
+	err := row.Scan(append(dest, extra...)...)
+	return d, err
+}
+
+func (s *WebhookStore) CreateWebhook(ctx context.Context, hook models.Webhook) (models.Webhook, error) {
+	s.log(ctx).Debug("Creating webhook", zap.String("url", hook.URL), zap.Strings("events", hook.Events))
+
+	events, err := json.Marshal(hook.Events)
+	if err != nil {
+		return models.Webhook{}, fmt.Errorf("failed to encode webhook events: %w", err)
+	}
+	query := "INSERT INTO webhooks (url, secret, events, active) VALUES ($1, $2, $3, $4) RETURNING " + webhookColumns
+	created, err := scanWebhook(s.conn().QueryRowContext(ctx, query, hook.URL, hook.Secret, events, hook.Active))
+	if err != nil {
+		return models.Webhook{}, fmt.Errorf("failed to create webhook: %w", err)
+	}
+	return created, nil
+}
+
+func (s *WebhookStore) ListWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	query := "SELECT " + webhookColumns + " FROM webhooks ORDER BY id"
+	rows, err := s.conn().QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	var hooks []models.Webhook
+	for rows.Next() {
+		hook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook: %w", err)
+		}
+		hooks = append(hooks, hook)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating through webhooks: %w", err)
+	}
+	return hooks, nil
+}
+
+func (s *WebhookStore) GetWebhook(ctx context.Context, id int) (models.Webhook, error) {
+	query := "SELECT " + webhookColumns + " FROM webhooks WHERE id = $1"
+	hook, err := scanWebhook(s.conn().QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Webhook{}, storage.ErrWebhookNotFound
+		}
+		return models.Webhook{}, fmt.Errorf("failed to get webhook: %w", err)
+	}
+	return hook, nil
+}
+
+func (s *WebhookStore) UpdateWebhook(ctx context.Context, hook models.Webhook) (models.Webhook, error) {
+	s.log(ctx).Debug("Updating webhook", zap.Int("webhook", hook.Id), zap.String("url", hook.URL), zap.Strings("events", hook.Events))
+
+	events, err := json.Marshal(hook.Events)
+	if err != nil {
+		return models.Webhook{}, fmt.Errorf("failed to encode webhook events: %w", err)
+	}
+	query := "UPDATE webhooks SET url = $2, events = $3, active = $4 WHERE id = $1 RETURNING " + webhookColumns
+	updated, err := scanWebhook(s.conn().QueryRowContext(ctx, query, hook.Id, hook.URL, events, hook.Active))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Webhook{}, storage.ErrWebhookNotFound
+		}
+		return models.Webhook{}, fmt.Errorf("failed to update webhook: %w", err)
+	}
+	return updated, nil
+}
+
+func (s *WebhookStore) DeleteWebhook(ctx context.Context, id int) error {
+	s.log(ctx).Debug("Deleting webhook", zap.Int("webhook", id))
+
+	row, err := s.conn().ExecContext(ctx, "DELETE FROM webhooks WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+	n, err := row.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to retrieve rows affected: %w", err)
+	}
+	if n == 0 {
+		return storage.ErrWebhookNotFound
+	}
+	return nil
+}
+
+func (s *WebhookStore) ListDeliveries(ctx context.Context, webhookID int, limit, offset int) ([]models.WebhookDelivery, error) {
+	query := "SELECT " + deliveryColumns + " FROM webhook_deliveries WHERE webhook_id = $1 ORDER BY id DESC LIMIT $2 OFFSET $3"
+	rows, err := s.conn().QueryContext(ctx, query, webhookID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating through webhook deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+func (s *WebhookStore) DispatchEvents(ctx context.Context, limit int) (int, error) {
+	row, err := s.conn().ExecContext(ctx, queryDispatchEvents, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to dispatch song events: %w", err)
+	}
+	n, err := row.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to retrieve rows affected: %w", err)
+	}
+	return int(n), nil
+}
+
+func (s *WebhookStore) ClaimDeliveries(ctx context.Context, limit, perWebhook int, skip []int, lease time.Duration) ([]models.DueDelivery, error) {
+	if skip == nil {
+		// A NULL array would match no webhook at all.
+		skip = []int{}
+	}
+	rows, err := s.conn().QueryContext(ctx, queryClaimDeliveries, limit, lease.Seconds(), perWebhook, skip)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var due []models.DueDelivery
+	for rows.Next() {
+		var (
+			d    models.DueDelivery
+			data []byte
+			err  error
+		)
+		d.WebhookDelivery, err = scanDelivery(rows, &data, &d.Event.CreatedAt, &d.URL, &d.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		d.Event.Id, d.Event.Type, d.Event.Data = d.EventId, d.EventType, data
+		d.Event.CreatedAt = d.Event.CreatedAt.UTC()
+		due = append(due, d)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating through webhook deliveries: %w", err)
+	}
+	return due, nil
+}
+
+func (s *WebhookStore) RecordAttempt(ctx context.Context, d models.WebhookDelivery) error {
+	query := `UPDATE webhook_deliveries SET status = $2, attempts = $3, next_attempt_at = $4,
+	last_status_code = $5, last_error = $6, delivered_at = $7 WHERE id = $1`
+	_, err := s.conn().ExecContext(ctx, query, d.Id, d.Status, d.Attempts, d.NextAttemptAt,
+		d.LastStatusCode, d.LastError, d.DeliveredAt)
+	if err != nil {
+		return fmt.Errorf("failed to record webhook delivery: %w", err)
+	}
+	return nil
+}
+
+func (s *WebhookStore) PruneDeliveries(ctx context.Context, before time.Time) (int64, error) {
+	s.log(ctx).Debug("Pruning webhook deliveries", zap.Time("before", before))
+
+	query := "DELETE FROM webhook_deliveries WHERE status <> 'pending' AND created_at < $1"
+	row, err := s.conn().ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune webhook deliveries: %w", err)
+	}
+	n, err := row.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to retrieve rows affected: %w", err)
+	}
+	return n, nil
+}
@@ -0,0 +1,103 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/SemenShakhray/list-of-song/internal/models"
+	"github.com/SemenShakhray/list-of-song/internal/storage"
+
+	"go.uber.org/zap"
+)
+
+// eventPollInterval is how often WatchEvents reads the new events. SQLite has
+// no notifications, but every process writing the file adds its events to the
+// same table.
+const eventPollInterval = 500 * time.Millisecond
+
+const eventColumns = "id, type, data, created_at"
+
+type EventStore struct {
+	DB  *sql.DB
+	Log *zap.Logger
+	// PollInterval is how often WatchEvents reads the new events.
+	PollInterval time.Duration
+}
+
+func NewEventStore(db *sql.DB, log *zap.Logger) storage.EventStorer {
+	return &EventStore{
+		DB:           db,
+		Log:          log,
+		PollInterval: eventPollInterval,
+	}
+}
+
+func scanEvent(row rowScanner) (models.Event, error) {
+	var (
+		event models.Event
+		data  string
+	)
+	err := row.Scan(&event.Id, &event.Type, &data, &event.CreatedAt)
+	event.Data = json.RawMessage(data)
+	event.CreatedAt = event.CreatedAt.UTC()
+	return event, err
+}
+
+func (s *EventStore) queryEvents(ctx context.Context, query string, args ...any) ([]models.Event, error) {
+	rows, err := s.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query song events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []models.Event
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan song event: %w", err)
+		}
+		events = append(events, event)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating through song events: %w", err)
+	}
+	return events, nil
+}
+
+func (s *EventStore) RecentEvents(ctx context.Context, limit int) ([]models.Event, error) {
+	query := "SELECT " + eventColumns + " FROM (SELECT " + eventColumns +
+		" FROM song_events ORDER BY id DESC LIMIT ?) ORDER BY id"
+	return s.queryEvents(ctx, query, limit)
+}
+
+// WatchEvents reads the events after the newest one it has seen every poll
+// interval. Writes are serialized, so the events are committed in the order
+// of their IDs and none is skipped.
+func (s *EventStore) WatchEvents(ctx context.Context, after int64, fn func(models.Event)) error {
+	ticker := time.NewTicker(s.PollInterval)
+	defer ticker.Stop()
+
+	query := "SELECT " + eventColumns + " FROM song_events WHERE id > ? ORDER BY id"
+	for {
+		events, err := s.queryEvents(ctx, query, after)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		for _, event := range events {
+			fn(event)
+			after = event.Id
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/SemenShakhray/list-of-song/internal/models"
+
+	"go.uber.org/zap"
+)
+
+// Export streams every song matching filters to fn in id order. Rows are read
+// from the open cursor one at a time, so memory use does not depend on the
+// size of the result. A zero filters.Limit means no limit.
+func (s *Store) Export(ctx context.Context, filters models.Filters, fn func(models.Song) error) error {
+	s.log(ctx).Debug("Export songs", zap.Any("filters_song", filters))
+
+	limit := filters.Limit
+	if limit == 0 {
+		limit = -1
+	}
+	query, args := songsQuery("id, song, group_name, text, link, date_release", "deleted_at IS NULL", "id", filters, limit)
+
+	rows, err := s.conn().QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query songs: %w", err)
+	}
+	defer rows.Close()
+
+	total := 0
+	for rows.Next() {
+		var song models.Song
+		err := rows.Scan(&song.Id, &song.Song, &song.Group, &song.Text, &song.Link, &song.Date)
+		if err != nil {
+			return fmt.Errorf("failed to scan song: %w", err)
+		}
+		if err := fn(song); err != nil {
+			return err
+		}
+		total++
+	}
+
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("error iterating through songs: %w", err)
+	}
+	s.log(ctx).Debug("Songs have been successfully exported", zap.Int("total", total))
+	return nil
+}
@@ -0,0 +1,212 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/SemenShakhray/list-of-song/internal/models"
+	"github.com/SemenShakhray/list-of-song/internal/requestctx"
+	"github.com/SemenShakhray/list-of-song/internal/storage"
+
+	"go.uber.org/zap"
+)
+
+// getSong reads a song inside the transaction, which already holds the write
+// lock of the database. deleted selects whether the song must be in the trash
+// or not.
+func (s *Store) getSong(ctx context.Context, id int, deleted bool) (models.Song, error) {
+	query := "SELECT " + songColumns + " FROM songs WHERE id = ? AND (deleted_at IS NOT NULL) = ?"
+	song, err := scanSong(s.conn().QueryRowContext(ctx, query, id, deleted))
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return models.Song{}, fmt.Errorf("failed to read song: %w", err)
+	}
+	return song, err
+}
+
+// addRevision appends the next revision of a song to its history and the
+// event of the change to the outbox. It must run in the transaction that made
+// the change, so the event is sent exactly when the change is committed.
+func (s *Store) addRevision(ctx context.Context, action string, before, after *models.Song) error {
+	songID := 0
+	if after != nil {
+		songID = after.Id
+	} else if before != nil {
+		songID = before.Id
+	}
+
+	beforeJSON, err := snapshot(before)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := snapshot(after)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO song_revisions (song_id, revision, action, before, after, actor, request_id)
+	SELECT ?1, COALESCE(MAX(revision), 0) + 1, ?2, ?3, ?4, ?5, ?6 FROM song_revisions WHERE song_id = ?1
+	RETURNING revision`
+
+	var revision int
+	err = s.conn().QueryRowContext(ctx, query, songID, action, beforeJSON, afterJSON,
+		requestctx.Actor(ctx), requestctx.RequestID(ctx)).Scan(&revision)
+	if err != nil {
+		return fmt.Errorf("failed to record song revision: %w", err)
+	}
+
+	data, err := json.Marshal(models.SongChange{
+		SongId:   songID,
+		Revision: revision,
+		Action:   action,
+		Song:     after,
+		Previous: before,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode song event: %w", err)
+	}
+	query = "INSERT INTO song_events (type, song_id, revision, data) VALUES (?, ?, ?, ?)"
+	_, err = s.conn().ExecContext(ctx, query, models.RevisionEvent(action), songID, revision, string(data))
+	if err != nil {
+		return fmt.Errorf("failed to record song event: %w", err)
+	}
+	s.log(ctx).Debug("Song revision recorded", zap.Int("song", songID), zap.Int("revision", revision), zap.String("action", action))
+	return nil
+}
+
+// snapshot returns song as JSON text, or nil to store NULL for no song.
+func snapshot(song *models.Song) (any, error) {
+	if song == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(song)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode song snapshot: %w", err)
+	}
+	return string(b), nil
+}
+
+const revisionColumns = "song_id, revision, action, before, after, actor, request_id, created_at"
+
+func scanRevision(row rowScanner) (models.Revision, error) {
+	var (
+		rev           models.Revision
+		before, after sql.NullString
+	)
+	err := row.Scan(&rev.SongId, &rev.Revision, &rev.Action, &before, &after, &rev.Actor, &rev.RequestId, &rev.CreatedAt)
+	if err != nil {
+		return models.Revision{}, err
+	}
+	if before.Valid {
+		rev.Before = &models.Song{}
+		if err := json.Unmarshal([]byte(before.String), rev.Before); err != nil {
+			return models.Revision{}, fmt.Errorf("failed to decode song snapshot: %w", err)
+		}
+	}
+	if after.Valid {
+		rev.After = &models.Song{}
+		if err := json.Unmarshal([]byte(after.String), rev.After); err != nil {
+			return models.Revision{}, fmt.Errorf("failed to decode song snapshot: %w", err)
+		}
+	}
+	return rev, nil
+}
+
+// GetHistory returns the revisions of a song, the newest first.
+func (s *Store) GetHistory(ctx context.Context, id int, limit, offset int) ([]models.Revision, error) {
+	s.log(ctx).Debug("Get song history", zap.Int("song", id))
+
+	query := "SELECT " + revisionColumns + ` FROM song_revisions WHERE song_id = ?
+	ORDER BY revision DESC LIMIT ? OFFSET ?`
+
+	rows, err := s.conn().QueryContext(ctx, query, id, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query song history: %w", err)
+	}
+	defer rows.Close()
+
+	var revisions []models.Revision
+	for rows.Next() {
+		rev, err := scanRevision(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan revision: %w", err)
+		}
+		revisions = append(revisions, rev)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating through song history: %w", err)
+	}
+	s.log(ctx).Debug("Song history has been successfully received", zap.Int("total", len(revisions)))
+	return revisions, nil
+}
+
+func (s *Store) GetRevision(ctx context.Context, id int, revision int) (models.Revision, error) {
+	s.log(ctx).Debug("Get song revision", zap.Int("song", id), zap.Int("revision", revision))
+
+	query := "SELECT " + revisionColumns + " FROM song_revisions WHERE song_id = ? AND revision = ?"
+	rev, err := scanRevision(s.conn().QueryRowContext(ctx, query, id, revision))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Revision{}, fmt.Errorf("revision not found")
+		}
+		return models.Revision{}, fmt.Errorf("failed to get song revision: %w", err)
+	}
+	return rev, nil
+}
+
+// Revert sets a song back to its state after the given revision, including
+// whether it was in the trash, and records that as a new revision.
+func (s *Store) Revert(ctx context.Context, id int, revision int) error {
+	s.log(ctx).Debug("Attempting to revert song", zap.Int("song", id), zap.Int("revision", revision))
+
+	query := `UPDATE songs SET song = ?, group_name = ?, text = ?, link = ?, date_release = ?, deleted_at = ?
+	WHERE id = ? RETURNING ` + songColumns
+
+	return s.inTx(ctx, func(tx *Store) error {
+		rev, err := tx.GetRevision(ctx, id, revision)
+		if err != nil {
+			return err
+		}
+		if rev.After == nil {
+			return fmt.Errorf("revision %d has no song state to revert to", revision)
+		}
+
+		before, err := scanSong(tx.conn().QueryRowContext(ctx, "SELECT "+songColumns+" FROM songs WHERE id = ?", id))
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("song not found")
+			}
+			return fmt.Errorf("failed to read song: %w", err)
+		}
+
+		target := rev.After
+		row := tx.conn().QueryRowContext(ctx, query, target.Song, target.Group, target.Text, target.Link, target.Date, utc(target.DeletedAt), id)
+		after, err := scanSong(row)
+		if isUniqueViolation(err) {
+			return storage.ErrSongExists
+		}
+		if err != nil {
+			return fmt.Errorf("failed to revert song: %w", err)
+		}
+
+		err = tx.addRevision(ctx, models.RevisionRevert, &before, &after)
+		if err != nil {
+			return err
+		}
+		s.log(ctx).Debug("Song successfully reverted", zap.Int("song", id), zap.Int("revision", revision))
+		return nil
+	})
+}
+
+// utc returns t in UTC, or nil for no time. Times are compared as text, so
+// every stored time must have the same offset.
+func utc(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.UTC()
+}
@@ -0,0 +1,101 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/SemenShakhray/list-of-song/internal/models"
+	"github.com/SemenShakhray/list-of-song/internal/storage"
+	"github.com/SemenShakhray/list-of-song/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+type KeyStore struct {
+	DB  *sql.DB
+	Log *zap.Logger
+}
+
+func NewKeyStore(db *sql.DB, log *zap.Logger) storage.KeyStorer {
+	return &KeyStore{
+		DB:  db,
+		Log: log,
+	}
+}
+
+func (s *KeyStore) log(ctx context.Context) *zap.Logger {
+	return logger.FromContext(ctx, s.Log)
+}
+
+const keyColumns = "id, name, prefix, role, key_hash, created_at, revoked_at"
+
+func scanKey(row rowScanner) (models.APIKey, error) {
+	var key models.APIKey
+	err := row.Scan(&key.Id, &key.Name, &key.Prefix, &key.Role, &key.Hash, &key.CreatedAt, &key.RevokedAt)
+	return key, err
+}
+
+func (s *KeyStore) CreateAPIKey(ctx context.Context, key models.APIKey) (models.APIKey, error) {
+	s.log(ctx).Debug("Creating API key", zap.String("name", key.Name), zap.String("prefix", key.Prefix), zap.String("role", key.Role))
+
+	query := "INSERT INTO api_keys (name, prefix, role, key_hash) VALUES (?, ?, ?, ?) RETURNING " + keyColumns
+	created, err := scanKey(s.DB.QueryRowContext(ctx, query, key.Name, key.Prefix, key.Role, key.Hash))
+	if err != nil {
+		return models.APIKey{}, fmt.Errorf("failed to create API key: %w", err)
+	}
+	return created, nil
+}
+
+func (s *KeyStore) ListAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	query := "SELECT " + keyColumns + " FROM api_keys ORDER BY id"
+	rows, err := s.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query API keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []models.APIKey
+	for rows.Next() {
+		key, err := scanKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan API key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating through API keys: %w", err)
+	}
+	return keys, nil
+}
+
+func (s *KeyStore) RevokeAPIKey(ctx context.Context, id int) error {
+	s.log(ctx).Debug("Revoking API key", zap.Int("key", id))
+
+	query := "UPDATE api_keys SET revoked_at = " + nowUTC + " WHERE id = ? AND revoked_at IS NULL"
+	row, err := s.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to revoke API key: %w", err)
+	}
+	n, err := row.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to retrieve rows affected: %w", err)
+	}
+	if n == 0 {
+		return storage.ErrKeyNotFound
+	}
+	return nil
+}
+
+func (s *KeyStore) GetAPIKeyByHash(ctx context.Context, hash string) (models.APIKey, error) {
+	query := "SELECT " + keyColumns + " FROM api_keys WHERE key_hash = ?"
+	key, err := scanKey(s.DB.QueryRowContext(ctx, query, hash))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.APIKey{}, storage.ErrKeyNotFound
+		}
+		return models.APIKey{}, fmt.Errorf("failed to get API key: %w", err)
+	}
+	return key, nil
+}
@@ -0,0 +1,240 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/SemenShakhray/list-of-song/internal/models"
+	"github.com/SemenShakhray/list-of-song/internal/storage"
+
+	"go.uber.org/zap"
+)
+
+// nowUTC is the current time in the format the driver writes time values in.
+const nowUTC = "strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')"
+
+// songColumns are the columns read by scanSong.
+const songColumns = "id, song, group_name, text, link, date_release, deleted_at"
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSong(row rowScanner) (models.Song, error) {
+	var song models.Song
+	err := row.Scan(&song.Id, &song.Song, &song.Group, &song.Text, &song.Link, &song.Date, &song.DeletedAt)
+	return song, err
+}
+
+// filterWhere returns the conditions matching filters and their arguments.
+// Song, group, text and link are case-insensitive partial matches in which %
+// and _ are wildcards, like ILIKE in the postgres store; date is exact when
+// set. The text filter is narrowed down with the trigram index when it can
+// be, before the rows are matched.
+func filterWhere(filters models.Filters) ([]string, []any) {
+	var (
+		where []string
+		args  []any
+	)
+	contains := func(column, value string) {
+		if value == "" {
+			return
+		}
+		where = append(where, "unicode_lower("+column+`) LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+strings.ToLower(value)+"%")
+	}
+
+	contains("song", filters.Song)
+	contains("group_name", filters.Group)
+	if phrase, ok := ftsPhrase(filters.Text); ok {
+		where = append(where, "id IN (SELECT rowid FROM songs_fts WHERE songs_fts MATCH ?)")
+		args = append(args, phrase)
+	}
+	contains("text", filters.Text)
+	contains("link", filters.Link)
+	if filters.Date != "" {
+		where = append(where, "date_release = ?")
+		args = append(args, filters.Date)
+	}
+	return where, args
+}
+
+// ftsPhrase returns the full text query finding s anywhere in the lyrics. The
+// trigram index cannot look up strings shorter than three characters or
+// patterns with wildcards, those are only matched row by row.
+func ftsPhrase(s string) (string, bool) {
+	if utf8.RuneCountInString(s) < 3 || strings.ContainsAny(s, `%_\`) {
+		return "", false
+	}
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`, true
+}
+
+// songsQuery returns the query selecting columns of the songs matching
+// filters that satisfy cond, ordered by order. A negative limit means no limit.
+func songsQuery(columns, cond, order string, filters models.Filters, limit int) (string, []any) {
+	where, args := filterWhere(filters)
+	query := "SELECT " + columns + " FROM songs WHERE " + strings.Join(append([]string{cond}, where...), " AND ") +
+		" ORDER BY " + order + " LIMIT ? OFFSET ?"
+	return query, append(args, limit, filters.Offset)
+}
+
+func (s *Store) AddSong(ctx context.Context, song models.Song) error {
+	s.log(ctx).Debug("Attempting to add song",
+		zap.String("song", song.Song),
+		zap.String("group", song.Group),
+	)
+
+	query := `INSERT INTO songs (song, group_name, text, link, date_release) VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT (song, group_name) WHERE deleted_at IS NULL DO NOTHING
+	RETURNING ` + songColumns
+
+	return s.inTx(ctx, func(tx *Store) error {
+		row := tx.conn().QueryRowContext(ctx, query, song.Song, song.Group, song.Text, song.Link, song.Date)
+		added, err := scanSong(row)
+		if errors.Is(err, sql.ErrNoRows) {
+			s.log(ctx).Warn("Song already exists in the storage",
+				zap.String("song", song.Song),
+				zap.String("group", song.Group),
+			)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to add song in storage: %w", err)
+		}
+
+		err = tx.addRevision(ctx, models.RevisionCreate, nil, &added)
+		if err != nil {
+			return err
+		}
+		s.log(ctx).Debug("Song successfully added")
+		return nil
+	})
+}
+
+func (s *Store) Update(ctx context.Context, song models.Song) error {
+	s.log(ctx).Debug("Updating info about song",
+		zap.Int("song", song.Id),
+	)
+
+	query := `UPDATE songs SET
+	song = COALESCE(NULLIF(?1, ''), song),
+	group_name = COALESCE(NULLIF(?2, ''), group_name),
+	text = COALESCE(NULLIF(?3, ''), text),
+	link = COALESCE(NULLIF(?4, ''), link),
+	date_release = COALESCE(NULLIF(?5, ''), date_release)
+	WHERE id = ?6
+	RETURNING ` + songColumns
+
+	return s.inTx(ctx, func(tx *Store) error {
+		before, err := tx.getSong(ctx, song.Id, false)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("song not found")
+		}
+		if err != nil {
+			return err
+		}
+
+		row := tx.conn().QueryRowContext(ctx, query, song.Song, song.Group, song.Text, song.Link, song.Date, song.Id)
+		after, err := scanSong(row)
+		if isUniqueViolation(err) {
+			return storage.ErrSongExists
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update info about song: %w", err)
+		}
+
+		err = tx.addRevision(ctx, models.RevisionUpdate, &before, &after)
+		if err != nil {
+			return err
+		}
+		s.log(ctx).Debug("Song info successfully updated")
+		return nil
+	})
+}
+
+func (s *Store) GetAll(ctx context.Context, filters models.Filters) ([]models.Song, error) {
+	s.log(ctx).Debug("Get songs", zap.Any("filters_song", filters))
+
+	query, args := songsQuery("id, song, group_name, text, link, date_release", "deleted_at IS NULL", "id", filters, filters.Limit)
+
+	var songs []models.Song
+	rows, err := s.conn().QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query songs: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var song models.Song
+		err := rows.Scan(&song.Id, &song.Song, &song.Group, &song.Text, &song.Link, &song.Date)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan song: %w", err)
+		}
+		songs = append(songs, song)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating through songs: %w", err)
+	}
+	s.log(ctx).Debug("List of songs has been successfully received", zap.Int("total", len(songs)))
+	return songs, nil
+}
+
+func (s *Store) Delete(ctx context.Context, id int) error {
+	s.log(ctx).Debug("Attempting to delete song",
+		zap.Int("song", id),
+	)
+
+	query := "UPDATE songs SET deleted_at = " + nowUTC + " WHERE id = ? RETURNING " + songColumns
+
+	return s.inTx(ctx, func(tx *Store) error {
+		before, err := tx.getSong(ctx, id, false)
+		if errors.Is(err, sql.ErrNoRows) {
+			s.log(ctx).Debug("No songs deleted",
+				zap.Int("song", id),
+			)
+			return fmt.Errorf("failed delete the song")
+		}
+		if err != nil {
+			return err
+		}
+
+		after, err := scanSong(tx.conn().QueryRowContext(ctx, query, id))
+		if err != nil {
+			return fmt.Errorf("failed to delete song: %w", err)
+		}
+
+		return tx.addRevision(ctx, models.RevisionDelete, &before, &after)
+	})
+}
+
+func (s *Store) GetText(ctx context.Context, filters models.Filters, id int) (string, error) {
+	s.log(ctx).Debug("Attemting get text of song")
+
+	query := "SELECT text FROM songs WHERE id = ? AND deleted_at IS NULL"
+
+	var text string
+	err := s.conn().QueryRowContext(ctx, query, id).Scan(&text)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.log(ctx).Warn("Song not found", zap.String("song", filters.Song))
+			return "", fmt.Errorf("failed to get text of the song: %w", err)
+		}
+		return "", fmt.Errorf("failed to retrieve text of the song: %w", err)
+	}
+
+	verses := strings.Split(text, "\n")
+	if filters.Offset >= len(verses) {
+		s.log(ctx).Debug("Offset exceeds number of verses", zap.Int("offset", filters.Offset), zap.Int("len(verses)", len(verses)))
+		return "", nil
+	}
+	end := min(filters.Offset+filters.Limit, len(verses))
+	text = strings.Join(verses[filters.Offset:end], "\n")
+
+	s.log(ctx).Debug("Text of the song successfully received", zap.String("song", filters.Song))
+	return text, nil
+}
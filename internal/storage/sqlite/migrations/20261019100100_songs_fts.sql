@@ -0,0 +1,40 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE VIRTUAL TABLE IF NOT EXISTS songs_fts USING fts5(
+    text,
+    content = 'songs',
+    content_rowid = 'id',
+    tokenize = 'trigram'
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER IF NOT EXISTS songs_fts_insert AFTER INSERT ON songs BEGIN
+    INSERT INTO songs_fts (rowid, text) VALUES (new.id, new.text);
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER IF NOT EXISTS songs_fts_delete AFTER DELETE ON songs BEGIN
+    INSERT INTO songs_fts (songs_fts, rowid, text) VALUES ('delete', old.id, old.text);
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER IF NOT EXISTS songs_fts_update AFTER UPDATE OF text ON songs BEGIN
+    INSERT INTO songs_fts (songs_fts, rowid, text) VALUES ('delete', old.id, old.text);
+    INSERT INTO songs_fts (rowid, text) VALUES (new.id, new.text);
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+INSERT INTO songs_fts (songs_fts) VALUES ('rebuild');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS songs_fts_insert;
+DROP TRIGGER IF EXISTS songs_fts_delete;
+DROP TRIGGER IF EXISTS songs_fts_update;
+DROP TABLE IF EXISTS songs_fts;
+-- +goose StatementEnd
@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS song_revisions (
+    song_id INTEGER NOT NULL,
+    revision INTEGER NOT NULL,
+    action TEXT NOT NULL,
+    before TEXT,
+    after TEXT,
+    actor TEXT NOT NULL DEFAULT '',
+    request_id TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    PRIMARY KEY (song_id, revision)
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER IF NOT EXISTS song_revisions_immutable_update BEFORE UPDATE ON song_revisions BEGIN
+    SELECT RAISE(ABORT, 'song revisions are immutable');
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER IF NOT EXISTS song_revisions_immutable_delete BEFORE DELETE ON song_revisions BEGIN
+    SELECT RAISE(ABORT, 'song revisions are immutable');
+END;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS song_revisions_immutable_update;
+DROP TRIGGER IF EXISTS song_revisions_immutable_delete;
+DROP TABLE IF EXISTS song_revisions;
+-- +goose StatementEnd
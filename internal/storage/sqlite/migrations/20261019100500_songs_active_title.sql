@@ -0,0 +1,66 @@
+-- +goose Up
+-- SQLite cannot drop the UNIQUE constraint of a table, so the table is
+-- rebuilt without it. Dropping the old table drops its triggers and indexes.
+-- +goose StatementBegin
+CREATE TABLE songs_rebuilt (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    song TEXT NOT NULL,
+    group_name TEXT NOT NULL,
+    text TEXT NOT NULL DEFAULT '',
+    link TEXT NOT NULL DEFAULT '',
+    date_release TEXT NOT NULL DEFAULT '',
+    deleted_at DATETIME
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+INSERT INTO songs_rebuilt (id, song, group_name, text, link, date_release, deleted_at)
+SELECT id, song, group_name, text, link, date_release, deleted_at FROM songs;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+-- The IDs of purged songs stay unused.
+DELETE FROM sqlite_sequence WHERE name = 'songs_rebuilt';
+INSERT INTO sqlite_sequence (name, seq) SELECT 'songs_rebuilt', seq FROM sqlite_sequence WHERE name = 'songs';
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE songs;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE songs_rebuilt RENAME TO songs;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS songs_deleted_at_idx ON songs (deleted_at) WHERE deleted_at IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE UNIQUE INDEX IF NOT EXISTS songs_active_title_idx ON songs (song, group_name) WHERE deleted_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER IF NOT EXISTS songs_fts_insert AFTER INSERT ON songs BEGIN
+    INSERT INTO songs_fts (rowid, text) VALUES (new.id, new.text);
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER IF NOT EXISTS songs_fts_delete AFTER DELETE ON songs BEGIN
+    INSERT INTO songs_fts (songs_fts, rowid, text) VALUES ('delete', old.id, old.text);
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER IF NOT EXISTS songs_fts_update AFTER UPDATE OF text ON songs BEGIN
+    INSERT INTO songs_fts (songs_fts, rowid, text) VALUES ('delete', old.id, old.text);
+    INSERT INTO songs_fts (rowid, text) VALUES (new.id, new.text);
+END;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS songs_active_title_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS songs_title_idx ON songs (song, group_name);
+-- +goose StatementEnd
@@ -0,0 +1,55 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/SemenShakhray/list-of-song/internal/storage"
+	"github.com/SemenShakhray/list-of-song/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+type OutboxStore struct {
+	DB  *sql.DB
+	Log *zap.Logger
+}
+
+func NewOutboxStore(db *sql.DB, log *zap.Logger) storage.OutboxStorer {
+	return &OutboxStore{
+		DB:  db,
+		Log: log,
+	}
+}
+
+func (s *OutboxStore) log(ctx context.Context) *zap.Logger {
+	return logger.FromContext(ctx, s.Log)
+}
+
+func (s *OutboxStore) SkipEvents(ctx context.Context) (int64, error) {
+	res, err := s.DB.ExecContext(ctx, "UPDATE song_events SET dispatched_at = "+nowUTC+" WHERE dispatched_at IS NULL")
+	if err != nil {
+		return 0, fmt.Errorf("failed to skip song events: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to retrieve rows affected: %w", err)
+	}
+	return n, nil
+}
+
+func (s *OutboxStore) PruneEvents(ctx context.Context, before time.Time) (int64, error) {
+	s.log(ctx).Debug("Pruning song events", zap.Time("before", before))
+
+	res, err := s.DB.ExecContext(ctx, "DELETE FROM song_events WHERE dispatched_at < ?", before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune song events: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to retrieve rows affected: %w", err)
+	}
+	return n, nil
+}
@@ -0,0 +1,134 @@
+// Package sqlite stores songs and API keys in a single SQLite file, for
+// installations that do not run PostgreSQL. It behaves like the postgres
+// package, filters included.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"embed"
+	"fmt"
+	"io/fs"
+	"strings"
+
+	"github.com/SemenShakhray/list-of-song/internal/storage"
+	"github.com/SemenShakhray/list-of-song/pkg/logger"
+
+	"github.com/pressly/goose/v3"
+	"go.uber.org/zap"
+	msqlite "modernc.org/sqlite"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+func init() {
+	// SQLite lower() and LIKE fold ASCII letters only, unicode_lower gives the
+	// filters the case-insensitivity of ILIKE in PostgreSQL.
+	msqlite.MustRegisterDeterministicScalarFunction("unicode_lower", 1, func(_ *msqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		switch v := args[0].(type) {
+		case string:
+			return strings.ToLower(v), nil
+		case []byte:
+			return strings.ToLower(string(v)), nil
+		}
+		return args[0], nil
+	})
+}
+
+type Store struct {
+	DB  *sql.DB
+	Log *zap.Logger
+
+	txOpts storage.TxOptions
+	tx     *sql.Tx
+}
+
+// querier is the part of *sql.DB and *sql.Tx used by the store methods.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// conn returns the transaction the store is bound to, or the pool otherwise.
+func (s *Store) conn() querier {
+	if s.tx != nil {
+		return s.tx
+	}
+	return s.DB
+}
+
+// log returns the store logger with the fields of the request ctx belongs to.
+func (s *Store) log(ctx context.Context) *zap.Logger {
+	return logger.FromContext(ctx, s.Log)
+}
+
+// NewStore creates a store on db. opts set the defaults for WithTx, the
+// isolation level is ignored since SQLite transactions are serializable.
+func NewStore(db *sql.DB, log *zap.Logger, opts ...storage.TxOption) storage.Storer {
+	return &Store{
+		DB:     db,
+		Log:    log,
+		txOpts: storage.TxOptions{}.Apply(opts...),
+	}
+}
+
+// Open opens the database file at path, creating it when it does not exist.
+// Transactions take the write lock when they begin, which stands in for the
+// row locks of the postgres store, and wait for each other up to five seconds.
+func Open(path string) (*sql.DB, error) {
+	dsn := path + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)" +
+		"&_txlock=immediate&_time_format=sqlite"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	return db, nil
+}
+
+func newProvider(db *sql.DB) (*goose.Provider, error) {
+	dir, err := fs.Sub(migrations, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load migrations: %w", err)
+	}
+	provider, err := goose.NewProvider(goose.DialectSQLite3, db, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load migrations: %w", err)
+	}
+	return provider, nil
+}
+
+// Migrate applies the migrations embedded in the package.
+func Migrate(ctx context.Context, db *sql.DB) error {
+	provider, err := newProvider(db)
+	if err != nil {
+		return err
+	}
+	if _, err := provider.Up(ctx); err != nil {
+		return fmt.Errorf("failed to apply migrations: %w", err)
+	}
+	return nil
+}
+
+// CheckMigrations returns an error when the database schema is behind the
+// newest embedded migration.
+func CheckMigrations(ctx context.Context, db *sql.DB) error {
+	provider, err := newProvider(db)
+	if err != nil {
+		return err
+	}
+	current, target, err := provider.GetVersions(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database version: %w", err)
+	}
+	if current < target {
+		return fmt.Errorf("database version %d is behind migration %d", current, target)
+	}
+	return nil
+}
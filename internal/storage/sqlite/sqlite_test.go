@@ -0,0 +1,27 @@
+package sqlite
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/SemenShakhray/list-of-song/internal/storage"
+	"github.com/SemenShakhray/list-of-song/internal/storage/storetest"
+
+	"go.uber.org/zap"
+)
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) storage.Storer {
+		db, err := Open(filepath.Join(t.TempDir(), "songs.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		if err := Migrate(context.Background(), db); err != nil {
+			t.Fatal(err)
+		}
+		return NewStore(db, zap.NewNop())
+	})
+}
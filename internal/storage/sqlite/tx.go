@@ -0,0 +1,101 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/SemenShakhray/list-of-song/internal/storage"
+
+	"go.uber.org/zap"
+	msqlite "modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+const (
+	// retryBaseDelay is the backoff before the first retry, it doubles on every attempt.
+	retryBaseDelay = 10 * time.Millisecond
+	retryMaxDelay  = 500 * time.Millisecond
+)
+
+// WithTx runs fn inside a database transaction. The Storer passed to fn is
+// bound to the transaction; it is committed when fn returns nil and rolled
+// back otherwise. Calling WithTx on a store that is already inside a
+// transaction reuses that transaction and ignores opts.
+//
+// Transactions that could not take the database lock in time are run again
+// up to TxOptions.MaxRetries times, so fn must not have side effects outside
+// the transaction.
+func (s *Store) WithTx(ctx context.Context, fn func(storage.Storer) error, opts ...storage.TxOption) error {
+	if s.tx != nil {
+		return fn(s)
+	}
+
+	o := s.txOpts.Apply(opts...)
+	delay := retryBaseDelay
+	for attempt := 0; ; attempt++ {
+		err := s.runTx(ctx, fn, o)
+		if err == nil || !isRetryable(err) || attempt >= o.MaxRetries {
+			return err
+		}
+
+		s.log(ctx).Debug("Retrying transaction", zap.Int("attempt", attempt+1), zap.Error(err))
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(delay/2 + rand.N(delay/2+1)):
+		}
+		delay = min(delay*2, retryMaxDelay)
+	}
+}
+
+// inTx is WithTx for the store methods, which need the concrete store.
+func (s *Store) inTx(ctx context.Context, fn func(tx *Store) error) error {
+	return s.WithTx(ctx, func(st storage.Storer) error {
+		return fn(st.(*Store))
+	})
+}
+
+func (s *Store) runTx(ctx context.Context, fn func(storage.Storer) error, o storage.TxOptions) error {
+	tx, err := s.DB.BeginTx(ctx, &sql.TxOptions{ReadOnly: o.ReadOnly})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	s.log(ctx).Debug("Transaction started")
+
+	err = fn(&Store{DB: s.DB, Log: s.Log, txOpts: s.txOpts, tx: tx})
+	if err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return errors.Join(err, fmt.Errorf("failed to rollback transaction: %w", rbErr))
+		}
+		s.log(ctx).Debug("Transaction rolled back", zap.Error(err))
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	s.log(ctx).Debug("Transaction committed")
+	return nil
+}
+
+// isRetryable reports whether err means the database stayed locked by another
+// connection for longer than the busy timeout.
+func isRetryable(err error) bool {
+	var sqliteErr *msqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	code := sqliteErr.Code() & 0xff
+	return code == sqlite3.SQLITE_BUSY || code == sqlite3.SQLITE_LOCKED
+}
+
+// isUniqueViolation reports whether err is a unique constraint violation,
+// which for songs means the title is taken by a song outside the trash.
+func isUniqueViolation(err error) bool {
+	var sqliteErr *msqlite.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+}
@@ -0,0 +1,314 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/SemenShakhray/list-of-song/internal/models"
+	"github.com/SemenShakhray/list-of-song/internal/storage"
+	"github.com/SemenShakhray/list-of-song/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+type WebhookStore struct {
+	DB  *sql.DB
+	Log *zap.Logger
+}
+
+func NewWebhookStore(db *sql.DB, log *zap.Logger) storage.WebhookStorer {
+	return &WebhookStore{
+		DB:  db,
+		Log: log,
+	}
+}
+
+func (s *WebhookStore) log(ctx context.Context) *zap.Logger {
+	return logger.FromContext(ctx, s.Log)
+}
+
+const (
+	webhookColumns  = "id, url, events, active, secret, created_at"
+	deliveryColumns = "id, webhook_id, event_id, event_type, status, attempts, next_attempt_at, last_status_code, last_error, created_at, delivered_at"
+)
+
+func scanWebhook(row rowScanner) (models.Webhook, error) {
+	var (
+		hook   models.Webhook
+		events string
+	)
+	err := row.Scan(&hook.Id, &hook.URL, &events, &hook.Active, &hook.Secret, &hook.CreatedAt)
+	if err != nil {
+		return models.Webhook{}, err
+	}
+	if err := json.Unmarshal([]byte(events), &hook.Events); err != nil {
+		return models.Webhook{}, fmt.Errorf("failed to decode webhook events: %w", err)
+	}
+	return hook, nil
+}
+
+func scanDelivery(row rowScanner, extra ...any) (models.WebhookDelivery, error) {
+	var d models.WebhookDelivery
+	dest := []any{&d.Id, &d.WebhookId, &d.EventId, &d.EventType, &d.Status, &d.Attempts, &d.NextAttemptAt,
+		&d.LastStatusCode, &d.LastError, &d.CreatedAt, &d.DeliveredAt}
+	err := row.Scan(append(dest, extra...)...)
+	return d, err
+}
+
+// encodeEvents returns the event types as the JSON array stored in the
+// events column.
+func encodeEvents(events []string) (string, error) {
+	b, err := json.Marshal(events)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode webhook events: %w", err)
+	}
+	return string(b), nil
+}
+
+func (s *WebhookStore) CreateWebhook(ctx context.Context, hook models.Webhook) (models.Webhook, error) {
+	s.log(ctx).Debug("Creating webhook", zap.String("url", hook.URL), zap.Strings("events", hook.Events))
+
+	events, err := encodeEvents(hook.Events)
+	if err != nil {
+		return models.Webhook{}, err
+	}
+	query := "INSERT INTO webhooks (url, secret, events, active) VALUES (?, ?, ?, ?) RETURNING " + webhookColumns
+	created, err := scanWebhook(s.DB.QueryRowContext(ctx, query, hook.URL, hook.Secret, events, hook.Active))
+	if err != nil {
+		return models.Webhook{}, fmt.Errorf("failed to create webhook: %w", err)
+	}
+	return created, nil
+}
+
+func (s *WebhookStore) ListWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	query := "SELECT " + webhookColumns + " FROM webhooks ORDER BY id"
+	rows, err := s.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	var hooks []models.Webhook
+	for rows.Next() {
+		hook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook: %w", err)
+		}
+		hooks = append(hooks, hook)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating through webhooks: %w", err)
+	}
+	return hooks, nil
+}
+
+func (s *WebhookStore) GetWebhook(ctx context.Context, id int) (models.Webhook, error) {
+	query := "SELECT " + webhookColumns + " FROM webhooks WHERE id = ?"
+	hook, err := scanWebhook(s.DB.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Webhook{}, storage.ErrWebhookNotFound
+		}
+		return models.Webhook{}, fmt.Errorf("failed to get webhook: %w", err)
+	}
+	return hook, nil
+}
+
+func (s *WebhookStore) UpdateWebhook(ctx context.Context, hook models.Webhook) (models.Webhook, error) {
+	s.log(ctx).Debug("Updating webhook", zap.Int("webhook", hook.Id), zap.String("url", hook.URL), zap.Strings("events", hook.Events))
+
+	events, err := encodeEvents(hook.Events)
+	if err != nil {
+		return models.Webhook{}, err
+	}
+	query := "UPDATE webhooks SET url = ?, events = ?, active = ? WHERE id = ? RETURNING " + webhookColumns
+	updated, err := scanWebhook(s.DB.QueryRowContext(ctx, query, hook.URL, events, hook.Active, hook.Id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Webhook{}, storage.ErrWebhookNotFound
+		}
+		return models.Webhook{}, fmt.Errorf("failed to update webhook: %w", err)
+	}
+	return updated, nil
+}
+
+func (s *WebhookStore) DeleteWebhook(ctx context.Context, id int) error {
+	s.log(ctx).Debug("Deleting webhook", zap.Int("webhook", id))
+
+	row, err := s.DB.ExecContext(ctx, "DELETE FROM webhooks WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+	n, err := row.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to retrieve rows affected: %w", err)
+	}
+	if n == 0 {
+		return storage.ErrWebhookNotFound
+	}
+	return nil
+}
+
+func (s *WebhookStore) ListDeliveries(ctx context.Context, webhookID int, limit, offset int) ([]models.WebhookDelivery, error) {
+	query := "SELECT " + deliveryColumns + " FROM webhook_deliveries WHERE webhook_id = ? ORDER BY id DESC LIMIT ? OFFSET ?"
+	rows, err := s.DB.QueryContext(ctx, query, webhookID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating through webhook deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+// DispatchEvents runs in a transaction that holds the write lock, so the
+// events up to the last one of the batch cannot change meanwhile.
+func (s *WebhookStore) DispatchEvents(ctx context.Context, limit int) (int, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var (
+		last sql.NullInt64
+		n    int
+	)
+	query := "SELECT MAX(id), COUNT(*) FROM (SELECT id FROM song_events WHERE dispatched_at IS NULL ORDER BY id LIMIT ?)"
+	if err := tx.QueryRowContext(ctx, query, limit).Scan(&last, &n); err != nil {
+		return 0, fmt.Errorf("failed to read song events: %w", err)
+	}
+	if n == 0 {
+		return 0, nil
+	}
+
+	query = `INSERT OR IGNORE INTO webhook_deliveries (webhook_id, event_id, event_type, event_data, event_created_at)
+	SELECT w.id, e.id, e.type, e.data, e.created_at FROM song_events e
+	JOIN webhooks w ON w.active AND EXISTS (SELECT 1 FROM json_each(w.events) WHERE json_each.value = e.type)
+	WHERE e.dispatched_at IS NULL AND e.id <= ?`
+	if _, err := tx.ExecContext(ctx, query, last.Int64); err != nil {
+		return 0, fmt.Errorf("failed to add webhook deliveries: %w", err)
+	}
+
+	query = "UPDATE song_events SET dispatched_at = " + nowUTC + " WHERE dispatched_at IS NULL AND id <= ?"
+	if _, err := tx.ExecContext(ctx, query, last.Int64); err != nil {
+		return 0, fmt.Errorf("failed to mark song events dispatched: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return n, nil
+}
+
+func (s *WebhookStore) ClaimDeliveries(ctx context.Context, limit, perWebhook int, skip []int, lease time.Duration) ([]models.DueDelivery, error) {
+	if skip == nil {
+		// json_each of null is a NULL, which would match no webhook at all.
+		skip = []int{}
+	}
+	skipped, err := json.Marshal(skip)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode webhooks: %w", err)
+	}
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	query := `SELECT id, webhook_id, event_id, event_type, status, attempts, next_attempt_at,
+	last_status_code, last_error, created_at, delivered_at, event_data, event_created_at, url, secret
+	FROM (
+		SELECT d.*, w.url, w.secret,
+			row_number() OVER (PARTITION BY d.webhook_id ORDER BY d.next_attempt_at, d.id) AS n
+		FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id
+		WHERE d.status = 'pending' AND d.next_attempt_at <= ? AND w.active
+			AND d.webhook_id NOT IN (SELECT value FROM json_each(?))
+	)
+	WHERE n <= ?
+	ORDER BY next_attempt_at, id LIMIT ?`
+	rows, err := tx.QueryContext(ctx, query, now, string(skipped), perWebhook, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var due []models.DueDelivery
+	for rows.Next() {
+		var (
+			d    models.DueDelivery
+			data string
+			err  error
+		)
+		d.WebhookDelivery, err = scanDelivery(rows, &data, &d.Event.CreatedAt, &d.URL, &d.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		d.Event.Id, d.Event.Type, d.Event.Data = d.EventId, d.EventType, json.RawMessage(data)
+		d.Event.CreatedAt = d.Event.CreatedAt.UTC()
+		due = append(due, d)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating through webhook deliveries: %w", err)
+	}
+
+	until := now.Add(lease)
+	for i := range due {
+		query := "UPDATE webhook_deliveries SET next_attempt_at = ? WHERE id = ?"
+		if _, err := tx.ExecContext(ctx, query, until, due[i].Id); err != nil {
+			return nil, fmt.Errorf("failed to claim webhook delivery: %w", err)
+		}
+		due[i].NextAttemptAt = until
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return due, nil
+}
+
+func (s *WebhookStore) RecordAttempt(ctx context.Context, d models.WebhookDelivery) error {
+	var deliveredAt any
+	if d.DeliveredAt != nil {
+		deliveredAt = d.DeliveredAt.UTC()
+	}
+	query := `UPDATE webhook_deliveries SET status = ?, attempts = ?, next_attempt_at = ?,
+	last_status_code = ?, last_error = ?, delivered_at = ? WHERE id = ?`
+	_, err := s.DB.ExecContext(ctx, query, d.Status, d.Attempts, d.NextAttemptAt.UTC(),
+		d.LastStatusCode, d.LastError, deliveredAt, d.Id)
+	if err != nil {
+		return fmt.Errorf("failed to record webhook delivery: %w", err)
+	}
+	return nil
+}
+
+func (s *WebhookStore) PruneDeliveries(ctx context.Context, before time.Time) (int64, error) {
+	s.log(ctx).Debug("Pruning webhook deliveries", zap.Time("before", before))
+
+	query := "DELETE FROM webhook_deliveries WHERE status <> 'pending' AND created_at < ?"
+	row, err := s.DB.ExecContext(ctx, query, before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune webhook deliveries: %w", err)
+	}
+	n, err := row.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to retrieve rows affected: %w", err)
+	}
+	return n, nil
+}
@@ -2,14 +2,102 @@ package storage
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/SemenShakhray/list-of-song/internal/models"
 )
 
+var (
+	ErrKeyNotFound     = errors.New("API key not found")
+	ErrWebhookNotFound = errors.New("webhook not found")
+	// ErrSongExists is returned when a change would give a song the title and
+	// group of another song outside the trash.
+	ErrSongExists = errors.New("song with this title and group already exists")
+)
+
 type Storer interface {
 	GetAll(ctx context.Context, filtres models.Filters) ([]models.Song, error)
 	AddSong(ctx context.Context, song models.Song) error
 	Update(ctx context.Context, song models.Song) error
 	Delete(ctx context.Context, id int) error
 	GetText(ctx context.Context, filtres models.Filters, id int) (string, error)
+	Export(ctx context.Context, filtres models.Filters, fn func(models.Song) error) error
+	GetTrash(ctx context.Context, filtres models.Filters) ([]models.Song, error)
+	Restore(ctx context.Context, id int) error
+	// Purge permanently removes songs deleted before the given time and
+	// returns how many were removed.
+	Purge(ctx context.Context, before time.Time) (int64, error)
+	GetHistory(ctx context.Context, id int, limit, offset int) ([]models.Revision, error)
+	GetRevision(ctx context.Context, id int, revision int) (models.Revision, error)
+	// Revert sets a song back to its state after the given revision.
+	Revert(ctx context.Context, id int, revision int) error
+	// WithTx runs fn atomically. The Storer passed to fn must be used for every
+	// call that belongs to the transaction. fn may be run more than once when
+	// the transaction is retried.
+	WithTx(ctx context.Context, fn func(Storer) error, opts ...TxOption) error
+}
+
+// KeyStorer keeps the API keys used for authentication. Keys are stored
+// hashed only.
+type KeyStorer interface {
+	CreateAPIKey(ctx context.Context, key models.APIKey) (models.APIKey, error)
+	ListAPIKeys(ctx context.Context) ([]models.APIKey, error)
+	RevokeAPIKey(ctx context.Context, id int) error
+	// GetAPIKeyByHash returns ErrKeyNotFound when there is no key with the hash.
+	GetAPIKeyByHash(ctx context.Context, hash string) (models.APIKey, error)
+}
+
+// WebhookStorer keeps the webhook subscriptions and the log of their
+// deliveries. The Storer writes an event to the outbox in the transaction of
+// every song change, DispatchEvents turns the events into deliveries.
+type WebhookStorer interface {
+	CreateWebhook(ctx context.Context, hook models.Webhook) (models.Webhook, error)
+	ListWebhooks(ctx context.Context) ([]models.Webhook, error)
+	// GetWebhook, UpdateWebhook and DeleteWebhook return ErrWebhookNotFound
+	// when there is no webhook with the id.
+	GetWebhook(ctx context.Context, id int) (models.Webhook, error)
+	// UpdateWebhook changes the URL, events and active flag of a webhook, the
+	// secret is kept.
+	UpdateWebhook(ctx context.Context, hook models.Webhook) (models.Webhook, error)
+	DeleteWebhook(ctx context.Context, id int) error
+	// ListDeliveries returns the deliveries of a webhook, the newest first.
+	ListDeliveries(ctx context.Context, webhookID int, limit, offset int) ([]models.WebhookDelivery, error)
+
+	// DispatchEvents takes up to limit events from the outbox and adds a
+	// delivery of each to every active webhook subscribed to its type, in one
+	// transaction. It returns the number of events taken.
+	DispatchEvents(ctx context.Context, limit int) (int, error)
+	// ClaimDeliveries returns up to limit pending deliveries that are due, at
+	// most perWebhook of one webhook and none of the webhooks in skip, and
+	// postpones them by lease, so other instances do not send them meanwhile.
+	// A delivery whose attempt is never recorded is claimed again after lease.
+	ClaimDeliveries(ctx context.Context, limit, perWebhook int, skip []int, lease time.Duration) ([]models.DueDelivery, error)
+	// RecordAttempt saves the status, attempts, next attempt and last result
+	// of a delivery.
+	RecordAttempt(ctx context.Context, delivery models.WebhookDelivery) error
+	// PruneDeliveries removes the delivered and failed deliveries created
+	// before the given time and returns how many were removed.
+	PruneDeliveries(ctx context.Context, before time.Time) (int64, error)
+}
+
+// OutboxStorer keeps the outbox of song events from growing.
+type OutboxStorer interface {
+	// SkipEvents marks the events in the outbox dispatched without adding
+	// deliveries and returns how many it marked.
+	SkipEvents(ctx context.Context) (int64, error)
+	// PruneEvents removes the events dispatched before the given time and
+	// returns how many were removed.
+	PruneEvents(ctx context.Context, before time.Time) (int64, error)
+}
+
+// EventStorer reads the song events of the outbox for the event stream.
+type EventStorer interface {
+	// RecentEvents returns up to limit newest events, oldest first.
+	RecentEvents(ctx context.Context, limit int) ([]models.Event, error)
+	// WatchEvents calls fn with the events after the given event ID and then
+	// with the events committed by any instance from now on, an event may be
+	// passed more than once. It blocks until ctx is cancelled or the database
+	// fails.
+	WatchEvents(ctx context.Context, after int64, fn func(models.Event)) error
 }
@@ -0,0 +1,219 @@
+package storetest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SemenShakhray/list-of-song/internal/models"
+	"github.com/SemenShakhray/list-of-song/internal/requestctx"
+	"github.com/SemenShakhray/list-of-song/internal/storage"
+)
+
+func testHistoryAndRevert(t *testing.T, s storage.Storer) {
+	song := add(t, s, models.Song{Song: "Knights of Cydonia", Group: "Muse", Text: "original"})[0]
+	if err := s.Update(ctx, models.Song{Id: song.Id, Text: "changed"}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if err := s.Delete(ctx, song.Id); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	history, err := s.GetHistory(ctx, song.Id, 10, 0)
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+	var actions []string
+	for _, rev := range history {
+		actions = append(actions, rev.Action)
+	}
+	wantActions := []string{models.RevisionDelete, models.RevisionUpdate, models.RevisionCreate}
+	if len(history) != 3 || history[0].Revision != 3 || history[2].Revision != 1 {
+		t.Fatalf("history = %+v, want revisions 3, 2, 1", history)
+	}
+	for i := range wantActions {
+		if actions[i] != wantActions[i] {
+			t.Errorf("actions = %q, want %q", actions, wantActions)
+			break
+		}
+	}
+	if history[2].Before != nil || history[2].After == nil || history[2].After.Text != "original" {
+		t.Errorf("create revision = %+v, want only the state after", history[2])
+	}
+	if history[0].After == nil || history[0].After.DeletedAt == nil {
+		t.Errorf("delete revision = %+v, want a deleted state after", history[0])
+	}
+
+	// Reverting to the state after the update also takes the song out of the trash.
+	if err := s.Revert(ctx, song.Id, 2); err != nil {
+		t.Fatalf("Revert: %v", err)
+	}
+	text, err := s.GetText(ctx, models.Filters{Limit: 10}, song.Id)
+	if err != nil {
+		t.Fatalf("GetText after revert: %v", err)
+	}
+	if text != "changed" {
+		t.Errorf("text after revert = %q, want %q", text, "changed")
+	}
+
+	rev, err := s.GetRevision(ctx, song.Id, 4)
+	if err != nil {
+		t.Fatalf("GetRevision: %v", err)
+	}
+	if rev.Action != models.RevisionRevert {
+		t.Errorf("revision 4 action = %q, want %q", rev.Action, models.RevisionRevert)
+	}
+	if err := s.Revert(ctx, song.Id, 10); err == nil {
+		t.Error("Revert to a missing revision succeeded, want an error")
+	}
+}
+
+func testHistoryPagination(t *testing.T, s storage.Storer) {
+	song := add(t, s, models.Song{Song: "Dead Inside", Group: "Muse", Text: "v1"})[0]
+	for _, text := range []string{"v2", "v3", "v4"} {
+		if err := s.Update(ctx, models.Song{Id: song.Id, Text: text}); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name          string
+		limit, offset int
+		want          []int
+	}{
+		{"first page", 2, 0, []int{4, 3}},
+		{"second page", 2, 2, []int{2, 1}},
+		{"partial page", 3, 3, []int{1}},
+		{"past the end", 2, 4, nil},
+		{"zero limit", 0, 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			history, err := s.GetHistory(ctx, song.Id, tt.limit, tt.offset)
+			if err != nil {
+				t.Fatalf("GetHistory: %v", err)
+			}
+			var got []int
+			for _, rev := range history {
+				got = append(got, rev.Revision)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("revisions = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("revisions = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+
+	// Every song has its own history.
+	other := add(t, s, models.Song{Song: "Follow Me", Group: "Muse"})[0]
+	history, err := s.GetHistory(ctx, other.Id, 10, 0)
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+	if len(history) != 1 || history[0].Revision != 1 || history[0].SongId != other.Id {
+		t.Errorf("history of another song = %+v, want its own first revision", history)
+	}
+
+	history, err = s.GetHistory(ctx, song.Id+1000, 10, 0)
+	if err != nil {
+		t.Fatalf("GetHistory of a missing song: %v", err)
+	}
+	if len(history) != 0 {
+		t.Errorf("history of a missing song = %+v, want none", history)
+	}
+}
+
+func testGetRevision(t *testing.T, s storage.Storer) {
+	song := add(t, s, models.Song{Song: "Bliss", Group: "Muse", Text: "Everything about you"})[0]
+
+	// Revisions record who made the change in which request.
+	ctx := requestctx.WithRequestID(requestctx.WithActor(ctx, "tester"), "req-1")
+	if err := s.Update(ctx, models.Song{Id: song.Id, Text: "Everything about you is so easy to love"}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	rev, err := s.GetRevision(ctx, song.Id, 2)
+	if err != nil {
+		t.Fatalf("GetRevision: %v", err)
+	}
+	if rev.SongId != song.Id || rev.Revision != 2 || rev.Action != models.RevisionUpdate {
+		t.Errorf("revision = %+v, want the update revision of the song", rev)
+	}
+	if rev.Actor != "tester" || rev.RequestId != "req-1" {
+		t.Errorf("revision actor %q, request %q, want tester and req-1", rev.Actor, rev.RequestId)
+	}
+	if rev.CreatedAt.IsZero() {
+		t.Error("revision has no creation time")
+	}
+
+	if _, err := s.GetRevision(ctx, song.Id, 3); err == nil {
+		t.Error("GetRevision of a missing revision succeeded, want an error")
+	}
+	if _, err := s.GetRevision(ctx, song.Id+1000, 1); err == nil {
+		t.Error("GetRevision of a missing song succeeded, want an error")
+	}
+}
+
+func testRevertErrors(t *testing.T, s storage.Storer) {
+	songs := add(t, s,
+		models.Song{Song: "Guiding Light", Group: "Muse"},
+		models.Song{Song: "Undisclosed Desires", Group: "Muse", Text: "original"},
+	)
+	other, song := songs[0], songs[1]
+	if err := s.Update(ctx, models.Song{Id: song.Id, Text: "changed"}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	if err := s.Revert(ctx, song.Id, 0); err == nil {
+		t.Error("Revert to revision 0 succeeded, want an error")
+	}
+	if err := s.Revert(ctx, song.Id+1000, 1); err == nil {
+		t.Error("Revert of a missing song succeeded, want an error")
+	}
+
+	// Reverting to a title another song has taken since fails and changes nothing.
+	if err := s.Update(ctx, models.Song{Id: song.Id, Song: "Exo-Politics"}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if err := s.Update(ctx, models.Song{Id: other.Id, Song: "Undisclosed Desires"}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if err := s.Revert(ctx, song.Id, 1); err == nil {
+		t.Error("Revert to a taken title succeeded, want an error")
+	}
+	history, err := s.GetHistory(ctx, song.Id, 10, 0)
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+	if len(history) != 3 {
+		t.Errorf("got %d revisions after a failed revert, want 3", len(history))
+	}
+
+	// The history of a purged song is kept, but there is nothing to revert.
+	if err := s.Delete(ctx, song.Id); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := s.Purge(ctx, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Purge: %v", err)
+	}
+	if err := s.Revert(ctx, song.Id, 2); err == nil {
+		t.Error("Revert of a purged song succeeded, want an error")
+	}
+	history, err = s.GetHistory(ctx, song.Id, 10, 0)
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+	if len(history) != 4 {
+		t.Errorf("got %d revisions of a purged song, want 4", len(history))
+	}
+
+	// Ids are not reused, even the highest one, so the kept history never
+	// applies to a new song.
+	added := add(t, s, models.Song{Song: "Undisclosed Desires", Group: "Muse Tribute"})[0]
+	if added.Id <= song.Id {
+		t.Errorf("new song got id %d, want an id after the purged %d", added.Id, song.Id)
+	}
+}
@@ -0,0 +1,376 @@
+package storetest
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/SemenShakhray/list-of-song/internal/models"
+	"github.com/SemenShakhray/list-of-song/internal/storage"
+)
+
+func testAddSong(t *testing.T, s storage.Storer) {
+	want := models.Song{Song: "Supermassive Black Hole", Group: "Muse", Text: "Ooh baby\nOoh", Link: "https://example.com/muse", Date: "16.07.2006"}
+	got := add(t, s, want)[0]
+
+	if got.Id <= 0 {
+		t.Errorf("id = %d, want a positive id", got.Id)
+	}
+	want.Id = got.Id
+	if got != want {
+		t.Errorf("stored song = %+v, want %+v", got, want)
+	}
+
+	// Only the title and the group are required, the rest is stored empty.
+	bare := add(t, s, models.Song{Song: "Citizen Erased", Group: "Muse"})[0]
+	if bare.Id == got.Id {
+		t.Errorf("second song got the id %d of the first", bare.Id)
+	}
+	if bare.Text != "" || bare.Link != "" || bare.Date != "" || bare.DeletedAt != nil {
+		t.Errorf("song without details = %+v, want empty details", bare)
+	}
+
+	history, err := s.GetHistory(ctx, got.Id, 10, 0)
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+	if len(history) != 1 || history[0].Action != models.RevisionCreate || history[0].After == nil || *history[0].After != got {
+		t.Errorf("history = %+v, want one create revision with the stored song", history)
+	}
+}
+
+func testAddSongDuplicate(t *testing.T, s storage.Storer) {
+	first := add(t, s, models.Song{Song: "Hysteria", Group: "Muse", Text: "first"})[0]
+
+	// The same title by another group is a different song.
+	if err := s.AddSong(ctx, models.Song{Song: "Hysteria", Group: "Def Leppard"}); err != nil {
+		t.Fatalf("AddSong of another group: %v", err)
+	}
+	// A duplicate is ignored without an error and does not change the song.
+	if err := s.AddSong(ctx, models.Song{Song: "Hysteria", Group: "Muse", Text: "second"}); err != nil {
+		t.Fatalf("AddSong of a duplicate: %v", err)
+	}
+
+	songs, err := s.GetAll(ctx, models.Filters{Group: "Muse", Limit: 10})
+	if err != nil {
+		t.Fatalf("GetAll: %v", err)
+	}
+	if len(songs) != 1 || songs[0] != first {
+		t.Errorf("songs of the group = %+v, want only %+v", songs, first)
+	}
+
+	// Matching is exact, titles differing in case are different songs.
+	if err := s.AddSong(ctx, models.Song{Song: "HYSTERIA", Group: "Muse"}); err != nil {
+		t.Fatalf("AddSong: %v", err)
+	}
+	songs, err = s.GetAll(ctx, models.Filters{Group: "Muse", Limit: 10})
+	if err != nil {
+		t.Fatalf("GetAll: %v", err)
+	}
+	if len(songs) != 2 {
+		t.Errorf("got %d songs of the group, want 2", len(songs))
+	}
+
+	// A song in the trash gives up its title, but cannot be restored while
+	// another song has it.
+	if err := s.Delete(ctx, first.Id); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	third := add(t, s, models.Song{Song: "Hysteria", Group: "Muse", Text: "third"})[0]
+	if third.Id == first.Id || third.Text != "third" {
+		t.Errorf("song added with the title of a deleted one = %+v, want a new song", third)
+	}
+	if err := s.Restore(ctx, first.Id); !errors.Is(err, storage.ErrSongExists) {
+		t.Errorf("Restore of a song whose title is taken = %v, want %v", err, storage.ErrSongExists)
+	}
+
+	// Renaming to the title of an active song is a conflict, to the title of
+	// a song in the trash is not.
+	upper := add(t, s, models.Song{Song: "HYSTERIA", Group: "Muse"})[0]
+	if err := s.Update(ctx, models.Song{Id: upper.Id, Song: "Hysteria"}); !errors.Is(err, storage.ErrSongExists) {
+		t.Errorf("Update to the title of an active song = %v, want %v", err, storage.ErrSongExists)
+	}
+	if err := s.Delete(ctx, third.Id); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := s.Update(ctx, models.Song{Id: upper.Id, Song: "Hysteria"}); err != nil {
+		t.Errorf("Update to the title of a song in the trash: %v", err)
+	}
+
+	// Ignored duplicates leave no revisions.
+	history, err := s.GetHistory(ctx, first.Id, 10, 0)
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+	if len(history) != 2 {
+		t.Errorf("got %d revisions, want create and delete only", len(history))
+	}
+}
+
+func testGetAllFilters(t *testing.T, s storage.Storer) {
+	add(t, s,
+		models.Song{Song: "Starlight", Group: "Muse", Text: "Far away\nThis ship is taking me far away", Link: "https://example.com/starlight", Date: "03.09.2006"},
+		models.Song{Song: "Uprising", Group: "Muse", Text: "Paranoia is in bloom", Link: "https://example.com/uprising", Date: "07.09.2009"},
+		models.Song{Song: "Группа крови", Group: "Кино", Text: "Тёплое место, но улицы ждут\nОтпечатков наших ног", Date: "05.01.1988"},
+		models.Song{Song: "100% Pure", Group: "Some_Band", Text: "one hundred", Date: "01.01.2000"},
+	)
+
+	tests := []struct {
+		name    string
+		filters models.Filters
+		want    []string
+	}{
+		{"no filters", models.Filters{}, []string{"Starlight", "Uprising", "Группа крови", "100% Pure"}},
+		{"partial title", models.Filters{Song: "light"}, []string{"Starlight"}},
+		{"case-insensitive title", models.Filters{Song: "STAR"}, []string{"Starlight"}},
+		{"case-insensitive Cyrillic", models.Filters{Group: "КИНО"}, []string{"Группа крови"}},
+		{"group", models.Filters{Group: "mus"}, []string{"Starlight", "Uprising"}},
+		{"lyrics", models.Filters{Text: "taking me"}, []string{"Starlight"}},
+		{"lyrics case-insensitive", models.Filters{Text: "PARANOIA"}, []string{"Uprising"}},
+		{"lyrics across lines", models.Filters{Text: "away\nThis"}, []string{"Starlight"}},
+		{"lyrics Cyrillic", models.Filters{Text: "ОТПЕЧАТК"}, []string{"Группа крови"}},
+		{"short lyrics", models.Filters{Text: "is"}, []string{"Starlight", "Uprising"}},
+		{"link", models.Filters{Link: "uprising"}, []string{"Uprising"}},
+		{"exact date", models.Filters{Date: "07.09.2009"}, []string{"Uprising"}},
+		{"partial date", models.Filters{Date: "2009"}, nil},
+		{"percent wildcard", models.Filters{Song: "up%ing"}, []string{"Uprising"}},
+		{"underscore wildcard", models.Filters{Group: "Some Band"}, nil},
+		{"underscore matches itself", models.Filters{Group: "e_b"}, []string{"100% Pure"}},
+		{"combined", models.Filters{Group: "Muse", Text: "far"}, []string{"Starlight"}},
+		{"no match", models.Filters{Song: "Resistance"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.filters.Limit = 10
+			songs, err := s.GetAll(ctx, tt.filters)
+			if err != nil {
+				t.Fatalf("GetAll: %v", err)
+			}
+			if got := names(songs); !equalSet(got, tt.want) {
+				t.Errorf("GetAll(%+v) = %q, want %q", tt.filters, got, tt.want)
+			}
+		})
+	}
+}
+
+func testGetAllPagination(t *testing.T, s storage.Storer) {
+	add(t, s,
+		models.Song{Song: "One", Group: "Band"},
+		models.Song{Song: "Two", Group: "Band"},
+		models.Song{Song: "Three", Group: "Band"},
+	)
+
+	var pages []string
+	for offset := 0; offset < 4; offset += 2 {
+		songs, err := s.GetAll(ctx, models.Filters{Limit: 2, Offset: offset})
+		if err != nil {
+			t.Fatalf("GetAll: %v", err)
+		}
+		if len(songs) > 2 {
+			t.Fatalf("got %d songs, want at most the limit of 2", len(songs))
+		}
+		pages = append(pages, names(songs)...)
+	}
+	if !equalSet(pages, []string{"One", "Two", "Three"}) {
+		t.Errorf("pages = %q, want every song once", pages)
+	}
+
+	songs, err := s.GetAll(ctx, models.Filters{Limit: 2, Offset: 3})
+	if err != nil {
+		t.Fatalf("GetAll: %v", err)
+	}
+	if len(songs) != 0 {
+		t.Errorf("got %d songs past the end, want none", len(songs))
+	}
+
+	songs, err = s.GetAll(ctx, models.Filters{Limit: 0})
+	if err != nil {
+		t.Fatalf("GetAll: %v", err)
+	}
+	if len(songs) != 0 {
+		t.Errorf("got %d songs with a zero limit, want none", len(songs))
+	}
+}
+
+func testUpdate(t *testing.T, s storage.Storer) {
+	song := add(t, s, models.Song{Song: "Madness", Group: "Muse", Text: "I can't get it right", Link: "https://example.com/old", Date: "20.08.2012"})[0]
+
+	// Empty fields keep their values.
+	if err := s.Update(ctx, models.Song{Id: song.Id, Link: "https://example.com/new"}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	songs, err := s.GetAll(ctx, models.Filters{Song: "Madness", Limit: 10})
+	if err != nil {
+		t.Fatalf("GetAll: %v", err)
+	}
+	want := song
+	want.Link = "https://example.com/new"
+	if len(songs) != 1 || songs[0] != want {
+		t.Errorf("updated song = %+v, want %+v", songs, want)
+	}
+
+	// Every field can change at once, including the title and the group.
+	want = models.Song{Id: song.Id, Song: "Resistance", Group: "MUSE", Text: "Love is our resistance", Link: "https://example.com/resistance", Date: "14.09.2009"}
+	if err := s.Update(ctx, want); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	songs, err = s.GetAll(ctx, models.Filters{Song: "Resistance", Limit: 10})
+	if err != nil {
+		t.Fatalf("GetAll: %v", err)
+	}
+	if len(songs) != 1 || songs[0] != want {
+		t.Errorf("updated song = %+v, want %+v", songs, want)
+	}
+
+	history, err := s.GetHistory(ctx, song.Id, 10, 0)
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+	if len(history) != 3 {
+		t.Fatalf("got %d revisions, want create and two updates", len(history))
+	}
+	last := history[0]
+	if last.Action != models.RevisionUpdate || last.Before == nil || last.Before.Song != "Madness" || last.After == nil || *last.After != want {
+		t.Errorf("update revision = %+v, want the states before and after", last)
+	}
+
+	// Taking the title of another song of the group fails and changes nothing.
+	other := add(t, s, models.Song{Song: "Exogenesis", Group: "MUSE"})[0]
+	if err := s.Update(ctx, models.Song{Id: other.Id, Song: "Resistance"}); err == nil {
+		t.Error("Update to a duplicate title succeeded, want an error")
+	}
+	songs, err = s.GetAll(ctx, models.Filters{Group: "MUSE", Limit: 10})
+	if err != nil {
+		t.Fatalf("GetAll: %v", err)
+	}
+	if got := names(songs); !equalSet(got, []string{"Resistance", "Exogenesis"}) {
+		t.Errorf("songs after a failed update = %q, want both unchanged", got)
+	}
+
+	if err := s.Update(ctx, models.Song{Id: song.Id + 1000, Text: "x"}); err == nil {
+		t.Error("Update of a missing song succeeded, want an error")
+	}
+
+	if err := s.Delete(ctx, song.Id); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := s.Update(ctx, models.Song{Id: song.Id, Text: "x"}); err == nil {
+		t.Error("Update of a deleted song succeeded, want an error")
+	}
+}
+
+func testGetText(t *testing.T, s storage.Storer) {
+	songs := add(t, s,
+		models.Song{Song: "Time Is Running Out", Group: "Muse", Text: "one\ntwo\nthree\nfour"},
+		models.Song{Song: "Instrumental", Group: "Muse"},
+	)
+	song, empty := songs[0], songs[1]
+
+	// The text is paginated by verses, the lines of the text.
+	tests := []struct {
+		name    string
+		id      int
+		filters models.Filters
+		want    string
+	}{
+		{"first page", song.Id, models.Filters{Limit: 2}, "one\ntwo"},
+		{"middle", song.Id, models.Filters{Limit: 2, Offset: 1}, "two\nthree"},
+		{"last page", song.Id, models.Filters{Limit: 2, Offset: 2}, "three\nfour"},
+		{"limit past the end", song.Id, models.Filters{Limit: 10, Offset: 3}, "four"},
+		{"offset at the end", song.Id, models.Filters{Limit: 2, Offset: 4}, ""},
+		{"offset past the end", song.Id, models.Filters{Limit: 2, Offset: 100}, ""},
+		{"zero limit", song.Id, models.Filters{Offset: 1}, ""},
+		{"empty text", empty.Id, models.Filters{Limit: 2}, ""},
+		{"empty text with offset", empty.Id, models.Filters{Limit: 2, Offset: 1}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, err := s.GetText(ctx, tt.filters, tt.id)
+			if err != nil {
+				t.Fatalf("GetText: %v", err)
+			}
+			if text != tt.want {
+				t.Errorf("GetText(limit %d, offset %d) = %q, want %q", tt.filters.Limit, tt.filters.Offset, text, tt.want)
+			}
+		})
+	}
+
+	if _, err := s.GetText(ctx, models.Filters{Limit: 2}, song.Id+1000); err == nil {
+		t.Error("GetText of a missing song succeeded, want an error")
+	}
+	if err := s.Delete(ctx, song.Id); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := s.GetText(ctx, models.Filters{Limit: 2}, song.Id); err == nil {
+		t.Error("GetText of a deleted song succeeded, want an error")
+	}
+}
+
+func testExport(t *testing.T, s storage.Storer) {
+	songs := add(t, s,
+		models.Song{Song: "Map of the Problematique", Group: "Muse", Text: "Fear and panic in the air"},
+		models.Song{Song: "Кукушка", Group: "Кино", Text: "Песен ещё ненаписанных сколько"},
+		models.Song{Song: "Assassin", Group: "Muse", Text: "Oppose and disagree"},
+		models.Song{Song: "Unintended", Group: "Muse"},
+	)
+	if err := s.Delete(ctx, songs[3].Id); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	export := func(filters models.Filters) []models.Song {
+		t.Helper()
+		var got []models.Song
+		err := s.Export(ctx, filters, func(song models.Song) error {
+			got = append(got, song)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Export: %v", err)
+		}
+		return got
+	}
+
+	// Songs come in id order and without the trash, a zero limit exports all.
+	got := export(models.Filters{})
+	if len(got) != 3 || got[0] != songs[0] || got[1] != songs[1] || got[2] != songs[2] {
+		t.Errorf("Export = %+v, want the active songs in id order", got)
+	}
+
+	tests := []struct {
+		name    string
+		filters models.Filters
+		want    []string
+	}{
+		{"filters", models.Filters{Group: "muse"}, []string{"Map of the Problematique", "Assassin"}},
+		{"lyrics", models.Filters{Text: "ненаписанных"}, []string{"Кукушка"}},
+		{"limit", models.Filters{Limit: 2}, []string{"Map of the Problematique", "Кукушка"}},
+		{"offset", models.Filters{Offset: 1}, []string{"Кукушка", "Assassin"}},
+		{"offset past the end", models.Filters{Offset: 3}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := names(export(tt.filters))
+			if len(got) != len(tt.want) {
+				t.Fatalf("Export(%+v) = %q, want %q", tt.filters, got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("Export(%+v) = %q, want %q", tt.filters, got, tt.want)
+				}
+			}
+		})
+	}
+
+	// An error of fn stops the export and is returned as is.
+	stop := errors.New("stop")
+	calls := 0
+	err := s.Export(ctx, models.Filters{}, func(models.Song) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) {
+		t.Errorf("Export = %v, want the error of fn", err)
+	}
+	if calls != 1 {
+		t.Errorf("fn called %d times after its error, want once", calls)
+	}
+}
@@ -0,0 +1,104 @@
+// Package storetest checks that a storage.Storer implementation behaves like
+// the others. Backends call Run from their own tests.
+package storetest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/SemenShakhray/list-of-song/internal/models"
+	"github.com/SemenShakhray/list-of-song/internal/storage"
+)
+
+// NewStore returns an empty store for one test. It registers the clean-up of
+// the store with t.Cleanup.
+type NewStore func(t *testing.T) storage.Storer
+
+// Run runs every conformance test against stores made by newStore.
+func Run(t *testing.T, newStore NewStore) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s storage.Storer)
+	}{
+		{"AddSong", testAddSong},
+		{"AddSongDuplicate", testAddSongDuplicate},
+		{"GetAllFilters", testGetAllFilters},
+		{"GetAllPagination", testGetAllPagination},
+		{"Update", testUpdate},
+		{"GetText", testGetText},
+		{"Export", testExport},
+		{"DeleteAndRestore", testDeleteAndRestore},
+		{"GetTrash", testGetTrash},
+		{"Purge", testPurge},
+		{"HistoryAndRevert", testHistoryAndRevert},
+		{"HistoryPagination", testHistoryPagination},
+		{"GetRevision", testGetRevision},
+		{"RevertErrors", testRevertErrors},
+		{"WithTxCommit", testWithTxCommit},
+		{"WithTxRollback", testWithTxRollback},
+		{"WithTxNested", testWithTxNested},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStore(t))
+		})
+	}
+}
+
+var ctx = context.Background()
+
+// add stores songs and returns them with their ids, in the order given.
+func add(t *testing.T, s storage.Storer, songs ...models.Song) []models.Song {
+	t.Helper()
+	for _, song := range songs {
+		if err := s.AddSong(ctx, song); err != nil {
+			t.Fatalf("AddSong(%q, %q): %v", song.Song, song.Group, err)
+		}
+	}
+
+	all, err := s.GetAll(ctx, models.Filters{Limit: 1000})
+	if err != nil {
+		t.Fatalf("GetAll: %v", err)
+	}
+	added := make([]models.Song, len(songs))
+	for i, song := range songs {
+		found := false
+		for _, stored := range all {
+			if stored.Song == song.Song && stored.Group == song.Group {
+				added[i], found = stored, true
+				break
+			}
+		}
+		if !found {
+			t.Fatalf("song %q of %q was not stored", song.Song, song.Group)
+		}
+	}
+	return added
+}
+
+// names returns the titles of songs.
+func names(songs []models.Song) []string {
+	list := make([]string, len(songs))
+	for i, song := range songs {
+		list[i] = song.Song
+	}
+	return list
+}
+
+// equalSet reports whether got and want hold the same strings in any order.
+func equalSet(got, want []string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	count := make(map[string]int)
+	for _, s := range got {
+		count[s]++
+	}
+	for _, s := range want {
+		if count[s] == 0 {
+			return false
+		}
+		count[s]--
+	}
+	return true
+}
@@ -0,0 +1,193 @@
+package storetest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SemenShakhray/list-of-song/internal/models"
+	"github.com/SemenShakhray/list-of-song/internal/storage"
+)
+
+func testDeleteAndRestore(t *testing.T, s storage.Storer) {
+	songs := add(t, s,
+		models.Song{Song: "Plug In Baby", Group: "Muse"},
+		models.Song{Song: "Bliss", Group: "Muse"},
+	)
+	id := songs[0].Id
+
+	if err := s.Delete(ctx, id); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	active, err := s.GetAll(ctx, models.Filters{Limit: 10})
+	if err != nil {
+		t.Fatalf("GetAll: %v", err)
+	}
+	if got := names(active); !equalSet(got, []string{"Bliss"}) {
+		t.Errorf("songs after delete = %q, want only Bliss", got)
+	}
+
+	trash, err := s.GetTrash(ctx, models.Filters{Limit: 10})
+	if err != nil {
+		t.Fatalf("GetTrash: %v", err)
+	}
+	if len(trash) != 1 || trash[0].Id != id || trash[0].DeletedAt == nil {
+		t.Errorf("trash = %+v, want the deleted song with its deletion time", trash)
+	}
+
+	if err := s.Delete(ctx, id); err == nil {
+		t.Error("second Delete succeeded, want an error")
+	}
+	if err := s.Delete(ctx, id+1000); err == nil {
+		t.Error("Delete of a missing song succeeded, want an error")
+	}
+
+	if err := s.Restore(ctx, id); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	active, err = s.GetAll(ctx, models.Filters{Limit: 10})
+	if err != nil {
+		t.Fatalf("GetAll: %v", err)
+	}
+	if got := names(active); !equalSet(got, []string{"Plug In Baby", "Bliss"}) {
+		t.Errorf("songs after restore = %q, want both", got)
+	}
+	if err := s.Restore(ctx, id); err == nil {
+		t.Error("Restore of a song not in the trash succeeded, want an error")
+	}
+}
+
+func testGetTrash(t *testing.T, s storage.Storer) {
+	songs := add(t, s,
+		models.Song{Song: "Sunburn", Group: "Muse", Text: "She burns like the sun"},
+		models.Song{Song: "Muscle Museum", Group: "Muse"},
+		models.Song{Song: "Кончится лето", Group: "Кино"},
+		models.Song{Song: "Showbiz", Group: "Muse"},
+	)
+	for _, song := range songs[:3] {
+		if err := s.Delete(ctx, song.Id); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		// The trash is ordered by the deletion time, so it must differ.
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The most recently deleted song comes first.
+	trash, err := s.GetTrash(ctx, models.Filters{Limit: 10})
+	if err != nil {
+		t.Fatalf("GetTrash: %v", err)
+	}
+	want := []string{"Кончится лето", "Muscle Museum", "Sunburn"}
+	if got := names(trash); len(got) != 3 || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Fatalf("GetTrash = %q, want %q", got, want)
+	}
+	for i, song := range trash {
+		if song.DeletedAt == nil {
+			t.Fatalf("deleted song %q has no deletion time", song.Song)
+		}
+		if i > 0 && !song.DeletedAt.Before(*trash[i-1].DeletedAt) {
+			t.Errorf("%q deleted at %v is not older than %q deleted at %v", song.Song, song.DeletedAt, trash[i-1].Song, trash[i-1].DeletedAt)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		filters models.Filters
+		want    []string
+	}{
+		{"group", models.Filters{Group: "muse", Limit: 10}, []string{"Muscle Museum", "Sunburn"}},
+		{"lyrics", models.Filters{Text: "BURNS", Limit: 10}, []string{"Sunburn"}},
+		{"page", models.Filters{Limit: 1, Offset: 1}, []string{"Muscle Museum"}},
+		{"past the end", models.Filters{Limit: 10, Offset: 3}, nil},
+		{"active songs", models.Filters{Song: "Showbiz", Limit: 10}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trash, err := s.GetTrash(ctx, tt.filters)
+			if err != nil {
+				t.Fatalf("GetTrash: %v", err)
+			}
+			if got := names(trash); !equalSet(got, tt.want) {
+				t.Errorf("GetTrash(%+v) = %q, want %q", tt.filters, got, tt.want)
+			}
+		})
+	}
+}
+
+func testPurge(t *testing.T, s storage.Storer) {
+	songs := add(t, s,
+		models.Song{Song: "Falling Down", Group: "Muse"},
+		models.Song{Song: "Cave", Group: "Muse"},
+		models.Song{Song: "Showbiz", Group: "Muse"},
+	)
+	old, recent := songs[0], songs[1]
+
+	n, err := s.Purge(ctx, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Purge: %v", err)
+	}
+	if n != 0 {
+		t.Errorf("Purge with an empty trash removed %d songs, want 0", n)
+	}
+
+	if err := s.Delete(ctx, old.Id); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if err := s.Delete(ctx, recent.Id); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	trash, err := s.GetTrash(ctx, models.Filters{Limit: 10})
+	if err != nil {
+		t.Fatalf("GetTrash: %v", err)
+	}
+	if len(trash) != 2 {
+		t.Fatalf("got %d songs in the trash, want 2", len(trash))
+	}
+	// The cut-off lies between the two deletions as the store recorded them,
+	// so the clocks of the test and the database do not matter.
+	newer, older := *trash[0].DeletedAt, *trash[1].DeletedAt
+	cutoff := older.Add(newer.Sub(older) / 2)
+
+	n, err = s.Purge(ctx, older)
+	if err != nil {
+		t.Fatalf("Purge: %v", err)
+	}
+	if n != 0 {
+		t.Errorf("Purge at the deletion time removed %d songs, want 0", n)
+	}
+
+	n, err = s.Purge(ctx, cutoff)
+	if err != nil {
+		t.Fatalf("Purge: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("Purge removed %d songs, want 1", n)
+	}
+	trash, err = s.GetTrash(ctx, models.Filters{Limit: 10})
+	if err != nil {
+		t.Fatalf("GetTrash: %v", err)
+	}
+	if got := names(trash); !equalSet(got, []string{"Cave"}) {
+		t.Errorf("trash after purge = %q, want only the recently deleted song", got)
+	}
+
+	// A purged song is gone for good, active songs are never purged.
+	if err := s.Restore(ctx, old.Id); err == nil {
+		t.Error("Restore of a purged song succeeded, want an error")
+	}
+	n, err = s.Purge(ctx, newer.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Purge: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("Purge removed %d songs, want 1", n)
+	}
+	active, err := s.GetAll(ctx, models.Filters{Limit: 10})
+	if err != nil {
+		t.Fatalf("GetAll: %v", err)
+	}
+	if got := names(active); !equalSet(got, []string{"Showbiz"}) {
+		t.Errorf("active songs after purge = %q, want Showbiz", got)
+	}
+}
@@ -0,0 +1,170 @@
+package storetest
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/SemenShakhray/list-of-song/internal/models"
+	"github.com/SemenShakhray/list-of-song/internal/storage"
+)
+
+var errRollback = errors.New("rollback")
+
+func testWithTxCommit(t *testing.T, s storage.Storer) {
+	song := add(t, s, models.Song{Song: "Apocalypse Please", Group: "Muse", Text: "old"})[0]
+
+	err := s.WithTx(ctx, func(tx storage.Storer) error {
+		if err := tx.AddSong(ctx, models.Song{Song: "Butterflies and Hurricanes", Group: "Muse"}); err != nil {
+			return err
+		}
+		// Changes are visible inside the transaction before the commit.
+		songs, err := tx.GetAll(ctx, models.Filters{Song: "Butterflies", Limit: 10})
+		if err != nil {
+			return err
+		}
+		if len(songs) != 1 {
+			t.Errorf("got %d added songs inside the transaction, want 1", len(songs))
+		}
+		return tx.Update(ctx, models.Song{Id: song.Id, Text: "new"})
+	})
+	if err != nil {
+		t.Fatalf("WithTx: %v", err)
+	}
+
+	songs, err := s.GetAll(ctx, models.Filters{Limit: 10})
+	if err != nil {
+		t.Fatalf("GetAll: %v", err)
+	}
+	if got := names(songs); !equalSet(got, []string{"Apocalypse Please", "Butterflies and Hurricanes"}) {
+		t.Errorf("songs after commit = %q, want both", got)
+	}
+	text, err := s.GetText(ctx, models.Filters{Limit: 10}, song.Id)
+	if err != nil {
+		t.Fatalf("GetText: %v", err)
+	}
+	if text != "new" {
+		t.Errorf("text after commit = %q, want %q", text, "new")
+	}
+}
+
+func testWithTxRollback(t *testing.T, s storage.Storer) {
+	song := add(t, s, models.Song{Song: "Stockholm Syndrome", Group: "Muse", Text: "old"})[0]
+
+	err := s.WithTx(ctx, func(tx storage.Storer) error {
+		if err := tx.AddSong(ctx, models.Song{Song: "Thoughts of a Dying Atheist", Group: "Muse"}); err != nil {
+			return err
+		}
+		if err := tx.Update(ctx, models.Song{Id: song.Id, Text: "new"}); err != nil {
+			return err
+		}
+		if err := tx.Delete(ctx, song.Id); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("WithTx = %v, want the error of fn", err)
+	}
+
+	// Nothing of the transaction is left, its revisions included.
+	songs, err := s.GetAll(ctx, models.Filters{Limit: 10})
+	if err != nil {
+		t.Fatalf("GetAll: %v", err)
+	}
+	if got := names(songs); !equalSet(got, []string{"Stockholm Syndrome"}) {
+		t.Errorf("songs after rollback = %q, want only the song added before", got)
+	}
+	text, err := s.GetText(ctx, models.Filters{Limit: 10}, song.Id)
+	if err != nil {
+		t.Fatalf("GetText: %v", err)
+	}
+	if text != "old" {
+		t.Errorf("text after rollback = %q, want %q", text, "old")
+	}
+	history, err := s.GetHistory(ctx, song.Id, 10, 0)
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+	if len(history) != 1 {
+		t.Errorf("got %d revisions after rollback, want only the create revision", len(history))
+	}
+
+	// A failed store call rolls back the calls before it.
+	err = s.WithTx(ctx, func(tx storage.Storer) error {
+		if err := tx.Update(ctx, models.Song{Id: song.Id, Text: "new"}); err != nil {
+			return err
+		}
+		return tx.Delete(ctx, song.Id+1000)
+	})
+	if err == nil {
+		t.Fatal("WithTx with a failed Delete succeeded, want an error")
+	}
+	text, err = s.GetText(ctx, models.Filters{Limit: 10}, song.Id)
+	if err != nil {
+		t.Fatalf("GetText: %v", err)
+	}
+	if text != "old" {
+		t.Errorf("text after a failed call = %q, want %q", text, "old")
+	}
+}
+
+func testWithTxNested(t *testing.T, s storage.Storer) {
+	// A nested WithTx joins the outer transaction, so its changes are
+	// committed or rolled back with the outer ones.
+	nested := func(outerErr error) error {
+		return s.WithTx(ctx, func(tx storage.Storer) error {
+			if err := tx.AddSong(ctx, models.Song{Song: "Outer", Group: "Nested"}); err != nil {
+				return err
+			}
+			err := tx.WithTx(ctx, func(inner storage.Storer) error {
+				return inner.AddSong(ctx, models.Song{Song: "Inner", Group: "Nested"})
+			})
+			if err != nil {
+				return err
+			}
+			return outerErr
+		})
+	}
+
+	if err := nested(errRollback); !errors.Is(err, errRollback) {
+		t.Fatalf("WithTx = %v, want the error of fn", err)
+	}
+	songs, err := s.GetAll(ctx, models.Filters{Group: "Nested", Limit: 10})
+	if err != nil {
+		t.Fatalf("GetAll: %v", err)
+	}
+	if len(songs) != 0 {
+		t.Errorf("songs after the outer rollback = %q, want none", names(songs))
+	}
+
+	if err := nested(nil); err != nil {
+		t.Fatalf("WithTx: %v", err)
+	}
+	songs, err = s.GetAll(ctx, models.Filters{Group: "Nested", Limit: 10})
+	if err != nil {
+		t.Fatalf("GetAll: %v", err)
+	}
+	if got := names(songs); !equalSet(got, []string{"Outer", "Inner"}) {
+		t.Errorf("songs after the outer commit = %q, want both", got)
+	}
+
+	// An error of the nested transaction fails the outer one.
+	err = s.WithTx(ctx, func(tx storage.Storer) error {
+		if err := tx.Update(ctx, models.Song{Id: songs[0].Id, Text: "changed"}); err != nil {
+			return err
+		}
+		return tx.WithTx(ctx, func(storage.Storer) error {
+			return errRollback
+		})
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("WithTx = %v, want the error of the nested fn", err)
+	}
+	text, err := s.GetText(ctx, models.Filters{Limit: 10}, songs[0].Id)
+	if err != nil {
+		t.Fatalf("GetText: %v", err)
+	}
+	if text != "" {
+		t.Errorf("text after the nested rollback = %q, want it unchanged", text)
+	}
+}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// TxOptions controls how WithTx runs a transaction.
+type TxOptions struct {
+	Isolation sql.IsolationLevel
+	ReadOnly  bool
+	// MaxRetries is how many times a transaction that failed with a
+	// serialization failure or deadlock is run again.
+	MaxRetries int
+}
+
+type TxOption func(*TxOptions)
+
+func WithIsolation(level sql.IsolationLevel) TxOption {
+	return func(o *TxOptions) {
+		o.Isolation = level
+	}
+}
+
+func WithReadOnly() TxOption {
+	return func(o *TxOptions) {
+		o.ReadOnly = true
+	}
+}
+
+func WithRetries(n int) TxOption {
+	return func(o *TxOptions) {
+		o.MaxRetries = n
+	}
+}
+
+// Apply returns a copy of o with opts applied.
+func (o TxOptions) Apply(opts ...TxOption) TxOptions {
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// ParseIsolation converts an SQL isolation level name such as
+// "read committed" or "serializable" to sql.IsolationLevel. An empty string
+// selects the database default.
+func ParseIsolation(name string) (sql.IsolationLevel, error) {
+	switch strings.ToLower(strings.Join(strings.Fields(strings.ReplaceAll(name, "_", " ")), " ")) {
+	case "", "default":
+		return sql.LevelDefault, nil
+	case "read uncommitted":
+		return sql.LevelReadUncommitted, nil
+	case "read committed":
+		return sql.LevelReadCommitted, nil
+	case "repeatable read":
+		return sql.LevelRepeatableRead, nil
+	case "serializable":
+		return sql.LevelSerializable, nil
+	}
+	return sql.LevelDefault, fmt.Errorf("unknown isolation level: %q", name)
+}
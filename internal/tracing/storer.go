@@ -0,0 +1,126 @@
+package tracing
+
+import (
+	"context"
+	"time"
+
+	"github.com/SemenShakhray/list-of-song/internal/models"
+	"github.com/SemenShakhray/list-of-song/internal/storage"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/SemenShakhray/list-of-song/internal/storage")
+
+// storer starts a span for every method of the wrapped Storer, the SQL
+// statements run by the method become its children.
+type storer struct {
+	next storage.Storer
+}
+
+// Storer wraps next so that its calls are traced.
+func Storer(next storage.Storer) storage.Storer {
+	return &storer{next: next}
+}
+
+func (s *storer) start(ctx context.Context, method string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "Storer."+method, trace.WithAttributes(attrs...))
+}
+
+func (s *storer) GetAll(ctx context.Context, filters models.Filters) ([]models.Song, error) {
+	ctx, span := s.start(ctx, "GetAll", attribute.Int("limit", filters.Limit), attribute.Int("offset", filters.Offset))
+	songs, err := s.next.GetAll(ctx, filters)
+	span.SetAttributes(attribute.Int("songs", len(songs)))
+	End(span, err)
+	return songs, err
+}
+
+func (s *storer) AddSong(ctx context.Context, song models.Song) error {
+	ctx, span := s.start(ctx, "AddSong")
+	err := s.next.AddSong(ctx, song)
+	End(span, err)
+	return err
+}
+
+func (s *storer) Update(ctx context.Context, song models.Song) error {
+	ctx, span := s.start(ctx, "Update", attribute.Int("song.id", song.Id))
+	err := s.next.Update(ctx, song)
+	End(span, err)
+	return err
+}
+
+func (s *storer) Delete(ctx context.Context, id int) error {
+	ctx, span := s.start(ctx, "Delete", attribute.Int("song.id", id))
+	err := s.next.Delete(ctx, id)
+	End(span, err)
+	return err
+}
+
+func (s *storer) GetText(ctx context.Context, filters models.Filters, id int) (string, error) {
+	ctx, span := s.start(ctx, "GetText", attribute.Int("song.id", id))
+	text, err := s.next.GetText(ctx, filters, id)
+	End(span, err)
+	return text, err
+}
+
+func (s *storer) Export(ctx context.Context, filters models.Filters, fn func(models.Song) error) error {
+	ctx, span := s.start(ctx, "Export")
+	err := s.next.Export(ctx, filters, fn)
+	End(span, err)
+	return err
+}
+
+func (s *storer) GetTrash(ctx context.Context, filters models.Filters) ([]models.Song, error) {
+	ctx, span := s.start(ctx, "GetTrash")
+	songs, err := s.next.GetTrash(ctx, filters)
+	End(span, err)
+	return songs, err
+}
+
+func (s *storer) Restore(ctx context.Context, id int) error {
+	ctx, span := s.start(ctx, "Restore", attribute.Int("song.id", id))
+	err := s.next.Restore(ctx, id)
+	End(span, err)
+	return err
+}
+
+func (s *storer) Purge(ctx context.Context, before time.Time) (int64, error) {
+	ctx, span := s.start(ctx, "Purge")
+	n, err := s.next.Purge(ctx, before)
+	span.SetAttributes(attribute.Int64("songs", n))
+	End(span, err)
+	return n, err
+}
+
+func (s *storer) GetHistory(ctx context.Context, id int, limit, offset int) ([]models.Revision, error) {
+	ctx, span := s.start(ctx, "GetHistory", attribute.Int("song.id", id))
+	revisions, err := s.next.GetHistory(ctx, id, limit, offset)
+	End(span, err)
+	return revisions, err
+}
+
+func (s *storer) GetRevision(ctx context.Context, id int, revision int) (models.Revision, error) {
+	ctx, span := s.start(ctx, "GetRevision", attribute.Int("song.id", id), attribute.Int("song.revision", revision))
+	rev, err := s.next.GetRevision(ctx, id, revision)
+	End(span, err)
+	return rev, err
+}
+
+func (s *storer) Revert(ctx context.Context, id int, revision int) error {
+	ctx, span := s.start(ctx, "Revert", attribute.Int("song.id", id), attribute.Int("song.revision", revision))
+	err := s.next.Revert(ctx, id, revision)
+	End(span, err)
+	return err
+}
+
+// WithTx traces the whole transaction and the calls made inside it.
+func (s *storer) WithTx(ctx context.Context, fn func(storage.Storer) error, opts ...storage.TxOption) error {
+	ctx, span := s.start(ctx, "WithTx")
+	err := s.next.WithTx(ctx, func(tx storage.Storer) error {
+		return fn(&storer{next: tx})
+	}, opts...)
+	End(span, err)
+	return err
+}
@@ -0,0 +1,34 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS song_revisions (
+    song_id INT NOT NULL,
+    revision INT NOT NULL,
+    action TEXT NOT NULL,
+    before JSONB,
+    after JSONB,
+    actor TEXT NOT NULL DEFAULT '',
+    request_id TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (song_id, revision)
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION song_revisions_immutable() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'song revisions are immutable';
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER song_revisions_immutable
+    BEFORE UPDATE OR DELETE ON song_revisions
+    FOR EACH ROW EXECUTE FUNCTION song_revisions_immutable();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS song_revisions;
+DROP FUNCTION IF EXISTS song_revisions_immutable();
+-- +goose StatementEnd
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION notify_song_event() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('song_events', NEW.id::text);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER song_events_notify AFTER INSERT ON song_events
+    FOR EACH ROW EXECUTE FUNCTION notify_song_event();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS song_events_notify ON song_events;
+DROP FUNCTION IF EXISTS notify_song_event();
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE songs DROP CONSTRAINT IF EXISTS songs_song_group_name_key;
+CREATE UNIQUE INDEX IF NOT EXISTS songs_active_title_idx ON songs (song, group_name) WHERE deleted_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS songs_active_title_idx;
+ALTER TABLE songs ADD CONSTRAINT songs_song_group_name_key UNIQUE (song, group_name);
+-- +goose StatementEnd
@@ -0,0 +1,170 @@
+package logger
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Levels is the base level of a logger and the levels overriding it for
+// named loggers. A logger named "app.postgres" takes the level of
+// "postgres", then of "app", then the base level.
+type Levels struct {
+	base zap.AtomicLevel
+
+	mu       sync.RWMutex
+	packages map[string]zap.AtomicLevel
+}
+
+// NewLevels parses the base level and the per package levels. An empty base
+// level means info.
+func NewLevels(base string, packages map[string]string) (*Levels, error) {
+	l := &Levels{
+		base:     zap.NewAtomicLevel(),
+		packages: make(map[string]zap.AtomicLevel),
+	}
+	if err := l.Set("", base); err != nil {
+		return nil, err
+	}
+	for name, level := range packages {
+		if err := l.Set(name, level); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// Set changes the level of the named package, or the base level when name is
+// empty. An empty level removes the override of a package.
+func (l *Levels) Set(name, level string) error {
+	if name == "" {
+		lvl, err := parseLevel(level)
+		if err != nil {
+			return err
+		}
+		l.base.SetLevel(lvl)
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if level == "" {
+		delete(l.packages, name)
+		return nil
+	}
+	lvl, err := parseLevel(level)
+	if err != nil {
+		return err
+	}
+	if atomic, ok := l.packages[name]; ok {
+		atomic.SetLevel(lvl)
+	} else {
+		l.packages[name] = zap.NewAtomicLevelAt(lvl)
+	}
+	return nil
+}
+
+// SetPackages replaces all per package levels with packages.
+func (l *Levels) SetPackages(packages map[string]string) error {
+	parsed := make(map[string]zapcore.Level, len(packages))
+	for name, level := range packages {
+		lvl, err := parseLevel(level)
+		if err != nil {
+			return err
+		}
+		parsed[name] = lvl
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for name := range l.packages {
+		if _, ok := parsed[name]; !ok {
+			delete(l.packages, name)
+		}
+	}
+	for name, lvl := range parsed {
+		if atomic, ok := l.packages[name]; ok {
+			atomic.SetLevel(lvl)
+		} else {
+			l.packages[name] = zap.NewAtomicLevelAt(lvl)
+		}
+	}
+	return nil
+}
+
+// Base returns the base level.
+func (l *Levels) Base() zapcore.Level {
+	return l.base.Level()
+}
+
+// Packages returns the per package levels.
+func (l *Levels) Packages() map[string]zapcore.Level {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	packages := make(map[string]zapcore.Level, len(l.packages))
+	for name, atomic := range l.packages {
+		packages[name] = atomic.Level()
+	}
+	return packages
+}
+
+// enabled reports whether the logger with the given name writes entries of lvl.
+func (l *Levels) enabled(name string, lvl zapcore.Level) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if len(l.packages) > 0 && name != "" {
+		parts := strings.Split(name, ".")
+		for i := len(parts) - 1; i >= 0; i-- {
+			if atomic, ok := l.packages[parts[i]]; ok {
+				return atomic.Enabled(lvl)
+			}
+		}
+	}
+	return l.base.Enabled(lvl)
+}
+
+// min returns the lowest level any logger writes.
+func (l *Levels) min() zapcore.Level {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	lvl := l.base.Level()
+	for _, atomic := range l.packages {
+		lvl = min(lvl, atomic.Level())
+	}
+	return lvl
+}
+
+func parseLevel(level string) (zapcore.Level, error) {
+	if level == "" {
+		return zapcore.InfoLevel, nil
+	}
+	lvl, err := zapcore.ParseLevel(level)
+	if err != nil {
+		return lvl, fmt.Errorf("unknown log level: %q", level)
+	}
+	return lvl, nil
+}
+
+// levelCore filters entries by the level of the logger that wrote them.
+type levelCore struct {
+	zapcore.Core
+	levels *Levels
+}
+
+func (c *levelCore) Enabled(lvl zapcore.Level) bool {
+	return lvl >= c.levels.min()
+}
+
+func (c *levelCore) With(fields []zapcore.Field) zapcore.Core {
+	return &levelCore{Core: c.Core.With(fields), levels: c.levels}
+}
+
+func (c *levelCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.levels.enabled(ent.LoggerName, ent.Level) {
+		return ce
+	}
+	return c.Core.Check(ent, ce)
+}
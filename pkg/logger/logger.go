@@ -1,27 +1,141 @@
 package logger
 
 import (
+	"context"
+	"fmt"
 	"os"
+	"time"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
-var log *zap.Logger
+// Formats.
+const (
+	FormatConsole = "console"
+	FormatJSON    = "json"
+)
 
-func NewLogger() *zap.Logger {
-	stdout := zapcore.AddSync(os.Stdout)
+// Outputs.
+const (
+	OutputStdout = "stdout"
+	OutputFile   = "file"
+)
 
-	level := zap.NewAtomicLevelAt(zapcore.DebugLevel)
+// log backs the package level helpers, it is replaced by New.
+var log = zap.NewNop()
 
-	developmentCfg := zap.NewDevelopmentEncoderConfig()
-	developmentCfg.EncodeLevel = zapcore.CapitalColorLevelEncoder
+// Options describe the logger built by New.
+type Options struct {
+	// Level is debug, info, warn or error.
+	Level string
+	// Levels overrides Level for logger names such as postgres or handlers.
+	Levels map[string]string
+	// Format is console or json.
+	Format string
+	// Outputs are the sinks of the log: stdout, the default, and file.
+	Outputs []string
+	File    File
+	// SamplingInitial entries with the same level and message are written
+	// every second, then only every SamplingThereafter-th. Zero disables sampling.
+	SamplingInitial    int
+	SamplingThereafter int
+}
+
+// File is a log file rotated when it reaches MaxSizeMB.
+type File struct {
+	Path       string
+	MaxSizeMB  int
+	MaxBackups int
+	MaxAgeDays int
+	Compress   bool
+}
 
-	consoleEncoder := zapcore.NewConsoleEncoder(developmentCfg)
+// New builds the logger described by cfg and makes it the logger of the
+// package level helpers. Components name their loggers with Named, the
+// returned Levels change the level of the whole logger or of one name at
+// runtime.
+func New(cfg Options) (*zap.Logger, *Levels, error) {
+	levels, err := NewLevels(cfg.Level, cfg.Levels)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	core := zapcore.NewTee(zapcore.NewCore(consoleEncoder, stdout, level))
+	if len(cfg.Outputs) == 0 {
+		cfg.Outputs = []string{OutputStdout}
+	}
+	var cores []zapcore.Core
+	for _, output := range cfg.Outputs {
+		var (
+			sink  zapcore.WriteSyncer
+			color bool
+		)
+		switch output {
+		case OutputStdout:
+			sink, color = zapcore.Lock(os.Stdout), true
+		case OutputFile:
+			sink = zapcore.AddSync(&lumberjack.Logger{
+				Filename:   cfg.File.Path,
+				MaxSize:    cfg.File.MaxSizeMB,
+				MaxBackups: cfg.File.MaxBackups,
+				MaxAge:     cfg.File.MaxAgeDays,
+				Compress:   cfg.File.Compress,
+			})
+		default:
+			return nil, nil, fmt.Errorf("unknown log output: %q", output)
+		}
+
+		encoder, err := newEncoder(cfg.Format, color)
+		if err != nil {
+			return nil, nil, err
+		}
+		// Levels are checked by levelCore, the sinks take everything.
+		cores = append(cores, zapcore.NewCore(encoder, sink, zapcore.DebugLevel))
+	}
+
+	core := zapcore.NewTee(cores...)
+	if cfg.SamplingInitial > 0 {
+		core = zapcore.NewSamplerWithOptions(core, time.Second, cfg.SamplingInitial, cfg.SamplingThereafter)
+	}
+
+	log = zap.New(&levelCore{Core: core, levels: levels})
+	return log, levels, nil
+}
 
-	return zap.New(core)
+func newEncoder(format string, color bool) (zapcore.Encoder, error) {
+	switch format {
+	case "", FormatConsole:
+		encoderCfg := zap.NewDevelopmentEncoderConfig()
+		if color {
+			encoderCfg.EncodeLevel = zapcore.CapitalColorLevelEncoder
+		}
+		return zapcore.NewConsoleEncoder(encoderCfg), nil
+	case FormatJSON:
+		encoderCfg := zap.NewProductionEncoderConfig()
+		encoderCfg.EncodeTime = zapcore.ISO8601TimeEncoder
+		return zapcore.NewJSONEncoder(encoderCfg), nil
+	}
+	return nil, fmt.Errorf("unknown log format: %q", format)
+}
+
+type fieldsKey struct{}
+
+// WithFields returns a copy of ctx carrying fields in addition to the fields
+// already stored there. Handlers and storage add them to every line they log
+// while serving the request, see FromContext.
+func WithFields(ctx context.Context, fields ...zap.Field) context.Context {
+	prev, _ := ctx.Value(fieldsKey{}).([]zap.Field)
+	return context.WithValue(ctx, fieldsKey{}, append(prev[:len(prev):len(prev)], fields...))
+}
+
+// FromContext returns log with the fields stored in ctx. The logger keeps its
+// name, so per package levels apply to request lines too.
+func FromContext(ctx context.Context, log *zap.Logger) *zap.Logger {
+	if fields, ok := ctx.Value(fieldsKey{}).([]zap.Field); ok {
+		return log.With(fields...)
+	}
+	return log
 }
 
 func Debug(msg string, fields ...zap.Field) {
@@ -36,6 +150,11 @@ func Warn(msg string, fields ...zap.Field) {
 	log.Warn(msg, fields...)
 }
 
+func Error(msg string, fields ...zap.Field) {
+	log.Error(msg, fields...)
+}
+
+// Deprecated: use Error.
 func Erorr(msg string, fields ...zap.Field) {
 	log.Error(msg, fields...)
 }
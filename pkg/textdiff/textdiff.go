@@ -0,0 +1,270 @@
+// Package textdiff computes line and word level differences between texts.
+package textdiff
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// The diff of n and m items takes n*m memory, texts with more lines or lines
+// with more words are not compared.
+const (
+	MaxLines = 2000
+	MaxWords = 2000
+)
+
+// ErrTooLarge is returned when a text has more than MaxLines lines or a line
+// more than MaxWords words.
+var ErrTooLarge = errors.New("text is too large to compare")
+
+type Op string
+
+const (
+	Equal  Op = "equal"
+	Delete Op = "delete"
+	Insert Op = "insert"
+	// Change is a deleted line replaced by an inserted one, Words holds the
+	// word level difference between them.
+	Change Op = "change"
+)
+
+// Line is one line of a diff. OldLine and NewLine are 1-based line numbers,
+// zero when the line does not exist on that side.
+type Line struct {
+	Op      Op     `json:"op"`
+	OldLine int    `json:"old_line,omitempty"`
+	NewLine int    `json:"new_line,omitempty"`
+	Old     string `json:"old,omitempty"`
+	New     string `json:"new,omitempty"`
+	Words   []Word `json:"words,omitempty"`
+}
+
+type Word struct {
+	Op   Op     `json:"op"`
+	Text string `json:"text"`
+}
+
+// Lines returns the line level difference between a and b. Runs of deleted
+// lines directly followed by inserted lines are paired into Change lines, a
+// Change of lines with more than MaxWords words has no Words.
+func Lines(a, b string) ([]Line, error) {
+	oldLines, newLines := splitLines(a), splitLines(b)
+	if len(oldLines) > MaxLines || len(newLines) > MaxLines {
+		return nil, ErrTooLarge
+	}
+	edits := diff(oldLines, newLines)
+
+	var lines []Line
+	oldNo, newNo := 0, 0
+	for i := 0; i < len(edits); {
+		if edits[i] == Equal {
+			oldNo++
+			newNo++
+			lines = append(lines, Line{Op: Equal, OldLine: oldNo, NewLine: newNo, Old: oldLines[oldNo-1], New: newLines[newNo-1]})
+			i++
+			continue
+		}
+
+		var deleted, inserted []int
+		for ; i < len(edits) && edits[i] != Equal; i++ {
+			if edits[i] == Delete {
+				oldNo++
+				deleted = append(deleted, oldNo)
+			} else {
+				newNo++
+				inserted = append(inserted, newNo)
+			}
+		}
+
+		paired := min(len(deleted), len(inserted))
+		for j := 0; j < paired; j++ {
+			o, n := oldLines[deleted[j]-1], newLines[inserted[j]-1]
+			words, _ := Words(o, n)
+			lines = append(lines, Line{Op: Change, OldLine: deleted[j], NewLine: inserted[j], Old: o, New: n, Words: words})
+		}
+		for _, no := range deleted[paired:] {
+			lines = append(lines, Line{Op: Delete, OldLine: no, Old: oldLines[no-1]})
+		}
+		for _, no := range inserted[paired:] {
+			lines = append(lines, Line{Op: Insert, NewLine: no, New: newLines[no-1]})
+		}
+	}
+	return lines, nil
+}
+
+// Words returns the word level difference between a and b, words are
+// separated by white space.
+func Words(a, b string) ([]Word, error) {
+	oldWords, newWords := strings.Fields(a), strings.Fields(b)
+	if len(oldWords) > MaxWords || len(newWords) > MaxWords {
+		return nil, ErrTooLarge
+	}
+	var words []Word
+	i, j := 0, 0
+	for _, op := range diff(oldWords, newWords) {
+		switch op {
+		case Equal:
+			words = append(words, Word{Op: Equal, Text: oldWords[i]})
+			i++
+			j++
+		case Delete:
+			words = append(words, Word{Op: Delete, Text: oldWords[i]})
+			i++
+		case Insert:
+			words = append(words, Word{Op: Insert, Text: newWords[j]})
+			j++
+		}
+	}
+	return words, nil
+}
+
+// Unified returns a and b as a unified diff with the given number of context
+// lines. An empty string means the texts are equal.
+func Unified(a, b, oldName, newName string, context int) (string, error) {
+	oldLines, newLines := splitLines(a), splitLines(b)
+	if len(oldLines) > MaxLines || len(newLines) > MaxLines {
+		return "", ErrTooLarge
+	}
+	edits := diff(oldLines, newLines)
+
+	var sb strings.Builder
+	for _, h := range hunks(edits, context) {
+		if sb.Len() == 0 {
+			fmt.Fprintf(&sb, "--- %s\n+++ %s\n", oldName, newName)
+		}
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(h.oldStart, h.oldCount), hunkRange(h.newStart, h.newCount))
+
+		i, j := h.oldStart, h.newStart
+		for _, op := range edits[h.from:h.to] {
+			switch op {
+			case Equal:
+				sb.WriteString(" " + oldLines[i] + "\n")
+				i++
+				j++
+			case Delete:
+				sb.WriteString("-" + oldLines[i] + "\n")
+				i++
+			case Insert:
+				sb.WriteString("+" + newLines[j] + "\n")
+				j++
+			}
+		}
+	}
+	return sb.String(), nil
+}
+
+type hunk struct {
+	from, to           int // range in the edit script
+	oldStart, oldCount int // 0-based start in the old lines
+	newStart, newCount int
+}
+
+// hunks groups changes of an edit script with up to context equal lines
+// around them, changes closer than 2*context lines share a hunk.
+func hunks(edits []Op, context int) []hunk {
+	var result []hunk
+	oldPos := make([]int, len(edits)+1)
+	newPos := make([]int, len(edits)+1)
+	for k, op := range edits {
+		oldPos[k+1], newPos[k+1] = oldPos[k], newPos[k]
+		if op != Insert {
+			oldPos[k+1]++
+		}
+		if op != Delete {
+			newPos[k+1]++
+		}
+	}
+
+	for k := 0; k < len(edits); {
+		if edits[k] == Equal {
+			k++
+			continue
+		}
+		from := max(k-context, 0)
+		to := k
+		for to < len(edits) {
+			if edits[to] != Equal {
+				to++
+				continue
+			}
+			run := to
+			for run < len(edits) && edits[run] == Equal {
+				run++
+			}
+			if run == len(edits) || run-to > 2*context {
+				to = min(to+context, len(edits))
+				break
+			}
+			to = run
+		}
+		result = append(result, hunk{
+			from: from, to: to,
+			oldStart: oldPos[from], oldCount: oldPos[to] - oldPos[from],
+			newStart: newPos[from], newCount: newPos[to] - newPos[from],
+		})
+		k = to
+	}
+	return result
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diff returns the shortest edit script turning a into b, computed from the
+// longest common subsequence. The table is quadratic, callers limit the number
+// of items.
+func diff(a, b []string) []Op {
+	n, m := len(a), len(b)
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	ops := make([]Op, 0, n+m)
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, Equal)
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, Delete)
+			i++
+		default:
+			ops = append(ops, Insert)
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		ops = append(ops, Delete)
+	}
+	for ; j < m; j++ {
+		ops = append(ops, Insert)
+	}
+	return ops
+}
@@ -0,0 +1,152 @@
+package textdiff
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		a, b string
+		want []Line
+	}{
+		{name: "both empty"},
+		{name: "equal", a: "a\nb", b: "a\nb\n", want: []Line{
+			{Op: Equal, OldLine: 1, NewLine: 1, Old: "a", New: "a"},
+			{Op: Equal, OldLine: 2, NewLine: 2, Old: "b", New: "b"},
+		}},
+		{name: "old empty", b: "a\nb", want: []Line{
+			{Op: Insert, NewLine: 1, New: "a"},
+			{Op: Insert, NewLine: 2, New: "b"},
+		}},
+		{name: "new empty", a: "a\nb", want: []Line{
+			{Op: Delete, OldLine: 1, Old: "a"},
+			{Op: Delete, OldLine: 2, Old: "b"},
+		}},
+		{name: "insert", a: "a\nc", b: "a\nb\nc", want: []Line{
+			{Op: Equal, OldLine: 1, NewLine: 1, Old: "a", New: "a"},
+			{Op: Insert, NewLine: 2, New: "b"},
+			{Op: Equal, OldLine: 2, NewLine: 3, Old: "c", New: "c"},
+		}},
+		{name: "delete", a: "a\nb\nc", b: "a\nc", want: []Line{
+			{Op: Equal, OldLine: 1, NewLine: 1, Old: "a", New: "a"},
+			{Op: Delete, OldLine: 2, Old: "b"},
+			{Op: Equal, OldLine: 3, NewLine: 2, Old: "c", New: "c"},
+		}},
+		{name: "replace", a: "la\nthe old song", b: "la\nthe new song", want: []Line{
+			{Op: Equal, OldLine: 1, NewLine: 1, Old: "la", New: "la"},
+			{Op: Change, OldLine: 2, NewLine: 2, Old: "the old song", New: "the new song", Words: []Word{
+				{Op: Equal, Text: "the"},
+				{Op: Delete, Text: "old"},
+				{Op: Insert, Text: "new"},
+				{Op: Equal, Text: "song"},
+			}},
+		}},
+		{name: "replace more lines than inserted", a: "a\nb", b: "c", want: []Line{
+			{Op: Change, OldLine: 1, NewLine: 1, Old: "a", New: "c", Words: []Word{
+				{Op: Delete, Text: "a"},
+				{Op: Insert, Text: "c"},
+			}},
+			{Op: Delete, OldLine: 2, Old: "b"},
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Lines(tc.a, tc.b)
+			if err != nil {
+				t.Fatalf("Lines: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Lines(%q, %q) = %+v, want %+v", tc.a, tc.b, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestWords(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		a, b string
+		want []Word
+	}{
+		{name: "both empty"},
+		{name: "old empty", b: "a b", want: []Word{{Op: Insert, Text: "a"}, {Op: Insert, Text: "b"}}},
+		{name: "new empty", a: "a b", want: []Word{{Op: Delete, Text: "a"}, {Op: Delete, Text: "b"}}},
+		{name: "insert", a: "a c", b: "a b c", want: []Word{
+			{Op: Equal, Text: "a"}, {Op: Insert, Text: "b"}, {Op: Equal, Text: "c"},
+		}},
+		{name: "delete", a: "a b c", b: "a  c", want: []Word{
+			{Op: Equal, Text: "a"}, {Op: Delete, Text: "b"}, {Op: Equal, Text: "c"},
+		}},
+		{name: "replace", a: "a b", b: "a x", want: []Word{
+			{Op: Equal, Text: "a"}, {Op: Delete, Text: "b"}, {Op: Insert, Text: "x"},
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Words(tc.a, tc.b)
+			if err != nil {
+				t.Fatalf("Words: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Words(%q, %q) = %+v, want %+v", tc.a, tc.b, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestUnified(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{name: "both empty"},
+		{name: "equal", a: "a\nb", b: "a\nb"},
+		{name: "old empty", b: "a", want: "--- old\n+++ new\n@@ -0,0 +1 @@\n+a\n"},
+		{name: "new empty", a: "a\nb", want: "--- old\n+++ new\n@@ -1,2 +0,0 @@\n-a\n-b\n"},
+		{name: "insert", a: "a\nc", b: "a\nb\nc", want: "--- old\n+++ new\n@@ -1,2 +1,3 @@\n a\n+b\n c\n"},
+		{name: "delete", a: "a\nb\nc", b: "a\nc", want: "--- old\n+++ new\n@@ -1,3 +1,2 @@\n a\n-b\n c\n"},
+		{name: "replace", a: "a\nb\nc", b: "a\nx\nc", want: "--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n"},
+		{
+			name: "distant changes",
+			a:    "1\n2\n3\n4\n5\n6",
+			b:    "x\n2\n3\n4\n5\ny",
+			want: "--- old\n+++ new\n@@ -1,2 +1,2 @@\n-1\n+x\n 2\n@@ -5,2 +5,2 @@\n 5\n-6\n+y\n",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Unified(tc.a, tc.b, "old", "new", 1)
+			if err != nil {
+				t.Fatalf("Unified: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("Unified(%q, %q) =\n%s\nwant\n%s", tc.a, tc.b, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestTooLarge(t *testing.T) {
+	long := strings.Repeat("la\n", MaxLines+1)
+	if _, err := Lines(long, "la"); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Lines of %d lines: err = %v, want ErrTooLarge", MaxLines+1, err)
+	}
+	if _, err := Unified("la", long, "old", "new", 3); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Unified of %d lines: err = %v, want ErrTooLarge", MaxLines+1, err)
+	}
+
+	wide := strings.Repeat("la ", MaxWords+1)
+	if _, err := Words(wide, "la"); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Words of %d words: err = %v, want ErrTooLarge", MaxWords+1, err)
+	}
+	// A line too wide for a word diff is still compared line by line.
+	lines, err := Lines("la", wide)
+	if err != nil {
+		t.Fatalf("Lines: %v", err)
+	}
+	if len(lines) != 1 || lines[0].Op != Change || lines[0].Words != nil {
+		t.Errorf("Lines of a %d word line = %+v, want one Change without Words", MaxWords+1, lines)
+	}
+}